@@ -8,6 +8,7 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/jiejie-dev/funny/v2/internal/cli"
+	"github.com/jiejie-dev/funny/v2/internal/compiler"
 	"github.com/jiejie-dev/funny/v2/internal/dap"
 	"github.com/jiejie-dev/funny/v2/internal/lsp"
 	"github.com/jiejie-dev/funny/v2/internal/mcp"
@@ -36,7 +37,38 @@ var runCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
-		if err := cli.Run(data, args[0]); err != nil {
+		level, _ := cmd.Flags().GetInt("opt")
+		opts := cli.RunOptions{OptLevel: compiler.OptLevel(level)}
+		opts.Limits.MaxInstructions, _ = cmd.Flags().GetInt64("max-instructions")
+		opts.Limits.MaxCallDepth, _ = cmd.Flags().GetInt("max-depth")
+		heapMB, _ := cmd.Flags().GetInt64("max-heap-mb")
+		opts.Limits.MaxHeapBytes = heapMB << 20
+		opts.Profile, _ = cmd.Flags().GetString("profile")
+		if timeout, _ := cmd.Flags().GetDuration("timeout"); timeout > 0 {
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			opts.Context = ctx
+		}
+		if err := cli.RunWithOptions(data, args[0], opts); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return nil
+	},
+}
+
+var buildCmd = &cobra.Command{
+	Use:   "build <script>",
+	Short: "Compile a funny script to a bytecode file (.fnc) that run executes",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		data, err := os.ReadFile(args[0])
+		if err != nil {
+			return err
+		}
+		out, _ := cmd.Flags().GetString("output")
+		level, _ := cmd.Flags().GetInt("opt")
+		if err := cli.Build(data, args[0], out, compiler.OptLevel(level)); err != nil {
 			fmt.Fprintln(os.Stderr, err)
 			os.Exit(1)
 		}
@@ -139,7 +171,11 @@ var disasmCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
-		out, err := cli.Disasm(data, args[0])
+		level := compiler.O0
+		if opt, _ := cmd.Flags().GetBool("opt"); opt {
+			level = compiler.O1
+		}
+		out, err := cli.Disasm(data, args[0], level)
 		if err != nil {
 			return err
 		}
@@ -220,6 +256,26 @@ var pkgListCmd = &cobra.Command{
 	},
 }
 
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Manage the compile cache (FUNNY_CACHE_DIR)",
+}
+
+var cacheCleanCmd = &cobra.Command{
+	Use:   "clean",
+	Short: "Remove every cached compile",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir, n, err := cli.CacheClean()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Printf("removed %d cached compiles from %s\n", n, dir)
+		return nil
+	},
+}
+
 var benchCmd = &cobra.Command{
 	Use:   "bench",
 	Short: "Run benchmarks (VM perf, AI friendliness)",
@@ -277,9 +333,14 @@ var testCmd = &cobra.Command{
 		if len(args) > 0 {
 			path = args[0]
 		}
-		verbose, _ := cmd.Flags().GetBool("verbose")
-		jsonOut, _ := cmd.Flags().GetBool("json")
-		if err := cli.Test(path, verbose, jsonOut); err != nil {
+		opts := cli.TestOptions{Path: path}
+		opts.Verbose, _ = cmd.Flags().GetBool("verbose")
+		opts.JSON, _ = cmd.Flags().GetBool("json")
+		opts.Cover, _ = cmd.Flags().GetBool("cover")
+		opts.CoverLCOV, _ = cmd.Flags().GetString("cover-lcov")
+		opts.CoverJSON, _ = cmd.Flags().GetString("cover-json")
+		opts.CoverMin, _ = cmd.Flags().GetFloat64("cover-min")
+		if err := cli.TestWithOptions(opts); err != nil {
 			fmt.Fprintln(os.Stderr, err)
 			os.Exit(1)
 		}
@@ -324,11 +385,21 @@ var mcpCmd = &cobra.Command{
 }
 
 func init() {
+	runCmd.Flags().IntP("opt", "O", 1, "optimization level: -O0 runs the code as compiled, -O1 optimizes it")
+	runCmd.Flags().Duration("timeout", 0, "stop the script after this long (e.g. 30s; 0 = no limit)")
+	runCmd.Flags().Int64("max-instructions", 0, "stop the script after this many VM instructions (0 = no limit)")
+	runCmd.Flags().Int("max-depth", 0, "maximum call depth, bounding recursion (0 = no limit)")
+	runCmd.Flags().Int64("max-heap-mb", 0, "approximate heap growth allowed, in MiB (0 = no limit)")
+	runCmd.Flags().String("profile", "", "write a pprof profile of the run's funny functions and lines to this file")
+	buildCmd.Flags().StringP("output", "o", "", "output file (default: the script's name with a .fnc extension)")
+	buildCmd.Flags().IntP("opt", "O", 1, "optimization level: -O0 or -O1")
+	disasmCmd.Flags().Bool("opt", false, "show the code as optimized at -O1")
 	fmtCmd.Flags().BoolP("write", "w", false, "write result to the source file instead of stdout")
 	debugCmd.Flags().Bool("source-map", false, "emit JSON source map and exit")
 	debugCmd.Flags().StringArrayP("break", "b", nil, "breakpoint at line or file:line (repeatable)")
 	pkgCmd.PersistentFlags().String("project", ".", "project root containing funny.pkg")
 	pkgCmd.AddCommand(pkgInstallCmd, pkgAddCmd, pkgUpdateCmd, pkgListCmd)
+	cacheCmd.AddCommand(cacheCleanCmd)
 	pkgAddCmd.Flags().String("source", "", "package source (path:, https://, git+url@ref)")
 	pkgAddCmd.Flags().String("version", "", "version constraint (1.2.3, >=1.0.0, ^1.2.0, *)")
 	pkgAddCmd.Flags().String("entry", "", "entry .fn file (default: <name>.fn)")
@@ -342,10 +413,14 @@ func init() {
 	benchCmd.AddCommand(benchAICmd)
 	testCmd.Flags().BoolP("verbose", "v", false, "print each test as it runs")
 	testCmd.Flags().Bool("json", false, "emit JSON report")
+	testCmd.Flags().Bool("cover", false, "report the line coverage of the code the tests run")
+	testCmd.Flags().String("cover-lcov", "", "write the coverage to this file in LCOV format (implies --cover)")
+	testCmd.Flags().String("cover-json", "", "write the coverage to this file as JSON, e.g. .funny/coverage.json for the LSP (implies --cover)")
+	testCmd.Flags().Float64("cover-min", 0, "fail unless total coverage is at least this percentage (implies --cover)")
 	docCmd.Flags().String("format", "markdown", "output format: markdown or json")
 	docCmd.Flags().String("out", "", "write docs to directory (default: stdout)")
 	docCmd.Flags().Bool("include-tests", false, "include *_test.fn files")
-	rootCmd.AddCommand(runCmd, astCmd, fmtCmd, describeCmd, disasmCmd, debugCmd, pkgCmd, replCmd, benchCmd, testCmd, docCmd, dapCmd, lspCmd, mcpCmd)
+	rootCmd.AddCommand(runCmd, buildCmd, astCmd, fmtCmd, describeCmd, disasmCmd, debugCmd, pkgCmd, cacheCmd, replCmd, benchCmd, testCmd, docCmd, dapCmd, lspCmd, mcpCmd)
 }
 
 func main() {
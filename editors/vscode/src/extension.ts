@@ -33,6 +33,24 @@ interface PlanGraphResult {
   plans: PlanGraph[];
 }
 
+interface CoverageResult {
+  file?: string;
+  covered: number;
+  total: number;
+  percent: number;
+  uncovered: { start: { line: number }; end: { line: number } }[];
+}
+
+// Uncovered-line decorations are off until Funny: Toggle Coverage turns
+// them on; the server only answers funny/coverage when asked.
+let coverageOn = false;
+const uncoveredDecoration = vscode.window.createTextEditorDecorationType({
+  isWholeLine: true,
+  backgroundColor: new vscode.ThemeColor("diffEditor.removedLineBackground"),
+  overviewRulerColor: new vscode.ThemeColor("editorOverviewRuler.errorForeground"),
+  overviewRulerLane: vscode.OverviewRulerLane.Left,
+});
+
 export function activate(context: vscode.ExtensionContext): void {
   const config = vscode.workspace.getConfiguration("funny");
   const serverPath = config.get<string>("lsp.path") ?? "funny";
@@ -72,6 +90,13 @@ export function activate(context: vscode.ExtensionContext): void {
     vscode.commands.registerCommand("funny.debugFile", debugCurrentFileTerminal),
     vscode.commands.registerCommand("funny.formatFile", formatCurrentFile),
     vscode.commands.registerCommand("funny.showPlanGraph", showPlanGraph),
+    vscode.commands.registerCommand("funny.toggleCoverage", toggleCoverage),
+    vscode.window.onDidChangeActiveTextEditor((editor) => {
+      if (coverageOn && editor) {
+        void showCoverage(editor);
+      }
+    }),
+    uncoveredDecoration,
     vscode.commands.registerCommand(
       "funny.restartLanguageServer",
       restartLanguageServer
@@ -217,6 +242,50 @@ async function showPlanGraph(): Promise<void> {
   panel.webview.html = renderPlanGraphHtml(result.plans);
 }
 
+async function toggleCoverage(): Promise<void> {
+  coverageOn = !coverageOn;
+  for (const editor of vscode.window.visibleTextEditors) {
+    if (coverageOn) {
+      await showCoverage(editor);
+    } else {
+      editor.setDecorations(uncoveredDecoration, []);
+    }
+  }
+}
+
+// showCoverage decorates the lines of editor's document that the report
+// written by `funny test --cover-json .funny/coverage.json` has as never run.
+async function showCoverage(editor: vscode.TextEditor): Promise<void> {
+  if (!client || editor.document.languageId !== "funny") {
+    return;
+  }
+  const coverageFile =
+    vscode.workspace.getConfiguration("funny").get<string>("coverageFile") ?? "";
+  let result: CoverageResult;
+  try {
+    result = await client.sendRequest<CoverageResult>("funny/coverage", {
+      textDocument: { uri: editor.document.uri.toString() },
+      coverageFile,
+    });
+  } catch (err) {
+    const message = err instanceof Error ? err.message : String(err);
+    vscode.window.showErrorMessage(`Coverage request failed: ${message}`);
+    return;
+  }
+  editor.setDecorations(
+    uncoveredDecoration,
+    result.uncovered.map(
+      (r) => new vscode.Range(r.start.line, 0, r.end.line, 0)
+    )
+  );
+  if (result.file) {
+    vscode.window.setStatusBarMessage(
+      `Funny coverage: ${result.percent.toFixed(1)}% (${result.covered}/${result.total} lines)`,
+      5000
+    );
+  }
+}
+
 function renderPlanGraphHtml(plans: PlanGraph[]): string {
   const sections = plans
     .map((plan) => {
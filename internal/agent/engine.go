@@ -65,7 +65,7 @@ func (e *Engine) execStmt(s ast.Statement) (any, bool, error) {
 	switch n := s.(type) {
 	case *ast.Step:
 		return nil, false, e.execStep(n)
-	case *ast.LetStmt, *ast.AssignStmt:
+	case *ast.LetStmt, *ast.AssignStmt, *ast.DeferStmt:
 		return nil, false, e.eval.Exec(toProgram(n))
 	case *ast.ExprStmt:
 		v, err := e.eval.Eval(n.X)
@@ -224,7 +224,7 @@ func (e *Engine) runStepBodyOnce(s *ast.Step, timeout time.Duration) (any, bool,
 	if timeout > 0 {
 		v, has, err = e.execWithTimeout(s.Body, timeout)
 	} else {
-		v, has, err = e.execBlock(s.Body)
+		v, has, err = e.execStepBody(s.Body)
 	}
 	if err != nil {
 		return nil, false, err
@@ -242,6 +242,17 @@ func (e *Engine) runStepBodyOnce(s *ast.Step, timeout time.Duration) (any, bool,
 	return v, has, nil
 }
 
+// execStepBody runs one attempt of a step body, then whatever it
+// deferred - after a failure or cancellation too.
+func (e *Engine) execStepBody(body *ast.Block) (v any, has bool, err error) {
+	end := e.eval.BeginDefers()
+	v, has, err = e.execBlock(body)
+	if err = end(err); err != nil {
+		return nil, false, err
+	}
+	return v, has, nil
+}
+
 // execWithTimeout runs body on its own goroutine with a cancellable
 // evaluator. When the deadline passes the context is cancelled and the
 // evaluator stops at the next preemption point (loop head, statement
@@ -258,7 +269,7 @@ func (e *Engine) execWithTimeout(body *ast.Block, d time.Duration) (any, bool, e
 	ch := make(chan outcome, 1)
 	go func() {
 		fork := &Engine{eval: evaluator.NewWithContext(e.eval.Scope(), ctx)}
-		v, has, err := fork.execBlock(body)
+		v, has, err := fork.execStepBody(body)
 		ch <- outcome{v, has, err}
 	}()
 
@@ -322,3 +322,52 @@ func TestEngine_PlanFromFile(t *testing.T) {
 	err = e.RunPlan(plan, "plan.fn")
 	assert.NoError(t, err)
 }
+
+// runPlanWithFns runs the plan that follows a prelude of function
+// declarations in src, with those functions in scope.
+func runPlanWithFns(t *testing.T, src string) (*Engine, error) {
+	t.Helper()
+	prog, err := parser.New(src, "test.fn").Parse()
+	require.NoError(t, err)
+	last := len(prog.Stmts) - 1
+	plan, ok := prog.Stmts[last].(*ast.PlanBlock)
+	require.True(t, ok)
+	e := New()
+	require.NoError(t, e.eval.Exec(&ast.Program{Stmts: prog.Stmts[:last]}))
+	return e, e.RunPlan(plan, "test")
+}
+
+func TestEngine_Defer_RunsWhenEachAttemptExits(t *testing.T) {
+	e, err := runPlanWithFns(t, `fn note(x: str):
+    log = log + x
+plan "demo":
+    let log = ""
+    step "ok" -> tool:
+        defer note("1")
+        defer note("2")
+        note("body;")
+    step "fails" -> tool with retry max=2:
+        defer note(";cleanup")
+        return err("boom")
+`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed after 2 attempts")
+	v, _ := e.eval.Scope().Get("log")
+	assert.Equal(t, "body;21;cleanup;cleanup", v)
+}
+
+func TestEngine_Defer_RunsAfterTimeout(t *testing.T) {
+	e, err := runPlanWithFns(t, `fn note(x: str):
+    log = log + x
+plan "demo":
+    let log = ""
+    step "slow" -> tool with timeout="20ms":
+        defer note("cleanup")
+        while true:
+            let x = 1
+`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "timed out")
+	v, _ := e.eval.Scope().Get("log")
+	assert.Equal(t, "cleanup", v)
+}
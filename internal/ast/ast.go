@@ -138,19 +138,55 @@ func (e *ListExpr) String() string {
 	return "[" + joinComma(parts) + "]"
 }
 
+// IndexExpr is `Object[Index]`, or the slice `Object[Low:High]` when
+// Slice is set. A slice's bounds may each be nil (omitted); Index is then
+// unused.
 type IndexExpr struct {
 	NodePos Pos
 	Object  Expression
 	Index   Expression
+	Slice   bool
+	Low     Expression
+	High    Expression
 }
 
 func (e *IndexExpr) Pos() Pos    { return e.NodePos }
 func (e *IndexExpr) exprMarker() {}
 func (e *IndexExpr) nodeMarker() {}
 func (e *IndexExpr) String() string {
+	if e.Slice {
+		var lo, hi string
+		if e.Low != nil {
+			lo = e.Low.String()
+		}
+		if e.High != nil {
+			hi = e.High.String()
+		}
+		return fmt.Sprintf("%s[%s:%s]", e.Object.String(), lo, hi)
+	}
 	return fmt.Sprintf("%s[%s]", e.Object.String(), e.Index.String())
 }
 
+// RangeExpr is the half-open integer range `Start..End`, optionally
+// `Start..End step Step`. Step is nil when omitted (meaning 1); a negative
+// step counts down from Start towards End.
+type RangeExpr struct {
+	NodePos Pos
+	Start   Expression
+	End     Expression
+	Step    Expression
+}
+
+func (e *RangeExpr) Pos() Pos    { return e.NodePos }
+func (e *RangeExpr) exprMarker() {}
+func (e *RangeExpr) nodeMarker() {}
+func (e *RangeExpr) String() string {
+	if e.Step != nil {
+		return fmt.Sprintf("%s..%s step %s", e.Start.String(), e.End.String(), e.Step.String())
+	}
+	return fmt.Sprintf("%s..%s", e.Start.String(), e.End.String())
+}
+
 type FieldExpr struct {
 	NodePos Pos
 	Object  Expression
@@ -181,6 +217,20 @@ func (e *CallExpr) String() string {
 	return fmt.Sprintf("%s(%s)", e.Func.String(), joinComma(parts))
 }
 
+// EmptyStructLiteral returns the struct literal a call `Name()` is when
+// Name turns out to be a struct rather than a function: one giving no
+// fields, so every field takes its default. The parser can't tell the two
+// apart (it sees no `field:`), so the checker, compiler and evaluator ask
+// for it where a call's name isn't a function; ok is false for a call
+// with arguments or to anything but a bare name.
+func (e *CallExpr) EmptyStructLiteral() (lit *StructLiteralExpr, ok bool) {
+	v, isName := e.Func.(*VariableExpr)
+	if !isName || len(e.Args) > 0 {
+		return nil, false
+	}
+	return &StructLiteralExpr{NodePos: e.NodePos, TypeName: v.Name, Fields: map[string]Expression{}}, true
+}
+
 // MapLiteralExpr is a `{key: value, ...}` literal. Keys and Values are
 // parallel slices (not a Go map) to preserve source order and to allow keys
 // that are arbitrary expressions, not just compile-time-constant strings.
@@ -201,6 +251,25 @@ func (e *MapLiteralExpr) String() string {
 	return "{" + joinComma(parts) + "}"
 }
 
+// SetLiteralExpr is a `set{a, b, ...}` literal. Elements keep source
+// order, which is the set's iteration order; repeats are dropped when the
+// set is built.
+type SetLiteralExpr struct {
+	NodePos  Pos
+	Elements []Expression
+}
+
+func (e *SetLiteralExpr) Pos() Pos    { return e.NodePos }
+func (e *SetLiteralExpr) exprMarker() {}
+func (e *SetLiteralExpr) nodeMarker() {}
+func (e *SetLiteralExpr) String() string {
+	parts := make([]string, len(e.Elements))
+	for i, el := range e.Elements {
+		parts[i] = el.String()
+	}
+	return "set{" + joinComma(parts) + "}"
+}
+
 type StructLiteralExpr struct {
 	NodePos  Pos
 	TypeName string
@@ -286,6 +355,27 @@ func (b *Block) ToProgram() *Program {
 	return &Program{NodePos: b.NodePos, Stmts: b.Statements}
 }
 
+// ConstDecl is a module-level `const Name = Value` (`pub const` to export
+// it). Value must be evaluable at compile time - literals, other
+// constants, and operators over them - and the name can't be reassigned.
+type ConstDecl struct {
+	NodePos Pos
+	Name    string
+	Value   Expression
+	Pub     bool
+}
+
+func (s *ConstDecl) Pos() Pos    { return s.NodePos }
+func (s *ConstDecl) stmtMarker() {}
+func (s *ConstDecl) nodeMarker() {}
+func (s *ConstDecl) String() string {
+	prefix := ""
+	if s.Pub {
+		prefix = "pub "
+	}
+	return fmt.Sprintf("%sconst %s = %s", prefix, s.Name, s.Value.String())
+}
+
 type LetStmt struct {
 	NodePos Pos
 	Name    string
@@ -365,11 +455,62 @@ func (s *WhileStmt) String() string {
 	return fmt.Sprintf("while %s:\n%s", s.Cond.String(), s.Body.String())
 }
 
+// MatchArm is one `pattern [if guard] => body` arm of a match. A pattern
+// is `_`, a bare name (which binds the matched value), an OrPattern, a
+// destructuring pattern - `ok(p)` / `err(p)` on a Result, or a struct
+// literal `User(name: p, ...)` whose field values are themselves
+// patterns - or any other expression, compared against the value. Guard
+// is nil when absent.
 type MatchArm struct {
 	Pattern Expression
+	Guard   Expression
 	Body    *Block
 }
 
+// PatternBindings returns the names a match pattern binds, in source
+// order for everything but struct fields (which are unordered). Only the
+// first alternative of an OrPattern is walked: the type checker requires
+// every alternative to bind the same names.
+func PatternBindings(p Expression) []*VariableExpr {
+	switch n := p.(type) {
+	case *VariableExpr:
+		if n.Name != "_" {
+			return []*VariableExpr{n}
+		}
+	case *OrPattern:
+		return PatternBindings(n.Alts[0])
+	case *CallExpr:
+		if f, ok := n.Func.(*VariableExpr); ok && (f.Name == "ok" || f.Name == "err") && len(n.Args) == 1 {
+			return PatternBindings(n.Args[0])
+		}
+	case *StructLiteralExpr:
+		var out []*VariableExpr
+		for _, sub := range n.Fields {
+			out = append(out, PatternBindings(sub)...)
+		}
+		return out
+	}
+	return nil
+}
+
+// OrPattern is the match pattern `a | b | ...`, which matches when any of
+// its alternatives does.
+type OrPattern struct {
+	NodePos Pos
+	Alts    []Expression
+}
+
+func (e *OrPattern) Pos() Pos    { return e.NodePos }
+func (e *OrPattern) exprMarker() {}
+func (e *OrPattern) nodeMarker() {}
+func (e *OrPattern) String() string {
+	parts := make([]string, len(e.Alts))
+	for i, a := range e.Alts {
+		parts[i] = a.String()
+	}
+	return strings.Join(parts, " | ")
+}
+
 type MatchStmt struct {
 	NodePos Pos
 	Expr    Expression
@@ -382,11 +523,31 @@ func (s *MatchStmt) nodeMarker() {}
 func (s *MatchStmt) String() string {
 	out := fmt.Sprintf("match %s:\n", s.Expr.String())
 	for _, a := range s.Arms {
+		if a.Guard != nil {
+			out += fmt.Sprintf("    %s if %s =>\n%s", a.Pattern.String(), a.Guard.String(), a.Body.String())
+			continue
+		}
 		out += fmt.Sprintf("    %s =>\n%s", a.Pattern.String(), a.Body.String())
 	}
 	return out
 }
 
+// DeferStmt is `defer <call>`: the callee and arguments are evaluated
+// where the statement runs, and the call itself when the enclosing
+// function or plan step body exits - normally, through `?`, or on a
+// runtime error. Deferred calls run last-registered first.
+type DeferStmt struct {
+	NodePos Pos
+	Call    *CallExpr
+}
+
+func (s *DeferStmt) Pos() Pos    { return s.NodePos }
+func (s *DeferStmt) stmtMarker() {}
+func (s *DeferStmt) nodeMarker() {}
+func (s *DeferStmt) String() string {
+	return "defer " + s.Call.String()
+}
+
 type ReturnStmt struct {
 	NodePos Pos
 	Value   Expression
@@ -450,7 +611,9 @@ func (s *ExprStmt) String() string { return s.X.String() }
 type Param struct {
 	Name    string
 	TypeAnn string
-	Mut     bool // struct fields only: `mut count: int`
+	Mut     bool       // struct fields (`mut count: int`) and method receivers (`mut self`)
+	Default Expression // struct fields only (`age: int = 0`); nil if required
+	Attrs   Attributes // struct fields only (`@json("user_name")`)
 }
 
 func (p Param) String() string {
@@ -458,19 +621,29 @@ func (p Param) String() string {
 	if p.Mut {
 		prefix = "mut "
 	}
+	out := prefix + p.Name
 	if p.TypeAnn != "" {
-		return fmt.Sprintf("%s%s: %s", prefix, p.Name, p.TypeAnn)
+		out = fmt.Sprintf("%s%s: %s", prefix, p.Name, p.TypeAnn)
 	}
-	return prefix + p.Name
+	if p.Default != nil {
+		out += " = " + p.Default.String()
+	}
+	return out
 }
 
+// FnDecl is a function declaration. Methods are FnDecls nested in a
+// StructDecl: Receiver names the owning struct and Params[0] is the `self`
+// receiver (Params[0].Mut for a `mut self` method). Interface method
+// signatures are FnDecls with a nil Body.
 type FnDecl struct {
-	NodePos Pos
-	Pub     bool
-	Name    string
-	Params  []Param
-	RetType string
-	Body    *Block
+	NodePos  Pos
+	Attrs    Attributes
+	Pub      bool
+	Name     string
+	Receiver string
+	Params   []Param
+	RetType  string
+	Body     *Block
 }
 
 func (s *FnDecl) Pos() Pos    { return s.NodePos }
@@ -485,19 +658,24 @@ func (s *FnDecl) String() string {
 	if s.Pub {
 		prefix = "pub "
 	}
-	out := fmt.Sprintf("%sfn %s(%s)", prefix, s.Name, joinComma(parts))
+	out := fmt.Sprintf("%s%sfn %s(%s)", s.Attrs, prefix, s.Name, joinComma(parts))
 	if s.RetType != "" {
 		out += " -> " + s.RetType
 	}
+	if s.Body == nil {
+		return out + "\n"
+	}
 	out += ":\n" + s.Body.String()
 	return out
 }
 
 type StructDecl struct {
 	NodePos Pos
+	Attrs   Attributes
 	Pub     bool
 	Name    string
 	Fields  []Param
+	Methods []*FnDecl
 }
 
 func (s *StructDecl) Pos() Pos    { return s.NodePos }
@@ -508,13 +686,74 @@ func (s *StructDecl) String() string {
 	if s.Pub {
 		prefix = "pub "
 	}
-	out := fmt.Sprintf("%sstruct %s:\n", prefix, s.Name)
+	out := fmt.Sprintf("%s%sstruct %s:\n", s.Attrs, prefix, s.Name)
 	for _, f := range s.Fields {
+		for _, a := range f.Attrs {
+			out += fmt.Sprintf("    %s\n", a)
+		}
 		out += fmt.Sprintf("    %s\n", f.String())
 	}
+	for _, m := range s.Methods {
+		out += "    " + strings.ReplaceAll(strings.TrimSuffix(m.String(), "\n"), "\n", "\n    ") + "\n"
+	}
+	return out
+}
+
+// Method returns the method declared on s with the given name, or nil.
+func (s *StructDecl) Method(name string) *FnDecl {
+	for _, m := range s.Methods {
+		if m.Name == name {
+			return m
+		}
+	}
+	return nil
+}
+
+// InterfaceDecl declares a structural interface: any struct whose methods
+// include every signature in Methods (each a body-less FnDecl taking
+// `self`) implements it, without naming the interface.
+type InterfaceDecl struct {
+	NodePos Pos
+	Pub     bool
+	Name    string
+	Methods []*FnDecl
+}
+
+func (s *InterfaceDecl) Pos() Pos    { return s.NodePos }
+func (s *InterfaceDecl) stmtMarker() {}
+func (s *InterfaceDecl) nodeMarker() {}
+func (s *InterfaceDecl) String() string {
+	prefix := ""
+	if s.Pub {
+		prefix = "pub "
+	}
+	out := fmt.Sprintf("%sinterface %s:\n", prefix, s.Name)
+	for _, m := range s.Methods {
+		out += "    " + m.String()
+	}
 	return out
 }
 
+// TypeAliasDecl declares `type Name = Target`, a transparent alias: Name
+// and Target are interchangeable everywhere a type annotation is allowed.
+type TypeAliasDecl struct {
+	NodePos Pos
+	Pub     bool
+	Name    string
+	Target  string // type annotation text, e.g. "str" or "map[str, list[int]]"
+}
+
+func (s *TypeAliasDecl) Pos() Pos    { return s.NodePos }
+func (s *TypeAliasDecl) stmtMarker() {}
+func (s *TypeAliasDecl) nodeMarker() {}
+func (s *TypeAliasDecl) String() string {
+	prefix := ""
+	if s.Pub {
+		prefix = "pub "
+	}
+	return fmt.Sprintf("%stype %s = %s", prefix, s.Name, s.Target)
+}
+
 // ----- Top-Level -----
 
 type ImportDecl struct {
@@ -0,0 +1,116 @@
+package ast
+
+import "strings"
+
+// Attribute is a declaration attribute, written on its own line before a
+// `fn`, `struct` or plan `step`: `@test_only`, `@deprecated("use v2")`,
+// `@tool(description: "...")`. Arguments are literals.
+type Attribute struct {
+	NodePos Pos
+	Name    string
+	Args    []AttrArg
+}
+
+// AttrArg is one attribute argument; Name is empty for a positional one.
+type AttrArg struct {
+	Name  string
+	Value *LiteralExpr
+}
+
+func (a *Attribute) String() string {
+	if len(a.Args) == 0 {
+		return "@" + a.Name
+	}
+	parts := make([]string, len(a.Args))
+	for i, arg := range a.Args {
+		parts[i] = arg.Value.String()
+		if arg.Name != "" {
+			parts[i] = arg.Name + ": " + parts[i]
+		}
+	}
+	return "@" + a.Name + "(" + strings.Join(parts, ", ") + ")"
+}
+
+// Arg returns the argument called name or, failing that, the first
+// positional argument, so `@deprecated("x")` and
+// `@deprecated(message: "x")` read the same.
+func (a *Attribute) Arg(name string) (any, bool) {
+	for _, arg := range a.Args {
+		if arg.Name == name {
+			return arg.Value.Value, true
+		}
+	}
+	for _, arg := range a.Args {
+		if arg.Name == "" {
+			return arg.Value.Value, true
+		}
+	}
+	return nil, false
+}
+
+// StringArg is Arg for a string argument; it returns "" when there is
+// none.
+func (a *Attribute) StringArg(name string) string {
+	v, _ := a.Arg(name)
+	s, _ := v.(string)
+	return s
+}
+
+// Attributes are the attributes of one declaration, in source order.
+type Attributes []*Attribute
+
+// Get returns the attribute called name, or nil.
+func (as Attributes) Get(name string) *Attribute {
+	for _, a := range as {
+		if a.Name == name {
+			return a
+		}
+	}
+	return nil
+}
+
+// Deprecated reports whether the declaration is `@deprecated`, and the
+// message it gives (possibly empty).
+func (as Attributes) Deprecated() (string, bool) {
+	a := as.Get("deprecated")
+	if a == nil {
+		return "", false
+	}
+	return a.StringArg("message"), true
+}
+
+// ToolDescription returns the description of a `@tool(description: ...)`
+// attribute, or "".
+func (as Attributes) ToolDescription() string {
+	if a := as.Get("tool"); a != nil {
+		return a.StringArg("description")
+	}
+	return ""
+}
+
+// TestOnly reports whether the declaration is `@test_only`.
+func (as Attributes) TestOnly() bool {
+	return as.Get("test_only") != nil
+}
+
+// String prints each attribute on its own line, as it precedes the
+// declaration in source.
+func (as Attributes) String() string {
+	var sb strings.Builder
+	for _, a := range as {
+		sb.WriteString(a.String())
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// JSONKey returns the key a struct field is read from and written to in
+// JSON: the name its `@json("key")` attribute gives, or its own.
+func (p Param) JSONKey() string {
+	if a := p.Attrs.Get("json"); a != nil {
+		if key := a.StringArg("name"); key != "" {
+			return key
+		}
+	}
+	return p.Name
+}
@@ -18,6 +18,7 @@ func (k StepKind) String() string { return string(k) }
 // Step represents a single step within a plan block.
 type Step struct {
 	NodePos Pos
+	Attrs   Attributes
 	Name    string
 	Kind    StepKind
 	Body    *Block
@@ -40,7 +41,7 @@ func (s *Step) Pos() Pos    { return s.NodePos }
 func (s *Step) stmtMarker() {}
 func (s *Step) nodeMarker() {}
 func (s *Step) String() string {
-	out := "step " + s.Name + " " + string(s.Kind) + ":\n"
+	out := s.Attrs.String() + "step " + s.Name + " " + string(s.Kind) + ":\n"
 	if s.Retry != nil {
 		out += "    retry: " + s.Retry.String() + "\n"
 	}
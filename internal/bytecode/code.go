@@ -18,21 +18,58 @@ type BuiltinInfo struct {
 	Arity int
 }
 
+// MethodInfo identifies a method called via CALL_METHOD. The VM takes the
+// receiver from below the Arity arguments on the operand stack and calls
+// the "Type.method" function of its runtime struct type.
+type MethodInfo struct {
+	Name  string
+	Arity int // excluding the receiver
+}
+
+// DeferInfo describes a call registered by DEFER: the call instruction to
+// run when the frame returns, and how many values (arguments, plus the
+// receiver of a method call) DEFER captures from the operand stack for it.
+type DeferInfo struct {
+	Op    OpCode // CALL, CALL_BUILTIN or CALL_METHOD
+	Arg   int    // that instruction's operand
+	Arity int
+}
+
+// StructInfo is the layout of a struct type, the operand of NEW_STRUCT:
+// its name and its fields in declaration order. NEW_STRUCT pops one value
+// per field, the first field's deepest. The compiler adds one StructInfo
+// per struct type, by pointer, so every NEW_STRUCT of a type shares it.
+type StructInfo struct {
+	Name   string
+	Fields []string
+}
+
+// FieldInfo is the operand of GET_FIELD and SET_FIELD: the field's name,
+// and its index in the struct's fields when the compiler knows the
+// object's struct type. Slot is -1 otherwise (and for the fields of a
+// Result or a map), and the VM looks the field up by name.
+type FieldInfo struct {
+	Name string
+	Slot int
+}
+
 // Instruction is a single bytecode instruction.
 type Instruction struct {
 	Op  OpCode
 	Arg int // operand (constant index, local index, jump target, etc.)
 }
 
-// String renders an instruction for disassembly.
+// String renders an instruction for disassembly: the mnemonic, then the
+// operand if the opcode takes one (so `LOAD_LOCAL 0` keeps its 0).
 func (i Instruction) String() string {
-	if i.Arg == 0 {
-		return string(i.Op)
+	if i.Op.OperandWidth() == 0 {
+		return i.Op.String()
 	}
 	return fmt.Sprintf("%s %d", i.Op, i.Arg)
 }
 
-// Function is a compiled function body.
+// Function is a compiled function body, or, when Extern is set, a stub
+// with no body standing for a function of another module (see Link).
 type Function struct {
 	Name       string
 	Arity      int
@@ -40,6 +77,19 @@ type Function struct {
 	Code       []Instruction
 	Locations  []SourceLoc // parallel to Code
 	LocalNames []string    // slot index → name (params + locals)
+	Extern     *Symbol     // the function a stub stands for; nil for a real function
+}
+
+// Symbol names a function by qualified name: the module that defines it
+// (the Module.Name it's compiled into) and its name in that module's
+// export table.
+type Symbol struct {
+	Module string
+	Name   string
+}
+
+func (s Symbol) String() string {
+	return s.Module + "::" + s.Name
 }
 
 // Emit appends an instruction with no source location (tests / legacy).
@@ -54,10 +104,14 @@ func (f *Function) EmitAt(op OpCode, arg int, loc SourceLoc) {
 }
 
 // Module is a compilation unit (one .fn file produces one Module).
+// Functions[0] is its top-level code. Exports maps the name of each
+// function other modules may call to its index; calls the other way go
+// through stubs (see Function.Extern) until Link resolves them.
 type Module struct {
 	Name      string
 	Constants []Value
 	Functions []*Function
+	Exports   map[string]int
 }
 
 // NewModule creates an empty Module with the given name.
@@ -83,6 +137,14 @@ func (m *Module) AddFunction(f *Function) int {
 	return len(m.Functions) - 1
 }
 
+// Export adds the function at fnIdx to the module's export table.
+func (m *Module) Export(name string, fnIdx int) {
+	if m.Exports == nil {
+		m.Exports = map[string]int{}
+	}
+	m.Exports[name] = fnIdx
+}
+
 // valueEqual compares two runtime values for constant-pool deduplication.
 // Note: uses == for primitives; for slices/maps would need deep comparison (not needed for M2-B constants).
 func valueEqual(a, b Value) bool {
@@ -94,6 +156,10 @@ func (m *Module) Disassemble() string {
 	var b strings.Builder
 	fmt.Fprintf(&b, "module %s\n", m.Name)
 	for i, fn := range m.Functions {
+		if fn.Extern != nil {
+			fmt.Fprintf(&b, "  fn %d %s arity=%d extern %s\n", i, fn.Name, fn.Arity, fn.Extern)
+			continue
+		}
 		fmt.Fprintf(&b, "  fn %d %s arity=%d locals=%d\n", i, fn.Name, fn.Arity, fn.NumLocals)
 		for j, instr := range fn.Code {
 			line := fmt.Sprintf("    %4d %s", j, instr.String())
@@ -0,0 +1,597 @@
+package bytecode
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Magic starts every encoded module (a `.fnc` file).
+const Magic = "FNC\x00"
+
+// FormatVersion is the version of the encoding MarshalBinary writes and
+// Decode reads. Opcode numbers are part of the encoding, so adding,
+// removing or reordering opcodes must bump it along with any change to
+// the layout below.
+const FormatVersion = 6
+
+// The layout, after Magic and a uint16 FormatVersion (integers are
+// varints unless noted, strings are a length and their bytes):
+//
+//	name
+//	file count, files          (the files Locations point into)
+//	constant count, constants  (a kind byte, then the value)
+//	function count, functions:
+//	    name, arity, local count
+//	    instruction count, instructions (opcode byte, then an operand of
+//	        OpCode.OperandWidth bytes, little-endian)
+//	    location count (0 or the instruction count), locations
+//	        (file index + 1, or 0 for none; line; column)
+//	    local name count, local names
+//	    extern flag byte (1 for a stub), and for a stub: module, name
+//	export count, exports (name, function index), sorted by name
+
+// Constant kinds.
+const (
+	constNil byte = iota
+	constInt
+	constFloat
+	constStr
+	constBool
+	constBuiltin
+	constMethod
+	constDefer
+	constStruct
+	constField
+)
+
+// IsEncoded reports whether data starts like an encoded module.
+func IsEncoded(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(Magic))
+}
+
+// MarshalBinary encodes m in the `.fnc` format. It fails on a constant of
+// a type the format has no kind for, and on an operand that doesn't fit
+// its opcode's width.
+func (m *Module) MarshalBinary() ([]byte, error) {
+	w := &encoder{files: map[string]int{}}
+	w.buf.WriteString(Magic)
+	w.buf.Write(binary.LittleEndian.AppendUint16(nil, FormatVersion))
+	w.str(m.Name)
+
+	var files []string
+	for _, fn := range m.Functions {
+		for _, loc := range fn.Locations {
+			if _, ok := w.files[loc.File]; !ok && loc.File != "" {
+				w.files[loc.File] = len(files)
+				files = append(files, loc.File)
+			}
+		}
+	}
+	w.uint(len(files))
+	for _, f := range files {
+		w.str(f)
+	}
+
+	w.uint(len(m.Constants))
+	for i, c := range m.Constants {
+		if err := w.constant(c); err != nil {
+			return nil, fmt.Errorf("constant %d: %w", i, err)
+		}
+	}
+
+	w.uint(len(m.Functions))
+	for _, fn := range m.Functions {
+		if err := w.function(fn); err != nil {
+			return nil, fmt.Errorf("function %s: %w", fn.Name, err)
+		}
+	}
+
+	names := make([]string, 0, len(m.Exports))
+	for name := range m.Exports {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	w.uint(len(names))
+	for _, name := range names {
+		w.str(name)
+		w.uint(m.Exports[name])
+	}
+	return w.buf.Bytes(), nil
+}
+
+type encoder struct {
+	buf   bytes.Buffer
+	files map[string]int
+}
+
+func (w *encoder) uint(n int) { w.buf.Write(binary.AppendUvarint(nil, uint64(n))) }
+func (w *encoder) int(n int)  { w.buf.Write(binary.AppendVarint(nil, int64(n))) }
+
+func (w *encoder) str(s string) {
+	w.uint(len(s))
+	w.buf.WriteString(s)
+}
+
+func (w *encoder) constant(c Value) error {
+	switch v := c.(type) {
+	case nil:
+		w.buf.WriteByte(constNil)
+	case int:
+		w.buf.WriteByte(constInt)
+		w.int(v)
+	case float64:
+		w.buf.WriteByte(constFloat)
+		w.buf.Write(binary.LittleEndian.AppendUint64(nil, math.Float64bits(v)))
+	case string:
+		w.buf.WriteByte(constStr)
+		w.str(v)
+	case bool:
+		w.buf.WriteByte(constBool)
+		if v {
+			w.buf.WriteByte(1)
+		} else {
+			w.buf.WriteByte(0)
+		}
+	case BuiltinInfo:
+		w.buf.WriteByte(constBuiltin)
+		w.str(v.Name)
+		w.uint(v.Arity)
+	case MethodInfo:
+		w.buf.WriteByte(constMethod)
+		w.str(v.Name)
+		w.uint(v.Arity)
+	case DeferInfo:
+		w.buf.WriteByte(constDefer)
+		w.buf.WriteByte(byte(v.Op))
+		w.int(v.Arg)
+		w.uint(v.Arity)
+	case *StructInfo:
+		w.buf.WriteByte(constStruct)
+		w.str(v.Name)
+		w.uint(len(v.Fields))
+		for _, f := range v.Fields {
+			w.str(f)
+		}
+	case FieldInfo:
+		w.buf.WriteByte(constField)
+		w.str(v.Name)
+		w.int(v.Slot)
+	default:
+		return fmt.Errorf("no encoding for %T", c)
+	}
+	return nil
+}
+
+func (w *encoder) function(fn *Function) error {
+	w.str(fn.Name)
+	w.uint(fn.Arity)
+	w.uint(fn.NumLocals)
+	w.uint(len(fn.Code))
+	for ip, instr := range fn.Code {
+		w.buf.WriteByte(byte(instr.Op))
+		width := instr.Op.OperandWidth()
+		if instr.Arg < 0 || instr.Arg >= 1<<(8*width) {
+			return fmt.Errorf("instruction %d: operand %d doesn't fit %s's %d bytes", ip, instr.Arg, instr.Op, width)
+		}
+		switch width {
+		case 2:
+			w.buf.Write(binary.LittleEndian.AppendUint16(nil, uint16(instr.Arg)))
+		case 4:
+			w.buf.Write(binary.LittleEndian.AppendUint32(nil, uint32(instr.Arg)))
+		}
+	}
+	w.uint(len(fn.Locations))
+	for _, loc := range fn.Locations {
+		file := 0
+		if loc.File != "" {
+			file = w.files[loc.File] + 1
+		}
+		w.uint(file)
+		w.uint(loc.Line)
+		w.uint(loc.Col)
+	}
+	w.uint(len(fn.LocalNames))
+	for _, name := range fn.LocalNames {
+		w.str(name)
+	}
+	if fn.Extern == nil {
+		w.buf.WriteByte(0)
+		return nil
+	}
+	w.buf.WriteByte(1)
+	w.str(fn.Extern.Module)
+	w.str(fn.Extern.Name)
+	return nil
+}
+
+// errTruncated reports an encoding that ends mid-value.
+var errTruncated = errors.New("truncated")
+
+// Decode reads a module written by MarshalBinary. Besides the layout it
+// checks every operand against what it refers to (a constant, function
+// or instruction), so the VM never indexes out of range running it.
+func Decode(data []byte) (*Module, error) {
+	if !IsEncoded(data) {
+		return nil, fmt.Errorf("not a compiled funny module")
+	}
+	r := &decoder{data: data, pos: len(Magic)}
+	if len(data) < r.pos+2 {
+		return nil, fmt.Errorf("compiled module: %w", errTruncated)
+	}
+	if v := binary.LittleEndian.Uint16(data[r.pos:]); v != FormatVersion {
+		return nil, fmt.Errorf("compiled module has format version %d, this funny reads version %d; rebuild it", v, FormatVersion)
+	}
+	r.pos += 2
+	m, err := r.module()
+	if err != nil {
+		return nil, fmt.Errorf("compiled module: %w", err)
+	}
+	return m, nil
+}
+
+type decoder struct {
+	data []byte
+	pos  int
+}
+
+func (r *decoder) byte() (byte, error) {
+	if r.pos >= len(r.data) {
+		return 0, errTruncated
+	}
+	b := r.data[r.pos]
+	r.pos++
+	return b, nil
+}
+
+func (r *decoder) bytes(n int) ([]byte, error) {
+	if n < 0 || n > len(r.data)-r.pos {
+		return nil, errTruncated
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b, nil
+}
+
+func (r *decoder) uint() (int, error) {
+	n, size := binary.Uvarint(r.data[r.pos:])
+	if size <= 0 || n > math.MaxInt32 {
+		return 0, errTruncated
+	}
+	r.pos += size
+	return int(n), nil
+}
+
+func (r *decoder) int() (int, error) {
+	n, size := binary.Varint(r.data[r.pos:])
+	if size <= 0 {
+		return 0, errTruncated
+	}
+	r.pos += size
+	return int(n), nil
+}
+
+// count reads a length, rejecting one larger than the bytes left (every
+// element takes at least one), so a corrupt count can't force a huge
+// allocation.
+func (r *decoder) count() (int, error) {
+	n, err := r.uint()
+	if err != nil {
+		return 0, err
+	}
+	if n > len(r.data)-r.pos {
+		return 0, errTruncated
+	}
+	return n, nil
+}
+
+func (r *decoder) str() (string, error) {
+	n, err := r.uint()
+	if err != nil {
+		return "", err
+	}
+	b, err := r.bytes(n)
+	return string(b), err
+}
+
+func (r *decoder) module() (*Module, error) {
+	name, err := r.str()
+	if err != nil {
+		return nil, err
+	}
+	m := NewModule(name)
+	nfiles, err := r.count()
+	if err != nil {
+		return nil, err
+	}
+	files := make([]string, nfiles)
+	for i := range files {
+		if files[i], err = r.str(); err != nil {
+			return nil, err
+		}
+	}
+	nconst, err := r.count()
+	if err != nil {
+		return nil, err
+	}
+	m.Constants = make([]Value, nconst)
+	for i := range m.Constants {
+		if m.Constants[i], err = r.constant(); err != nil {
+			return nil, fmt.Errorf("constant %d: %w", i, err)
+		}
+	}
+	nfn, err := r.count()
+	if err != nil {
+		return nil, err
+	}
+	m.Functions = make([]*Function, nfn)
+	for i := range m.Functions {
+		if m.Functions[i], err = r.function(files); err != nil {
+			return nil, fmt.Errorf("function %d: %w", i, err)
+		}
+	}
+	nexport, err := r.count()
+	if err != nil {
+		return nil, err
+	}
+	for range nexport {
+		name, err := r.str()
+		if err != nil {
+			return nil, err
+		}
+		idx, err := r.uint()
+		if err != nil {
+			return nil, err
+		}
+		if idx >= len(m.Functions) || m.Functions[idx].Extern != nil {
+			return nil, fmt.Errorf("export %s: no function %d to export", name, idx)
+		}
+		m.Export(name, idx)
+	}
+	if r.pos != len(r.data) {
+		return nil, fmt.Errorf("%d bytes of trailing data", len(r.data)-r.pos)
+	}
+	for _, fn := range m.Functions {
+		if err := checkOperands(m, fn); err != nil {
+			return nil, fmt.Errorf("function %s: %w", fn.Name, err)
+		}
+	}
+	return m, nil
+}
+
+func (r *decoder) constant() (Value, error) {
+	kind, err := r.byte()
+	if err != nil {
+		return nil, err
+	}
+	switch kind {
+	case constNil:
+		return nil, nil
+	case constInt:
+		return r.int()
+	case constFloat:
+		b, err := r.bytes(8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.LittleEndian.Uint64(b)), nil
+	case constStr:
+		return r.str()
+	case constBool:
+		b, err := r.byte()
+		return b != 0, err
+	case constBuiltin, constMethod:
+		name, err := r.str()
+		if err != nil {
+			return nil, err
+		}
+		arity, err := r.uint()
+		if err != nil {
+			return nil, err
+		}
+		if kind == constBuiltin {
+			return BuiltinInfo{Name: name, Arity: arity}, nil
+		}
+		return MethodInfo{Name: name, Arity: arity}, nil
+	case constDefer:
+		op, err := r.byte()
+		if err != nil {
+			return nil, err
+		}
+		arg, err := r.int()
+		if err != nil {
+			return nil, err
+		}
+		arity, err := r.uint()
+		if err != nil {
+			return nil, err
+		}
+		return DeferInfo{Op: OpCode(op), Arg: arg, Arity: arity}, nil
+	case constStruct:
+		name, err := r.str()
+		if err != nil {
+			return nil, err
+		}
+		n, err := r.uint()
+		if err != nil {
+			return nil, err
+		}
+		info := &StructInfo{Name: name, Fields: make([]string, n)}
+		for i := range info.Fields {
+			if info.Fields[i], err = r.str(); err != nil {
+				return nil, err
+			}
+		}
+		return info, nil
+	case constField:
+		name, err := r.str()
+		if err != nil {
+			return nil, err
+		}
+		slot, err := r.int()
+		if err != nil {
+			return nil, err
+		}
+		return FieldInfo{Name: name, Slot: slot}, nil
+	}
+	return nil, fmt.Errorf("unknown constant kind %d", kind)
+}
+
+func (r *decoder) function(files []string) (*Function, error) {
+	fn := &Function{}
+	var err error
+	if fn.Name, err = r.str(); err != nil {
+		return nil, err
+	}
+	if fn.Arity, err = r.uint(); err != nil {
+		return nil, err
+	}
+	if fn.NumLocals, err = r.uint(); err != nil {
+		return nil, err
+	}
+	ncode, err := r.count()
+	if err != nil {
+		return nil, err
+	}
+	if ncode > 0 {
+		fn.Code = make([]Instruction, ncode)
+	}
+	for ip := range fn.Code {
+		b, err := r.byte()
+		if err != nil {
+			return nil, err
+		}
+		op := OpCode(b)
+		if !op.Valid() {
+			return nil, fmt.Errorf("instruction %d: unknown opcode %d", ip, b)
+		}
+		arg := 0
+		switch op.OperandWidth() {
+		case 2:
+			raw, err := r.bytes(2)
+			if err != nil {
+				return nil, err
+			}
+			arg = int(binary.LittleEndian.Uint16(raw))
+		case 4:
+			raw, err := r.bytes(4)
+			if err != nil {
+				return nil, err
+			}
+			arg = int(binary.LittleEndian.Uint32(raw))
+		}
+		fn.Code[ip] = Instruction{Op: op, Arg: arg}
+	}
+	nloc, err := r.count()
+	if err != nil {
+		return nil, err
+	}
+	if nloc != 0 && nloc != ncode {
+		return nil, fmt.Errorf("%d locations for %d instructions", nloc, ncode)
+	}
+	if nloc > 0 {
+		fn.Locations = make([]SourceLoc, nloc)
+	}
+	for i := range fn.Locations {
+		file, err := r.uint()
+		if err != nil {
+			return nil, err
+		}
+		if file > len(files) {
+			return nil, fmt.Errorf("location %d: no file %d", i, file)
+		}
+		if file > 0 {
+			fn.Locations[i].File = files[file-1]
+		}
+		if fn.Locations[i].Line, err = r.uint(); err != nil {
+			return nil, err
+		}
+		if fn.Locations[i].Col, err = r.uint(); err != nil {
+			return nil, err
+		}
+	}
+	nnames, err := r.count()
+	if err != nil {
+		return nil, err
+	}
+	if nnames > 0 {
+		fn.LocalNames = make([]string, nnames)
+	}
+	for i := range fn.LocalNames {
+		if fn.LocalNames[i], err = r.str(); err != nil {
+			return nil, err
+		}
+	}
+	extern, err := r.byte()
+	if err != nil {
+		return nil, err
+	}
+	switch extern {
+	case 0:
+	case 1:
+		if ncode != 0 {
+			return nil, fmt.Errorf("stub for another module's function has %d instructions", ncode)
+		}
+		fn.Extern = &Symbol{}
+		if fn.Extern.Module, err = r.str(); err != nil {
+			return nil, err
+		}
+		if fn.Extern.Name, err = r.str(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("bad extern flag %d", extern)
+	}
+	return fn, nil
+}
+
+// operandKind is what an opcode's operand refers to.
+type operandKind int
+
+const (
+	operandOther operandKind = iota // a count, or nothing
+	operandConstant
+	operandLocal
+	operandFunction
+	operandInstruction
+)
+
+func (op OpCode) operandKind() operandKind {
+	switch op {
+	case PUSH_INT, PUSH_FLOAT, PUSH_STR, PUSH_BOOL, FORMAT_VALUE,
+		CALL_BUILTIN, CALL_METHOD, DEFER, NEW_STRUCT, GET_FIELD, SET_FIELD:
+		return operandConstant
+	case LOAD_LOCAL, STORE_LOCAL, STORE_LOCAL_POP:
+		return operandLocal
+	case CALL, TAIL_CALL:
+		return operandFunction
+	case JUMP, JUMP_IF_FALSE, JUMP_IF_TRUE:
+		return operandInstruction
+	}
+	return operandOther
+}
+
+// checkOperands checks that each operand of fn that refers to something
+// refers to something that exists.
+func checkOperands(m *Module, fn *Function) error {
+	for ip, instr := range fn.Code {
+		limit, what := -1, ""
+		switch instr.Op.operandKind() {
+		case operandConstant:
+			limit, what = len(m.Constants), "constant"
+		case operandLocal:
+			limit, what = fn.NumLocals, "local"
+		case operandFunction:
+			limit, what = len(m.Functions), "function"
+		case operandInstruction:
+			limit, what = len(fn.Code)+1, "instruction"
+		}
+		if limit >= 0 && instr.Arg >= limit {
+			return fmt.Errorf("instruction %d: %s refers to %s %d of %d", ip, instr.Op, what, instr.Arg, limit)
+		}
+	}
+	return nil
+}
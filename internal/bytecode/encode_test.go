@@ -0,0 +1,94 @@
+package bytecode
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func encodeTestModule() *Module {
+	m := NewModule("main.fn")
+	m.AddConstant(42)
+	m.AddConstant(-7)
+	m.AddConstant(2.5)
+	m.AddConstant("hi")
+	m.AddConstant(true)
+	m.AddConstant(BuiltinInfo{Name: "println", Arity: 1})
+	m.AddConstant(MethodInfo{Name: "area", Arity: 0})
+	m.AddConstant(DeferInfo{Op: CALL_BUILTIN, Arg: 5, Arity: 1})
+	m.AddConstant(&StructInfo{Name: "Point", Fields: []string{"x", "y"}})
+	m.AddConstant(FieldInfo{Name: "y", Slot: 1})
+	m.AddConstant(FieldInfo{Name: "tag", Slot: -1})
+
+	main := &Function{Name: "main", NumLocals: 1, LocalNames: []string{"x"}}
+	main.EmitAt(PUSH_INT, 0, SourceLoc{File: "main.fn", Line: 1, Col: 9})
+	main.EmitAt(STORE_LOCAL, 0, SourceLoc{File: "main.fn", Line: 1, Col: 1})
+	main.EmitAt(LOAD_LOCAL, 0, SourceLoc{File: "main.fn", Line: 2, Col: 9})
+	main.EmitAt(CALL, 1, SourceLoc{File: "lib.fn", Line: 3, Col: 5})
+	main.EmitAt(CALL_BUILTIN, 5, SourceLoc{})
+	main.EmitAt(HALT, 0, SourceLoc{})
+	m.AddFunction(main)
+
+	helper := &Function{Name: "helper", Arity: 1, NumLocals: 1}
+	helper.Emit(LOAD_LOCAL, 0)
+	helper.Emit(RETURN, 0)
+	m.Export("helper", m.AddFunction(helper))
+
+	m.AddFunction(&Function{Name: "add", Arity: 2, Extern: &Symbol{Module: "/src/lib.fn", Name: "add"}})
+	return m
+}
+
+func TestEncode_RoundTrip(t *testing.T) {
+	m := encodeTestModule()
+	data, err := m.MarshalBinary()
+	require.NoError(t, err)
+	assert.True(t, IsEncoded(data))
+
+	got, err := Decode(data)
+	require.NoError(t, err)
+	assert.Equal(t, m, got)
+	assert.Equal(t, m.Disassemble(), got.Disassemble())
+}
+
+func TestEncode_RejectsOperandWiderThanOpcode(t *testing.T) {
+	m := NewModule("main.fn")
+	f := &Function{Name: "main", NumLocals: 70000}
+	f.Emit(LOAD_LOCAL, 70000) // LOAD_LOCAL's operand is 2 bytes
+	m.AddFunction(f)
+	_, err := m.MarshalBinary()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "doesn't fit LOAD_LOCAL")
+}
+
+func TestDecode_RejectsBadInput(t *testing.T) {
+	good, err := encodeTestModule().MarshalBinary()
+	require.NoError(t, err)
+
+	_, err = Decode([]byte("let x = 1\n"))
+	assert.ErrorContains(t, err, "not a compiled funny module")
+
+	old := append([]byte{}, good...)
+	binary.LittleEndian.PutUint16(old[len(Magic):], FormatVersion+1)
+	_, err = Decode(old)
+	assert.ErrorContains(t, err, "rebuild it")
+
+	for n := len(Magic) + 2; n < len(good); n++ {
+		_, err := Decode(good[:n])
+		assert.Error(t, err, "truncated at %d bytes", n)
+	}
+	_, err = Decode(append(good, 0))
+	assert.ErrorContains(t, err, "trailing data")
+}
+
+func TestDecode_RejectsOutOfRangeOperands(t *testing.T) {
+	m := NewModule("main.fn")
+	f := &Function{Name: "main"}
+	f.Emit(PUSH_STR, 3) // no constants
+	m.AddFunction(f)
+	data, err := m.MarshalBinary()
+	require.NoError(t, err)
+	_, err = Decode(data)
+	assert.ErrorContains(t, err, "PUSH_STR refers to constant 3 of 0")
+}
@@ -0,0 +1,128 @@
+package bytecode
+
+import "fmt"
+
+// Link joins modules compiled one file at a time into the one module the
+// VM runs. entry is the program's own file: its top-level code becomes
+// the linked module's main. libs are the files it imports, dependencies
+// before dependents; their top-level functions, which only libraries'
+// declarations ever compile into, are dropped.
+//
+// The linked module holds main, then every lib's functions in order, then
+// entry's, with no stubs: each stub is resolved by qualified name, against
+// the export table of the module its Symbol names, which must be one of
+// libs. Constant pools are merged, so every operand that refers to a
+// function or a constant is renumbered, and struct layouts are shared by
+// name, so a struct built in one module has the same runtime type as one
+// built in another. The inputs are left as they are, so a module (say, a
+// cached library) can be linked into any number of programs.
+func Link(entry *Module, libs ...*Module) (*Module, error) {
+	out := NewModule(entry.Name)
+	byName := make(map[string]*Module, len(libs))
+	for _, lib := range libs {
+		if _, dup := byName[lib.Name]; dup {
+			return nil, fmt.Errorf("link: module %s given twice", lib.Name)
+		}
+		byName[lib.Name] = lib
+	}
+
+	// Number every real function first, so a stub can be resolved to a
+	// function of a module linked after its own.
+	l := &linker{out: out, fnIdx: map[*Module][]int{}, structs: map[string]*StructInfo{}}
+	mods := append(append([]*Module{}, libs...), entry)
+	next := 1
+	for _, m := range mods {
+		idx := make([]int, len(m.Functions))
+		for i, fn := range m.Functions {
+			switch {
+			case i == 0 && m == entry:
+				idx[i] = 0
+			case i == 0 || fn.Extern != nil:
+				idx[i] = -1
+			default:
+				idx[i] = next
+				next++
+			}
+		}
+		l.fnIdx[m] = idx
+	}
+	for _, m := range mods {
+		idx := l.fnIdx[m]
+		for i, fn := range m.Functions {
+			if fn.Extern == nil {
+				continue
+			}
+			target, ok := byName[fn.Extern.Module]
+			if !ok {
+				return nil, fmt.Errorf("link: %s calls %s, but module %s isn't linked", m.Name, fn.Extern, fn.Extern.Module)
+			}
+			at, ok := target.Exports[fn.Extern.Name]
+			if !ok {
+				return nil, fmt.Errorf("link: %s calls %s, which module %s doesn't export", m.Name, fn.Extern, fn.Extern.Module)
+			}
+			idx[i] = l.fnIdx[target][at]
+		}
+	}
+
+	out.Functions = make([]*Function, next)
+	for _, m := range mods {
+		// A DEFER's DeferInfo refers to a constant of its own (the
+		// deferred call's operand), so it's added once the rest are.
+		consts := make([]int, len(m.Constants))
+		for i, c := range m.Constants {
+			if _, isDefer := c.(DeferInfo); !isDefer {
+				consts[i] = l.constant(c)
+			}
+		}
+		for i, c := range m.Constants {
+			if info, isDefer := c.(DeferInfo); isDefer {
+				switch info.Op.operandKind() {
+				case operandConstant:
+					info.Arg = consts[info.Arg]
+				case operandFunction:
+					info.Arg = l.fnIdx[m][info.Arg]
+				}
+				consts[i] = out.AddConstant(info)
+			}
+		}
+		idx := l.fnIdx[m]
+		for i, fn := range m.Functions {
+			if idx[i] < 0 || fn.Extern != nil {
+				continue
+			}
+			linked := *fn
+			linked.Code = make([]Instruction, len(fn.Code))
+			for ip, instr := range fn.Code {
+				switch instr.Op.operandKind() {
+				case operandConstant:
+					instr.Arg = consts[instr.Arg]
+				case operandFunction:
+					instr.Arg = idx[instr.Arg]
+				}
+				linked.Code[ip] = instr
+			}
+			out.Functions[idx[i]] = &linked
+		}
+	}
+	return out, nil
+}
+
+// linker is the state of one Link.
+type linker struct {
+	out     *Module
+	fnIdx   map[*Module][]int      // a module's function index → the linked one (-1 for a dropped one)
+	structs map[string]*StructInfo // struct name → the layout every module's NEW_STRUCT shares
+}
+
+// constant adds c to the linked module's pool and returns its index
+// there.
+func (l *linker) constant(c Value) int {
+	if info, ok := c.(*StructInfo); ok {
+		if shared, ok := l.structs[info.Name]; ok {
+			c = shared
+		} else {
+			l.structs[info.Name] = info
+		}
+	}
+	return l.out.AddConstant(c)
+}
@@ -0,0 +1,83 @@
+package bytecode
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// linkTestModules returns a library exporting double, which builds a
+// Point, and an entry whose main calls it through a stub and builds a
+// Point of its own.
+func linkTestModules() (entry, lib *Module) {
+	lib = NewModule("/src/lib.fn")
+	lib.AddFunction(&Function{Name: "main", Code: []Instruction{{Op: HALT}}})
+	libPoint := lib.AddConstant(&StructInfo{Name: "Point", Fields: []string{"x"}})
+	two := lib.AddConstant(2)
+	double := &Function{Name: "double", Arity: 1, NumLocals: 1}
+	double.Emit(LOAD_LOCAL, 0)
+	double.Emit(PUSH_INT, two)
+	double.Emit(MUL_INT, 0)
+	double.Emit(NEW_STRUCT, libPoint)
+	double.Emit(RETURN, 0)
+	lib.Export("double", lib.AddFunction(double))
+
+	entry = NewModule("main.fn")
+	one := entry.AddConstant(1)
+	entryPoint := entry.AddConstant(&StructInfo{Name: "Point", Fields: []string{"x"}})
+	main := &Function{Name: "main"}
+	main.Emit(PUSH_INT, one)
+	main.Emit(CALL, 1)
+	main.Emit(PUSH_INT, one)
+	main.Emit(NEW_STRUCT, entryPoint)
+	main.Emit(HALT, 0)
+	entry.AddFunction(main)
+	entry.AddFunction(&Function{Name: "double", Arity: 1, Extern: &Symbol{Module: lib.Name, Name: "double"}})
+	return entry, lib
+}
+
+func TestLink_ResolvesStubsAndRenumbersOperands(t *testing.T) {
+	entry, lib := linkTestModules()
+	before := entry.Disassemble()
+
+	linked, err := Link(entry, lib)
+	require.NoError(t, err)
+	assert.Equal(t, "main.fn", linked.Name)
+	require.Len(t, linked.Functions, 2)
+	assert.Equal(t, "main", linked.Functions[0].Name)
+	assert.Equal(t, "double", linked.Functions[1].Name)
+	assert.Nil(t, linked.Functions[1].Extern)
+
+	main := linked.Functions[0]
+	assert.Equal(t, Instruction{Op: CALL, Arg: 1}, main.Code[1])
+	assert.Equal(t, 1, linked.Constants[main.Code[0].Arg])
+	double := linked.Functions[1]
+	assert.Equal(t, 2, linked.Constants[double.Code[1].Arg])
+	assert.Equal(t, double.Code[3].Arg, main.Code[3].Arg, "both modules' Points share one StructInfo")
+	assert.Equal(t, before, entry.Disassemble(), "the inputs are left as they are")
+}
+
+func TestLink_RenumbersDeferredCalls(t *testing.T) {
+	entry, lib := linkTestModules()
+	entry.Functions[0].Code[1] = Instruction{Op: DEFER, Arg: entry.AddConstant(DeferInfo{Op: CALL, Arg: 1, Arity: 1})}
+	printlnInfo := entry.AddConstant(BuiltinInfo{Name: "println", Arity: 1})
+	entry.Functions[0].Emit(DEFER, entry.AddConstant(DeferInfo{Op: CALL_BUILTIN, Arg: printlnInfo, Arity: 1}))
+
+	linked, err := Link(entry, lib)
+	require.NoError(t, err)
+	main := linked.Functions[0]
+	assert.Equal(t, DeferInfo{Op: CALL, Arg: 1, Arity: 1}, linked.Constants[main.Code[1].Arg])
+	info := linked.Constants[main.Code[len(main.Code)-1].Arg].(DeferInfo)
+	assert.Equal(t, BuiltinInfo{Name: "println", Arity: 1}, linked.Constants[info.Arg])
+}
+
+func TestLink_RejectsUnresolvedSymbols(t *testing.T) {
+	entry, lib := linkTestModules()
+	_, err := Link(entry)
+	assert.ErrorContains(t, err, "main.fn calls /src/lib.fn::double, but module /src/lib.fn isn't linked")
+
+	delete(lib.Exports, "double")
+	_, err = Link(entry, lib)
+	assert.ErrorContains(t, err, "which module /src/lib.fn doesn't export")
+}
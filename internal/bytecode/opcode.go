@@ -1,86 +1,237 @@
 // v2/internal/bytecode/opcode.go
 package bytecode
 
-// OpCode identifies a typed bytecode instruction.
-type OpCode string
+import "fmt"
+
+// OpCode identifies a typed bytecode instruction. It is a byte so the VM's
+// dispatch switch compiles to a jump table; the names in opNames exist
+// only for people and tools (Disassemble, the JSON source map).
+type OpCode uint8
 
 const (
 	// Stack manipulation
-	PUSH_INT   OpCode = "PUSH_INT"
-	PUSH_FLOAT OpCode = "PUSH_FLOAT"
-	PUSH_STR   OpCode = "PUSH_STR"
-	PUSH_BOOL  OpCode = "PUSH_BOOL"
-	PUSH_NIL   OpCode = "PUSH_NIL"
-	POP        OpCode = "POP"
-	DUP        OpCode = "DUP"
+	PUSH_INT OpCode = iota
+	PUSH_FLOAT
+	PUSH_STR
+	PUSH_BOOL
+	PUSH_NIL
+	POP
+	DUP
 
 	// Variables
-	LOAD_LOCAL   OpCode = "LOAD_LOCAL"
-	STORE_LOCAL  OpCode = "STORE_LOCAL"
-	LOAD_GLOBAL  OpCode = "LOAD_GLOBAL"
-	STORE_GLOBAL OpCode = "STORE_GLOBAL"
+	LOAD_LOCAL
+	STORE_LOCAL
+	LOAD_GLOBAL
+	STORE_GLOBAL
 
 	// Arithmetic (typed)
-	ADD_INT   OpCode = "ADD_INT"
-	SUB_INT   OpCode = "SUB_INT"
-	MUL_INT   OpCode = "MUL_INT"
-	DIV_INT   OpCode = "DIV_INT"
-	MOD_INT   OpCode = "MOD_INT"
-	NEG_INT   OpCode = "NEG_INT"
-	ADD_FLOAT OpCode = "ADD_FLOAT"
-	SUB_FLOAT OpCode = "SUB_FLOAT"
-	MUL_FLOAT OpCode = "MUL_FLOAT"
-	DIV_FLOAT OpCode = "DIV_FLOAT"
-	NEG_FLOAT OpCode = "NEG_FLOAT"
-	ADD_STR   OpCode = "ADD_STR"
+	ADD_INT
+	SUB_INT
+	MUL_INT
+	DIV_INT
+	MOD_INT
+	NEG_INT
+	ADD_FLOAT
+	SUB_FLOAT
+	MUL_FLOAT
+	DIV_FLOAT
+	NEG_FLOAT
+	ADD_STR
 
 	// String formatting (f-string interpolation)
-	FORMAT_VALUE OpCode = "FORMAT_VALUE"
+	FORMAT_VALUE
 
 	// Comparison (typed)
-	EQ_INT    OpCode = "EQ_INT"
-	EQ_STR    OpCode = "EQ_STR"
-	EQ_BOOL   OpCode = "EQ_BOOL"
-	EQ_NIL    OpCode = "EQ_NIL"
-	EQ_FLOAT  OpCode = "EQ_FLOAT"
-	LT_INT    OpCode = "LT_INT"
-	GT_INT    OpCode = "GT_INT"
-	LTE_INT   OpCode = "LTE_INT"
-	GTE_INT   OpCode = "GTE_INT"
-	LT_FLOAT  OpCode = "LT_FLOAT"
-	GT_FLOAT  OpCode = "GT_FLOAT"
-	LTE_FLOAT OpCode = "LTE_FLOAT"
-	GTE_FLOAT OpCode = "GTE_FLOAT"
+	EQ_INT
+	EQ_STR
+	EQ_BOOL
+	EQ_NIL
+	EQ_FLOAT
+	EQ_VALUE // lists, maps and structs (see stdlib.Equal)
+	LT_INT
+	GT_INT
+	LTE_INT
+	GTE_INT
+	LT_FLOAT
+	GT_FLOAT
+	LTE_FLOAT
+	GTE_FLOAT
 
 	// Logical
-	NOT_BOOL OpCode = "NOT_BOOL"
-	AND_BOOL OpCode = "AND_BOOL"
-	OR_BOOL  OpCode = "OR_BOOL"
-	IN_LIST  OpCode = "IN_LIST"
+	NOT_BOOL
+	AND_BOOL
+	OR_BOOL
+	IN_LIST
+	IN_SET // hashed lookup; see stdlib.Set.Has
 
 	// Control flow
-	JUMP          OpCode = "JUMP"
-	JUMP_IF_FALSE OpCode = "JUMP_IF_FALSE"
-	JUMP_IF_TRUE  OpCode = "JUMP_IF_TRUE"
-	TRY_OR_RETURN OpCode = "TRY_OR_RETURN"
+	JUMP
+	JUMP_IF_FALSE
+	JUMP_IF_TRUE
+	TRY_OR_RETURN
 
 	// Functions
-	CALL         OpCode = "CALL"
-	CALL_BUILTIN OpCode = "CALL_BUILTIN"
-	RETURN       OpCode = "RETURN"
+	CALL
+	CALL_BUILTIN
+	CALL_METHOD
+	RETURN
+
+	// TAIL_CALL is CALL in tail position (return f(...)): the callee takes
+	// over the current frame instead of pushing a new one. A RETURN always
+	// follows it, for when the frame can't be reused.
+	TAIL_CALL
+
+	// DEFER pops the arguments of a call (see DeferInfo) and registers
+	// the call to run when the current frame returns or unwinds.
+	DEFER
 
 	// Data structures
-	BUILD_LIST OpCode = "BUILD_LIST"
-	INDEX      OpCode = "INDEX"
-	SET_INDEX  OpCode = "SET_INDEX"
-	BUILD_MAP  OpCode = "BUILD_MAP"
-	GET_FIELD  OpCode = "GET_FIELD"
-	SET_FIELD  OpCode = "SET_FIELD"
-	NEW_STRUCT OpCode = "NEW_STRUCT"
+	BUILD_LIST
+	INDEX
+	SLICE      // pops high, low, object (nil bound = omitted)
+	RANGE      // pops step, end, start; pushes the list
+	CHECK_STEP // fails if the range step on top of the stack is zero
+	SET_INDEX
+	BUILD_MAP
+	BUILD_SET
+	GET_FIELD  // FieldInfo operand; pops the object, pushes the field
+	SET_FIELD  // FieldInfo operand; pops the object, leaves the value
+	NEW_STRUCT // StructInfo operand; pops the field values
+
+	// WRAP_VALIDATED pops a `validate` hook's Result and the struct it was
+	// called on, and pushes the Result if it is err, else ok(struct).
+	WRAP_VALIDATED
 
 	// Halt
-	HALT OpCode = "HALT"
+	HALT
+
+	// Fused instructions, emitted only by the optimizer (see
+	// compiler.Optimize).
+	STORE_LOCAL_POP // STORE_LOCAL then POP
+
+	numOpCodes // not an opcode: the size of the tables below
 )
 
-// String returns the string representation of the OpCode.
-func (op OpCode) String() string { return string(op) }
+// opNames maps each opcode to its mnemonic.
+var opNames = [numOpCodes]string{
+	PUSH_INT:       "PUSH_INT",
+	PUSH_FLOAT:     "PUSH_FLOAT",
+	PUSH_STR:       "PUSH_STR",
+	PUSH_BOOL:      "PUSH_BOOL",
+	PUSH_NIL:       "PUSH_NIL",
+	POP:            "POP",
+	DUP:            "DUP",
+	LOAD_LOCAL:     "LOAD_LOCAL",
+	STORE_LOCAL:    "STORE_LOCAL",
+	LOAD_GLOBAL:    "LOAD_GLOBAL",
+	STORE_GLOBAL:   "STORE_GLOBAL",
+	ADD_INT:        "ADD_INT",
+	SUB_INT:        "SUB_INT",
+	MUL_INT:        "MUL_INT",
+	DIV_INT:        "DIV_INT",
+	MOD_INT:        "MOD_INT",
+	NEG_INT:        "NEG_INT",
+	ADD_FLOAT:      "ADD_FLOAT",
+	SUB_FLOAT:      "SUB_FLOAT",
+	MUL_FLOAT:      "MUL_FLOAT",
+	DIV_FLOAT:      "DIV_FLOAT",
+	NEG_FLOAT:      "NEG_FLOAT",
+	ADD_STR:        "ADD_STR",
+	FORMAT_VALUE:   "FORMAT_VALUE",
+	EQ_INT:         "EQ_INT",
+	EQ_STR:         "EQ_STR",
+	EQ_BOOL:        "EQ_BOOL",
+	EQ_NIL:         "EQ_NIL",
+	EQ_FLOAT:       "EQ_FLOAT",
+	EQ_VALUE:       "EQ_VALUE",
+	LT_INT:         "LT_INT",
+	GT_INT:         "GT_INT",
+	LTE_INT:        "LTE_INT",
+	GTE_INT:        "GTE_INT",
+	LT_FLOAT:       "LT_FLOAT",
+	GT_FLOAT:       "GT_FLOAT",
+	LTE_FLOAT:      "LTE_FLOAT",
+	GTE_FLOAT:      "GTE_FLOAT",
+	NOT_BOOL:       "NOT_BOOL",
+	AND_BOOL:       "AND_BOOL",
+	OR_BOOL:        "OR_BOOL",
+	IN_LIST:        "IN_LIST",
+	IN_SET:         "IN_SET",
+	JUMP:           "JUMP",
+	JUMP_IF_FALSE:  "JUMP_IF_FALSE",
+	JUMP_IF_TRUE:   "JUMP_IF_TRUE",
+	TRY_OR_RETURN:  "TRY_OR_RETURN",
+	CALL:           "CALL",
+	CALL_BUILTIN:   "CALL_BUILTIN",
+	CALL_METHOD:    "CALL_METHOD",
+	RETURN:         "RETURN",
+	TAIL_CALL:      "TAIL_CALL",
+	DEFER:          "DEFER",
+	BUILD_LIST:     "BUILD_LIST",
+	INDEX:          "INDEX",
+	SLICE:          "SLICE",
+	RANGE:          "RANGE",
+	CHECK_STEP:     "CHECK_STEP",
+	SET_INDEX:      "SET_INDEX",
+	BUILD_MAP:      "BUILD_MAP",
+	BUILD_SET:      "BUILD_SET",
+	GET_FIELD:      "GET_FIELD",
+	SET_FIELD:      "SET_FIELD",
+	NEW_STRUCT:     "NEW_STRUCT",
+	WRAP_VALIDATED: "WRAP_VALIDATED",
+	HALT:           "HALT",
+	// Fused
+	STORE_LOCAL_POP: "STORE_LOCAL_POP",
+}
+
+// operandWidths is the number of bytes each opcode's operand needs: 0 for
+// opcodes that ignore Instruction.Arg, 2 for local slots, and 4 for
+// constant-pool and function indices, jump targets and element counts.
+var operandWidths = [numOpCodes]uint8{
+	PUSH_INT:      4,
+	PUSH_FLOAT:    4,
+	PUSH_STR:      4,
+	PUSH_BOOL:     4,
+	LOAD_LOCAL:    2,
+	STORE_LOCAL:   2,
+	LOAD_GLOBAL:   4,
+	STORE_GLOBAL:  4,
+	FORMAT_VALUE:  4,
+	JUMP:          4,
+	JUMP_IF_FALSE: 4,
+	JUMP_IF_TRUE:  4,
+	CALL:          4,
+	CALL_BUILTIN:  4,
+	CALL_METHOD:   4,
+	TAIL_CALL:     4,
+	DEFER:         4,
+	BUILD_LIST:    4,
+	BUILD_MAP:     4,
+	BUILD_SET:     4,
+	GET_FIELD:     4,
+	SET_FIELD:     4,
+	NEW_STRUCT:    4,
+	// Fused
+	STORE_LOCAL_POP: 2,
+}
+
+// String returns the opcode's mnemonic, or OpCode(n) for a byte that isn't
+// one.
+func (op OpCode) String() string {
+	if op < numOpCodes {
+		return opNames[op]
+	}
+	return fmt.Sprintf("OpCode(%d)", uint8(op))
+}
+
+// OperandWidth returns the size in bytes of op's operand, 0 when op has
+// none.
+func (op OpCode) OperandWidth() int {
+	if op < numOpCodes {
+		return int(operandWidths[op])
+	}
+	return 0
+}
+
+// Valid reports whether op is a defined opcode.
+func (op OpCode) Valid() bool { return op < numOpCodes }
@@ -55,11 +55,19 @@ func TestOpCode_String(t *testing.T) {
 		{JUMP_IF_TRUE, "JUMP_IF_TRUE"},
 		{CALL, "CALL"},
 		{CALL_BUILTIN, "CALL_BUILTIN"},
+		{CALL_METHOD, "CALL_METHOD"},
+		{WRAP_VALIDATED, "WRAP_VALIDATED"},
+		{SLICE, "SLICE"},
+		{RANGE, "RANGE"},
+		{CHECK_STEP, "CHECK_STEP"},
 		{RETURN, "RETURN"},
+		{DEFER, "DEFER"},
 		{BUILD_LIST, "BUILD_LIST"},
 		{INDEX, "INDEX"},
 		{SET_INDEX, "SET_INDEX"},
 		{BUILD_MAP, "BUILD_MAP"},
+		{BUILD_SET, "BUILD_SET"},
+		{IN_SET, "IN_SET"},
 		{GET_FIELD, "GET_FIELD"},
 		{SET_FIELD, "SET_FIELD"},
 		{NEW_STRUCT, "NEW_STRUCT"},
@@ -69,3 +77,23 @@ func TestOpCode_String(t *testing.T) {
 		assert.Equal(t, c.want, c.op.String(), "OpCode=%v", c.op)
 	}
 }
+
+func TestOpCode_TablesCoverEveryOpcode(t *testing.T) {
+	seen := map[string]bool{}
+	for op := OpCode(0); op < numOpCodes; op++ {
+		name := op.String()
+		assert.NotEmpty(t, name, "opcode %d has no name", uint8(op))
+		assert.False(t, seen[name], "duplicate name %s", name)
+		seen[name] = true
+	}
+	assert.False(t, numOpCodes.Valid())
+	assert.Equal(t, "OpCode(200)", OpCode(200).String())
+}
+
+func TestOpCode_OperandWidth(t *testing.T) {
+	assert.Equal(t, 4, JUMP.OperandWidth())
+	assert.Equal(t, 2, LOAD_LOCAL.OperandWidth())
+	assert.Equal(t, 0, ADD_INT.OperandWidth())
+	assert.Equal(t, "LOAD_LOCAL 0", Instruction{Op: LOAD_LOCAL}.String())
+	assert.Equal(t, "ADD_INT", Instruction{Op: ADD_INT}.String())
+}
@@ -40,7 +40,7 @@ func (m *Module) SourceMap() ModuleSourceMap {
 		for i, instr := range fn.Code {
 			entry := SourceMapEntry{
 				IP:  i,
-				Op:  string(instr.Op),
+				Op:  instr.Op.String(),
 				Arg: instr.Arg,
 			}
 			if i < len(fn.Locations) && !fn.Locations[i].IsZero() {
@@ -0,0 +1,180 @@
+package cli
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jiejie-dev/funny/v2/internal/compiler"
+	"github.com/jiejie-dev/funny/v2/internal/module"
+	"github.com/jiejie-dev/funny/v2/internal/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMain points the compile cache at a scratch directory, so the
+// package's Run tests never touch the user's cache.
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "funny-cache-")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv("FUNNY_CACHE_DIR", dir)
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func TestBuild_RunsCompiledModule(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "math.fn"),
+		[]byte("pub fn add(a: int, b: int) -> int:\n    return a + b\n"), 0o644))
+	mainPath := filepath.Join(dir, "main.fn")
+	src := []byte("import \"math.fn\"\nprintln(add(40, 2))\n")
+	require.NoError(t, Build(src, mainPath, "", compiler.O1))
+
+	data, err := os.ReadFile(filepath.Join(dir, "main.fnc"))
+	require.NoError(t, err)
+	// The compiled module needs neither its source nor its imports.
+	require.NoError(t, os.Remove(filepath.Join(dir, "math.fn")))
+	out := captureStdout(t, func() {
+		require.NoError(t, Run(data, filepath.Join(dir, "main.fnc")))
+	})
+	assert.Equal(t, "42\n", out)
+}
+
+func TestRun_CorruptCompiledModule(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "main.fnc")
+	require.NoError(t, Build([]byte("println(1)\n"), "main.fn", out, compiler.O1))
+	data, err := os.ReadFile(out)
+	require.NoError(t, err)
+	err = Run(data[:len(data)-3], out)
+	assert.ErrorContains(t, err, "compiled module")
+}
+
+func TestRun_CompileCache(t *testing.T) {
+	t.Setenv("FUNNY_CACHE_DIR", t.TempDir())
+	dir := t.TempDir()
+	libPath := filepath.Join(dir, "lib.fn")
+	require.NoError(t, os.WriteFile(libPath, []byte("pub fn greet() -> str:\n    return \"hello\"\n"), 0o644))
+	mainPath := filepath.Join(dir, "main.fn")
+	src := []byte("import \"lib.fn\"\nprintln(greet())\n")
+
+	run := func() string {
+		return captureStdout(t, func() { require.NoError(t, Run(src, mainPath)) })
+	}
+	assert.Equal(t, "hello\n", run())
+
+	// Swap the cached bytecode for another program's: the next run using
+	// it shows the entry was hit rather than recompiled.
+	entryPath := filepath.Join(os.Getenv("FUNNY_CACHE_DIR"), cacheKey(src, mainPath, compiler.O1))
+	other, _, _, err := compileSource([]byte("println(\"cached\")\n"), "other.fn", compiler.O1)
+	require.NoError(t, err)
+	var entry cacheEntry
+	data, err := os.ReadFile(entryPath)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &entry))
+	assert.Equal(t, []cacheDep{{Path: libPath, Hash: entry.Deps[0].Hash}}, entry.Deps)
+	entry.Module, err = other.MarshalBinary()
+	require.NoError(t, err)
+	data, err = json.Marshal(entry)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(entryPath, data, 0o644))
+	assert.Equal(t, "cached\n", run())
+
+	// Changing an import makes the entry stale.
+	require.NoError(t, os.WriteFile(libPath, []byte("pub fn greet() -> str:\n    return \"bye\"\n"), 0o644))
+	assert.Equal(t, "bye\n", run())
+
+	entries, err := os.ReadDir(os.Getenv("FUNNY_CACHE_DIR"))
+	require.NoError(t, err)
+	t.Setenv("FUNNY_CACHE", "off")
+	src = []byte("import \"lib.fn\"\nprintln(greet() + \"!\")\n")
+	assert.Equal(t, "bye!\n", run())
+	after, err := os.ReadDir(os.Getenv("FUNNY_CACHE_DIR"))
+	require.NoError(t, err)
+	assert.Len(t, after, len(entries))
+}
+
+func TestRun_CompileCacheKeepsEachImportsCompile(t *testing.T) {
+	t.Setenv("FUNNY_CACHE_DIR", t.TempDir())
+	dir := t.TempDir()
+	libPath := filepath.Join(dir, "lib.fn")
+	require.NoError(t, os.WriteFile(libPath, []byte("pub fn greet() -> str:\n    return \"hello\"\n"), 0o644))
+	mainPath := filepath.Join(dir, "main.fn")
+	run := func(src string) string {
+		return captureStdout(t, func() { require.NoError(t, Run([]byte(src), mainPath)) })
+	}
+	assert.Equal(t, "hello\n", run("import \"lib.fn\"\nprintln(greet())\n"))
+
+	// Swap lib.fn's cached compile for one of a different lib.fn: a
+	// program that missed the cache, having changed itself, links the
+	// cached one instead of recompiling lib.fn.
+	prog, err := parser.New("import \"lib.fn\"\n", mainPath).Parse()
+	require.NoError(t, err)
+	g, err := module.Load(prog, mainPath)
+	require.NoError(t, err)
+	lib := g.Units[0]
+	key := unitKey(lib, compiler.O1, map[*module.Unit]string{})
+	entryPath := filepath.Join(os.Getenv("FUNNY_CACHE_DIR"), key)
+	require.FileExists(t, entryPath)
+	other := *lib
+	otherProg, err := parser.New("pub fn greet() -> str:\n    return \"cached\"\n", libPath).Parse()
+	require.NoError(t, err)
+	other.Decls = otherProg.Stmts
+	mod, err := compiler.CompileUnit(&other)
+	require.NoError(t, err)
+	cacheStore(key, nil, nil, mod)
+	assert.Equal(t, "cached!\n", run("import \"lib.fn\"\nprintln(greet() + \"!\")\n"))
+
+	// Changing lib.fn changes its key.
+	require.NoError(t, os.WriteFile(libPath, []byte("pub fn greet() -> str:\n    return \"bye\"\n"), 0o644))
+	assert.Equal(t, "bye?\n", run("import \"lib.fn\"\nprintln(greet() + \"?\")\n"))
+}
+
+func TestCachePrune_EvictsLeastRecentlyUsed(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	for i, name := range []string{"old", "mid", "new", cacheTempPrefix + "1"} {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, make([]byte, 100), 0o644))
+		used := now.Add(time.Duration(i-4) * time.Hour)
+		require.NoError(t, os.Chtimes(path, used, used))
+	}
+	cachePrune(dir, 250)
+	assert.NoFileExists(t, filepath.Join(dir, "old"))
+	assert.FileExists(t, filepath.Join(dir, "mid"))
+	assert.FileExists(t, filepath.Join(dir, "new"))
+	assert.FileExists(t, filepath.Join(dir, cacheTempPrefix+"1"), "an entry being written is left alone")
+
+	cachePrune(dir, 1000)
+	assert.FileExists(t, filepath.Join(dir, "mid"), "a cache under its limit is left alone")
+}
+
+func TestRun_CompileCacheStaysUnderItsLimit(t *testing.T) {
+	cache := t.TempDir()
+	t.Setenv("FUNNY_CACHE_DIR", cache)
+	t.Setenv("FUNNY_CACHE_MAX_MB", "1")
+	stale := filepath.Join(cache, "stale")
+	require.NoError(t, os.WriteFile(stale, make([]byte, 1<<20), 0o644))
+	long := time.Now().Add(-24 * time.Hour)
+	require.NoError(t, os.Chtimes(stale, long, long))
+
+	path := filepath.Join(t.TempDir(), "main.fn")
+	out := captureStdout(t, func() { require.NoError(t, Run([]byte("println(1)\n"), path)) })
+	assert.Equal(t, "1\n", out)
+	assert.NoFileExists(t, stale, "writing an entry evicts the least recently used")
+	files, err := os.ReadDir(cache)
+	require.NoError(t, err)
+	assert.Len(t, files, 1)
+
+	dir, n, err := CacheClean()
+	require.NoError(t, err)
+	assert.Equal(t, cache, dir)
+	assert.Equal(t, 1, n)
+	files, err = os.ReadDir(cache)
+	require.NoError(t, err)
+	assert.Empty(t, files)
+}
@@ -0,0 +1,262 @@
+package cli
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jiejie-dev/funny/v2/internal/bytecode"
+	"github.com/jiejie-dev/funny/v2/internal/compiler"
+	"github.com/jiejie-dev/funny/v2/internal/module"
+)
+
+// The compile cache lets `funny run` skip parsing, type-checking and
+// compiling a script it has already compiled. An entry is keyed by the
+// script's path, source and optimization level (plus the funny binary
+// itself, so a rebuilt funny never runs bytecode compiled by an older
+// one) and records the hash of every file the script imports; an import
+// changing on disk makes the entry stale. Each imported file's own,
+// unlinked compile is cached too (see unitKey), so a script that missed
+// still only recompiles the files that changed. It lives in
+// FUNNY_CACHE_DIR, or funny/bytecode under the user cache directory;
+// FUNNY_CACHE=off turns it off. The cache is best-effort: an entry that
+// can't be read or written is a miss. It's kept under FUNNY_CACHE_MAX_MB
+// (defaultCacheMaxBytes when unset) by evicting the least recently used
+// entries whenever one is written (see cachePrune), and `funny cache
+// clean` empties it (see CacheClean).
+
+// defaultCacheMaxBytes is how big the cache may grow unless
+// FUNNY_CACHE_MAX_MB says otherwise.
+const defaultCacheMaxBytes = 256 << 20
+
+// cacheTempPrefix starts the name of an entry still being written.
+const cacheTempPrefix = "entry-"
+
+// cacheEntry is one cached compile, stored as JSON.
+type cacheEntry struct {
+	Deps     []cacheDep `json:"deps"`
+	Warnings []string   `json:"warnings,omitempty"`
+	Module   []byte     `json:"module"` // bytecode.Module.MarshalBinary
+}
+
+// cacheDep is an imported file and the hash of its contents at compile time.
+type cacheDep struct {
+	Path string `json:"path"`
+	Hash string `json:"hash"`
+}
+
+// cacheDir returns the cache directory, or "" when caching is off or
+// there's nowhere to put it.
+func cacheDir() string {
+	if os.Getenv("FUNNY_CACHE") == "off" {
+		return ""
+	}
+	if dir := os.Getenv("FUNNY_CACHE_DIR"); dir != "" {
+		return dir
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "funny", "bytecode")
+}
+
+// cacheMaxBytes returns the size the cache is pruned to.
+func cacheMaxBytes() int64 {
+	if mb, err := strconv.ParseInt(os.Getenv("FUNNY_CACHE_MAX_MB"), 10, 64); err == nil && mb > 0 {
+		return mb << 20
+	}
+	return defaultCacheMaxBytes
+}
+
+// cacheKey names the entry for src compiled from file at level.
+func cacheKey(src []byte, file string, level compiler.OptLevel) string {
+	h := sha256.New()
+	h.Write(binary.LittleEndian.AppendUint16(nil, bytecode.FormatVersion))
+	h.Write([]byte{byte(level)})
+	if exe, err := os.Executable(); err == nil {
+		if fi, err := os.Stat(exe); err == nil {
+			h.Write([]byte(exe))
+			h.Write(binary.LittleEndian.AppendUint64(nil, uint64(fi.Size())))
+			h.Write(binary.LittleEndian.AppendUint64(nil, uint64(fi.ModTime().UnixNano())))
+		}
+	}
+	if abs, err := filepath.Abs(file); err == nil {
+		file = abs
+	}
+	h.Write([]byte(file))
+	h.Write([]byte{0})
+	h.Write(src)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// unitKey names the cached compile of the imported file u at level, given
+// the keys of the files u imports. It covers u's path, source and module
+// name and, through those keys, the same of every file u's imports reach,
+// since compiling u reads their declarations.
+func unitKey(u *module.Unit, level compiler.OptLevel, keys map[*module.Unit]string) string {
+	h := sha256.New()
+	h.Write([]byte(cacheKey(u.Source, u.Path, level)))
+	h.Write([]byte(u.Name))
+	for _, dep := range u.Deps {
+		h.Write([]byte{0})
+		h.Write([]byte(keys[dep]))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// hashFile returns the hex sha256 of path's contents.
+func hashFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// cacheLoad returns the compile cached under key, if there is a fresh one.
+func cacheLoad(key string) (*bytecode.Module, []string, bool) {
+	dir := cacheDir()
+	if dir == "" {
+		return nil, nil, false
+	}
+	path := filepath.Join(dir, key)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, false
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, nil, false
+	}
+	for _, dep := range entry.Deps {
+		if hash, err := hashFile(dep.Path); err != nil || hash != dep.Hash {
+			return nil, nil, false
+		}
+	}
+	mod, err := bytecode.Decode(entry.Module)
+	if err != nil {
+		return nil, nil, false
+	}
+	// An entry's modification time is when it was last used, which is
+	// what cachePrune evicts by.
+	now := time.Now()
+	os.Chtimes(path, now, now)
+	return mod, entry.Warnings, true
+}
+
+// cacheStore records mod under key as a compile that read the imported
+// files deps and produced warnings.
+func cacheStore(key string, deps []string, warnings []string, mod *bytecode.Module) {
+	dir := cacheDir()
+	if dir == "" {
+		return
+	}
+	entry := cacheEntry{Warnings: warnings}
+	for _, path := range deps {
+		hash, err := hashFile(path)
+		if err != nil {
+			return
+		}
+		entry.Deps = append(entry.Deps, cacheDep{Path: path, Hash: hash})
+	}
+	var err error
+	if entry.Module, err = mod.MarshalBinary(); err != nil {
+		return
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return
+	}
+	// Write then rename, so a concurrent run never reads half an entry.
+	tmp, err := os.CreateTemp(dir, cacheTempPrefix+"*")
+	if err != nil {
+		return
+	}
+	_, werr := tmp.Write(data)
+	cerr := tmp.Close()
+	if werr != nil || cerr != nil || os.Rename(tmp.Name(), filepath.Join(dir, key)) != nil {
+		os.Remove(tmp.Name())
+		return
+	}
+	cachePrune(dir, cacheMaxBytes())
+}
+
+// cachePrune removes the least recently used entries in dir until the
+// rest take at most max bytes. Entries still being written are left
+// alone.
+func cachePrune(dir string, max int64) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	type cached struct {
+		path string
+		size int64
+		used time.Time
+	}
+	var entries []cached
+	var total int64
+	for _, f := range files {
+		if !f.Type().IsRegular() || strings.HasPrefix(f.Name(), cacheTempPrefix) {
+			continue
+		}
+		info, err := f.Info()
+		if err != nil {
+			continue
+		}
+		entries = append(entries, cached{filepath.Join(dir, f.Name()), info.Size(), info.ModTime()})
+		total += info.Size()
+	}
+	if total <= max {
+		return
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].used.Before(entries[j].used) })
+	for _, e := range entries {
+		if total <= max {
+			break
+		}
+		if os.Remove(e.path) == nil {
+			total -= e.size
+		}
+	}
+}
+
+// CacheClean removes every entry from the compile cache and returns the
+// cache directory and the number of entries removed.
+func CacheClean() (string, int, error) {
+	dir := cacheDir()
+	if dir == "" {
+		return "", 0, fmt.Errorf("the compile cache is off (FUNNY_CACHE=off) or has no directory")
+	}
+	files, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return dir, 0, nil
+	}
+	if err != nil {
+		return dir, 0, err
+	}
+	removed := 0
+	for _, f := range files {
+		if !f.Type().IsRegular() {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, f.Name())); err != nil {
+			return dir, removed, err
+		}
+		removed++
+	}
+	return dir, removed, nil
+}
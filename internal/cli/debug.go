@@ -72,15 +72,15 @@ func CompileModule(src []byte, file string) (*bytecode.Module, error) {
 	if err != nil {
 		return nil, err
 	}
-	prog, err = module.Resolve(prog, file)
+	g, err := module.Load(prog, file)
 	if err != nil {
 		return nil, err
 	}
 	env := types.NewEnv(nil)
-	if err := types.Check(prog, env); err != nil {
+	if err := types.Check(g.Program(), env); err != nil {
 		return nil, err
 	}
-	return compiler.Compile(prog, file)
+	return compileGraph(g, compiler.O0)
 }
 
 func parseBreakpoint(spec, defaultFile string) (file string, line1 int, err error) {
@@ -131,7 +131,7 @@ func readDebugCommand(in io.Reader, out io.Writer, dbg *vm.Debugger, defaultFile
 		PrintDebugStack(out, *ev)
 		return readDebugCommand(in, out, dbg, defaultFile, ev)
 	case "w", "where":
-		fmt.Fprintf(out, "  at %s in %s ip=%d\n", ev.Location.Display(), ev.FnName, ev.IP)
+		PrintDebugWhere(out, *ev)
 		return readDebugCommand(in, out, dbg, defaultFile, ev)
 	case "b", "break":
 		if len(parts) < 2 {
@@ -162,11 +162,26 @@ func printDebugHelp(out io.Writer) {
   break (b) N    Set breakpoint at line N (or file:line)
   locals (l)     Show local variables
   stack (p)      Show operand stack
-  where (w)      Show current source location
+  where (w)      Show the call stack, innermost call first
   quit (q)       Stop debugging
   help (h)       Show this help`)
 }
 
+// PrintDebugWhere writes the call stack from the last event, innermost
+// call first, marking the calls tail calls elided.
+func PrintDebugWhere(out io.Writer, ev vm.DebugEvent) {
+	for i, call := range ev.CallStack {
+		if i == 0 {
+			fmt.Fprintf(out, "  at %s in %s ip=%d\n", call.Location.Display(), call.FnName, ev.IP)
+		} else {
+			fmt.Fprintf(out, "  at %s in %s\n", call.Location.Display(), call.FnName)
+		}
+		if call.Elided > 0 {
+			fmt.Fprintf(out, "  ... %s\n", vm.ElidedLabel(call.Elided))
+		}
+	}
+}
+
 // PrintDebugLocals writes locals from the last event (helper for extensions).
 func PrintDebugLocals(out io.Writer, ev vm.DebugEvent) {
 	for _, lv := range ev.Locals {
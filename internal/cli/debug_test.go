@@ -5,6 +5,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/jiejie-dev/funny/v2/internal/compiler"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -24,7 +25,7 @@ println(x)
 func TestDisasm_IncludesSourceComments(t *testing.T) {
 	src := `let x = 1
 `
-	out, err := Disasm([]byte(src), "t.fn")
+	out, err := Disasm([]byte(src), "t.fn", compiler.O0)
 	require.NoError(t, err)
 	assert.Contains(t, out, "; t.fn:")
 }
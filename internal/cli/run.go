@@ -2,11 +2,15 @@
 package cli
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/jiejie-dev/funny/v2/internal/ast"
+	"github.com/jiejie-dev/funny/v2/internal/bytecode"
 	"github.com/jiejie-dev/funny/v2/internal/compiler"
 	"github.com/jiejie-dev/funny/v2/internal/evaluator"
 	"github.com/jiejie-dev/funny/v2/internal/formatter"
@@ -16,37 +20,208 @@ import (
 	"github.com/jiejie-dev/funny/v2/internal/vm"
 )
 
-// Run parses, type-checks, and executes the given source.
-// By default uses the bytecode VM; set FUNNY_INTERPRET=1 to use the tree-walking evaluator.
+// Run parses, type-checks, and executes the given source at the default
+// optimization level (O1); see RunWithOptions.
 func Run(src []byte, file string) error {
-	p := parser.New(string(src), file)
-	prog, err := p.Parse()
+	return RunWithOptions(src, file, RunOptions{OptLevel: compiler.O1})
+}
+
+// RunOptions configures RunWithOptions.
+type RunOptions struct {
+	OptLevel compiler.OptLevel // passes run over the compiled bytecode
+	Context  context.Context   // cancels the run when done; nil means never
+	Limits   vm.Limits         // resource limits for the VM (the evaluator ignores them)
+	Profile  string            // file to write a pprof profile of the VM run to; empty means none
+}
+
+// RunWithOptions parses, type-checks, and executes the given source.
+// By default uses the bytecode VM; set FUNNY_INTERPRET=1 to use the tree-walking evaluator.
+// src may also be a module compiled by `funny build` (a `.fnc` file),
+// which runs on the VM as is. Source compiled for the VM goes through the
+// compile cache (see cache.go).
+func RunWithOptions(src []byte, file string, opts RunOptions) error {
+	if bytecode.IsEncoded(src) || filepath.Ext(file) == ".fnc" {
+		mod, err := bytecode.Decode(src)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		for _, fn := range mod.Functions {
+			if fn.Extern != nil {
+				return fmt.Errorf("%s: compiled module isn't linked: %s is left to another module", file, fn.Extern)
+			}
+		}
+		return runModule(mod, opts)
+	}
+	if os.Getenv("FUNNY_INTERPRET") != "" {
+		prog, _, env, err := check(src, file)
+		if err != nil {
+			return err
+		}
+		printWarnings(env)
+		e := evaluator.NewWithContext(nil, opts.Context)
+		return e.Exec(prog)
+	}
+	key := cacheKey(src, file, opts.OptLevel)
+	if mod, warnings, ok := cacheLoad(key); ok {
+		for _, w := range warnings {
+			fmt.Fprintln(os.Stderr, w)
+		}
+		return runModule(mod, opts)
+	}
+	mod, deps, warnings, err := compileSource(src, file, opts.OptLevel)
 	if err != nil {
 		return err
 	}
-	prog, err = module.Resolve(prog, file)
+	cacheStore(key, deps, warnings, mod)
+	return runModule(mod, opts)
+}
+
+// Build compiles src to bytecode and writes it to out in the `.fnc`
+// format, which Run executes without recompiling. An empty out means
+// file with its extension replaced by `.fnc`.
+func Build(src []byte, file, out string, level compiler.OptLevel) error {
+	if out == "" {
+		out = strings.TrimSuffix(file, filepath.Ext(file)) + ".fnc"
+	}
+	mod, _, _, err := compileSource(src, file, level)
 	if err != nil {
 		return err
 	}
+	data, err := mod.MarshalBinary()
+	if err != nil {
+		return fmt.Errorf("build: %w", err)
+	}
+	return os.WriteFile(out, data, 0o644)
+}
+
+// check parses src, loads its imports and type-checks the whole program.
+// It also returns the import graph, which compileGraph compiles, and the
+// env holding any warnings.
+func check(src []byte, file string) (*ast.Program, *module.Graph, *types.Env, error) {
+	p := parser.New(string(src), file)
+	prog, err := p.Parse()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	g, err := module.Load(prog, file)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	prog = g.Program()
 	env := types.NewEnv(nil)
 	if err := types.Check(prog, env); err != nil {
-		return err
+		return nil, nil, nil, err
 	}
-	if os.Getenv("FUNNY_INTERPRET") != "" {
-		e := evaluator.New(nil)
-		return e.Exec(prog)
+	return prog, g, env, nil
+}
+
+// compileSource checks and compiles src at level, printing any warnings.
+// It returns the imported files it read and the warnings alongside the
+// module.
+func compileSource(src []byte, file string, level compiler.OptLevel) (*bytecode.Module, []string, []string, error) {
+	_, g, env, err := check(src, file)
+	if err != nil {
+		return nil, nil, nil, err
 	}
-	mod, err := compiler.Compile(prog, file)
+	printWarnings(env)
+	var warnings []string
+	for _, w := range env.Warnings() {
+		warnings = append(warnings, w.Format())
+	}
+	mod, err := compileGraph(g, level)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return mod, g.Files(), warnings, nil
+}
+
+// compileGraph compiles each file of the type-checked import graph g into
+// a module of its own at level, and links them. The imported files go
+// through the compile cache one at a time, so a program whose own source
+// changed recompiles only that, and programs importing the same files
+// share their compiles.
+func compileGraph(g *module.Graph, level compiler.OptLevel) (*bytecode.Module, error) {
+	keys := map[*module.Unit]string{}
+	libs := make([]*bytecode.Module, len(g.Units))
+	for i, u := range g.Units {
+		keys[u] = unitKey(u, level, keys)
+		if mod, _, ok := cacheLoad(keys[u]); ok {
+			libs[i] = mod
+			continue
+		}
+		mod, err := compileUnit(u, level)
+		if err != nil {
+			return nil, err
+		}
+		cacheStore(keys[u], nil, nil, mod)
+		libs[i] = mod
+	}
+	entry, err := compileUnit(g.Main, level)
 	if err != nil {
-		return fmt.Errorf("compile: %w", err)
+		return nil, err
+	}
+	return bytecode.Link(entry, libs...)
+}
+
+// compileUnit compiles one file of an import graph at level.
+func compileUnit(u *module.Unit, level compiler.OptLevel) (*bytecode.Module, error) {
+	mod, err := compiler.CompileUnit(u)
+	if err != nil {
+		return nil, fmt.Errorf("compile: %w", err)
+	}
+	compiler.Optimize(mod, level)
+	return mod, nil
+}
+
+// runModule runs a compiled module on the VM under opts' context and
+// limits, profiling it if opts asks to. The profile is written even when
+// the run fails, since a run stopped by a timeout is often the one worth
+// profiling.
+func runModule(mod *bytecode.Module, opts RunOptions) error {
+	ctx := opts.Context
+	if ctx == nil {
+		ctx = context.Background()
 	}
 	m := vm.New(mod)
-	if _, err := m.Run(); err != nil {
-		return err
+	m.SetLimits(opts.Limits)
+	var prof *vm.Profiler
+	if opts.Profile != "" {
+		prof = vm.NewProfiler(vm.DefaultProfilePeriod)
+		m.SetProfiler(prof)
+	}
+	_, err := m.RunContext(ctx)
+	if prof != nil {
+		if perr := writeProfile(prof, opts.Profile); perr != nil && err == nil {
+			err = perr
+		}
+	}
+	return err
+}
+
+// writeProfile writes prof to the file at path.
+func writeProfile(prof *vm.Profiler, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("profile: %w", err)
+	}
+	if err := prof.Write(f); err != nil {
+		f.Close()
+		return fmt.Errorf("profile: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("profile: %w", err)
 	}
 	return nil
 }
 
+// printWarnings writes the type checker's warnings to stderr; they don't
+// stop the script from running.
+func printWarnings(env *types.Env) {
+	for _, w := range env.Warnings() {
+		fmt.Fprintln(os.Stderr, w.Format())
+	}
+}
+
 // Ast returns the JSON-serialized AST.
 func Ast(src []byte, file string) ([]byte, error) {
 	p := parser.New(string(src), file)
@@ -63,22 +238,14 @@ func Format(src []byte, file string) (string, error) {
 	return formatter.Format(src, file)
 }
 
-// Disasm compiles and returns the human-readable bytecode disassembly.
-func Disasm(src []byte, file string) (string, error) {
-	p := parser.New(string(src), file)
-	prog, err := p.Parse()
-	if err != nil {
-		return "", err
-	}
-	prog, err = module.Resolve(prog, file)
+// Disasm compiles at level and returns the human-readable bytecode
+// disassembly.
+func Disasm(src []byte, file string, level compiler.OptLevel) (string, error) {
+	_, g, _, err := check(src, file)
 	if err != nil {
 		return "", err
 	}
-	env := types.NewEnv(nil)
-	if err := types.Check(prog, env); err != nil {
-		return "", err
-	}
-	mod, err := compiler.Compile(prog, file)
+	mod, err := compileGraph(g, level)
 	if err != nil {
 		return "", err
 	}
@@ -6,6 +6,8 @@ import (
 	"path/filepath"
 	"testing"
 
+	"github.com/jiejie-dev/funny/v2/internal/compiler"
+	"github.com/jiejie-dev/funny/v2/internal/vm"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -92,7 +94,7 @@ func TestRun_TypeError_Still_Caught(t *testing.T) {
 
 func TestDisasm_Outputs(t *testing.T) {
 	src := `let x = 1`
-	out, err := Disasm([]byte(src), "test.fn")
+	out, err := Disasm([]byte(src), "test.fn", compiler.O0)
 	assert.NoError(t, err)
 	assert.Contains(t, out, "module test.fn")
 	assert.Contains(t, out, "PUSH_INT")
@@ -145,6 +147,16 @@ println(1)
 	assert.Contains(t, err.Error(), "E1102")
 }
 
+func TestRun_ImportedPrivateFunctionTracesUnderQualifiedName(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "lib.fn"),
+		[]byte("fn boom(xs: list[int]) -> int:\n    return xs[5]\n\npub fn first(xs: list[int]) -> int:\n    let v = boom(xs)\n    return v\n"), 0o644))
+	mainPath := filepath.Join(dir, "main.fn")
+	err := Run([]byte("import \"lib.fn\"\nprintln(first([1]))\n"), mainPath)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "at lib::boom ("+filepath.Join(dir, "lib.fn")+":2:15)")
+}
+
 func TestDisasm_WithImport_IncludesImportedFunction(t *testing.T) {
 	dir := t.TempDir()
 	require.NoError(t, os.WriteFile(filepath.Join(dir, "math.fn"),
@@ -157,7 +169,7 @@ let r = add(1, 2)
 
 	data, err := os.ReadFile(mainPath)
 	require.NoError(t, err)
-	out, err := Disasm(data, mainPath)
+	out, err := Disasm(data, mainPath, compiler.O0)
 	require.NoError(t, err)
 	assert.Contains(t, out, "add")
 }
@@ -394,3 +406,21 @@ println(c.label)
 	})
 	assert.Equal(t, "3\nhits\n", out)
 }
+
+func TestRunWithOptions_WritesProfileOfFailedRun(t *testing.T) {
+	t.Setenv("FUNNY_CACHE", "off")
+	path := filepath.Join(t.TempDir(), "run.pprof")
+	src := `let n = 0
+while true:
+    n = n + 1
+`
+	err := RunWithOptions([]byte(src), "spin.fn", RunOptions{
+		OptLevel: compiler.O1,
+		Limits:   vm.Limits{MaxInstructions: 100000},
+		Profile:  path,
+	})
+	require.ErrorIs(t, err, vm.ErrInstructionLimit)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x1f, 0x8b}, data[:2], "the profile is gzipped")
+}
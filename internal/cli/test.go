@@ -3,24 +3,45 @@ package cli
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 
 	"github.com/jiejie-dev/funny/v2/internal/testrunner"
 )
 
 // Test runs funny test files and prints a summary.
 func Test(path string, verbose, jsonOut bool) error {
-	report, err := testrunner.Run(testrunner.Options{Path: path, Verbose: verbose})
+	return TestWithOptions(TestOptions{Path: path, Verbose: verbose, JSON: jsonOut})
+}
+
+// TestOptions configures TestWithOptions. Setting any of CoverLCOV,
+// CoverJSON or CoverMin implies Cover.
+type TestOptions struct {
+	Path      string  // file or directory of *_test.fn files
+	Verbose   bool    // print each test as it runs
+	JSON      bool    // print the report as JSON instead of text
+	Cover     bool    // report line coverage
+	CoverLCOV string  // file to write the coverage to in LCOV format
+	CoverJSON string  // file to write the coverage to as JSON (what the LSP reads)
+	CoverMin  float64 // fail if total coverage is below this percentage
+}
+
+// TestWithOptions runs funny test files and prints a summary, with the
+// line coverage of the code they ran when opts asks for it.
+func TestWithOptions(opts TestOptions) error {
+	cover := opts.Cover || opts.CoverLCOV != "" || opts.CoverJSON != "" || opts.CoverMin > 0
+	report, err := testrunner.Run(testrunner.Options{Path: opts.Path, Verbose: opts.Verbose, Cover: cover})
 	if err != nil {
 		return err
 	}
-	if jsonOut {
+	if opts.JSON {
 		data, err := json.MarshalIndent(report, "", "  ")
 		if err != nil {
 			return err
 		}
 		fmt.Println(string(data))
-	} else if !verbose {
+	} else if !opts.Verbose {
 		for _, t := range report.Tests {
 			status := "PASS"
 			if !t.Passed {
@@ -33,8 +54,45 @@ func Test(path string, verbose, jsonOut bool) error {
 		}
 	}
 	fmt.Fprintf(os.Stdout, "\n%d passed, %d failed\n", report.Passed, report.Failed)
+	if cov := report.Coverage; cov != nil {
+		if !opts.JSON {
+			fmt.Fprintln(os.Stdout, "\ncoverage:")
+			if err := cov.WriteSummary(os.Stdout); err != nil {
+				return err
+			}
+		}
+		if err := writeCoverage(opts.CoverLCOV, cov.WriteLCOV); err != nil {
+			return err
+		}
+		if err := writeCoverage(opts.CoverJSON, cov.WriteJSON); err != nil {
+			return err
+		}
+	}
 	if report.Failed > 0 {
 		return fmt.Errorf("%d test(s) failed", report.Failed)
 	}
+	if cov := report.Coverage; cov != nil && cov.Percent < opts.CoverMin {
+		return fmt.Errorf("coverage %.1f%% is below the minimum of %.1f%%", cov.Percent, opts.CoverMin)
+	}
 	return nil
 }
+
+// writeCoverage creates the file at path (and its directory), if path
+// isn't empty, and fills it with write.
+func writeCoverage(path string, write func(io.Writer) error) error {
+	if path == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("coverage: %w", err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("coverage: %w", err)
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return fmt.Errorf("coverage: %w", err)
+	}
+	return f.Close()
+}
@@ -1,6 +1,7 @@
 package cli
 
 import (
+	"os"
 	"path/filepath"
 	"testing"
 
@@ -22,3 +23,21 @@ func TestCLI_DocMarkdown(t *testing.T) {
 	})
 	require.Contains(t, out, "Add two integers")
 }
+
+func TestCLI_TestCoverageGate(t *testing.T) {
+	root := filepath.Join("..", "..", "testdata", "testrunner")
+	lcov := filepath.Join(t.TempDir(), "out", "cover.lcov")
+	out := captureStdout(t, func() {
+		require.NoError(t, TestWithOptions(TestOptions{Path: root, CoverLCOV: lcov, CoverMin: 100}))
+	})
+	require.Contains(t, out, "coverage:\n")
+	require.FileExists(t, lcov)
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "lib.fn"), []byte("pub fn never() -> int:\n    return 1\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "lib_test.fn"), []byte("import \"./lib.fn\"\n\ntest \"nothing\":\n    assert(true)\n"), 0o644))
+	captureStdout(t, func() {
+		err := TestWithOptions(TestOptions{Path: dir, CoverMin: 50})
+		require.ErrorContains(t, err, "coverage 0.0% is below the minimum of 50.0%")
+	})
+}
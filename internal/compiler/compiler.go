@@ -3,6 +3,7 @@ package compiler
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/jiejie-dev/funny/v2/internal/ast"
 	"github.com/jiejie-dev/funny/v2/internal/bytecode"
@@ -22,6 +23,22 @@ const (
 	valNil   valueType = "nil"
 )
 
+// setType is the valueType of a set whose elements have valueType elem.
+// Unlike a list, which reports its element type, a set keeps a valueType
+// of its own so `in` can pick IN_SET; setElem recovers the element type
+// for a for loop over it.
+func setType(elem valueType) valueType { return "set[" + elem + "]" }
+
+// setElem reports the element type of a set valueType.
+func (vt valueType) setElem() (valueType, bool) {
+	if inner, ok := strings.CutPrefix(string(vt), "set["); ok {
+		if elem, ok := strings.CutSuffix(inner, "]"); ok {
+			return valueType(elem), true
+		}
+	}
+	return "", false
+}
+
 // Compiler translates a typed AST into bytecode.
 type Compiler struct {
 	mod          *bytecode.Module
@@ -32,7 +49,13 @@ type Compiler struct {
 	functions    map[string]int                  // function name → index in mod.Functions
 	fnRetTypes   map[string]valueType            // function name → declared return value type
 	structFields map[string]map[string]valueType // struct name → field name → value type
+	interfaces   map[string]map[string]valueType // interface name → method name → return value type
+	structDecls  map[string]*ast.StructDecl      // struct name → declaration (field defaults, validate hook)
+	structInfos  map[string]int                  // struct name → its StructInfo constant, once NEW_STRUCT needs it
+	aliases      map[string]string               // type alias name → target annotation
 	loopStack    []loopFrame                     // active loops for break/continue
+	consts       map[string]any                  // const name → folded value
+	externs      map[string]externFn             // function name → another module's function; see CompileUnit
 }
 
 type loopFrame struct {
@@ -42,52 +65,91 @@ type loopFrame struct {
 
 // Compile translates a typed Program into a Module.
 func Compile(prog *ast.Program, name string) (*bytecode.Module, error) {
-	c := &Compiler{
+	c := newCompiler(name)
+	c.declareTypes(prog.Stmts)
+	if err := c.foldConsts(prog.Stmts); err != nil {
+		return nil, err
+	}
+	if err := c.compileMain(prog.Stmts); err != nil {
+		return nil, err
+	}
+	return c.mod, nil
+}
+
+func newCompiler(name string) *Compiler {
+	return &Compiler{
 		mod:          bytecode.NewModule(name),
 		scopes:       []map[string]int{{}},
 		functions:    map[string]int{},
 		fnRetTypes:   map[string]valueType{},
 		structFields: map[string]map[string]valueType{},
+		interfaces:   map[string]map[string]valueType{},
+		structDecls:  map[string]*ast.StructDecl{},
+		structInfos:  map[string]int{},
+		aliases:      map[string]string{},
+		consts:       map[string]any{},
+		externs:      map[string]externFn{},
 	}
-	// Two passes so struct A can have a field typed as struct B regardless
-	// of which one is declared first: pass 1 registers every struct name
-	// (so annotationValueType recognizes it as *some* struct), pass 2 fills
-	// in field types now that all names are known.
-	for _, s := range prog.Stmts {
-		if sd, ok := s.(*ast.StructDecl); ok {
-			c.structFields[sd.Name] = map[string]valueType{}
+}
+
+// declareTypes records the struct, interface and alias declarations among
+// stmts. Two passes so struct A can have a field typed as struct B
+// regardless of which one is declared first: pass 1 registers every
+// struct, interface and alias name (so annotationValueType recognizes
+// it), pass 2 fills in field and interface method return types now that
+// all names are known.
+func (c *Compiler) declareTypes(stmts []ast.Statement) {
+	for _, s := range stmts {
+		switch d := s.(type) {
+		case *ast.StructDecl:
+			c.structFields[d.Name] = map[string]valueType{}
+			c.structDecls[d.Name] = d
+		case *ast.InterfaceDecl:
+			c.interfaces[d.Name] = map[string]valueType{}
+		case *ast.TypeAliasDecl:
+			c.aliases[d.Name] = d.Target
 		}
 	}
-	for _, s := range prog.Stmts {
-		if sd, ok := s.(*ast.StructDecl); ok {
-			for _, p := range sd.Fields {
-				c.structFields[sd.Name][p.Name] = annotationValueType(p.TypeAnn, c.structFields)
+	for _, s := range stmts {
+		switch d := s.(type) {
+		case *ast.StructDecl:
+			for _, p := range d.Fields {
+				c.structFields[d.Name][p.Name] = c.annotationValueType(p.TypeAnn)
+			}
+		case *ast.InterfaceDecl:
+			for _, m := range d.Methods {
+				c.interfaces[d.Name][m.Name] = c.annotationValueType(m.RetType)
 			}
 		}
 	}
+}
+
+// compileMain compiles stmts as the module's top-level code, Functions[0],
+// with the functions they declare alongside it.
+func (c *Compiler) compileMain(stmts []ast.Statement) error {
 	mainFn := &bytecode.Function{Name: "main", Arity: 0}
 	c.mod.AddFunction(mainFn)
 	c.fn = mainFn
 	c.functions["main"] = 0
 	lastMeaningful := -1
-	for i := len(prog.Stmts) - 1; i >= 0; i-- {
-		if _, isComment := prog.Stmts[i].(*ast.CommentStmt); isComment {
+	for i := len(stmts) - 1; i >= 0; i-- {
+		if _, isComment := stmts[i].(*ast.CommentStmt); isComment {
 			continue
 		}
 		lastMeaningful = i
 		break
 	}
-	for i, s := range prog.Stmts {
+	for i, s := range stmts {
 		isLast := i == lastMeaningful
 		if err := c.compileStmt(s, isLast); err != nil {
-			return nil, err
+			return err
 		}
 	}
-	if len(prog.Stmts) > 0 {
-		c.pos = prog.Stmts[lastMeaningful].Pos()
+	if len(stmts) > 0 {
+		c.pos = stmts[lastMeaningful].Pos()
 	}
 	c.emit(bytecode.HALT, 0)
-	return c.mod, nil
+	return nil
 }
 
 // emit records c.pos alongside the instruction for debugger source maps.
@@ -181,7 +243,15 @@ func (c *Compiler) compileStmt(s ast.Statement, isLast bool) error {
 		return c.compileFnDecl(n)
 	case *ast.ReturnStmt:
 		return c.compileReturn(n)
+	case *ast.DeferStmt:
+		return c.compileDefer(n)
 	case *ast.StructDecl:
+		return c.compileStructDecl(n)
+	case *ast.InterfaceDecl, *ast.TypeAliasDecl:
+		// Purely static; calls through an interface compile to CALL_METHOD.
+		return nil
+	case *ast.ConstDecl:
+		// Already folded into every use (see foldConsts).
 		return nil
 	case *ast.CommentStmt:
 		return nil
@@ -212,8 +282,8 @@ func (c *Compiler) compileLet(n *ast.LetStmt) error {
 	// silently degrades to "untracked", which used to make comparisons
 	// like `e.response_ms > xs[i].response_ms` fail to compile at all
 	// ("unsupported op > for nil") once both sides ended up untracked.
-	if vt == valNil && n.TypeAnn != "" {
-		if at := annotationValueType(n.TypeAnn, c.structFields); at != valNil {
+	if (vt == valNil || vt == setType(valNil)) && n.TypeAnn != "" {
+		if at := c.annotationValueType(n.TypeAnn); at != valNil {
 			vt = at
 		}
 	}
@@ -265,17 +335,16 @@ func (c *Compiler) compileIndexAssign(idx *ast.IndexExpr, value ast.Expression)
 }
 
 // compileFieldAssign compiles `obj.field = value` into SET_FIELD. Stack layout
-// (bottom to top): value, object, field name — mirroring SET_INDEX.
+// (bottom to top): value, object — SET_FIELD's operand names the field.
 func (c *Compiler) compileFieldAssign(fe *ast.FieldExpr, value ast.Expression) error {
 	if _, err := c.compileExpr(value); err != nil {
 		return err
 	}
-	if _, err := c.compileExpr(fe.Object); err != nil {
+	objType, err := c.compileExpr(fe.Object)
+	if err != nil {
 		return err
 	}
-	nameIdx := c.mod.AddConstant(fe.Field)
-	c.emit(bytecode.PUSH_STR, nameIdx)
-	c.emit(bytecode.SET_FIELD, 0)
+	c.emit(bytecode.SET_FIELD, c.fieldInfo(objType, fe.Field))
 	c.emit(bytecode.POP, 0)
 	return nil
 }
@@ -3,9 +3,11 @@ package compiler
 
 import (
 	"fmt"
+	"sort"
 
 	"github.com/jiejie-dev/funny/v2/internal/ast"
 	"github.com/jiejie-dev/funny/v2/internal/bytecode"
+	"github.com/jiejie-dev/funny/v2/internal/typederror"
 )
 
 // compileIf translates: `if cond: then elif ...: ... else:? ...` into a
@@ -108,18 +110,24 @@ func (c *Compiler) compileWhile(n *ast.WhileStmt) error {
 
 // compileFor compiles: for x in iterable: body
 //
-// Emitted layout (using list and index locals):
+// A range iterable (`for i in a..b step k`) never builds a list; see
+// compileForRange. Any other iterable is stored in a local and walked by
+// index, with its length read once up front (so, like the evaluator, a
+// loop that appends to its own list doesn't visit the new elements):
 //
 //	<compile iterable>
 //	STORE_LOCAL __for_list__
 //	POP
+//	LOAD_LOCAL __for_list__
+//	CALL_BUILTIN "len"
+//	STORE_LOCAL __for_len__
+//	POP
 //	PUSH_INT 0
 //	STORE_LOCAL __for_idx__
 //	POP
 // loopStart:
 //	LOAD_LOCAL __for_idx__
-//	LOAD_LOCAL __for_list__
-//	CALL_BUILTIN "len"
+//	LOAD_LOCAL __for_len__
 //	LT_INT
 //	JUMP_IF_FALSE loopEnd
 //	LOAD_LOCAL __for_list__
@@ -138,6 +146,9 @@ func (c *Compiler) compileWhile(n *ast.WhileStmt) error {
 func (c *Compiler) compileFor(n *ast.ForStmt) error {
 	c.pushScope()
 	defer c.popScope()
+	if r, ok := n.Iterable.(*ast.RangeExpr); ok {
+		return c.compileForRange(n, r)
+	}
 	iterType, err := c.compileExpr(n.Iterable)
 	if err != nil {
 		return err
@@ -145,6 +156,12 @@ func (c *Compiler) compileFor(n *ast.ForStmt) error {
 	listSlot := c.declareLocal("__for_list__", valNil)
 	c.emit(bytecode.STORE_LOCAL, listSlot)
 	c.emit(bytecode.POP, 0)
+	lenSlot := c.declareLocal("__for_len__", valInt)
+	c.emit(bytecode.LOAD_LOCAL, listSlot)
+	nameIdx := c.mod.AddConstant(bytecode.BuiltinInfo{Name: "len", Arity: 1})
+	c.emit(bytecode.CALL_BUILTIN, nameIdx)
+	c.emit(bytecode.STORE_LOCAL, lenSlot)
+	c.emit(bytecode.POP, 0)
 	idxSlot := c.declareLocal("__for_idx__", valInt)
 	// Regression: this used to hardcode Arg=0, which reads whatever value
 	// happens to sit at Constants[0] instead of the intended literal 0 -
@@ -157,15 +174,17 @@ func (c *Compiler) compileFor(n *ast.ForStmt) error {
 	c.emit(bytecode.POP, 0)
 	loopStart := len(c.fn.Code)
 	c.emit(bytecode.LOAD_LOCAL, idxSlot)
-	c.emit(bytecode.LOAD_LOCAL, listSlot)
-	nameIdx := c.mod.AddConstant(bytecode.BuiltinInfo{Name: "len", Arity: 1})
-	c.emit(bytecode.CALL_BUILTIN, nameIdx)
+	c.emit(bytecode.LOAD_LOCAL, lenSlot)
 	c.emit(bytecode.LT_INT, 0)
 	exitJump := len(c.fn.Code)
 	c.emit(bytecode.JUMP_IF_FALSE, 0)
 	c.emit(bytecode.LOAD_LOCAL, listSlot)
 	c.emit(bytecode.LOAD_LOCAL, idxSlot)
 	c.emit(bytecode.INDEX, 0)
+	if elem, ok := iterType.setElem(); ok {
+		// INDEX on a set yields its elements in iteration order.
+		iterType = elem
+	}
 	if iterType == "" {
 		iterType = valNil
 	}
@@ -190,6 +209,126 @@ func (c *Compiler) compileFor(n *ast.ForStmt) error {
 	return nil
 }
 
+// compileForRange compiles `for x in a..b step k` to a plain integer
+// counter loop: no list, no builtin call, just locals and int opcodes.
+// Start and end are evaluated once. When the step is an int literal
+// (`step 2`, `step -1`, or omitted) its sign picks the comparison at
+// compile time:
+//
+//	<compile a>
+//	STORE_LOCAL __for_idx__
+//	POP
+//	<compile b>
+//	STORE_LOCAL __for_end__
+//	POP
+// loopStart:
+//	LOAD_LOCAL __for_idx__
+//	LOAD_LOCAL __for_end__
+//	LT_INT                      (GT_INT for a negative step)
+//	JUMP_IF_FALSE loopEnd
+//	LOAD_LOCAL __for_idx__
+//	STORE_LOCAL x
+//	POP
+//	<compile body>
+//	LOAD_LOCAL __for_idx__
+//	PUSH_INT <step_const>
+//	ADD_INT
+//	STORE_LOCAL __for_idx__
+//	POP
+//	JUMP loopStart
+// loopEnd:
+//
+// Any other step is checked once by CHECK_STEP, which fails on zero,
+// stored in __for_step__, and the test checks its sign on each iteration,
+// matching stdlib.InRange.
+func (c *Compiler) compileForRange(n *ast.ForStmt, r *ast.RangeExpr) error {
+	idxSlot := c.declareLocal("__for_idx__", valInt)
+	if _, err := c.compileExpr(r.Start); err != nil {
+		return err
+	}
+	c.emit(bytecode.STORE_LOCAL, idxSlot)
+	c.emit(bytecode.POP, 0)
+	endSlot := c.declareLocal("__for_end__", valInt)
+	if _, err := c.compileExpr(r.End); err != nil {
+		return err
+	}
+	c.emit(bytecode.STORE_LOCAL, endSlot)
+	c.emit(bytecode.POP, 0)
+	step, constStep := 1, true
+	if r.Step != nil {
+		step, constStep = c.intConstant(r.Step)
+		constStep = constStep && step != 0
+	}
+	stepSlot := -1
+	if !constStep {
+		stepSlot = c.declareLocal("__for_step__", valInt)
+		if _, err := c.compileExpr(r.Step); err != nil {
+			return err
+		}
+		c.pos = r.Step.Pos()
+		c.emit(bytecode.CHECK_STEP, 0)
+		c.emit(bytecode.STORE_LOCAL, stepSlot)
+		c.emit(bytecode.POP, 0)
+	}
+	zeroIdx := c.mod.AddConstant(0)
+	loopStart := len(c.fn.Code)
+	if constStep {
+		c.emit(bytecode.LOAD_LOCAL, idxSlot)
+		c.emit(bytecode.LOAD_LOCAL, endSlot)
+		if step > 0 {
+			c.emit(bytecode.LT_INT, 0)
+		} else {
+			c.emit(bytecode.GT_INT, 0)
+		}
+	} else {
+		// step > 0 ? idx < end : (idx > end and step < 0)
+		c.emit(bytecode.LOAD_LOCAL, stepSlot)
+		c.emit(bytecode.PUSH_INT, zeroIdx)
+		c.emit(bytecode.GT_INT, 0)
+		downJump := len(c.fn.Code)
+		c.emit(bytecode.JUMP_IF_FALSE, 0)
+		c.emit(bytecode.LOAD_LOCAL, idxSlot)
+		c.emit(bytecode.LOAD_LOCAL, endSlot)
+		c.emit(bytecode.LT_INT, 0)
+		testJump := len(c.fn.Code)
+		c.emit(bytecode.JUMP, 0)
+		c.fn.Code[downJump].Arg = len(c.fn.Code)
+		c.emit(bytecode.LOAD_LOCAL, idxSlot)
+		c.emit(bytecode.LOAD_LOCAL, endSlot)
+		c.emit(bytecode.GT_INT, 0)
+		c.emit(bytecode.LOAD_LOCAL, stepSlot)
+		c.emit(bytecode.PUSH_INT, zeroIdx)
+		c.emit(bytecode.LT_INT, 0)
+		c.emit(bytecode.AND_BOOL, 0)
+		c.fn.Code[testJump].Arg = len(c.fn.Code)
+	}
+	exitJump := len(c.fn.Code)
+	c.emit(bytecode.JUMP_IF_FALSE, 0)
+	userSlot := c.declareLocal(n.Name, valInt)
+	c.emit(bytecode.LOAD_LOCAL, idxSlot)
+	c.emit(bytecode.STORE_LOCAL, userSlot)
+	c.emit(bytecode.POP, 0)
+	c.pushLoop()
+	if err := c.compileBlock(n.Body); err != nil {
+		return err
+	}
+	continueStart := len(c.fn.Code)
+	c.emit(bytecode.LOAD_LOCAL, idxSlot)
+	if constStep {
+		c.emit(bytecode.PUSH_INT, c.mod.AddConstant(step))
+	} else {
+		c.emit(bytecode.LOAD_LOCAL, stepSlot)
+	}
+	c.emit(bytecode.ADD_INT, 0)
+	c.emit(bytecode.STORE_LOCAL, idxSlot)
+	c.emit(bytecode.POP, 0)
+	c.emit(bytecode.JUMP, loopStart)
+	loopEnd := len(c.fn.Code)
+	c.popLoop(loopEnd, continueStart)
+	c.fn.Code[exitJump].Arg = loopEnd
+	return nil
+}
+
 // compileBlock compiles a block of statements in a new scope.
 func (c *Compiler) compileBlock(b *ast.Block) error {
 	return c.compileBlockResult(b, false)
@@ -258,17 +397,169 @@ func isWildcardPattern(p ast.Expression) bool {
 	return ok && v.Name == "_"
 }
 
-func (c *Compiler) compilePatternMatch(scrutineeSlot int, pattern ast.Expression) error {
-	if isWildcardPattern(pattern) {
-		idx := c.mod.AddConstant(true)
-		c.emit(bytecode.PUSH_BOOL, idx)
+// compileMatch compiles a match statement. The scrutinee is stored in a
+// local, then each arm tests its pattern's alternatives in turn (see
+// compilePattern): a failed test jumps to the next alternative, and past
+// the last one to the next arm.
+//
+//	<alt 1 tests>          (failures -> alt2)
+//	JUMP body
+// alt2:
+//	<alt 2 tests>          (failures -> nextArm)
+// body:
+//	<guard>                (if any)
+//	JUMP_IF_FALSE nextArm
+//	<arm body>
+//	JUMP matchEnd
+// nextArm:
+//	...
+// matchEnd:
+func (c *Compiler) compileMatch(n *ast.MatchStmt) error {
+	c.pushScope()
+	defer c.popScope()
+	scrType, err := c.compileExpr(n.Expr)
+	if err != nil {
+		return err
+	}
+	slot := c.declareLocal("__match__", scrType)
+	c.emit(bytecode.STORE_LOCAL, slot)
+	c.emit(bytecode.POP, 0)
+
+	endJumps := []int{}
+	for _, arm := range n.Arms {
+		if err := c.compileMatchArm(slot, arm); err != nil {
+			return err
+		}
+		endJumps = append(endJumps, len(c.fn.Code)-1)
+	}
+	c.patchJumps(endJumps, len(c.fn.Code))
+	return nil
+}
+
+// compileMatchArm compiles one arm, ending with its (unpatched) JUMP to
+// the end of the match. The names the pattern binds live in a scope of
+// their own, shared by every alternative, so `ok(v) | err(v)` stores v in
+// one slot whichever side matched.
+func (c *Compiler) compileMatchArm(slot int, arm ast.MatchArm) error {
+	c.pushScope()
+	defer c.popScope()
+	var fails, bodyJumps []int
+	alts := []ast.Expression{arm.Pattern}
+	if or, ok := arm.Pattern.(*ast.OrPattern); ok {
+		alts = or.Alts
+	}
+	for i, alt := range alts {
+		c.patchJumps(fails, len(c.fn.Code))
+		fails = nil
+		if err := c.compilePattern(slot, alt, &fails); err != nil {
+			return err
+		}
+		if i < len(alts)-1 {
+			bodyJumps = append(bodyJumps, len(c.fn.Code))
+			c.emit(bytecode.JUMP, 0)
+		}
+	}
+	c.patchJumps(bodyJumps, len(c.fn.Code))
+	if arm.Guard != nil {
+		if _, err := c.compileExpr(arm.Guard); err != nil {
+			return err
+		}
+		fails = append(fails, len(c.fn.Code))
+		c.emit(bytecode.JUMP_IF_FALSE, 0)
+	}
+	if err := c.compileBlock(arm.Body); err != nil {
+		return err
+	}
+	c.emit(bytecode.JUMP, 0)
+	c.patchJumps(fails, len(c.fn.Code))
+	return nil
+}
+
+func (c *Compiler) patchJumps(idxs []int, target int) {
+	for _, idx := range idxs {
+		c.fn.Code[idx].Arg = target
+	}
+}
+
+// compilePattern emits the tests for matching the value in slot against
+// pattern p, appending the index of every JUMP_IF_FALSE taken on a failed
+// test to fails, and stores any names it binds.
+func (c *Compiler) compilePattern(slot int, p ast.Expression, fails *[]int) error {
+	switch n := p.(type) {
+	case *ast.VariableExpr:
+		if n.Name == "_" {
+			return nil
+		}
+		if _, isConst := c.fold(n); isConst {
+			// A constant compares against its value instead of binding.
+			break
+		}
+		c.emit(bytecode.LOAD_LOCAL, slot)
+		c.emit(bytecode.STORE_LOCAL, c.declareLocal(n.Name, c.varTypes[slot]))
+		c.emit(bytecode.POP, 0)
+		return nil
+	case *ast.CallExpr:
+		if v, ok := n.Func.(*ast.VariableExpr); ok && (v.Name == "ok" || v.Name == "err") && len(n.Args) == 1 {
+			c.emitFieldTest(slot, "tag", v.Name, fails)
+			return c.compileSubPattern(slot, valNil, "val", valNil, n.Args[0], fails)
+		}
+	case *ast.StructLiteralExpr:
+		if c.varTypes[slot] != valueType(n.TypeName) {
+			c.emitFieldTest(slot, typederror.StructTypeField, n.TypeName, fails)
+		}
+		names := make([]string, 0, len(n.Fields))
+		for name := range n.Fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			ft := c.structFields[n.TypeName][name]
+			if ft == "" {
+				ft = valNil
+			}
+			if err := c.compileSubPattern(slot, valueType(n.TypeName), name, ft, n.Fields[name], fails); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return c.compileValuePattern(slot, p, fails)
+}
+
+// compileSubPattern matches field of the value in slot, which the pattern
+// has already checked is an owner, against sub, via a fresh temporary local
+// (skipped entirely for a `_` sub-pattern).
+func (c *Compiler) compileSubPattern(slot int, owner valueType, field string, vt valueType, sub ast.Expression, fails *[]int) error {
+	if isWildcardPattern(sub) {
 		return nil
 	}
+	c.emit(bytecode.LOAD_LOCAL, slot)
+	c.emit(bytecode.GET_FIELD, c.fieldInfo(owner, field))
+	tmp := c.declareLocal(fmt.Sprintf("__match_%d__", c.fn.NumLocals), vt)
+	c.emit(bytecode.STORE_LOCAL, tmp)
+	c.emit(bytecode.POP, 0)
+	return c.compilePattern(tmp, sub, fails)
+}
+
+// emitFieldTest fails the pattern unless the value in slot has the string
+// want in field (a Result's tag, a struct's type name).
+func (c *Compiler) emitFieldTest(slot int, field, want string, fails *[]int) {
+	c.emit(bytecode.LOAD_LOCAL, slot)
+	c.emit(bytecode.GET_FIELD, c.fieldInfo(valNil, field))
+	c.emit(bytecode.PUSH_STR, c.mod.AddConstant(want))
+	c.emit(bytecode.EQ_STR, 0)
+	*fails = append(*fails, len(c.fn.Code))
+	c.emit(bytecode.JUMP_IF_FALSE, 0)
+}
+
+// compileValuePattern fails the pattern unless the value in slot equals
+// the pattern evaluated as an ordinary expression.
+func (c *Compiler) compileValuePattern(slot int, pattern ast.Expression, fails *[]int) error {
 	scrType := valNil
-	if scrutineeSlot < len(c.varTypes) {
-		scrType = c.varTypes[scrutineeSlot]
+	if slot < len(c.varTypes) {
+		scrType = c.varTypes[slot]
 	}
-	c.emit(bytecode.LOAD_LOCAL, scrutineeSlot)
+	c.emit(bytecode.LOAD_LOCAL, slot)
 	patType, err := c.compileExpr(pattern)
 	if err != nil {
 		return err
@@ -281,46 +572,15 @@ func (c *Compiler) compilePatternMatch(scrutineeSlot int, pattern ast.Expression
 		case patType == valNil && scrType != valNil:
 			opType = scrType
 		default:
-			return fmt.Errorf("compilePatternMatch: type mismatch %s vs %s", scrType, patType)
+			return fmt.Errorf("compileValuePattern: type mismatch %s vs %s", scrType, patType)
 		}
 	}
 	op, err := pickBinaryOp("==", opType)
 	if err != nil {
-		return fmt.Errorf("compilePatternMatch: %w", err)
+		return fmt.Errorf("compileValuePattern: %w", err)
 	}
 	c.emit(op, 0)
+	*fails = append(*fails, len(c.fn.Code))
+	c.emit(bytecode.JUMP_IF_FALSE, 0)
 	return nil
 }
-
-func (c *Compiler) compileMatch(n *ast.MatchStmt) error {
-	c.pushScope()
-	defer c.popScope()
-	scrType, err := c.compileExpr(n.Expr)
-	if err != nil {
-		return err
-	}
-	slot := c.declareLocal("__match__", scrType)
-	c.emit(bytecode.STORE_LOCAL, slot)
-	c.emit(bytecode.POP, 0)
-
-	endJumps := []int{}
-	for _, arm := range n.Arms {
-		if err := c.compilePatternMatch(slot, arm.Pattern); err != nil {
-			return err
-		}
-		skipIdx := len(c.fn.Code)
-		c.emit(bytecode.JUMP_IF_FALSE, 0)
-		if err := c.compileBlock(arm.Body); err != nil {
-			return err
-		}
-		endIdx := len(c.fn.Code)
-		c.emit(bytecode.JUMP, 0)
-		endJumps = append(endJumps, endIdx)
-		c.fn.Code[skipIdx].Arg = len(c.fn.Code)
-	}
-	matchEnd := len(c.fn.Code)
-	for _, idx := range endJumps {
-		c.fn.Code[idx].Arg = matchEnd
-	}
-	return nil
-}
\ No newline at end of file
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/jiejie-dev/funny/v2/internal/bytecode"
+	"github.com/jiejie-dev/funny/v2/internal/errs"
 	"github.com/jiejie-dev/funny/v2/internal/vm"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -94,6 +95,68 @@ func TestCompile_For(t *testing.T) {
 	assert.True(t, hasJump, "JUMP for loop back")
 }
 
+// TestCompile_ForRange_IsACounterLoop checks that a range loop builds no
+// list and calls no builtin, and that literal and variable steps (both
+// directions) all visit the right values.
+func TestCompile_ForRange_IsACounterLoop(t *testing.T) {
+	mod := compileExpr(t, `let seen = ""
+let n = 4
+let down = -2
+for i in 0..n:
+    seen = seen + to_str(i)
+for i in 1..10 step 3:
+    seen = seen + to_str(i)
+for i in 6..0 step down:
+    seen = seen + to_str(i)
+seen
+`)
+	for _, instr := range mod.Functions[0].Code {
+		assert.NotEqual(t, bytecode.BUILD_LIST, instr.Op)
+		assert.NotEqual(t, bytecode.RANGE, instr.Op)
+		if instr.Op == bytecode.CALL_BUILTIN {
+			assert.Equal(t, "to_str", mod.Constants[instr.Arg].(bytecode.BuiltinInfo).Name)
+		}
+	}
+	got, err := vm.New(mod).Run()
+	require.NoError(t, err)
+	assert.Equal(t, "0123147642", got)
+}
+
+func TestCompile_Range_ZeroStepFailsOnVM(t *testing.T) {
+	for _, src := range []string{
+		"let k = 0\nlet xs = 0..3 step k\nlen(xs)\n",
+		"let k = 0\nlet n = 0\nfor i in 0..3 step k:\n    n = n + 1\nn\n",
+	} {
+		_, err := vm.New(compileExpr(t, src)).Run()
+		require.Error(t, err, src)
+		var diag *errs.Error
+		require.ErrorAs(t, err, &diag, src)
+		assert.Equal(t, "E2011", diag.Code, src)
+		assert.Contains(t, diag.Message, "range step must not be zero", src)
+	}
+}
+
+func TestCompile_For_CallsLenOnce(t *testing.T) {
+	mod := compileExpr(t, `let xs = [1, 2]
+for x in xs:
+    xs[0] = x
+`)
+	var lens int
+	for _, instr := range mod.Functions[0].Code {
+		if instr.Op == bytecode.CALL_BUILTIN && mod.Constants[instr.Arg].(bytecode.BuiltinInfo).Name == "len" {
+			lens++
+		}
+	}
+	assert.Equal(t, 1, lens)
+}
+
+func TestCompile_RangeValue_BuildsList(t *testing.T) {
+	mod := compileExpr(t, "let xs = 0..10 step 4\nlen(xs) * 100 + xs[2]\n")
+	got, err := vm.New(mod).Run()
+	require.NoError(t, err)
+	assert.Equal(t, 308, got)
+}
+
 // TestCompile_For_RunsOnVM_VisitsEveryElement is a regression test for a
 // severe bug: compileFor initialized the loop index with a hardcoded
 // `Emit(bytecode.PUSH_INT, 0)`, i.e. Arg=0, which the VM interprets as
@@ -147,6 +210,49 @@ msg
 	assert.Equal(t, "not found", got)
 }
 
+func TestCompile_MatchPatterns_RunsOnVM(t *testing.T) {
+	mod := compileExpr(t, `struct User:
+    name: str
+    age: int
+fn half(n: int) -> Result:
+    if n % 2 == 1:
+        return err("odd")
+    return ok(n / 2)
+fn describe(u: User) -> str:
+    match u:
+        User(name: "root", age: _) =>
+            return "admin"
+        User(name: n, age: a) if a < 18 =>
+            return n + " (minor)"
+        User(name: n, age: _) =>
+            return n
+    return "?"
+let out = ""
+for x in 0..6:
+    match x:
+        1 | 2 =>
+            out = out + "s"
+        n if n > 3 =>
+            out = out + "b"
+        _ =>
+            out = out + "o"
+match half(8):
+    ok(v) =>
+        out = out + f" ok {v}"
+    err(e) =>
+        out = out + f" err {e}"
+match half(3):
+    ok(4) =>
+        out = out + " four"
+    err(e) =>
+        out = out + f" err {e}"
+out + " " + describe(User(name: "root", age: 40)) + "," + describe(User(name: "kid", age: 9)) + "," + describe(User(name: "ann", age: 30))
+`)
+	got, err := vm.New(mod).Run()
+	require.NoError(t, err)
+	assert.Equal(t, "ossobb ok 4 err odd admin,kid (minor),ann", got)
+}
+
 func TestCompile_BreakInWhile_RunsOnVM(t *testing.T) {
 	mod := compileExpr(t, `let x = 0
 while x < 10:
@@ -27,6 +27,25 @@ func (c *Compiler) compileList(n *ast.ListExpr) (valueType, error) {
 	return elemType, nil
 }
 
+// compileRange compiles a range used as a value (`let xs = 0..n`): start,
+// end and step (1 when omitted) are pushed and RANGE builds the list.
+// for-in loops over a range don't come through here; compileForRange
+// counts them without a list.
+func (c *Compiler) compileRange(n *ast.RangeExpr) (valueType, error) {
+	for _, e := range []ast.Expression{n.Start, n.End} {
+		if _, err := c.compileExpr(e); err != nil {
+			return "", err
+		}
+	}
+	if n.Step == nil {
+		c.emit(bytecode.PUSH_INT, c.mod.AddConstant(1))
+	} else if _, err := c.compileExpr(n.Step); err != nil {
+		return "", err
+	}
+	c.emit(bytecode.RANGE, 0)
+	return valInt, nil
+}
+
 // compileIndex compiles a[b] (object on stack, then index, then INDEX).
 //
 // Returns the same valueType as the indexed object itself. That looks
@@ -39,13 +58,29 @@ func (c *Compiler) compileList(n *ast.ListExpr) (valueType, error) {
 // moment an index was taken, even though the compiler knew the element
 // type going in. (String indexing also produces a same-type result: one
 // character back as a string - see internal/vm/instructions.go's
-// execIndex. Map values aren't tracked by this compiler at all, so
-// map-typed objects report valNil either way, same as before.)
+// execIndex. A map's tracked valueType is likewise its value type - see
+// compileMapLiteral - so indexing a map reproduces it too.)
+//
+// A slice `a[lo:hi]` pushes both bounds instead (PUSH_NIL for an omitted
+// one) and emits SLICE; it too keeps the object's valueType.
 func (c *Compiler) compileIndex(n *ast.IndexExpr) (valueType, error) {
 	objType, err := c.compileExpr(n.Object)
 	if err != nil {
 		return "", err
 	}
+	if n.Slice {
+		for _, b := range []ast.Expression{n.Low, n.High} {
+			if b == nil {
+				c.emit(bytecode.PUSH_NIL, 0)
+				continue
+			}
+			if _, err := c.compileExpr(b); err != nil {
+				return "", err
+			}
+		}
+		c.emit(bytecode.SLICE, 0)
+		return objType, nil
+	}
 	if _, err := c.compileExpr(n.Index); err != nil {
 		return "", err
 	}
@@ -53,7 +88,7 @@ func (c *Compiler) compileIndex(n *ast.IndexExpr) (valueType, error) {
 	return objType, nil
 }
 
-// compileField compiles a.b (push object, push field name as string, GET_FIELD).
+// compileField compiles a.b (push object, GET_FIELD; see fieldInfo).
 // If the object's value type is a recognized struct name (see
 // annotationValueType/compileStructLiteral), looks up the field's real
 // declared type from c.structFields so it participates correctly in typed
@@ -72,9 +107,7 @@ func (c *Compiler) compileField(n *ast.FieldExpr) (valueType, error) {
 	if err != nil {
 		return "", err
 	}
-	nameIdx := c.mod.AddConstant(n.Field)
-	c.emit(bytecode.PUSH_STR, nameIdx)
-	c.emit(bytecode.GET_FIELD, 0)
+	c.emit(bytecode.GET_FIELD, c.fieldInfo(objType, n.Field))
 	if fields, ok := c.structFields[string(objType)]; ok {
 		if ft, ok := fields[n.Field]; ok {
 			return ft, nil
@@ -86,39 +119,122 @@ func (c *Compiler) compileField(n *ast.FieldExpr) (valueType, error) {
 	return valNil, nil
 }
 
-// compileMapLiteral compiles {k: v, ...} into BUILD_MAP n. Empty map literals
-// are rejected by the type checker before compilation is reached.
+// fieldInfo returns the constant index of GET_FIELD/SET_FIELD's operand
+// for field of a value of type objType: the field's slot when objType is
+// a struct that declares it, else -1, which makes the VM look the field up
+// by name.
+func (c *Compiler) fieldInfo(objType valueType, field string) int {
+	slot := -1
+	if decl, ok := c.structDecls[string(objType)]; ok {
+		for i, f := range decl.Fields {
+			if f.Name == field {
+				slot = i
+				break
+			}
+		}
+	}
+	return c.mod.AddConstant(bytecode.FieldInfo{Name: field, Slot: slot})
+}
+
+// structInfo returns the constant index of the StructInfo for decl,
+// adding it on first use.
+func (c *Compiler) structInfo(decl *ast.StructDecl) int {
+	if idx, ok := c.structInfos[decl.Name]; ok {
+		return idx
+	}
+	info := &bytecode.StructInfo{Name: decl.Name, Fields: make([]string, len(decl.Fields))}
+	for i, f := range decl.Fields {
+		info.Fields[i] = f.Name
+	}
+	idx := c.mod.AddConstant(info)
+	c.structInfos[decl.Name] = idx
+	return idx
+}
+
+// compileMapLiteral compiles {k: v, ...} into BUILD_MAP n. Like
+// compileList, it returns the uniform value type if all values agree
+// (what indexing the map produces), otherwise valNil.
 func (c *Compiler) compileMapLiteral(n *ast.MapLiteralExpr) (valueType, error) {
+	var valType valueType = valNil
 	for i, k := range n.Keys {
 		if _, err := c.compileExpr(k); err != nil {
 			return "", err
 		}
-		if _, err := c.compileExpr(n.Values[i]); err != nil {
+		vt, err := c.compileExpr(n.Values[i])
+		if err != nil {
 			return "", err
 		}
+		if i == 0 {
+			valType = vt
+		} else if vt != valType {
+			valType = valNil
+		}
 	}
 	c.emit(bytecode.BUILD_MAP, len(n.Keys))
-	return valNil, nil
+	return valType, nil
 }
 
-// compileStructLiteral compiles Point(x: 1, y: 2) into BUILD_MAP + NEW_STRUCT.
+// compileSetLiteral compiles set{a, b, ...} into BUILD_SET n. Its
+// valueType is setType of the uniform element type, or of valNil when the
+// elements' types disagree or aren't tracked.
+func (c *Compiler) compileSetLiteral(n *ast.SetLiteralExpr) (valueType, error) {
+	var elemType valueType = valNil
+	for i, e := range n.Elements {
+		vt, err := c.compileExpr(e)
+		if err != nil {
+			return "", err
+		}
+		if i == 0 {
+			elemType = vt
+		} else if vt != elemType {
+			elemType = valNil
+		}
+	}
+	c.emit(bytecode.BUILD_SET, len(n.Elements))
+	return setType(elemType), nil
+}
+
+// compileStructLiteral compiles Point(x: 1, y: 2) into the field values, in
+// declaration order, and NEW_STRUCT.
 // Returns the struct's own name as its valueType (see annotationValueType),
 // so a `let p = Point(...)` local (or a struct-typed function
 // param/return) carries enough static type info for compileField to look
 // up its real field types later.
+//
+// Fields are evaluated in declaration order, whatever order the literal
+// gives them in. Fields the literal omits are filled by compiling their
+// declared default expression in place, so each literal gets a fresh
+// value (two literals never share one default list). If the struct has a `validate` method the
+// new value is passed to it and WRAP_VALIDATED turns the pair into the
+// literal's Result; like compileTry, the struct's name is still returned
+// as the valueType so `User(...)?` stays typed.
 func (c *Compiler) compileStructLiteral(n *ast.StructLiteralExpr) (valueType, error) {
-	if len(n.Fields) == 0 {
-		return "", fmt.Errorf("empty struct literal")
+	decl := c.structDecls[n.TypeName]
+	if decl == nil {
+		return "", fmt.Errorf("compileStructLiteral: unknown struct %s", n.TypeName)
 	}
-	for k, v := range n.Fields {
-		nameIdx := c.mod.AddConstant(k)
-		c.emit(bytecode.PUSH_STR, nameIdx)
+	for _, f := range decl.Fields {
+		v, given := n.Fields[f.Name]
+		if !given {
+			v = f.Default
+		}
+		if v == nil {
+			return "", fmt.Errorf("compileStructLiteral: %s.%s has no value", n.TypeName, f.Name)
+		}
 		if _, err := c.compileExpr(v); err != nil {
 			return "", err
 		}
 	}
-	c.emit(bytecode.BUILD_MAP, len(n.Fields))
-	typeIdx := c.mod.AddConstant(n.TypeName)
-	c.emit(bytecode.NEW_STRUCT, typeIdx)
+	c.pos = n.Pos()
+	c.emit(bytecode.NEW_STRUCT, c.structInfo(decl))
+	if decl != nil && decl.Method("validate") != nil {
+		fnIdx, ok := c.lookupFunction(methodFuncName(n.TypeName, "validate"))
+		if !ok {
+			return "", fmt.Errorf("compileStructLiteral: %s.validate not declared", n.TypeName)
+		}
+		c.emit(bytecode.DUP, 0)
+		c.emit(bytecode.CALL, fnIdx)
+		c.emit(bytecode.WRAP_VALIDATED, 0)
+	}
 	return valueType(n.TypeName), nil
-}
\ No newline at end of file
+}
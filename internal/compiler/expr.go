@@ -10,7 +10,12 @@ import (
 
 func (c *Compiler) compileExpr(e ast.Expression) (valueType, error) {
 	c.pos = e.Pos()
+	if v, ok := c.fold(e); ok {
+		return c.compileLiteral(&ast.LiteralExpr{NodePos: e.Pos(), Value: v})
+	}
 	switch n := e.(type) {
+	case *ast.SubExpr:
+		return c.compileExpr(n.Inner)
 	case *ast.LiteralExpr:
 		return c.compileLiteral(n)
 	case *ast.VariableExpr:
@@ -25,8 +30,12 @@ func (c *Compiler) compileExpr(e ast.Expression) (valueType, error) {
 		return c.compileList(n)
 	case *ast.MapLiteralExpr:
 		return c.compileMapLiteral(n)
+	case *ast.SetLiteralExpr:
+		return c.compileSetLiteral(n)
 	case *ast.IndexExpr:
 		return c.compileIndex(n)
+	case *ast.RangeExpr:
+		return c.compileRange(n)
 	case *ast.FieldExpr:
 		return c.compileField(n)
 	case *ast.StructLiteralExpr:
@@ -124,10 +133,15 @@ func (c *Compiler) compileBinary(n *ast.BinaryExpr) (valueType, error) {
 		if _, err := c.compileExpr(n.Left); err != nil {
 			return "", err
 		}
-		if _, err := c.compileExpr(n.Right); err != nil {
+		rightType, err := c.compileExpr(n.Right)
+		if err != nil {
 			return "", err
 		}
-		c.emit(bytecode.IN_LIST, 0)
+		if _, ok := rightType.setElem(); ok {
+			c.emit(bytecode.IN_SET, 0)
+		} else {
+			c.emit(bytecode.IN_LIST, 0)
+		}
 		return valBool, nil
 	}
 	leftOp, err := c.compileExpr(n.Left)
@@ -238,6 +252,9 @@ func pickBinaryOp(op string, lhs valueType) (bytecode.OpCode, error) {
 			return bytecode.EQ_NIL, nil
 		case valFloat:
 			return bytecode.EQ_FLOAT, nil
+		default:
+			// A struct or interface value: compared field by field.
+			return bytecode.EQ_VALUE, nil
 		}
 	case "<":
 		switch lhs {
@@ -276,7 +293,7 @@ func pickBinaryOp(op string, lhs valueType) (bytecode.OpCode, error) {
 			return bytecode.OR_BOOL, nil
 		}
 	}
-	return "", fmt.Errorf("pickBinaryOp: unsupported op %s for %s", op, lhs)
+	return 0, fmt.Errorf("pickBinaryOp: unsupported op %s for %s", op, lhs)
 }
 
 func (c *Compiler) compileUnary(n *ast.UnaryExpr) (valueType, error) {
@@ -91,6 +91,21 @@ func TestCompile_Assign_IndexIntoList_RunsOnVM(t *testing.T) {
 	assert.Equal(t, 99, got)
 }
 
+func TestCompile_Slice_EmitsSliceAndRunsOnVM(t *testing.T) {
+	src := "let xs = [1, 2, 3, 4, 5]\nlet ys = xs[1:-1]\nys[0] = 99\nlet s = \"héllo\"\nto_str(len(ys)) + s[:2] + s[-2:] + to_str(xs[1]) + to_str(xs[:][4])\n"
+	mod := compileExpr(t, src)
+	var slices int
+	for _, instr := range mod.Functions[0].Code {
+		if instr.Op == bytecode.SLICE {
+			slices++
+		}
+	}
+	assert.Equal(t, 4, slices)
+	got, err := vm.New(mod).Run()
+	require.NoError(t, err)
+	assert.Equal(t, "3hélo25", got, "a list slice is a copy")
+}
+
 func TestCompile_FString_ProducesFormatValueAndAddStr(t *testing.T) {
 	mod := compileExpr(t, "let name = \"world\"\nf\"hi {name}!\"\n")
 	fn := mod.Functions[0]
@@ -230,18 +245,28 @@ func TestCompile_Field(t *testing.T) {
     x: int
     y: int
 
-let p = Point(x: 1, y: 2)
-p.x
+let p = Point(y: 2, x: 1)
+p.y
 `)
 	fn := mod.Functions[0]
-	var hasGetField bool
+	var fields []bytecode.FieldInfo
+	var info *bytecode.StructInfo
 	for _, instr := range fn.Code {
-		if instr.Op == bytecode.GET_FIELD {
-			hasGetField = true
-			break
+		switch instr.Op {
+		case bytecode.GET_FIELD:
+			fields = append(fields, mod.Constants[instr.Arg].(bytecode.FieldInfo))
+		case bytecode.NEW_STRUCT:
+			info = mod.Constants[instr.Arg].(*bytecode.StructInfo)
 		}
 	}
-	assert.True(t, hasGetField)
+	// The field resolves to its declaration slot; the literal's values
+	// are pushed in declaration order.
+	assert.Equal(t, []bytecode.FieldInfo{{Name: "y", Slot: 1}}, fields)
+	require.NotNil(t, info)
+	assert.Equal(t, []string{"x", "y"}, info.Fields)
+	got, err := vm.New(mod).Run()
+	require.NoError(t, err)
+	assert.Equal(t, 2, got)
 }
 
 func TestCompile_InList_EmitsOpcode(t *testing.T) {
@@ -273,3 +298,134 @@ func TestCompile_InList_RunsOnVM(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, false, got3)
 }
+
+func TestCompile_Const_FoldsToSinglePush(t *testing.T) {
+	mod := compileExpr(t, "const A = 6\nconst B = A * 7\nB - A\n")
+	fn := mod.Functions[0]
+	require.Len(t, fn.Code, 2)
+	assert.Equal(t, bytecode.PUSH_INT, fn.Code[0].Op)
+	assert.Equal(t, 36, mod.Constants[fn.Code[0].Arg])
+}
+
+func TestCompile_Const_UsedInFunctionsAndPatterns_RunsOnVM(t *testing.T) {
+	src := `const LIMIT = 2 + 1
+const PREFIX = "n="
+
+fn label(n: int) -> str:
+    match n:
+        LIMIT =>
+            return PREFIX + "limit"
+        _ =>
+            return PREFIX + to_str(n)
+
+let total = 0
+for i in 0..10 step LIMIT:
+    total = total + i
+label(LIMIT) + " " + label(total)
+`
+	mod := compileExpr(t, src)
+	got, err := vm.New(mod).Run()
+	require.NoError(t, err)
+	assert.Equal(t, "n=limit n=18", got)
+}
+
+func TestCompile_DecodeEncodeJSON_RunsOnVM(t *testing.T) {
+	src := `struct Item:
+    @json("item_name")
+    name: str
+    price: float
+    note: str?
+
+struct Order:
+    items: list[Item]
+
+fn total(s: str) -> str:
+    match decode_json(Order, s):
+        ok(o) =>
+            let sum = 0.0
+            for it in o.items:
+                sum = sum + it.price
+            return to_str(sum)
+        err(e) =>
+            return e
+
+let good = "{\"items\": [{\"item_name\": \"a\", \"price\": 1.5}, {\"item_name\": \"b\", \"price\": 2}]}"
+let bad = "{\"items\": [{\"item_name\": \"a\", \"price\": \"x\"}]}"
+total(good) + " | " + total(bad) + " | " + encode_json(Item(name: "c", price: 3.0, note: nil))
+`
+	mod := compileExpr(t, src)
+	got, err := vm.New(mod).Run()
+	require.NoError(t, err)
+	assert.Equal(t, `3.5 | $.items[0].price: expected float, got string | {"item_name":"c","note":null,"price":3}`, got)
+}
+
+func TestCompile_DecodeJSON_AppliesDefaultsAndValidate_RunsOnVM(t *testing.T) {
+	src := `struct P:
+    a: int
+    b: str = "d"
+    fn validate(self) -> Result:
+        if self.a < 0:
+            return err("a is negative")
+        return ok(self)
+
+struct Box:
+    items: list[P]
+
+fn show(s: str) -> str:
+    match decode_json(Box, s):
+        ok(box) =>
+            let out = ""
+            for p in box.items:
+                out = out + p.b
+            return out
+        err(e) =>
+            return e
+
+show("{\"items\": [{\"a\": 1}, {\"a\": 2, \"b\": \"x\"}]}") + " | " + show("{\"items\": [{\"a\": -1}]}")
+`
+	mod := compileExpr(t, src)
+	got, err := vm.New(mod).Run()
+	require.NoError(t, err)
+	assert.Equal(t, "dx | $.items[0]: a is negative", got)
+}
+
+func TestCompile_Sets_RunOnVM(t *testing.T) {
+	src := `let seen = set{3, 1, 3}
+let more: set[int] = set_union(seen, to_set([2, 1]))
+let order = ""
+for x in more:
+    order = order + to_str(x)
+let common = set_intersection(more, set{1, 2, 9})
+order + to_str(len(common)) + to_str(2 in more) + to_str(5 in more)
+`
+	mod := compileExpr(t, src)
+	var ops []bytecode.OpCode
+	for _, ins := range mod.Functions[0].Code {
+		ops = append(ops, ins.Op)
+	}
+	assert.Contains(t, ops, bytecode.BUILD_SET)
+	assert.Contains(t, ops, bytecode.IN_SET)
+	got, err := vm.New(mod).Run()
+	require.NoError(t, err)
+	assert.Equal(t, "3122truefalse", got)
+}
+
+func TestCompile_MapKeysAndEquality_RunOnVM(t *testing.T) {
+	src := `struct Point:
+    x: int
+    y: int
+
+let names: map[int, str] = {}
+names[1] = "one"
+names[2] = "two"
+let hits = {Point(x: 1, y: 2): "a"}
+hits[Point(x: 1, y: 2)] = "b"
+let same = [Point(x: 0, y: 0)] == [Point(x: 0, y: 0)]
+let found = Point(x: 3, y: 4) in [Point(x: 1, y: 1), Point(x: 3, y: 4)]
+names[1] + names[2] + hits[Point(x: 1, y: 2)] + to_str(len(hits)) + to_str(same) + to_str(found)
+`
+	mod := compileExpr(t, src)
+	got, err := vm.New(mod).Run()
+	require.NoError(t, err)
+	assert.Equal(t, "onetwob1truetrue", got)
+}
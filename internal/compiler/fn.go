@@ -3,10 +3,12 @@ package compiler
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/jiejie-dev/funny/v2/internal/ast"
 	"github.com/jiejie-dev/funny/v2/internal/bytecode"
+	"github.com/jiejie-dev/funny/v2/internal/stdlib"
 )
 
 // builtinNames lists functions that compile to CALL_BUILTIN instead of CALL.
@@ -27,6 +29,8 @@ var builtinNames = map[string]bool{
 	"err":           true,
 	"to_json":       true,
 	"parse_json":    true,
+	"decode_json":   true,
+	"encode_json":   true,
 	"now":           true,
 	"time_format":   true,
 	"sqrt":          true,
@@ -52,6 +56,11 @@ var builtinNames = map[string]bool{
 	"append":        true,
 	"assert":        true,
 	"assert_eq":     true,
+	// Sets; see stdlib.Set.
+	"to_set":           true,
+	"set_union":        true,
+	"set_intersection": true,
+	"set_difference":   true,
 }
 
 // compileFnDecl compiles a function declaration into a separate Function in
@@ -66,11 +75,25 @@ func (c *Compiler) compileFnDecl(n *ast.FnDecl) error {
 	if _, ok := c.functions[n.Name]; ok {
 		return fmt.Errorf("function %s already declared", n.Name)
 	}
-	fn := &bytecode.Function{Name: n.Name, Arity: len(n.Params)}
-	fnIdx := c.mod.AddFunction(fn)
-	c.functions[n.Name] = fnIdx
-	c.fnRetTypes[n.Name] = annotationValueType(n.RetType, c.structFields)
+	fn := c.declareFunction(n.Name, n)
+	return c.compileFnBody(fn, n)
+}
+
+// declareFunction adds an empty Function for decl to the module, and to
+// its export table, under name and records its index and return value
+// type, so calls to it (including recursive ones from its own body) can be
+// compiled before its body is.
+func (c *Compiler) declareFunction(name string, decl *ast.FnDecl) *bytecode.Function {
+	fn := &bytecode.Function{Name: name, Arity: len(decl.Params)}
+	c.functions[name] = c.mod.AddFunction(fn)
+	c.mod.Export(name, c.functions[name])
+	c.fnRetTypes[name] = c.annotationValueType(decl.RetType)
+	return fn
+}
 
+// compileFnBody compiles n's body into fn. A method's `self` receiver
+// has no type annotation; its value type is the receiver struct's name.
+func (c *Compiler) compileFnBody(fn *bytecode.Function, n *ast.FnDecl) error {
 	outerFn := c.fn
 	outerScopes := c.scopes
 	outerVarTypes := c.varTypes
@@ -78,8 +101,12 @@ func (c *Compiler) compileFnDecl(n *ast.FnDecl) error {
 	c.fn = fn
 	c.scopes = []map[string]int{{}}
 	c.varTypes = nil
-	for _, p := range n.Params {
-		c.declareLocal(p.Name, annotationValueType(p.TypeAnn, c.structFields))
+	for i, p := range n.Params {
+		vt := c.annotationValueType(p.TypeAnn)
+		if i == 0 && n.Receiver != "" {
+			vt = valueType(n.Receiver)
+		}
+		c.declareLocal(p.Name, vt)
 	}
 	if err := c.compileBlock(n.Body); err != nil {
 		return err
@@ -92,6 +119,32 @@ func (c *Compiler) compileFnDecl(n *ast.FnDecl) error {
 	return nil
 }
 
+// compileStructDecl compiles a struct's methods into ordinary module
+// functions named "Struct.method", taking the receiver as their first
+// argument. All of them are declared before any body is compiled so
+// methods can call each other through self in any order.
+func (c *Compiler) compileStructDecl(n *ast.StructDecl) error {
+	fns := make([]*bytecode.Function, len(n.Methods))
+	for i, m := range n.Methods {
+		name := methodFuncName(n.Name, m.Name)
+		if _, ok := c.functions[name]; ok {
+			return fmt.Errorf("method %s already declared", name)
+		}
+		fns[i] = c.declareFunction(name, m)
+	}
+	for i, m := range n.Methods {
+		c.pos = m.Pos()
+		if err := c.compileFnBody(fns[i], m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func methodFuncName(structName, method string) string {
+	return structName + "." + method
+}
+
 // annotationValueType maps a type annotation string to a valueType so that
 // subsequent variable lookups produce the correct operand type for
 // type-sensitive operators like `+`. Struct names resolve to a valueType
@@ -99,8 +152,10 @@ func (c *Compiler) compileFnDecl(n *ast.FnDecl) error {
 // so `p.x` on a `p: Point` parameter or `let p = Point(...)` can look up
 // Point's real field types instead of guessing. Anything else structurally
 // untracked (list[T], map[K,V], T?, an unrecognized name) falls back to
-// valNil ("unknown").
-func annotationValueType(ann string, structFields map[string]map[string]valueType) valueType {
+// valNil ("unknown"). Interface names are tracked the same way as struct
+// names, so compileMethodCall knows to dispatch dynamically; an alias maps
+// to its target's value type.
+func (c *Compiler) annotationValueType(ann string) valueType {
 	switch ann {
 	case "int":
 		return valInt
@@ -120,35 +175,113 @@ func annotationValueType(ann string, structFields map[string]map[string]valueTyp
 	// (`if x > 0:`).
 	if inner, ok := strings.CutPrefix(ann, "list["); ok {
 		if elem, ok := strings.CutSuffix(inner, "]"); ok {
-			return annotationValueType(elem, structFields)
+			return c.annotationValueType(elem)
+		}
+	}
+	// A map likewise reports its *value* type, which is what indexing it
+	// produces (see compileIndex).
+	if inner, ok := strings.CutPrefix(ann, "map["); ok {
+		if kv, ok := strings.CutSuffix(inner, "]"); ok {
+			depth := 0
+			for i, r := range kv {
+				switch r {
+				case '[':
+					depth++
+				case ']':
+					depth--
+				case ',':
+					if depth == 0 {
+						return c.annotationValueType(strings.TrimSpace(kv[i+1:]))
+					}
+				}
+			}
+		}
+	}
+	if inner, ok := strings.CutPrefix(ann, "set["); ok {
+		if elem, ok := strings.CutSuffix(inner, "]"); ok {
+			return setType(c.annotationValueType(elem))
 		}
 	}
-	if _, ok := structFields[ann]; ok {
+	if _, ok := c.structFields[ann]; ok {
 		return valueType(ann)
 	}
+	if _, ok := c.interfaces[ann]; ok {
+		return valueType(ann)
+	}
+	if target, ok := c.aliases[ann]; ok {
+		return c.annotationValueType(target)
+	}
 	return valNil
 }
 
-// compileReturn compiles a return statement.
+// compileReturn compiles a return statement. Returning a call to a
+// user-defined function from inside a function is a tail call: its CALL
+// becomes TAIL_CALL, so the callee reuses the frame and tail recursion
+// runs in constant stack. The RETURN after it still returns the result
+// when the VM can't reuse the frame (see vm.execTailCall).
 func (c *Compiler) compileReturn(n *ast.ReturnStmt) error {
 	c.pos = n.Pos()
 	if n.Value != nil {
 		if _, err := c.compileExpr(n.Value); err != nil {
 			return err
 		}
+		if _, isCall := n.Value.(*ast.CallExpr); isCall && c.fn != c.mod.Functions[0] {
+			if last := len(c.fn.Code) - 1; c.fn.Code[last].Op == bytecode.CALL {
+				c.fn.Code[last].Op = bytecode.TAIL_CALL
+			}
+		}
 	}
 	c.emit(bytecode.RETURN, 0)
 	return nil
 }
 
+// compileDefer compiles `defer f(args)`. The call is compiled as usual and
+// its final call instruction swapped for DEFER, so the callee's arguments
+// (and a method's receiver) are evaluated now and captured by the frame,
+// and the call itself runs when the frame returns:
+//
+//	<args>
+//	DEFER DeferInfo{CALL fnIdx, arity}
+func (c *Compiler) compileDefer(n *ast.DeferStmt) error {
+	if c.fn == c.mod.Functions[0] {
+		return fmt.Errorf("defer outside a function")
+	}
+	if _, err := c.compileCall(n.Call); err != nil {
+		return err
+	}
+	last := len(c.fn.Code) - 1
+	call := c.fn.Code[last]
+	switch call.Op {
+	case bytecode.CALL, bytecode.CALL_BUILTIN, bytecode.CALL_METHOD:
+	default:
+		return fmt.Errorf("compileDefer: call compiled to %s", call.Op)
+	}
+	c.fn.Code = c.fn.Code[:last]
+	c.fn.Locations = c.fn.Locations[:last]
+	arity := len(n.Call.Args)
+	if _, isMethod := n.Call.Func.(*ast.FieldExpr); isMethod {
+		arity++
+	}
+	c.pos = n.Pos()
+	infoIdx := c.mod.AddConstant(bytecode.DeferInfo{Op: call.Op, Arg: call.Arg, Arity: arity})
+	c.emit(bytecode.DEFER, infoIdx)
+	return nil
+}
+
 // compileCall compiles a function call expression.
 func (c *Compiler) compileCall(n *ast.CallExpr) (valueType, error) {
 	c.pos = n.Pos()
+	if fe, ok := n.Func.(*ast.FieldExpr); ok {
+		return c.compileMethodCall(n, fe)
+	}
 	varName, ok := n.Func.(*ast.VariableExpr)
 	if !ok {
 		return "", fmt.Errorf("compileCall: only direct function calls supported (got %T)", n.Func)
 	}
 	name := varName.Name
+	if name == "decode_json" || name == "encode_json" {
+		return c.compileJSONCall(n, name)
+	}
 	if builtinNames[name] {
 		argTypes := make([]valueType, len(n.Args))
 		for i, arg := range n.Args {
@@ -162,8 +295,11 @@ func (c *Compiler) compileCall(n *ast.CallExpr) (valueType, error) {
 		c.emit(bytecode.CALL_BUILTIN, nameIdx)
 		return builtinValueType(name, argTypes), nil
 	}
-	fnIdx, ok := c.functions[name]
+	fnIdx, ok := c.lookupFunction(name)
 	if !ok {
+		if lit, isLit := n.EmptyStructLiteral(); isLit && c.structDecls[name] != nil {
+			return c.compileStructLiteral(lit)
+		}
 		return "", fmt.Errorf("undefined function: %s", name)
 	}
 	for _, arg := range n.Args {
@@ -175,6 +311,115 @@ func (c *Compiler) compileCall(n *ast.CallExpr) (valueType, error) {
 	return c.fnRetTypes[name], nil
 }
 
+// compileJSONCall compiles decode_json(Type, s) and encode_json(v): the
+// schema built from the program's struct declarations is pushed as a
+// string ahead of the value argument (see stdlib.Schema).
+func (c *Compiler) compileJSONCall(n *ast.CallExpr, name string) (valueType, error) {
+	decls := stdlib.TypeDecls{Structs: c.structDecls, Aliases: c.aliases}
+	want := 1
+	if name == "decode_json" {
+		want = 2
+	}
+	if len(n.Args) != want {
+		return "", fmt.Errorf("%s expects %d args, got %d", name, want, len(n.Args))
+	}
+	schema := stdlib.EncodeSchema(decls)
+	value := n.Args[0]
+	if name == "decode_json" {
+		typeName, ok := n.Args[0].(*ast.VariableExpr)
+		if !ok {
+			return "", fmt.Errorf("decode_json: first argument must be a struct name")
+		}
+		var err error
+		if schema, err = stdlib.DecodeSchema(typeName.Name, decls); err != nil {
+			return "", err
+		}
+		value = n.Args[1]
+	}
+	if err := c.compileFieldDefaults(schema); err != nil {
+		return "", err
+	}
+	c.pos = n.Pos()
+	c.emit(bytecode.PUSH_STR, c.mod.AddConstant(schema.Encode()))
+	if _, err := c.compileExpr(value); err != nil {
+		return "", err
+	}
+	c.pos = n.Pos()
+	nameIdx := c.mod.AddConstant(bytecode.BuiltinInfo{Name: name, Arity: 2})
+	c.emit(bytecode.CALL_BUILTIN, nameIdx)
+	if name == "encode_json" {
+		return valStr, nil
+	}
+	return valNil, nil
+}
+
+// compileFieldDefaults adds to the module, once, a function returning the
+// declared default of each defaulted field of the structs in a
+// decode_json schema: "Struct.field.default" (see defaultFuncName). The
+// VM calls them by name for the fields a document omits, as it calls
+// "Struct.validate" on each decoded struct.
+func (c *Compiler) compileFieldDefaults(schema *stdlib.Schema) error {
+	names := make([]string, 0, len(schema.Structs))
+	for name := range schema.Structs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, f := range c.structDecls[name].Fields {
+			fnName := defaultFuncName(name, f.Name)
+			if _, done := c.functions[fnName]; done || f.Default == nil {
+				continue
+			}
+			thunk := &ast.FnDecl{NodePos: f.Default.Pos(), Name: fnName, Body: &ast.Block{
+				NodePos:    f.Default.Pos(),
+				Statements: []ast.Statement{&ast.ReturnStmt{NodePos: f.Default.Pos(), Value: f.Default}},
+			}}
+			fn := &bytecode.Function{Name: fnName}
+			c.functions[fnName] = c.mod.AddFunction(fn)
+			if err := c.compileFnBody(fn, thunk); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// defaultFuncName names the function compileFieldDefaults compiles for
+// a field's default; the VM builds the same name to call it.
+func defaultFuncName(structName, field string) string {
+	return structName + "." + field + ".default"
+}
+
+// compileMethodCall compiles `obj.method(args)`, with the receiver pushed
+// as the first argument. When the receiver's struct is known statically
+// from its value type this is a direct CALL of the "Struct.method"
+// function; otherwise (an interface-typed value, or one whose type the
+// compiler doesn't track) it emits CALL_METHOD, which the VM resolves
+// against the receiver's runtime struct type.
+func (c *Compiler) compileMethodCall(n *ast.CallExpr, fe *ast.FieldExpr) (valueType, error) {
+	objType, err := c.compileExpr(fe.Object)
+	if err != nil {
+		return "", err
+	}
+	for _, arg := range n.Args {
+		if _, err := c.compileExpr(arg); err != nil {
+			return "", err
+		}
+	}
+	c.pos = n.Pos()
+	name := methodFuncName(string(objType), fe.Field)
+	if fnIdx, ok := c.lookupFunction(name); ok {
+		c.emit(bytecode.CALL, fnIdx)
+		return c.fnRetTypes[name], nil
+	}
+	infoIdx := c.mod.AddConstant(bytecode.MethodInfo{Name: fe.Field, Arity: len(n.Args)})
+	c.emit(bytecode.CALL_METHOD, infoIdx)
+	if methods, ok := c.interfaces[string(objType)]; ok {
+		return methods[fe.Field], nil
+	}
+	return valNil, nil
+}
+
 // builtinValueType returns the concrete compiler-tracked value type a
 // builtin call produces, so `len(x) > 0` / `sqrt(x) < 1.0` / etc. can pick
 // a typed comparison opcode the same way a literal or `let`-bound local
@@ -209,6 +454,17 @@ func builtinValueType(name string, argTypes []valueType) valueType {
 		return valStr
 	case "str_contains", "regex_match", "file_exists":
 		return valBool
+	case "to_set":
+		// A list's valueType is its element type (see compileList).
+		if len(argTypes) == 1 {
+			return setType(argTypes[0])
+		}
+	case "set_union", "set_intersection", "set_difference":
+		if len(argTypes) > 0 {
+			if _, ok := argTypes[0].setElem(); ok {
+				return argTypes[0]
+			}
+		}
 	}
 	return valNil
 }
@@ -2,11 +2,14 @@
 package compiler
 
 import (
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
 	"github.com/jiejie-dev/funny/v2/internal/bytecode"
+	"github.com/jiejie-dev/funny/v2/internal/parser"
+	"github.com/jiejie-dev/funny/v2/internal/stdlib"
 	"github.com/jiejie-dev/funny/v2/internal/vm"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -62,6 +65,60 @@ func TestCompile_Return(t *testing.T) {
 	assert.True(t, hasReturn)
 }
 
+func TestCompile_TailCall(t *testing.T) {
+	src := `fn count(n: int, acc: int) -> int:
+    if n == 0:
+        return acc
+    return count(n - 1, acc + 1)
+
+fn twice(n: int) -> int:
+    return count(n, 0) + count(n, 0)
+
+count(3, 0)
+`
+	mod := compileExpr(t, src)
+	ops := func(fn *bytecode.Function) []bytecode.OpCode {
+		var out []bytecode.OpCode
+		for _, instr := range fn.Code {
+			out = append(out, instr.Op)
+		}
+		return out
+	}
+	count := ops(mod.Functions[1])
+	require.Contains(t, count, bytecode.TAIL_CALL)
+	assert.NotContains(t, count, bytecode.CALL)
+	assert.NotContains(t, ops(mod.Functions[2]), bytecode.TAIL_CALL, "a call whose result is added to isn't in tail position")
+	assert.NotContains(t, ops(mod.Functions[0]), bytecode.TAIL_CALL, "top-level code has no frame to reuse")
+}
+
+// TestCompile_TailCall_WithDefer checks that a frame with deferred calls
+// isn't reused by its tail call: the defers still run after the callee
+// returns, and its result is still returned.
+func TestCompile_TailCall_WithDefer(t *testing.T) {
+	src := `struct Log:
+    mut s: str
+
+    fn add(mut self, x: str):
+        self.s = self.s + x
+
+fn inner(l: Log) -> int:
+    l.add("inner ")
+    return 7
+
+fn outer(l: Log) -> int:
+    defer l.add("outer-defer")
+    return inner(l)
+
+let l = Log(s: "")
+let r = outer(l)
+to_str(r) + " " + l.s
+`
+	mod := compileExpr(t, src)
+	got, err := vm.New(mod).Run()
+	require.NoError(t, err)
+	assert.Equal(t, "7 inner outer-defer", got)
+}
+
 // Regression test: compileFnDecl used to reset c.scopes to a brand-new
 // empty map (instead of saving/restoring the enclosing scope) after
 // compiling a function body, so any top-level local declared *before* the
@@ -376,3 +433,232 @@ func TestBuiltinValueType(t *testing.T) {
 		assert.Equal(t, c.want, got, "%s(%v)", c.name, c.argTypes)
 	}
 }
+
+// TestCompile_MethodCall_RunsOnVM checks that methods compile to ordinary
+// "Struct.method" functions called directly with the receiver as their
+// first argument, and that a `mut self` method's field assignment is
+// visible to the caller afterward.
+func TestCompile_MethodCall_RunsOnVM(t *testing.T) {
+	src := `struct Counter:
+    mut count: int
+    inc: int
+
+    fn get(self) -> int:
+        return self.count
+
+    fn bump(mut self):
+        self.count = self.count + self.inc
+
+let c = Counter(count: 1, inc: 5)
+c.bump()
+c.bump()
+c.get() * 2
+`
+	mod := compileExpr(t, src)
+	var names []string
+	for _, fn := range mod.Functions {
+		names = append(names, fn.Name)
+	}
+	assert.Equal(t, []string{"main", "Counter.get", "Counter.bump"}, names)
+	assert.Equal(t, 1, mod.Functions[1].Arity)
+	got, err := vm.New(mod).Run()
+	require.NoError(t, err)
+	assert.Equal(t, 22, got)
+}
+
+func TestCompile_MethodCallsLaterMethodThroughSelf_RunsOnVM(t *testing.T) {
+	src := `struct Rect:
+    w: int
+    h: int
+
+    fn describe(self) -> str:
+        return "area=" + to_str(self.area())
+
+    fn area(self) -> int:
+        return self.w * self.h
+
+let r = Rect(w: 3, h: 4)
+r.describe()
+`
+	mod := compileExpr(t, src)
+	got, err := vm.New(mod).Run()
+	require.NoError(t, err)
+	assert.Equal(t, "area=12", got)
+}
+
+func TestCompile_InterfaceCall_DispatchesOnRuntimeType(t *testing.T) {
+	src := `interface Shape:
+    fn area(self) -> int
+
+struct Square:
+    side: int
+
+    fn area(self) -> int:
+        return self.side * self.side
+
+struct Rect:
+    w: int
+    h: int
+
+    fn area(self) -> int:
+        return self.w * self.h
+
+fn total(shapes: list[Shape]) -> int:
+    let sum = 0
+    for s in shapes:
+        sum = sum + s.area()
+    return sum
+
+total([Square(side: 3), Rect(w: 2, h: 5)])
+`
+	mod := compileExpr(t, src)
+	var dynamic int
+	for _, fn := range mod.Functions {
+		for _, instr := range fn.Code {
+			if instr.Op == bytecode.CALL_METHOD {
+				dynamic++
+				info := mod.Constants[instr.Arg].(bytecode.MethodInfo)
+				assert.Equal(t, bytecode.MethodInfo{Name: "area", Arity: 0}, info)
+			}
+		}
+	}
+	assert.Equal(t, 1, dynamic, "only the call through the interface is dynamic")
+	got, err := vm.New(mod).Run()
+	require.NoError(t, err)
+	assert.Equal(t, 19, got)
+}
+
+func TestCompile_InterfaceCall_WithArgs_RunsOnVM(t *testing.T) {
+	src := `interface Row:
+    fn cell(self, i: int) -> str
+
+struct User:
+    name: str
+    email: str
+
+    fn cell(self, i: int) -> str:
+        if i == 0:
+            return self.name
+        return self.email
+
+fn first(r: Row) -> str:
+    return r.cell(0) + "," + r.cell(1)
+
+first(User(name: "ann", email: "a@x.io"))
+`
+	got, err := vm.New(compileExpr(t, src)).Run()
+	require.NoError(t, err)
+	assert.Equal(t, "ann,a@x.io", got)
+}
+
+func TestCompile_StructDefaults_FillOmittedFields_RunsOnVM(t *testing.T) {
+	src := `type Name = str
+
+struct User:
+    name: Name
+    age: int = 18
+    tags: list[str] = ["new"]
+
+let u = User(name: "a")
+let v = User(name: "b", age: 30)
+to_str(u.age) + "," + to_str(v.age) + "," + u.tags[0]
+`
+	got, err := vm.New(compileExpr(t, src)).Run()
+	require.NoError(t, err)
+	assert.Equal(t, "18,30,new", got)
+}
+
+func TestCompile_StructDefaults_EmptyCallBuildsStruct_RunsOnVM(t *testing.T) {
+	src := `struct Bag:
+    items: list[int] = [1, 2]
+    label: str = "bag"
+
+let b = Bag()
+b.label + to_str(len(b.items))
+`
+	got, err := vm.New(compileExpr(t, src)).Run()
+	require.NoError(t, err)
+	assert.Equal(t, "bag2", got)
+}
+
+func TestCompile_ValidateHook_WrapsConstructionInResult(t *testing.T) {
+	src := `struct Age:
+    n: int
+
+    fn validate(self) -> Result:
+        if self.n < 0:
+            return err("negative")
+        return ok(self)
+
+Age(n: %s)
+`
+	got, err := vm.New(compileExpr(t, fmt.Sprintf(src, "3"))).Run()
+	require.NoError(t, err)
+	res := got.(map[string]any)
+	assert.Equal(t, "ok", res["tag"])
+	n, _ := res["val"].(*stdlib.Struct).Get("n")
+	assert.Equal(t, 3, n)
+
+	got, err = vm.New(compileExpr(t, fmt.Sprintf(src, "0 - 1"))).Run()
+	require.NoError(t, err)
+	res = got.(map[string]any)
+	assert.Equal(t, "err", res["tag"])
+	assert.Equal(t, "negative", res["val"])
+}
+
+// TestCompile_Defer_RunsOnVM checks that deferred calls run last-first when
+// the function returns, including through `?`, with their arguments
+// evaluated at the `defer`.
+func TestCompile_Defer_RunsOnVM(t *testing.T) {
+	src := `struct Log:
+    mut s: str
+
+    fn add(mut self, x: str):
+        self.s = self.s + x
+
+fn half(n: int) -> Result:
+    if n % 2 == 1:
+        return err("odd")
+    return ok(n / 2)
+
+fn work(l: Log, n: int) -> Result:
+    defer l.add("]")
+    let m = n
+    defer l.add(to_str(m))
+    m = 0
+    l.add("[")
+    let h = half(n)?
+    l.add("+")
+    return h
+
+let l = Log(s: "")
+work(l, 4)
+work(l, 3)
+l.s
+`
+	mod := compileExpr(t, src)
+	got, err := vm.New(mod).Run()
+	require.NoError(t, err)
+	assert.Equal(t, "[+4][3]", got)
+}
+
+func TestCompile_Defer_RunsOnRuntimeError(t *testing.T) {
+	src := `fn pick(xs: list[int]) -> int:
+    defer assert_eq(len(xs), 99)
+    return xs[5]
+
+pick([1, 2])
+`
+	mod := compileExpr(t, src)
+	_, err := vm.New(mod).Run()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "index out of bounds")
+	assert.Contains(t, err.Error(), "99")
+}
+
+func TestCompile_Defer_AtTopLevel_Errors(t *testing.T) {
+	prog, err := parser.New("defer println(1)\n", "").Parse()
+	require.NoError(t, err)
+	_, err = Compile(prog, "test")
+	require.Error(t, err)
+}
@@ -0,0 +1,199 @@
+package compiler
+
+import (
+	"fmt"
+
+	"github.com/jiejie-dev/funny/v2/internal/ast"
+)
+
+// foldConsts evaluates every top-level `const` ahead of compiling any code.
+// Constants are not stored anywhere at runtime: each use, in main or in a
+// function, compiles to a PUSH_* of the folded value (see fold).
+func (c *Compiler) foldConsts(stmts []ast.Statement) error {
+	for _, s := range stmts {
+		d, ok := s.(*ast.ConstDecl)
+		if !ok {
+			continue
+		}
+		v, _, ok := c.foldExpr(d.Value)
+		if !ok {
+			return fmt.Errorf("const %s: %s is not a compile-time constant", d.Name, d.Value)
+		}
+		c.consts[d.Name] = v
+	}
+	return nil
+}
+
+// fold evaluates e at compile time when it is made of literals and
+// constants, with at least one constant among them: a constant's uses, and
+// arithmetic on them, compile to a single PUSH_*. An expression of
+// literals alone is compiled as written.
+func (c *Compiler) fold(e ast.Expression) (any, bool) {
+	v, usesConst, ok := c.foldExpr(e)
+	return v, ok && usesConst
+}
+
+// foldExpr evaluates e if it is constant, reporting whether a `const` was
+// involved. A division by zero is not folded, so it still fails at runtime
+// like any other.
+func (c *Compiler) foldExpr(e ast.Expression) (v any, usesConst, ok bool) {
+	switch n := e.(type) {
+	case *ast.LiteralExpr:
+		switch n.Value.(type) {
+		case int, float64, string, bool:
+			return n.Value, false, true
+		}
+	case *ast.VariableExpr:
+		if slot, _ := c.lookupLocal(n.Name); slot >= 0 {
+			return nil, false, false
+		}
+		if v, ok := c.consts[n.Name]; ok {
+			return v, true, true
+		}
+	case *ast.SubExpr:
+		return c.foldExpr(n.Inner)
+	case *ast.UnaryExpr:
+		x, uses, ok := c.foldExpr(n.Expr)
+		if !ok {
+			return nil, false, false
+		}
+		if v, ok := foldUnary(n.Op, x); ok {
+			return v, uses, true
+		}
+	case *ast.BinaryExpr:
+		l, lUses, ok := c.foldExpr(n.Left)
+		if !ok {
+			return nil, false, false
+		}
+		r, rUses, ok := c.foldExpr(n.Right)
+		if !ok {
+			return nil, false, false
+		}
+		if v, ok := foldBinary(n.Op, l, r); ok {
+			return v, lUses || rUses, true
+		}
+	}
+	return nil, false, false
+}
+
+// intConstant reports the value of an int expression known at compile
+// time: a literal, a negated one, or one folded from constants.
+func (c *Compiler) intConstant(e ast.Expression) (int, bool) {
+	v, _, ok := c.foldExpr(e)
+	i, isInt := v.(int)
+	return i, ok && isInt
+}
+
+func foldUnary(op string, x any) (any, bool) {
+	switch x := x.(type) {
+	case int:
+		if op == "-" {
+			return -x, true
+		}
+	case float64:
+		if op == "-" {
+			return -x, true
+		}
+	case bool:
+		if op == "not" {
+			return !x, true
+		}
+	}
+	return nil, false
+}
+
+// foldBinary applies op to two constants of the same type, for exactly
+// the operators the VM has opcodes for.
+func foldBinary(op string, l, r any) (any, bool) {
+	switch l := l.(type) {
+	case int:
+		r, ok := r.(int)
+		if !ok {
+			return nil, false
+		}
+		switch op {
+		case "+":
+			return l + r, true
+		case "-":
+			return l - r, true
+		case "*":
+			return l * r, true
+		case "/":
+			if r != 0 {
+				return l / r, true
+			}
+		case "%":
+			if r != 0 {
+				return l % r, true
+			}
+		case "==":
+			return l == r, true
+		case "!=":
+			return l != r, true
+		case "<":
+			return l < r, true
+		case ">":
+			return l > r, true
+		case "<=":
+			return l <= r, true
+		case ">=":
+			return l >= r, true
+		}
+	case float64:
+		r, ok := r.(float64)
+		if !ok {
+			return nil, false
+		}
+		switch op {
+		case "+":
+			return l + r, true
+		case "-":
+			return l - r, true
+		case "*":
+			return l * r, true
+		case "/":
+			return l / r, true
+		case "==":
+			return l == r, true
+		case "!=":
+			return l != r, true
+		case "<":
+			return l < r, true
+		case ">":
+			return l > r, true
+		case "<=":
+			return l <= r, true
+		case ">=":
+			return l >= r, true
+		}
+	case string:
+		r, ok := r.(string)
+		if !ok {
+			return nil, false
+		}
+		switch op {
+		case "+":
+			return l + r, true
+		case "==":
+			return l == r, true
+		case "!=":
+			return l != r, true
+		}
+	case bool:
+		r, ok := r.(bool)
+		if !ok {
+			return nil, false
+		}
+		switch op {
+		case "==":
+			return l == r, true
+		case "!=":
+			return l != r, true
+		case "and":
+			return l && r, true
+		case "or":
+			return l || r, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,356 @@
+package compiler
+
+import (
+	"math"
+
+	"github.com/jiejie-dev/funny/v2/internal/bytecode"
+)
+
+// OptLevel selects what Optimize does to a compiled module.
+type OptLevel int
+
+const (
+	// O0 leaves the code as Compile emitted it.
+	O0 OptLevel = iota
+	// O1 folds constant expressions, threads jumps, drops unreachable
+	// code and fuses STORE_LOCAL/POP pairs.
+	O1
+)
+
+// maxOptRounds bounds the passes over one function; each round's rewrites
+// can expose more (a folded condition makes a branch dead, say), but a
+// handful of rounds reaches a fixed point for any real code.
+const maxOptRounds = 8
+
+// Optimize rewrites every function of mod in place at the given level.
+// Folding may add constants to mod. The rewrites keep Locations parallel
+// to Code: an instruction that replaces several takes the location of the
+// first, so breakpoints and source maps still land on the right lines.
+func Optimize(mod *bytecode.Module, level OptLevel) {
+	if level < O1 {
+		return
+	}
+	for _, fn := range mod.Functions {
+		o := &optimizer{mod: mod, fn: fn}
+		for round := 0; round < maxOptRounds; round++ {
+			changed := o.fold()
+			changed = o.threadJumps() || changed
+			changed = o.dropUnreachable() || changed
+			changed = o.peephole() || changed
+			if !changed {
+				break
+			}
+		}
+	}
+}
+
+// optimizer rewrites one function. A pass marks instructions removed (and
+// may overwrite the first instruction of a window with its replacement);
+// compact then drops the removed ones and renumbers jump targets.
+type optimizer struct {
+	mod     *bytecode.Module
+	fn      *bytecode.Function
+	removed []bool
+	targets []bool // targets[i]: some jump lands on instruction i
+}
+
+// begin prepares a pass: it clears the removal marks and records which
+// instructions are jump targets. A window of instructions may be rewritten
+// only if none but its first is a target, or a jump would land mid-rewrite.
+func (o *optimizer) begin() {
+	n := len(o.fn.Code)
+	o.removed = make([]bool, n)
+	o.targets = make([]bool, n+1)
+	for _, instr := range o.fn.Code {
+		if isJump(instr.Op) && instr.Arg <= n {
+			o.targets[instr.Arg] = true
+		}
+	}
+}
+
+func isJump(op bytecode.OpCode) bool {
+	return op == bytecode.JUMP || op == bytecode.JUMP_IF_FALSE || op == bytecode.JUMP_IF_TRUE
+}
+
+// window reports whether the n instructions from i exist, aren't removed,
+// and aren't jumped into past the first.
+func (o *optimizer) window(i, n int) bool {
+	if i+n > len(o.fn.Code) {
+		return false
+	}
+	for j := i; j < i+n; j++ {
+		if o.removed[j] || (j > i && o.targets[j]) {
+			return false
+		}
+	}
+	return true
+}
+
+// replace rewrites the n-instruction window at i as instr (the first
+// instruction's slot, keeping its location) and removes the rest.
+func (o *optimizer) replace(i, n int, instr bytecode.Instruction) {
+	o.fn.Code[i] = instr
+	for j := i + 1; j < i+n; j++ {
+		o.removed[j] = true
+	}
+}
+
+// remove drops the n-instruction window at i; jumps to it land on
+// whatever follows.
+func (o *optimizer) remove(i, n int) {
+	for j := i; j < i+n; j++ {
+		o.removed[j] = true
+	}
+}
+
+// compact drops removed instructions and their locations, pointing each
+// jump at the new index of its target (or of the first instruction kept
+// after it). It reports whether anything was dropped.
+func (o *optimizer) compact() bool {
+	code := o.fn.Code
+	hasLocs := len(o.fn.Locations) == len(code)
+	newIndex := make([]int, len(code)+1)
+	kept := 0
+	for i := range code {
+		newIndex[i] = kept
+		if !o.removed[i] {
+			kept++
+		}
+	}
+	newIndex[len(code)] = kept
+	if kept == len(code) {
+		return false
+	}
+	out := make([]bytecode.Instruction, 0, kept)
+	var locs []bytecode.SourceLoc
+	if hasLocs {
+		locs = make([]bytecode.SourceLoc, 0, kept)
+	}
+	for i, instr := range code {
+		if o.removed[i] {
+			continue
+		}
+		if isJump(instr.Op) && instr.Arg <= len(code) {
+			instr.Arg = newIndex[instr.Arg]
+		}
+		out = append(out, instr)
+		if hasLocs {
+			locs = append(locs, o.fn.Locations[i])
+		}
+	}
+	o.fn.Code = out
+	if hasLocs {
+		o.fn.Locations = locs
+	}
+	return true
+}
+
+// constant returns the value a PUSH_* instruction pushes.
+func (o *optimizer) constant(instr bytecode.Instruction) (bytecode.Value, bool) {
+	switch instr.Op {
+	case bytecode.PUSH_INT, bytecode.PUSH_FLOAT, bytecode.PUSH_STR, bytecode.PUSH_BOOL:
+		if instr.Arg < len(o.mod.Constants) {
+			return o.mod.Constants[instr.Arg], true
+		}
+	}
+	return nil, false
+}
+
+// push returns the instruction that pushes constant v.
+func (o *optimizer) push(v bytecode.Value) bytecode.Instruction {
+	op := bytecode.PUSH_INT
+	switch v.(type) {
+	case float64:
+		op = bytecode.PUSH_FLOAT
+	case string:
+		op = bytecode.PUSH_STR
+	case bool:
+		op = bytecode.PUSH_BOOL
+	}
+	return bytecode.Instruction{Op: op, Arg: o.mod.AddConstant(v)}
+}
+
+// fold evaluates operators whose operands are constants pushed right
+// before them, and resolves conditional jumps on a constant condition.
+func (o *optimizer) fold() bool {
+	o.begin()
+	code := o.fn.Code
+	for i := range code {
+		if o.removed[i] {
+			continue
+		}
+		a, ok := o.constant(code[i])
+		if !ok || !o.window(i, 2) {
+			continue
+		}
+		next := code[i+1]
+		if v, ok := foldUnaryOp(next.Op, a); ok {
+			o.replace(i, 2, o.push(v))
+			continue
+		}
+		switch next.Op {
+		case bytecode.JUMP_IF_FALSE, bytecode.JUMP_IF_TRUE:
+			cond, ok := a.(bool)
+			if !ok {
+				continue
+			}
+			if cond == (next.Op == bytecode.JUMP_IF_TRUE) {
+				o.replace(i, 2, bytecode.Instruction{Op: bytecode.JUMP, Arg: next.Arg})
+			} else {
+				o.remove(i, 2)
+			}
+			continue
+		}
+		b, ok := o.constant(next)
+		if !ok || !o.window(i, 3) {
+			continue
+		}
+		if v, ok := foldBinaryOp(code[i+2].Op, a, b); ok {
+			o.replace(i, 3, o.push(v))
+		}
+	}
+	return o.compact()
+}
+
+// unaryOperators and binaryOperators map the opcodes fold evaluates to
+// the operator whose compile-time semantics (foldUnary, foldBinary) match.
+var unaryOperators = map[bytecode.OpCode]string{
+	bytecode.NEG_INT:   "-",
+	bytecode.NEG_FLOAT: "-",
+	bytecode.NOT_BOOL:  "not",
+}
+
+var binaryOperators = map[bytecode.OpCode]string{
+	bytecode.ADD_INT:   "+",
+	bytecode.SUB_INT:   "-",
+	bytecode.MUL_INT:   "*",
+	bytecode.DIV_INT:   "/",
+	bytecode.MOD_INT:   "%",
+	bytecode.ADD_FLOAT: "+",
+	bytecode.SUB_FLOAT: "-",
+	bytecode.MUL_FLOAT: "*",
+	bytecode.DIV_FLOAT: "/",
+	bytecode.ADD_STR:   "+",
+	bytecode.EQ_INT:    "==",
+	bytecode.EQ_STR:    "==",
+	bytecode.EQ_BOOL:   "==",
+	bytecode.LT_INT:    "<",
+	bytecode.GT_INT:    ">",
+	bytecode.LTE_INT:   "<=",
+	bytecode.GTE_INT:   ">=",
+	bytecode.LT_FLOAT:  "<",
+	bytecode.GT_FLOAT:  ">",
+	bytecode.LTE_FLOAT: "<=",
+	bytecode.GTE_FLOAT: ">=",
+	bytecode.AND_BOOL:  "and",
+	bytecode.OR_BOOL:   "or",
+}
+
+// foldUnaryOp evaluates unary opcode op on constant a.
+func foldUnaryOp(op bytecode.OpCode, a bytecode.Value) (bytecode.Value, bool) {
+	operator, ok := unaryOperators[op]
+	if !ok {
+		return nil, false
+	}
+	return checkFolded(foldUnary(operator, a))
+}
+
+// foldBinaryOp evaluates binary opcode op on constants a and b.
+func foldBinaryOp(op bytecode.OpCode, a, b bytecode.Value) (bytecode.Value, bool) {
+	operator, ok := binaryOperators[op]
+	if !ok {
+		return nil, false
+	}
+	return checkFolded(foldBinary(operator, a, b))
+}
+
+// checkFolded rejects a folded float that is zero, NaN or infinite: the
+// constant pool dedups with ==, which would merge -0.0 into 0.0 and never
+// match NaN, so those stay computed at runtime.
+func checkFolded(v any, ok bool) (bytecode.Value, bool) {
+	if f, isFloat := v.(float64); ok && isFloat && (f == 0 || math.IsNaN(f) || math.IsInf(f, 0)) {
+		return nil, false
+	}
+	return v, ok
+}
+
+// threadJumps points jumps that land on an unconditional JUMP at that
+// jump's own target, and drops jumps to the next instruction (a
+// conditional one becomes a POP of its condition).
+func (o *optimizer) threadJumps() bool {
+	o.begin()
+	code := o.fn.Code
+	changed := false
+	for i, instr := range code {
+		if !isJump(instr.Op) {
+			continue
+		}
+		target := instr.Arg
+		for hops := 0; hops < len(code) && target < len(code) && code[target].Op == bytecode.JUMP && code[target].Arg != target; hops++ {
+			target = code[target].Arg
+		}
+		if target != instr.Arg {
+			code[i].Arg = target
+			changed = true
+		}
+		if target == i+1 {
+			if instr.Op == bytecode.JUMP {
+				o.remove(i, 1)
+			} else {
+				code[i] = bytecode.Instruction{Op: bytecode.POP}
+				changed = true
+			}
+		}
+	}
+	return o.compact() || changed
+}
+
+// dropUnreachable removes instructions no path from the entry reaches,
+// such as code after a RETURN or an unconditional JUMP.
+func (o *optimizer) dropUnreachable() bool {
+	o.begin()
+	code := o.fn.Code
+	reached := make([]bool, len(code))
+	work := []int{0}
+	for len(work) > 0 {
+		i := work[len(work)-1]
+		work = work[:len(work)-1]
+		for i < len(code) && !reached[i] {
+			reached[i] = true
+			op := code[i].Op
+			if isJump(op) {
+				work = append(work, code[i].Arg)
+			}
+			if op == bytecode.JUMP || op == bytecode.RETURN || op == bytecode.HALT {
+				break
+			}
+			i++
+		}
+	}
+	for i := range code {
+		if !reached[i] {
+			o.removed[i] = true
+		}
+	}
+	return o.compact()
+}
+
+// peephole fuses STORE_LOCAL; POP into STORE_LOCAL_POP and drops a value
+// pushed only to be popped.
+func (o *optimizer) peephole() bool {
+	o.begin()
+	code := o.fn.Code
+	for i := range code {
+		if !o.window(i, 2) || code[i+1].Op != bytecode.POP {
+			continue
+		}
+		switch code[i].Op {
+		case bytecode.STORE_LOCAL:
+			o.replace(i, 2, bytecode.Instruction{Op: bytecode.STORE_LOCAL_POP, Arg: code[i].Arg})
+		case bytecode.PUSH_INT, bytecode.PUSH_FLOAT, bytecode.PUSH_STR, bytecode.PUSH_BOOL,
+			bytecode.PUSH_NIL, bytecode.LOAD_LOCAL, bytecode.DUP:
+			o.remove(i, 2)
+		}
+	}
+	return o.compact()
+}
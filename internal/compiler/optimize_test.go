@@ -0,0 +1,144 @@
+package compiler
+
+import (
+	"testing"
+
+	"github.com/jiejie-dev/funny/v2/internal/bytecode"
+	"github.com/jiejie-dev/funny/v2/internal/vm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func opsOf(fn *bytecode.Function) []bytecode.OpCode {
+	var ops []bytecode.OpCode
+	for _, instr := range fn.Code {
+		ops = append(ops, instr.Op)
+	}
+	return ops
+}
+
+func TestOptimize_FoldsConstantsAndFusesStores(t *testing.T) {
+	src := "let x = 2 * 3 + -1\nlet s = \"a\" + \"b\"\nx\n"
+	plain := compileExpr(t, src).Functions[0]
+	mod := compileExpr(t, src)
+	Optimize(mod, O1)
+	fn := mod.Functions[0]
+	assert.Equal(t, []bytecode.OpCode{
+		bytecode.PUSH_INT, bytecode.STORE_LOCAL_POP,
+		bytecode.PUSH_STR, bytecode.STORE_LOCAL_POP,
+		bytecode.LOAD_LOCAL, bytecode.HALT,
+	}, opsOf(fn))
+	assert.Equal(t, 5, mod.Constants[fn.Code[0].Arg])
+	assert.Equal(t, "ab", mod.Constants[fn.Code[2].Arg])
+	// Each statement's first instruction keeps its location.
+	require.Len(t, fn.Locations, len(fn.Code))
+	assert.Equal(t, plain.Locations[0], fn.Locations[0])
+	assert.Equal(t, plain.Locations[8], fn.Locations[2])
+	assert.Equal(t, plain.Locations[13], fn.Locations[4])
+}
+
+func TestOptimize_LeavesRuntimeErrorsAlone(t *testing.T) {
+	mod := compileExpr(t, "1 / 0\n")
+	Optimize(mod, O1)
+	assert.Contains(t, opsOf(mod.Functions[0]), bytecode.DIV_INT)
+	_, err := vm.New(mod).Run()
+	assert.ErrorContains(t, err, "division by zero")
+}
+
+func TestOptimize_DropsDeadBranchesAndCodeAfterReturn(t *testing.T) {
+	mod := compileExpr(t, `fn pick(n: int) -> int:
+    if n > 0:
+        return 1
+    else:
+        return 2
+    return 3
+let r = 0
+if false:
+    r = 10
+pick(r)
+`)
+	Optimize(mod, O1)
+	main, pick := mod.Functions[0], mod.Functions[1]
+	for _, fn := range mod.Functions {
+		require.Len(t, fn.Locations, len(fn.Code))
+		for _, instr := range fn.Code {
+			if isJump(instr.Op) {
+				assert.LessOrEqual(t, instr.Arg, len(fn.Code))
+			}
+		}
+	}
+	// `if false` leaves no test or jump behind, and `return 3` is gone.
+	assert.NotContains(t, opsOf(main), bytecode.JUMP_IF_FALSE)
+	assert.NotContains(t, opsOf(main), bytecode.JUMP)
+	for _, instr := range pick.Code {
+		if instr.Op == bytecode.PUSH_INT {
+			assert.NotEqual(t, 3, mod.Constants[instr.Arg])
+		}
+	}
+	got, err := vm.New(mod).Run()
+	require.NoError(t, err)
+	assert.Equal(t, 2, got)
+}
+
+func TestOptimize_ThreadsJumps(t *testing.T) {
+	m := bytecode.NewModule("t")
+	fn := &bytecode.Function{Name: "main"}
+	fn.Emit(bytecode.PUSH_BOOL, m.AddConstant(true)) // 0
+	fn.Emit(bytecode.JUMP_IF_TRUE, 3)                // 1
+	fn.Emit(bytecode.HALT, 0)                        // 2
+	fn.Emit(bytecode.JUMP, 4)                        // 3
+	fn.Emit(bytecode.JUMP, 5)                        // 4
+	fn.Emit(bytecode.PUSH_INT, m.AddConstant(7))     // 5
+	fn.Emit(bytecode.HALT, 0)                        // 6
+	m.AddFunction(fn)
+	Optimize(m, O1)
+	assert.Equal(t, []bytecode.OpCode{bytecode.PUSH_INT, bytecode.HALT}, opsOf(fn))
+}
+
+// TestOptimize_SameResultsAsUnoptimized runs programs compiled at O0 and
+// O1 and compares what they return.
+func TestOptimize_SameResultsAsUnoptimized(t *testing.T) {
+	programs := []string{
+		"let x = 10\nlet y = x * 2 + 3 * 4\ny - -x\n",
+		"let f = 1.5 * 2.0\nlet z = 0.0 * -1.0\nto_str(f) + to_str(z) + to_str(not (2 < 3))\n",
+		`fn fib(n: int) -> int:
+    if n < 2:
+        return n
+    return fib(n - 1) + fib(n - 2)
+fib(15)
+`,
+		`let total = 0
+for i in 0..20:
+    if i % 3 == 0:
+        continue
+    if i > 15:
+        break
+    total = total + i
+while total > 50 and true:
+    total = total - 7
+total
+`,
+		`let acc = ""
+let words = ["a", "bb", "ccc"]
+for w in words:
+    match len(w):
+        1 =>
+            acc = acc + "one"
+        2 | 3 =>
+            acc = acc + "few"
+acc + to_str(true or false) + to_str("x" == "x")
+`,
+	}
+	for _, src := range programs {
+		plain := compileExpr(t, src)
+		want, err := vm.New(plain).Run()
+		require.NoError(t, err, src)
+
+		opt := compileExpr(t, src)
+		Optimize(opt, O1)
+		assert.LessOrEqual(t, len(opt.Functions[0].Code), len(plain.Functions[0].Code), src)
+		got, err := vm.New(opt).Run()
+		require.NoError(t, err, src)
+		assert.Equal(t, want, got, src)
+	}
+}
@@ -0,0 +1,77 @@
+package compiler
+
+import (
+	"github.com/jiejie-dev/funny/v2/internal/ast"
+	"github.com/jiejie-dev/funny/v2/internal/bytecode"
+	"github.com/jiejie-dev/funny/v2/internal/module"
+)
+
+// externFn is a function declared by another module of the program: the
+// symbol a call to it links against, and its declaration, for its arity
+// and return type.
+type externFn struct {
+	sym  bytecode.Symbol
+	decl *ast.FnDecl
+}
+
+// CompileUnit compiles one file of a program's import graph into a
+// Module of its own, named after u.Path. Only u's own declarations (and,
+// for the program's entry file, its top-level code) are compiled. The
+// declarations of the files u's imports reach are only read: their
+// types, struct layouts and constants, and the signatures of their
+// functions. A call to one of those functions compiles to a call of a
+// stub, whose Extern names the function by the path of its module and
+// its name there; bytecode.Link resolves it against that module's
+// export table, which lists every function a module declares.
+//
+// Since a module's code depends only on its own source and on the
+// declarations it can see, the compile of an imported file can be reused
+// by every program that imports it, until one of those files changes.
+func CompileUnit(u *module.Unit) (*bytecode.Module, error) {
+	c := newCompiler(u.Path)
+	visible := u.Visible()
+	var decls []ast.Statement
+	for _, dep := range visible {
+		decls = append(decls, dep.Decls...)
+	}
+	decls = append(decls, u.Decls...)
+	c.declareTypes(decls)
+	if err := c.foldConsts(decls); err != nil {
+		return nil, err
+	}
+	for _, dep := range visible {
+		for _, s := range dep.Decls {
+			switch d := s.(type) {
+			case *ast.FnDecl:
+				c.externs[d.Name] = externFn{bytecode.Symbol{Module: dep.Path, Name: d.Name}, d}
+			case *ast.StructDecl:
+				for _, m := range d.Methods {
+					name := methodFuncName(d.Name, m.Name)
+					c.externs[name] = externFn{bytecode.Symbol{Module: dep.Path, Name: name}, m}
+				}
+			}
+		}
+	}
+	if err := c.compileMain(u.Decls); err != nil {
+		return nil, err
+	}
+	return c.mod, nil
+}
+
+// lookupFunction returns the index of the function called name: one the
+// module declares, or a stub for another module's, added on its first
+// call so a module only carries stubs for what it calls.
+func (c *Compiler) lookupFunction(name string) (int, bool) {
+	if idx, ok := c.functions[name]; ok {
+		return idx, true
+	}
+	ext, ok := c.externs[name]
+	if !ok {
+		return 0, false
+	}
+	sym := ext.sym
+	fn := &bytecode.Function{Name: name, Arity: len(ext.decl.Params), Extern: &sym}
+	c.functions[name] = c.mod.AddFunction(fn)
+	c.fnRetTypes[name] = c.annotationValueType(ext.decl.RetType)
+	return c.functions[name], true
+}
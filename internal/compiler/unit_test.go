@@ -0,0 +1,112 @@
+package compiler
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jiejie-dev/funny/v2/internal/bytecode"
+	"github.com/jiejie-dev/funny/v2/internal/module"
+	"github.com/jiejie-dev/funny/v2/internal/parser"
+	"github.com/jiejie-dev/funny/v2/internal/types"
+	"github.com/jiejie-dev/funny/v2/internal/vm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// loadGraph writes files into a temp dir, then parses, loads and
+// type-checks main.fn.
+func loadGraph(t *testing.T, files map[string]string) *module.Graph {
+	t.Helper()
+	dir := t.TempDir()
+	for name, src := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(src), 0o644))
+	}
+	mainPath := filepath.Join(dir, "main.fn")
+	prog, err := parser.New(files["main.fn"], mainPath).Parse()
+	require.NoError(t, err)
+	g, err := module.Load(prog, mainPath)
+	require.NoError(t, err)
+	require.NoError(t, types.Check(g.Program(), types.NewEnv(nil)))
+	return g
+}
+
+const shapesLib = `const SCALE = 10
+
+fn scale(x: int) -> int:
+    return x * SCALE
+
+pub struct Point:
+    x: int
+    y: int
+    fn sum(self) -> int:
+        return self.x + self.y
+
+pub fn make(x: int) -> Point:
+    return Point(x: scale(x), y: 1)
+`
+
+func TestCompileUnit_CallsIntoImportsGoThroughStubs(t *testing.T) {
+	g := loadGraph(t, map[string]string{
+		"shapes.fn": shapesLib,
+		"main.fn":   "import \"shapes.fn\"\nlet p = make(2)\nlet q = Point(x: 1, y: 2)\np.sum() + q.sum()\n",
+	})
+	lib, err := CompileUnit(g.Units[0])
+	require.NoError(t, err)
+	assert.Equal(t, g.Units[0].Path, lib.Name)
+	for _, name := range []string{"shapes::scale", "Point.sum", "make"} {
+		idx, ok := lib.Exports[name]
+		require.True(t, ok, name)
+		assert.Equal(t, name, lib.Functions[idx].Name)
+	}
+
+	entry, err := CompileUnit(g.Main)
+	require.NoError(t, err)
+	externs := map[string]bytecode.Symbol{}
+	for _, fn := range entry.Functions {
+		if fn.Extern != nil {
+			externs[fn.Name] = *fn.Extern
+			assert.Empty(t, fn.Code)
+		}
+	}
+	assert.Equal(t, map[string]bytecode.Symbol{
+		"make":      {Module: lib.Name, Name: "make"},
+		"Point.sum": {Module: lib.Name, Name: "Point.sum"},
+	}, externs)
+
+	linked, err := bytecode.Link(entry, lib)
+	require.NoError(t, err)
+	got, err := vm.New(linked).Run()
+	require.NoError(t, err)
+	assert.Equal(t, 24, got)
+}
+
+func TestCompileUnit_LinksTheSameAsTheSplicedProgram(t *testing.T) {
+	g := loadGraph(t, map[string]string{
+		"shapes.fn": shapesLib,
+		"geo.fn":    "import \"shapes.fn\"\npub fn far(x: int) -> int:\n    defer println(\"far\")\n    return make(x).sum()\n",
+		"main.fn":   "import \"geo.fn\"\nimport \"shapes.fn\"\nfar(3) + make(1).sum()\n",
+	})
+	var libs []*bytecode.Module
+	for _, u := range g.Units {
+		mod, err := CompileUnit(u)
+		require.NoError(t, err)
+		libs = append(libs, mod)
+	}
+	entry, err := CompileUnit(g.Main)
+	require.NoError(t, err)
+	linked, err := bytecode.Link(entry, libs...)
+	require.NoError(t, err)
+	for _, fn := range linked.Functions {
+		assert.Nil(t, fn.Extern, fn.Name)
+	}
+	got, err := vm.New(linked).Run()
+	require.NoError(t, err)
+
+	spliced, err := Compile(g.Program(), g.Main.Path)
+	require.NoError(t, err)
+	want, err := vm.New(spliced).Run()
+	require.NoError(t, err)
+	assert.Equal(t, want, got)
+	assert.Equal(t, 42, got)
+}
@@ -152,17 +152,30 @@ func (s *Server) handleRequest(req Message) error {
 		if ev == nil {
 			return s.respond(req, true, map[string]any{"stackFrames": []any{}, "totalFrames": 0})
 		}
-		line := ev.Location.Line + 1
-		col := ev.Location.Col + 1
+		// Calls elided by tail calls show as a label frame under the
+		// frame that made them.
+		frames := make([]map[string]any, 0, len(ev.CallStack))
+		for _, call := range ev.CallStack {
+			frames = append(frames, map[string]any{
+				"id":     frameID + len(frames),
+				"name":   call.FnName,
+				"line":   call.Location.Line + 1,
+				"column": call.Location.Col + 1,
+				"source": map[string]any{"path": call.Location.File},
+			})
+			if call.Elided > 0 {
+				frames = append(frames, map[string]any{
+					"id":               frameID + len(frames),
+					"name":             "[" + vm.ElidedLabel(call.Elided) + "]",
+					"line":             0,
+					"column":           0,
+					"presentationHint": "label",
+				})
+			}
+		}
 		return s.respond(req, true, map[string]any{
-			"stackFrames": []map[string]any{{
-				"id":     frameID,
-				"name":   ev.FnName,
-				"line":   line,
-				"column": col,
-				"source": map[string]any{"path": ev.Location.File},
-			}},
-			"totalFrames": 1,
+			"stackFrames": frames,
+			"totalFrames": len(frames),
 		})
 	case "scopes":
 		return s.respond(req, true, map[string]any{
@@ -16,16 +16,19 @@ import (
 
 // SymbolDoc describes one documented declaration.
 type SymbolDoc struct {
-	Name      string            `json:"name"`
-	Kind      string            `json:"kind"` // fn, struct
-	Public    bool              `json:"public"`
-	Summary   string            `json:"summary,omitempty"`
-	Body      []string          `json:"body,omitempty"`
-	Args      map[string]string `json:"args,omitempty"`
-	Returns   string            `json:"returns,omitempty"`
-	Signature string            `json:"signature"`
-	File      string            `json:"file"`
-	Line      int               `json:"line"`
+	Name            string            `json:"name"`
+	Kind            string            `json:"kind"` // fn, struct, interface, type, const
+	Public          bool              `json:"public"`
+	Summary         string            `json:"summary,omitempty"`
+	Body            []string          `json:"body,omitempty"`
+	Args            map[string]string `json:"args,omitempty"`
+	Returns         string            `json:"returns,omitempty"`
+	Signature       string            `json:"signature"`
+	File            string            `json:"file"`
+	Line            int               `json:"line"`
+	Deprecated      bool              `json:"deprecated,omitempty"`       // `@deprecated`
+	DeprecationNote string            `json:"deprecation_note,omitempty"` // its message, if any
+	Tool            string            `json:"tool,omitempty"`             // `@tool(description: ...)`
 }
 
 // ModuleDoc is extracted documentation for one source file.
@@ -67,11 +70,12 @@ func fnSymbol(fn *ast.FnDecl, docLines []string, env *types.Env) SymbolDoc {
 		Name:      fn.Name,
 		Kind:      "fn",
 		Public:    fn.Pub,
-		Signature: sig,
+		Signature: fn.Attrs.String() + sig,
 		File:      fn.NodePos.File,
 		Line:      fn.NodePos.Line + 1,
 	}
 	parseDocLines(&sym, docLines)
+	applyAttributes(&sym, fn.Attrs)
 	if fn.RetType != "" {
 		if sym.Returns == "" {
 			sym.Returns = fn.RetType
@@ -93,27 +97,70 @@ func structSymbol(sd *ast.StructDecl, docLines []string) SymbolDoc {
 		}
 		fields = append(fields, fmt.Sprintf("    %s%s: %s", prefix, f.Name, f.TypeAnn))
 	}
+	for _, m := range sd.Methods {
+		fields = append(fields, "    "+fnSignature(m))
+	}
 	sig := fmt.Sprintf("struct %s:\n%s", sd.Name, strings.Join(fields, "\n"))
 	sym := SymbolDoc{
 		Name:      sd.Name,
 		Kind:      "struct",
 		Public:    sd.Pub,
-		Signature: sig,
+		Signature: sd.Attrs.String() + sig,
 		File:      sd.NodePos.File,
 		Line:      sd.NodePos.Line + 1,
 	}
 	parseDocLines(&sym, docLines)
+	applyAttributes(&sym, sd.Attrs)
+	return sym
+}
+
+func interfaceSymbol(id *ast.InterfaceDecl, docLines []string) SymbolDoc {
+	methods := make([]string, len(id.Methods))
+	for i, m := range id.Methods {
+		methods[i] = "    " + fnSignature(m)
+	}
+	sym := SymbolDoc{
+		Name:      id.Name,
+		Kind:      "interface",
+		Public:    id.Pub,
+		Signature: fmt.Sprintf("interface %s:\n%s", id.Name, strings.Join(methods, "\n")),
+		File:      id.NodePos.File,
+		Line:      id.NodePos.Line + 1,
+	}
+	parseDocLines(&sym, docLines)
+	return sym
+}
+
+func typeAliasSymbol(ta *ast.TypeAliasDecl, docLines []string) SymbolDoc {
+	sym := SymbolDoc{
+		Name:      ta.Name,
+		Kind:      "type",
+		Public:    ta.Pub,
+		Signature: fmt.Sprintf("type %s = %s", ta.Name, ta.Target),
+		File:      ta.NodePos.File,
+		Line:      ta.NodePos.Line + 1,
+	}
+	parseDocLines(&sym, docLines)
+	return sym
+}
+
+func constSymbol(cd *ast.ConstDecl, docLines []string) SymbolDoc {
+	sym := SymbolDoc{
+		Name:      cd.Name,
+		Kind:      "const",
+		Public:    cd.Pub,
+		Signature: fmt.Sprintf("const %s = %s", cd.Name, cd.Value),
+		File:      cd.NodePos.File,
+		Line:      cd.NodePos.Line + 1,
+	}
+	parseDocLines(&sym, docLines)
 	return sym
 }
 
 func fnSignature(fn *ast.FnDecl) string {
 	parts := make([]string, len(fn.Params))
 	for i, p := range fn.Params {
-		if p.TypeAnn != "" {
-			parts[i] = fmt.Sprintf("%s: %s", p.Name, p.TypeAnn)
-		} else {
-			parts[i] = p.Name
-		}
+		parts[i] = p.String()
 	}
 	ret := ""
 	if fn.RetType != "" {
@@ -126,6 +173,12 @@ func fnSignature(fn *ast.FnDecl) string {
 	return fmt.Sprintf("%s%s(%s)%s", prefix, fn.Name, strings.Join(parts, ", "), ret)
 }
 
+// applyAttributes records the attributes the docs surface.
+func applyAttributes(sym *SymbolDoc, attrs ast.Attributes) {
+	sym.DeprecationNote, sym.Deprecated = attrs.Deprecated()
+	sym.Tool = attrs.ToolDescription()
+}
+
 func parseDocLines(sym *SymbolDoc, lines []string) {
 	if len(lines) == 0 {
 		return
@@ -201,6 +254,12 @@ func RenderMarkdown(doc *ModuleDoc) string {
 			vis = " (public)"
 		}
 		sb.WriteString(fmt.Sprintf("### `%s` — %s%s\n\n", sym.Name, sym.Kind, vis))
+		if sym.Deprecated {
+			sb.WriteString(deprecationLine(sym) + "\n\n")
+		}
+		if sym.Tool != "" {
+			sb.WriteString("**Tool:** " + sym.Tool + "\n\n")
+		}
 		if sym.Summary != "" {
 			sb.WriteString(sym.Summary + "\n\n")
 		}
@@ -227,6 +286,14 @@ func RenderMarkdown(doc *ModuleDoc) string {
 	return sb.String()
 }
 
+// deprecationLine is the notice shown for a `@deprecated` symbol.
+func deprecationLine(sym SymbolDoc) string {
+	if sym.DeprecationNote == "" {
+		return "**Deprecated.**"
+	}
+	return "**Deprecated:** " + sym.DeprecationNote
+}
+
 // RenderJSON returns pretty-printed JSON for one module doc.
 func RenderJSON(doc *ModuleDoc) ([]byte, error) {
 	return json.MarshalIndent(doc, "", "  ")
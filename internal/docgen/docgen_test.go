@@ -31,3 +31,19 @@ func TestGenerateAll(t *testing.T) {
 	require.NoError(t, err)
 	assert.Len(t, docs, 1)
 }
+
+func TestExtract_Attributes(t *testing.T) {
+	src := "## Old adder\n@deprecated(\"use add2\")\n@tool(description: \"Adds two ints\")\npub fn add(a: int, b: int) -> int:\n    return a + b\n"
+	doc, err := Extract([]byte(src), "a.fn")
+	require.NoError(t, err)
+	require.Len(t, doc.Symbols, 1)
+	sym := doc.Symbols[0]
+	assert.Equal(t, "Old adder", sym.Summary)
+	assert.True(t, sym.Deprecated)
+	assert.Equal(t, "use add2", sym.DeprecationNote)
+	assert.Equal(t, "Adds two ints", sym.Tool)
+	assert.Equal(t, "@deprecated(\"use add2\")\n@tool(description: \"Adds two ints\")\npub fn add(a: int, b: int) -> int", sym.Signature)
+	md := RenderMarkdown(doc)
+	assert.Contains(t, md, "**Deprecated:** use add2")
+	assert.Contains(t, md, "**Tool:** Adds two ints")
+}
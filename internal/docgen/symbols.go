@@ -39,6 +39,15 @@ func CollectSymbols(prog *ast.Program, env *types.Env) []SymbolDoc {
 		case *ast.StructDecl:
 			lines := flushPending()
 			symbols = append(symbols, structSymbol(n, lines))
+		case *ast.InterfaceDecl:
+			lines := flushPending()
+			symbols = append(symbols, interfaceSymbol(n, lines))
+		case *ast.TypeAliasDecl:
+			lines := flushPending()
+			symbols = append(symbols, typeAliasSymbol(n, lines))
+		case *ast.ConstDecl:
+			lines := flushPending()
+			symbols = append(symbols, constSymbol(n, lines))
 		default:
 			pending = nil
 		}
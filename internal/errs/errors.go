@@ -1,7 +1,12 @@
 package errs
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
 
+// Position is a 0-based source location; Format displays it 1-based.
 type Position struct {
 	File string
 	Line int
@@ -13,6 +18,28 @@ type Error struct {
 	Message string
 	Pos     Position
 	Hint    string
+	// Warning marks a diagnostic that doesn't stop the program from
+	// running, such as unreachable code.
+	Warning bool
+	// Trace is the funny call stack of a runtime error, innermost call
+	// first; Pos is where the innermost call failed.
+	Trace []Frame
+	// Err is the error a runtime error reports, kept for errors.Is and
+	// errors.As.
+	Err error
+}
+
+// Frame is one active call in a runtime error's stack trace: the function
+// and the position it was executing (for a caller, the call). Elided
+// counts the calls the frame ran before them and gave up to tail calls,
+// which are no longer on the stack. Repeated counts the identical frames
+// (same function, position and Elided) directly below this one that were
+// folded into it, so deep recursion is one frame rather than thousands.
+type Frame struct {
+	Function string
+	Pos      Position
+	Elided   int
+	Repeated int
 }
 
 func New(code, message string, pos Position, hint string) *Error {
@@ -24,10 +51,80 @@ func (e *Error) Error() string {
 }
 
 func (e *Error) Format() string {
-	s := fmt.Sprintf("error[%s]: %s\n --> %s:%d:%d\n",
-		e.Code, e.Message, e.Pos.File, e.Pos.Line, e.Pos.Col)
+	label := "error"
+	if e.Warning {
+		label = "warning"
+	}
+	s := fmt.Sprintf("%s[%s]: %s\n --> %s:%d:%d\n",
+		label, e.Code, e.Message, e.Pos.File, e.Pos.Line+1, e.Pos.Col+1)
 	if e.Hint != "" {
 		s += fmt.Sprintf("\nhelp: %s", e.Hint)
 	}
+	if len(e.Trace) > 0 {
+		s += "\nstack trace:\n"
+		for _, f := range e.Trace {
+			s += fmt.Sprintf("    at %s (%s)\n", f.Function, f.Pos.Display())
+			switch {
+			case f.Elided == 1:
+				s += "    ... 1 tail call elided\n"
+			case f.Elided > 1:
+				s += fmt.Sprintf("    ... %d tail calls elided\n", f.Elided)
+			}
+			switch {
+			case f.Repeated == 1:
+				s += "    ... previous frame repeated 1 time\n"
+			case f.Repeated > 1:
+				s += fmt.Sprintf("    ... previous frame repeated %d times\n", f.Repeated)
+			}
+		}
+	}
 	return s
 }
+
+// Unwrap returns the error a runtime error reports, or nil.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Display returns the position 1-based (file:line:col), or "<unknown>"
+// when none was recorded.
+func (p Position) Display() string {
+	if p == (Position{}) {
+		return "<unknown>"
+	}
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Line+1, p.Col+1)
+}
+
+// List holds every error found by a pass that keeps going after the first
+// one (see types.Check), in source order. It satisfies error so it can be
+// returned wherever a single *Error was; errors.As on a List finds its
+// first entry.
+type List []*Error
+
+// Error formats every entry, separated by a blank line.
+func (l List) Error() string {
+	parts := make([]string, len(l))
+	for i, e := range l {
+		parts[i] = strings.TrimSuffix(e.Format(), "\n")
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// Unwrap exposes the entries to errors.Is/errors.As.
+func (l List) Unwrap() []error {
+	out := make([]error, len(l))
+	for i, e := range l {
+		out[i] = e
+	}
+	return out
+}
+
+// All returns the entries of err when it is (or wraps) a List, and err
+// alone otherwise, for callers that surface each error separately.
+func All(err error) []error {
+	var l List
+	if errors.As(err, &l) {
+		return l.Unwrap()
+	}
+	return []error{err}
+}
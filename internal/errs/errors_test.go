@@ -1,13 +1,14 @@
 package errs
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 )
 
 func TestError_Format(t *testing.T) {
-	pos := Position{File: "test.fn", Line: 3, Col: 5}
+	pos := Position{File: "test.fn", Line: 2, Col: 4}
 	e := New("E1001", "unexpected token", pos, "expected `:`")
 	got := e.Format()
 	assert.Contains(t, got, "error[E1001]")
@@ -23,3 +24,38 @@ func TestError_Format_WithoutHint(t *testing.T) {
 	assert.Contains(t, got, "error[E0001]")
 	assert.NotContains(t, got, "help:")
 }
+
+func TestList_FormatsEveryEntry(t *testing.T) {
+	l := List{
+		New("E2001", "undefined variable: a", Position{File: "t.fn"}, ""),
+		New("E2010", "type mismatch", Position{File: "t.fn", Line: 4}, "expected int here"),
+	}
+	got := l.Error()
+	assert.Contains(t, got, "error[E2001]")
+	assert.Contains(t, got, "t.fn:1:1")
+	assert.Contains(t, got, "error[E2010]")
+	assert.Contains(t, got, "t.fn:5:1")
+
+	var first *Error
+	assert.True(t, errors.As(error(l), &first))
+	assert.Equal(t, "E2001", first.Code)
+}
+
+func TestError_FormatsStackTrace(t *testing.T) {
+	cause := errors.New("vm: division by zero")
+	e := &Error{
+		Code:    "E2030",
+		Message: "division by zero",
+		Pos:     Position{File: "t.fn", Line: 1, Col: 11},
+		Trace: []Frame{
+			{Function: "ratio", Pos: Position{File: "t.fn", Line: 1, Col: 11}},
+			{Function: "main", Pos: Position{File: "t.fn", Line: 3, Col: 0}},
+			{Function: "init"},
+		},
+		Err: cause,
+	}
+	got := e.Format()
+	assert.Contains(t, got, "error[E2030]: division by zero\n --> t.fn:2:12\n")
+	assert.Contains(t, got, "stack trace:\n    at ratio (t.fn:2:12)\n    at main (t.fn:4:1)\n    at init (<unknown>)\n")
+	assert.ErrorIs(t, e, cause)
+}
@@ -0,0 +1,79 @@
+package evaluator
+
+import (
+	"errors"
+
+	"github.com/jiejie-dev/funny/v2/internal/ast"
+	"github.com/jiejie-dev/funny/v2/internal/errs"
+)
+
+// deferStack holds the calls `defer` registered in one function or plan
+// step body, with their arguments already evaluated.
+type deferStack struct {
+	calls []deferredCall
+}
+
+type deferredCall struct {
+	call func([]any) (any, error)
+	args []any
+}
+
+// execDefer evaluates a `defer`'s callee and arguments and registers the
+// call with the running function or step body.
+func (e *Evaluator) execDefer(n *ast.DeferStmt) error {
+	if e.defers == nil {
+		return errs.New("E2064", "defer outside a function or plan step", toErrPos(n.NodePos), "")
+	}
+	call, args, err := e.prepareCall(n.Call)
+	if err != nil {
+		return err
+	}
+	e.defers.calls = append(e.defers.calls, deferredCall{call: call, args: args})
+	return nil
+}
+
+// run makes the deferred calls, last registered first. A failing call
+// doesn't stop the rest; their errors come back joined. Cancellation is
+// suspended meanwhile: cleanup registered by a step that timed out still
+// runs to completion.
+func (d *deferStack) run(e *Evaluator) error {
+	if len(d.calls) == 0 {
+		return nil
+	}
+	ctx := e.ctx
+	e.ctx = nil
+	defer func() { e.ctx = ctx }()
+	var failed []error
+	for i := len(d.calls) - 1; i >= 0; i-- {
+		if _, err := d.calls[i].call(d.calls[i].args); err != nil {
+			failed = append(failed, err)
+		}
+	}
+	d.calls = nil
+	return errors.Join(failed...)
+}
+
+// BeginDefers starts collecting the `defer`s of a plan step body. The
+// returned function runs them and must be called however the body exits;
+// it returns err joined with any error the deferred calls raise.
+func (e *Evaluator) BeginDefers() (end func(err error) error) {
+	saved := e.defers
+	e.defers = &deferStack{}
+	return func(err error) error {
+		err = joinDeferred(err, e.defers.run(e))
+		e.defers = saved
+		return err
+	}
+}
+
+// joinDeferred adds the error of deferred calls to err, leaving err
+// itself (and its type) untouched when they succeeded.
+func joinDeferred(err, deferErr error) error {
+	if deferErr == nil {
+		return err
+	}
+	if err == nil {
+		return deferErr
+	}
+	return errors.Join(err, deferErr)
+}
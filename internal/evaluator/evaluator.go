@@ -9,6 +9,7 @@ import (
 
 	"github.com/jiejie-dev/funny/v2/internal/ast"
 	"github.com/jiejie-dev/funny/v2/internal/errs"
+	"github.com/jiejie-dev/funny/v2/internal/stdlib"
 	"github.com/jiejie-dev/funny/v2/internal/typederror"
 	"github.com/jiejie-dev/funny/v2/internal/strfmt"
 )
@@ -22,6 +23,7 @@ type Evaluator struct {
 	scope     *Scope
 	loopDepth int
 	ctx       context.Context
+	defers    *deferStack // of the running function or plan step body
 }
 
 func New(scope *Scope) *Evaluator {
@@ -84,23 +86,37 @@ func (e *Evaluator) Eval(node ast.Expression) (any, error) {
 			out = append(out, v)
 		}
 		return out, nil
+	case *ast.RangeExpr:
+		start, end, step, err := e.evalRange(n)
+		if err != nil {
+			return nil, err
+		}
+		return stdlib.Range(start, end, step), nil
 	case *ast.IndexExpr:
 		obj, err := e.Eval(n.Object)
 		if err != nil {
 			return nil, err
 		}
+		if n.Slice {
+			return e.evalSlice(n, obj)
+		}
 		idx, err := e.Eval(n.Index)
 		if err != nil {
 			return nil, err
 		}
-		if m, ok := obj.(map[string]any); ok {
-			ks, ok := idx.(string)
+		switch m := obj.(type) {
+		case *stdlib.Map:
+			v, ok := m.Get(idx)
 			if !ok {
-				ks = fmt.Sprintf("%v", idx)
+				return nil, errs.New("E2051", fmt.Sprintf("key not found: %s", stdlib.Literal(idx)), toErrPos(n.NodePos), "")
 			}
+			return v, nil
+		case map[string]any:
+			// A JSON object from parse_json.
+			ks, _ := idx.(string)
 			v, ok := m[ks]
 			if !ok {
-				return nil, errs.New("E2051", fmt.Sprintf("key not found: %q", ks), toErrPos(n.NodePos), "")
+				return nil, errs.New("E2051", fmt.Sprintf("key not found: %s", stdlib.Literal(idx)), toErrPos(n.NodePos), "")
 			}
 			return v, nil
 		}
@@ -132,23 +148,58 @@ func (e *Evaluator) Eval(node ast.Expression) (any, error) {
 	case *ast.FStringExpr:
 		return e.evalFString(n)
 	case *ast.StructLiteralExpr:
-		fields := map[string]any{}
-		for k, v := range n.Fields {
-			val, err := e.Eval(v)
-			if err != nil {
-				return nil, err
-			}
-			fields[k] = val
-		}
-		return typederror.TagStruct(n.TypeName, fields), nil
+		return e.evalStructLiteral(n)
 	case *ast.MapLiteralExpr:
 		return e.evalMapLiteral(n)
+	case *ast.SetLiteralExpr:
+		return e.evalSetLiteral(n)
 	}
 	return nil, errs.New("E2002", fmt.Sprintf("cannot eval %T", node), toErrPos(node.Pos()), "")
 }
 
+// evalSlice evaluates the bounds of `obj[lo:hi]` (nil when omitted) and
+// slices obj with the same rules as the VM's SLICE (see stdlib.Slice).
+func (e *Evaluator) evalSlice(n *ast.IndexExpr, obj any) (any, error) {
+	bounds := [2]any{}
+	for i, b := range []ast.Expression{n.Low, n.High} {
+		if b == nil {
+			continue
+		}
+		v, err := e.Eval(b)
+		if err != nil {
+			return nil, err
+		}
+		bounds[i] = v
+	}
+	out, err := stdlib.Slice(obj, bounds[0], bounds[1])
+	if err != nil {
+		return nil, errs.New("E2050", err.Error(), toErrPos(n.NodePos), "")
+	}
+	return out, nil
+}
+
+// evalRange evaluates the start, end and step of a range expression.
+func (e *Evaluator) evalRange(n *ast.RangeExpr) (int, int, int, error) {
+	parts := [3]any{}
+	for i, p := range []ast.Expression{n.Start, n.End, n.Step} {
+		if p == nil {
+			continue
+		}
+		v, err := e.Eval(p)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		parts[i] = v
+	}
+	start, end, step, err := stdlib.RangeArgs(parts[0], parts[1], parts[2])
+	if err != nil {
+		return 0, 0, 0, errs.New("E2011", err.Error(), toErrPos(n.NodePos), "")
+	}
+	return start, end, step, nil
+}
+
 // assignIndex evaluates `obj[idx] = val`. Go lists ([]any) and maps
-// (map[string]any) are both reference types, so mutating the element/entry
+// (*stdlib.Map) are both reference types, so mutating the element/entry
 // after evaluating n.Object is visible through any other reference to the
 // same underlying list/map (e.g. the variable it came from).
 func (e *Evaluator) assignIndex(n *ast.IndexExpr, val any) error {
@@ -160,10 +211,16 @@ func (e *Evaluator) assignIndex(n *ast.IndexExpr, val any) error {
 	if err != nil {
 		return err
 	}
-	if m, ok := obj.(map[string]any); ok {
+	switch m := obj.(type) {
+	case *stdlib.Map:
+		if err := m.Set(idx, val); err != nil {
+			return errs.New("E2050", err.Error(), toErrPos(n.NodePos), "")
+		}
+		return nil
+	case map[string]any:
 		ks, ok := idx.(string)
 		if !ok {
-			ks = fmt.Sprintf("%v", idx)
+			return errs.New("E2050", "object key must be str", toErrPos(n.NodePos), "")
 		}
 		m[ks] = val
 		return nil
@@ -200,10 +257,9 @@ func (e *Evaluator) assignField(n *ast.FieldExpr, val any) error {
 }
 
 // evalMapLiteral evaluates a `{key: value, ...}` literal into a
-// map[string]any, coercing non-string keys the same way the VM's BUILD_MAP
-// instruction does, so both execution paths agree on runtime representation.
+// *stdlib.Map, the same runtime value the VM's BUILD_MAP builds.
 func (e *Evaluator) evalMapLiteral(n *ast.MapLiteralExpr) (any, error) {
-	m := make(map[string]any, len(n.Keys))
+	m := stdlib.NewMap(len(n.Keys))
 	for i, k := range n.Keys {
 		kv, err := e.Eval(k)
 		if err != nil {
@@ -213,15 +269,29 @@ func (e *Evaluator) evalMapLiteral(n *ast.MapLiteralExpr) (any, error) {
 		if err != nil {
 			return nil, err
 		}
-		ks, ok := kv.(string)
-		if !ok {
-			ks = fmt.Sprintf("%v", kv)
+		if err := m.Set(kv, vv); err != nil {
+			return nil, errs.New("E2050", err.Error(), toErrPos(k.Pos()), "")
 		}
-		m[ks] = vv
 	}
 	return m, nil
 }
 
+// evalSetLiteral evaluates a `set{...}` literal into a *stdlib.Set, the
+// same runtime value the VM's BUILD_SET builds.
+func (e *Evaluator) evalSetLiteral(n *ast.SetLiteralExpr) (any, error) {
+	s := stdlib.NewSet(len(n.Elements))
+	for _, el := range n.Elements {
+		v, err := e.Eval(el)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.Add(v); err != nil {
+			return nil, errs.New("E2050", err.Error(), toErrPos(el.Pos()), "")
+		}
+	}
+	return s, nil
+}
+
 // evalFString evaluates an f-string by concatenating literal text with the
 // formatted result of each interpolated expression.
 func (e *Evaluator) evalFString(n *ast.FStringExpr) (any, error) {
@@ -289,9 +359,9 @@ func applyBinary(op string, l, r any) (any, error) {
 			}
 		}
 	case "==":
-		return l == r || equalsLoose(l, r), nil
+		return stdlib.Equal(l, r), nil
 	case "!=":
-		return !(l == r || equalsLoose(l, r)), nil
+		return !stdlib.Equal(l, r), nil
 	case "<":
 		return compare(l, r) < 0, nil
 	case ">":
@@ -305,9 +375,12 @@ func applyBinary(op string, l, r any) (any, error) {
 	case "or":
 		return truthy(l) || truthy(r), nil
 	case "in":
+		if s, ok := r.(*stdlib.Set); ok {
+			return s.Has(l), nil
+		}
 		if list, ok := r.([]any); ok {
 			for _, v := range list {
-				if v == l {
+				if stdlib.Equal(v, l) {
 					return true, nil
 				}
 			}
@@ -317,15 +390,6 @@ func applyBinary(op string, l, r any) (any, error) {
 	return nil, errs.New("E2031", fmt.Sprintf("unsupported binary op: %s", op), errs.Position{}, "")
 }
 
-func equalsLoose(l, r any) bool {
-	if li, ok := l.(int); ok {
-		if rf, ok := r.(float64); ok {
-			return float64(li) == rf
-		}
-	}
-	return false
-}
-
 func compare(l, r any) int {
 	if li, ok := l.(int); ok {
 		if ri, ok := r.(int); ok {
@@ -363,61 +427,244 @@ func truthy(v any) bool {
 }
 
 func (e *Evaluator) evalCall(n *ast.CallExpr) (any, error) {
+	call, args, err := e.prepareCall(n)
+	if err != nil {
+		return nil, err
+	}
+	return call(args)
+}
+
+// prepareCall resolves n's callee and evaluates its arguments, returning
+// them together with the function that makes the call: evalCall makes it
+// straight away, a `defer` keeps both until its function or step exits.
+func (e *Evaluator) prepareCall(n *ast.CallExpr) (func([]any) (any, error), []any, error) {
+	if fe, ok := n.Func.(*ast.FieldExpr); ok {
+		return e.prepareMethodCall(n, fe)
+	}
 	fn, ok := n.Func.(*ast.VariableExpr)
 	if !ok {
-		return nil, errs.New("E2070", "only direct function calls supported in M1", toErrPos(n.NodePos), "")
+		return nil, nil, errs.New("E2070", "only direct function calls supported in M1", toErrPos(n.NodePos), "")
+	}
+	if fn.Name == "decode_json" || fn.Name == "encode_json" {
+		return e.prepareJSONCall(n, fn.Name)
 	}
 	if isBuiltin(fn.Name) {
-		args := make([]any, len(n.Args))
-		for i, a := range n.Args {
-			v, err := e.Eval(a)
-			if err != nil {
-				return nil, err
-			}
-			args[i] = v
+		args, err := e.evalArgs(nil, n.Args)
+		if err != nil {
+			return nil, nil, err
 		}
-		return callBuiltin(fn.Name, args)
+		return func(args []any) (any, error) { return callBuiltin(fn.Name, args) }, args, nil
 	}
 	v, ok := e.scope.Get(fn.Name)
 	if !ok {
-		return nil, errs.New("E2071", fmt.Sprintf("undefined function: %s", fn.Name), toErrPos(n.NodePos), "")
+		return nil, nil, errs.New("E2071", fmt.Sprintf("undefined function: %s", fn.Name), toErrPos(n.NodePos), "")
 	}
 	userFn, ok := v.(*ast.FnDecl)
+	if _, isStruct := v.(*ast.StructDecl); isStruct {
+		if lit, isLit := n.EmptyStructLiteral(); isLit {
+			return func([]any) (any, error) { return e.evalStructLiteral(lit) }, nil, nil
+		}
+	}
 	if !ok {
-		return nil, errs.New("E2072", fmt.Sprintf("%s is not a function", fn.Name), toErrPos(n.NodePos), "")
+		return nil, nil, errs.New("E2072", fmt.Sprintf("%s is not a function", fn.Name), toErrPos(n.NodePos), "")
 	}
 	if len(n.Args) != len(userFn.Params) {
-		return nil, errs.New("E2073",
+		return nil, nil, errs.New("E2073",
 			fmt.Sprintf("%s expects %d args, got %d", fn.Name, len(userFn.Params), len(n.Args)),
 			toErrPos(n.NodePos), "")
 	}
-	callScope := NewScope(e.scope)
-	for i, p := range userFn.Params {
-		av, err := e.Eval(n.Args[i])
+	args, err := e.evalArgs(nil, n.Args)
+	if err != nil {
+		return nil, nil, err
+	}
+	return func(args []any) (any, error) { return e.callUserFn(userFn, args) }, args, nil
+}
+
+// prepareMethodCall resolves `obj.method(args)`: the receiver's struct type
+// comes from its __type tag, and the method from that struct's declaration
+// in scope. The receiver is the first argument. Struct values are maps, so
+// a `mut self` method's field assignments are visible to the caller
+// without copying anything back.
+func (e *Evaluator) prepareMethodCall(n *ast.CallExpr, fe *ast.FieldExpr) (func([]any) (any, error), []any, error) {
+	recv, err := e.Eval(fe.Object)
+	if err != nil {
+		return nil, nil, err
+	}
+	typeName := typederror.TypeOf(recv)
+	decl, _ := e.scope.Get(typeName)
+	sd, ok := decl.(*ast.StructDecl)
+	if !ok || typeName == "str" {
+		return nil, nil, errs.New("E2072", fmt.Sprintf("method call %s requires a struct receiver", fe.Field), toErrPos(n.NodePos), "")
+	}
+	m := sd.Method(fe.Field)
+	if m == nil {
+		return nil, nil, errs.New("E2072", fmt.Sprintf("struct %s has no method %q", sd.Name, fe.Field), toErrPos(n.NodePos), "")
+	}
+	if len(n.Args) != len(m.Params)-1 {
+		return nil, nil, errs.New("E2073",
+			fmt.Sprintf("%s.%s expects %d args, got %d", sd.Name, m.Name, len(m.Params)-1, len(n.Args)),
+			toErrPos(n.NodePos), "")
+	}
+	args, err := e.evalArgs([]any{recv}, n.Args)
+	if err != nil {
+		return nil, nil, err
+	}
+	return func(args []any) (any, error) { return e.callUserFn(m, args) }, args, nil
+}
+
+// prepareJSONCall resolves decode_json(Type, s) and encode_json(v): like
+// the compiler, it passes the builtin a schema built from the struct
+// declarations in scope ahead of the value argument (see stdlib.Schema).
+func (e *Evaluator) prepareJSONCall(n *ast.CallExpr, name string) (func([]any) (any, error), []any, error) {
+	decls := stdlib.TypeDecls{Structs: map[string]*ast.StructDecl{}, Aliases: map[string]string{}}
+	for k, v := range e.scope.Bindings() {
+		switch d := v.(type) {
+		case *ast.StructDecl:
+			decls.Structs[k] = d
+		case *ast.TypeAliasDecl:
+			decls.Aliases[k] = d.Target
+		}
+	}
+	want := 1
+	if name == "decode_json" {
+		want = 2
+	}
+	if len(n.Args) != want {
+		return nil, nil, errs.New("E2073", fmt.Sprintf("%s expects %d args, got %d", name, want, len(n.Args)), toErrPos(n.NodePos), "")
+	}
+	schema := stdlib.EncodeSchema(decls)
+	value := n.Args[0]
+	if name == "decode_json" {
+		typeName, ok := n.Args[0].(*ast.VariableExpr)
+		if !ok {
+			return nil, nil, errs.New("E2076", "decode_json: first argument must be a struct name", toErrPos(n.NodePos), "")
+		}
+		var err error
+		if schema, err = stdlib.DecodeSchema(typeName.Name, decls); err != nil {
+			return nil, nil, errs.New("E2076", err.Error(), toErrPos(n.NodePos), "")
+		}
+		value = n.Args[1]
+	}
+	args, err := e.evalArgs([]any{schema.Encode()}, []ast.Expression{value})
+	if err != nil {
+		return nil, nil, err
+	}
+	if name == "decode_json" {
+		hooks := structHooks{e, decls.Structs}
+		return func(args []any) (any, error) { return stdlib.DecodeJSON(args, hooks) }, args, nil
+	}
+	return func(args []any) (any, error) { return callBuiltin(name, args) }, args, nil
+}
+
+// structHooks lets decode_json finish a decoded struct as evalStructLiteral
+// finishes a literal: evaluating the defaults of omitted fields and
+// calling validate.
+type structHooks struct {
+	e     *Evaluator
+	decls map[string]*ast.StructDecl
+}
+
+func (h structHooks) Default(structName, field string) (any, error) {
+	for _, f := range h.decls[structName].Fields {
+		if f.Name == field {
+			return h.e.Eval(f.Default)
+		}
+	}
+	return nil, fmt.Errorf("%s has no field %s", structName, field)
+}
+
+func (h structHooks) Validate(structName string, value any) (any, error) {
+	return h.e.callUserFn(h.decls[structName].Method("validate"), []any{value})
+}
+
+// evalArgs appends the values of exprs, in order, to vals.
+func (e *Evaluator) evalArgs(vals []any, exprs []ast.Expression) ([]any, error) {
+	for _, a := range exprs {
+		v, err := e.Eval(a)
 		if err != nil {
 			return nil, err
 		}
-		callScope.Set(p.Name, av)
+		vals = append(vals, v)
 	}
-	saved := e.scope
-	e.scope = callScope
-	defer func() { e.scope = saved }()
-	ret, hasRet, err := e.execBlock(userFn.Body)
+	return vals, nil
+}
+
+// evalStructLiteral builds a struct value, evaluating the declared default
+// of every field the literal omits. A struct with a `validate` method
+// yields that method's err Result, or ok(value) if it returns ok.
+func (e *Evaluator) evalStructLiteral(n *ast.StructLiteralExpr) (any, error) {
+	fields := map[string]any{}
+	for k, v := range n.Fields {
+		val, err := e.Eval(v)
+		if err != nil {
+			return nil, err
+		}
+		fields[k] = val
+	}
+	decl, _ := e.scope.Get(n.TypeName)
+	sd, ok := decl.(*ast.StructDecl)
+	if !ok {
+		return typederror.TagStruct(n.TypeName, fields), nil
+	}
+	for _, f := range sd.Fields {
+		if _, given := fields[f.Name]; given || f.Default == nil {
+			continue
+		}
+		val, err := e.Eval(f.Default)
+		if err != nil {
+			return nil, err
+		}
+		fields[f.Name] = val
+	}
+	s := typederror.TagStruct(n.TypeName, fields)
+	validate := sd.Method("validate")
+	if validate == nil {
+		return s, nil
+	}
+	res, err := e.callUserFn(validate, []any{s})
+	if err != nil {
+		return nil, err
+	}
+	if m, ok := res.(map[string]any); ok && m["tag"] == "err" {
+		return res, nil
+	}
+	return stdlib.MakeResult("ok", s), nil
+}
+
+// callUserFn runs fn's body in a new scope with its params bound to args,
+// then the calls the body deferred, however it exits (see deferStack).
+func (e *Evaluator) callUserFn(fn *ast.FnDecl, args []any) (ret any, err error) {
+	callScope := NewScope(e.scope)
+	for i, p := range fn.Params {
+		callScope.Set(p.Name, args[i])
+	}
+	saved, savedDefers := e.scope, e.defers
+	e.scope, e.defers = callScope, &deferStack{}
+	defer func() {
+		err = joinDeferred(err, e.defers.run(e))
+		e.scope, e.defers = saved, savedDefers
+	}()
+	v, hasRet, err := e.execBlock(fn.Body, true)
 	if err != nil {
 		return nil, err
 	}
 	if hasRet {
-		return ret, nil
+		return v, nil
 	}
 	return nil, nil
 }
 
-func (e *Evaluator) execBlock(b *ast.Block) (any, bool, error) {
+// execBlock runs a block's statements. has reports a `return` (with its
+// value). When asResult is set - a function body, or an if/match that is
+// itself in result position - a trailing expression statement is the
+// block's value and is reported the same way; anywhere else (a loop body,
+// an if in the middle of a function) it is just evaluated.
+func (e *Evaluator) execBlock(b *ast.Block, asResult bool) (any, bool, error) {
 	for i, s := range b.Statements {
 		if err := e.checkCancel(); err != nil {
 			return nil, false, err
 		}
-		isLast := i == len(b.Statements)-1
+		isLast := asResult && i == len(b.Statements)-1
 		if es, ok := s.(*ast.ExprStmt); ok && isLast {
 			v, err := e.Eval(es.X)
 			if err != nil {
@@ -425,7 +672,7 @@ func (e *Evaluator) execBlock(b *ast.Block) (any, bool, error) {
 			}
 			return v, true, nil
 		}
-		v, has, err := e.execStmt(s)
+		v, has, err := e.execStmtResult(s, isLast)
 		if err != nil {
 			if errors.Is(err, errLoopBreak) || errors.Is(err, errLoopContinue) {
 				return nil, false, err
@@ -460,7 +707,7 @@ func (e *Evaluator) ExecCell(prog *ast.Program) (result any, showResult bool, er
 				}
 				return v, true, nil
 			}
-			v, has, err := e.execStmt(s)
+			v, has, err := e.execStmtResult(s, true)
 			if err != nil {
 				if errors.Is(err, errLoopBreak) {
 					return nil, false, errs.New("E2012", "break outside for/while", toErrPos(s.Pos()), "")
@@ -488,7 +735,39 @@ func (e *Evaluator) ExecCell(prog *ast.Program) (result any, showResult bool, er
 	return nil, false, nil
 }
 
+// execForIteration runs one iteration of a for loop's body with its
+// variable bound to item. brk reports a `break`; has reports a return out
+// of the enclosing function, with its value in v.
+func (e *Evaluator) execForIteration(n *ast.ForStmt, item any) (v any, brk, has bool, err error) {
+	if err := e.checkCancel(); err != nil {
+		return nil, false, false, err
+	}
+	saved := e.scope
+	iterScope := NewScope(e.scope)
+	iterScope.Set(n.Name, item)
+	e.scope = iterScope
+	v, has, err = e.execBlock(n.Body, false)
+	e.scope = saved
+	if err != nil {
+		if errors.Is(err, errLoopBreak) {
+			return nil, true, false, nil
+		}
+		if errors.Is(err, errLoopContinue) {
+			return nil, false, false, nil
+		}
+		return nil, false, false, err
+	}
+	return v, false, has, nil
+}
+
 func (e *Evaluator) execStmt(s ast.Statement) (any, bool, error) {
+	return e.execStmtResult(s, false)
+}
+
+// execStmtResult runs a statement; asResult marks an if/match in result
+// position, whose branches' trailing expressions are its value (see
+// execBlock).
+func (e *Evaluator) execStmtResult(s ast.Statement, asResult bool) (any, bool, error) {
 	if err := e.checkCancel(); err != nil {
 		return nil, false, err
 	}
@@ -500,6 +779,13 @@ func (e *Evaluator) execStmt(s ast.Statement) (any, bool, error) {
 		}
 		e.scope.Set(n.Name, v)
 		return nil, false, nil
+	case *ast.ConstDecl:
+		v, err := e.Eval(n.Value)
+		if err != nil {
+			return nil, false, err
+		}
+		e.scope.SetConst(n.Name, v)
+		return nil, false, nil
 	case *ast.AssignStmt:
 		v, err := e.Eval(n.Value)
 		if err != nil {
@@ -534,47 +820,53 @@ func (e *Evaluator) execStmt(s ast.Statement) (any, bool, error) {
 			return nil, false, err
 		}
 		if truthy(cond) {
-			return e.execBlock(n.Then)
+			return e.execBlock(n.Then, asResult)
 		}
 		if n.ElseIf != nil {
-			return e.execStmt(n.ElseIf)
+			return e.execStmtResult(n.ElseIf, asResult)
 		}
 		if n.ElseBlock != nil {
-			return e.execBlock(n.ElseBlock)
+			return e.execBlock(n.ElseBlock, asResult)
 		}
 		return nil, false, nil
 	case *ast.ForStmt:
+		e.loopDepth++
+		defer func() { e.loopDepth-- }()
+		// A range iterable is counted directly instead of materialized.
+		if r, ok := n.Iterable.(*ast.RangeExpr); ok {
+			start, end, step, err := e.evalRange(r)
+			if err != nil {
+				return nil, false, err
+			}
+			for i := start; stdlib.InRange(i, end, step); i += step {
+				v, brk, has, err := e.execForIteration(n, i)
+				if err != nil || has {
+					return v, has, err
+				}
+				if brk {
+					break
+				}
+			}
+			return nil, false, nil
+		}
 		iterable, err := e.Eval(n.Iterable)
 		if err != nil {
 			return nil, false, err
 		}
 		list, ok := iterable.([]any)
+		if s, isSet := iterable.(*stdlib.Set); isSet {
+			list, ok = s.Elems(), true
+		}
 		if !ok {
-			return nil, false, errs.New("E2011", "for-in requires list", toErrPos(n.NodePos), "")
+			return nil, false, errs.New("E2011", "for-in requires list or set", toErrPos(n.NodePos), "")
 		}
-		e.loopDepth++
-		defer func() { e.loopDepth-- }()
 		for _, item := range list {
-			if err := e.checkCancel(); err != nil {
-				return nil, false, err
+			v, brk, has, err := e.execForIteration(n, item)
+			if err != nil || has {
+				return v, has, err
 			}
-			saved := e.scope
-			iterScope := NewScope(e.scope)
-			iterScope.Set(n.Name, item)
-			e.scope = iterScope
-			_, has, err := e.execBlock(n.Body)
-			e.scope = saved
-			if err != nil {
-				if errors.Is(err, errLoopBreak) {
-					break
-				}
-				if errors.Is(err, errLoopContinue) {
-					continue
-				}
-				return nil, false, err
-			}
-			if has {
-				return nil, true, nil
+			if brk {
+				break
 			}
 		}
 		return nil, false, nil
@@ -592,7 +884,7 @@ func (e *Evaluator) execStmt(s ast.Statement) (any, bool, error) {
 			if !truthy(cond) {
 				break
 			}
-			_, has, err := e.execBlock(n.Body)
+			v, has, err := e.execBlock(n.Body, false)
 			if err != nil {
 				if errors.Is(err, errLoopBreak) {
 					break
@@ -603,7 +895,7 @@ func (e *Evaluator) execStmt(s ast.Statement) (any, bool, error) {
 				return nil, false, err
 			}
 			if has {
-				return nil, true, nil
+				return v, true, nil
 			}
 		}
 		return nil, false, nil
@@ -613,14 +905,21 @@ func (e *Evaluator) execStmt(s ast.Statement) (any, bool, error) {
 			return nil, false, err
 		}
 		for _, arm := range n.Arms {
-			matched, err := e.patternMatches(scrutinee, arm.Pattern)
+			binds, matched, err := e.matchArm(scrutinee, arm)
 			if err != nil {
 				return nil, false, err
 			}
 			if !matched {
 				continue
 			}
-			v, has, err := e.execBlock(arm.Body)
+			saved := e.scope
+			armScope := NewScope(e.scope)
+			for name, v := range binds {
+				armScope.Set(name, v)
+			}
+			e.scope = armScope
+			v, has, err := e.execBlock(arm.Body, asResult)
+			e.scope = saved
 			if err != nil {
 				if errors.Is(err, errLoopBreak) || errors.Is(err, errLoopContinue) {
 					return nil, false, err
@@ -661,6 +960,15 @@ func (e *Evaluator) execStmt(s ast.Statement) (any, bool, error) {
 	case *ast.StructDecl:
 		e.scope.Set(n.Name, n)
 		return nil, false, nil
+	case *ast.TypeAliasDecl:
+		// Aliases otherwise only constrain type checking; decode_json
+		// resolves field types through them (see jsonSchema).
+		e.scope.Set(n.Name, n)
+		return nil, false, nil
+	case *ast.InterfaceDecl:
+		// Interfaces only constrain type checking; evalMethodCall
+		// already dispatches on the receiver's runtime struct type.
+		return nil, false, nil
 	case *ast.MetaBlock:
 		return nil, false, nil
 	case *ast.PlanBlock:
@@ -671,6 +979,8 @@ func (e *Evaluator) execStmt(s ast.Statement) (any, bool, error) {
 		return nil, false, nil
 	case *ast.CommentStmt:
 		return nil, false, nil
+	case *ast.DeferStmt:
+		return nil, false, e.execDefer(n)
 	}
 	return nil, false, errs.New("E2014", fmt.Sprintf("cannot exec %T", s), toErrPos(s.Pos()), "")
 }
@@ -679,34 +989,77 @@ func toErrPos(p ast.Pos) errs.Position {
 	return errs.Position{File: p.File, Line: p.Line, Col: p.Col}
 }
 
-func (e *Evaluator) patternMatches(scrutinee any, pattern ast.Expression) (bool, error) {
-	if v, ok := pattern.(*ast.VariableExpr); ok && v.Name == "_" {
-		return true, nil
+// matchArm reports whether scrutinee matches one of arm's alternatives
+// and its guard, returning the names the matching alternative binds.
+func (e *Evaluator) matchArm(scrutinee any, arm ast.MatchArm) (map[string]any, bool, error) {
+	alts := []ast.Expression{arm.Pattern}
+	if or, ok := arm.Pattern.(*ast.OrPattern); ok {
+		alts = or.Alts
 	}
-	if v, ok := pattern.(*ast.VariableExpr); ok {
-		other, ok := e.scope.Get(v.Name)
-		if !ok {
-			return false, errs.New("E2001", fmt.Sprintf("undefined variable: %s", v.Name), toErrPos(v.NodePos), "")
+	for _, alt := range alts {
+		binds := map[string]any{}
+		matched, err := e.patternMatches(scrutinee, alt, binds)
+		if err != nil {
+			return nil, false, err
 		}
-		return valuesEqual(scrutinee, other), nil
-	}
-	pv, err := e.Eval(pattern)
-	if err != nil {
-		return false, err
+		if !matched {
+			continue
+		}
+		if arm.Guard == nil {
+			return binds, true, nil
+		}
+		saved := e.scope
+		guardScope := NewScope(e.scope)
+		for name, v := range binds {
+			guardScope.Set(name, v)
+		}
+		e.scope = guardScope
+		g, err := e.Eval(arm.Guard)
+		e.scope = saved
+		if err != nil {
+			return nil, false, err
+		}
+		return binds, truthy(g), nil
 	}
-	return valuesEqual(scrutinee, pv), nil
+	return nil, false, nil
 }
 
-func valuesEqual(a, b any) bool {
-	if a == b {
-		return true
+// patternMatches matches one pattern (see ast.MatchArm), recording the
+// names it binds in binds.
+func (e *Evaluator) patternMatches(scrutinee any, pattern ast.Expression, binds map[string]any) (bool, error) {
+	switch p := pattern.(type) {
+	case *ast.VariableExpr:
+		if e.scope.IsConst(p.Name) {
+			break
+		}
+		if p.Name != "_" {
+			binds[p.Name] = scrutinee
+		}
+		return true, nil
+	case *ast.CallExpr:
+		if v, ok := p.Func.(*ast.VariableExpr); ok && (v.Name == "ok" || v.Name == "err") && len(p.Args) == 1 {
+			r, ok := scrutinee.(map[string]any)
+			if !ok || r["tag"] != v.Name {
+				return false, nil
+			}
+			return e.patternMatches(r["val"], p.Args[0], binds)
+		}
+	case *ast.StructLiteralExpr:
+		m, ok := scrutinee.(map[string]any)
+		if !ok || m[typederror.StructTypeField] != p.TypeName {
+			return false, nil
+		}
+		for name, sub := range p.Fields {
+			matched, err := e.patternMatches(m[name], sub, binds)
+			if err != nil || !matched {
+				return false, err
+			}
+		}
+		return true, nil
 	}
-	eq, err := applyBinary("==", a, b)
+	pv, err := e.Eval(pattern)
 	if err != nil {
-		return false
-	}
-	if b, ok := eq.(bool); ok {
-		return b
+		return false, err
 	}
-	return false
+	return stdlib.Equal(scrutinee, pv), nil
 }
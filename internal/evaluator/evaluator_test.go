@@ -5,6 +5,7 @@ import (
 
 	"github.com/jiejie-dev/funny/v2/internal/ast"
 	"github.com/jiejie-dev/funny/v2/internal/parser"
+	"github.com/jiejie-dev/funny/v2/internal/stdlib"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -45,13 +46,97 @@ func TestEval_IndexExpr_MapRead_MissingKeyErrors(t *testing.T) {
 	require.Error(t, err)
 }
 
+func TestEval_Slice(t *testing.T) {
+	assert.Equal(t, []any{2, 3}, evalExpr(t, `[1, 2, 3, 4][1:3]`))
+	assert.Equal(t, []any{3, 4}, evalExpr(t, `[1, 2, 3, 4][-2:]`))
+	assert.Equal(t, []any{}, evalExpr(t, `[1, 2, 3, 4][3:1]`))
+	assert.Equal(t, "hé", evalExpr(t, `"héllo"[:2]`))
+}
+
+func TestEval_Range(t *testing.T) {
+	assert.Equal(t, []any{0, 1, 2}, evalExpr(t, `0..3`))
+	assert.Equal(t, []any{5, 3, 1}, evalExpr(t, `5..0 step -2`))
+	assert.Equal(t, []any{}, evalExpr(t, `3..0`))
+}
+
+func TestEval_Range_ZeroStepFails(t *testing.T) {
+	for _, src := range []string{
+		"let k = 0\nlet xs = 0..3 step k\n",
+		"let k = 0\nfor i in 0..3 step k:\n    print(i)\n",
+	} {
+		prog, err := parser.New(src, "").Parse()
+		require.NoError(t, err)
+		err = New(nil).Exec(prog)
+		require.Error(t, err, src)
+		assert.Contains(t, err.Error(), "E2011", src)
+		assert.Contains(t, err.Error(), "range step must not be zero", src)
+	}
+}
+
+func TestEval_ForRange_ReturnsFromInsideTheLoop(t *testing.T) {
+	e := execProgram(t, `fn first_above(k: int) -> int:
+    for i in 1..100:
+        if i > k:
+            return i
+    return 0
+let seen = ""
+for i in 0..6 step 2:
+    seen = seen + to_str(i)
+let found = first_above(7)
+`)
+	seen, _ := e.Scope().Get("seen")
+	assert.Equal(t, "024", seen)
+	found, _ := e.Scope().Get("found")
+	assert.Equal(t, 8, found)
+}
+
+func TestEval_MatchPatterns(t *testing.T) {
+	e := execProgram(t, `struct User:
+    name: str
+    age: int
+fn classify(r: Result) -> str:
+    match r:
+        ok(User(name: n, age: a)) if a < 18 =>
+            return n + " (minor)"
+        ok(User(name: n, age: _)) =>
+            return n
+        err(e) =>
+            return "error: " + e
+    return "?"
+let seen = ""
+for x in [1, 2, 3, 7]:
+    match x:
+        1 | 2 =>
+            seen = seen + "s"
+        n if n > 5 =>
+            seen = seen + "b"
+        _ =>
+            seen = seen + "o"
+let a = classify(ok(User(name: "kid", age: 9)))
+let b = classify(ok(User(name: "ann", age: 30)))
+let c = classify(err("missing"))
+`)
+	for name, want := range map[string]any{"seen": "ssob", "a": "kid (minor)", "b": "ann", "c": "error: missing"} {
+		got, _ := e.Scope().Get(name)
+		assert.Equal(t, want, got, name)
+	}
+}
+
+func TestEval_IfInsideFunction_DoesNotEndIt(t *testing.T) {
+	e := execProgram(t, "fn f() -> int:\n    if true:\n        to_str(1)\n    return 5\nlet v = f()\n")
+	v, _ := e.Scope().Get("v")
+	assert.Equal(t, 5, v)
+}
+
 func TestEval_Assign_IndexIntoMap(t *testing.T) {
 	e := execProgram(t, "let m = {\"a\": 1}\nm[\"a\"] = 100\nm[\"b\"] = 2\n")
 	v, ok := e.Scope().Get("m")
 	require.True(t, ok)
-	m := v.(map[string]any)
-	assert.Equal(t, 100, m["a"])
-	assert.Equal(t, 2, m["b"])
+	m := v.(*stdlib.Map)
+	a, _ := m.Get("a")
+	b, _ := m.Get("b")
+	assert.Equal(t, 100, a)
+	assert.Equal(t, 2, b)
 }
 
 func TestEval_Assign_IndexIntoList(t *testing.T) {
@@ -64,26 +149,24 @@ func TestEval_Assign_IndexIntoList(t *testing.T) {
 
 func TestEval_MapLiteral(t *testing.T) {
 	v := evalExpr(t, `{"a": 1, "b": 2}`)
-	m, ok := v.(map[string]any)
-	require.True(t, ok)
-	assert.Equal(t, 1, m["a"])
-	assert.Equal(t, 2, m["b"])
+	want, err := stdlib.MapOf("a", 1, "b", 2)
+	require.NoError(t, err)
+	assert.Equal(t, want, v)
 }
 
 func TestEval_MapLiteral_MultiLine(t *testing.T) {
 	src := "{\n    \"a\": 1,\n    \"b\": 2,\n}"
 	v := evalExpr(t, src)
-	m, ok := v.(map[string]any)
-	require.True(t, ok)
-	assert.Equal(t, 1, m["a"])
-	assert.Equal(t, 2, m["b"])
+	want, err := stdlib.MapOf("a", 1, "b", 2)
+	require.NoError(t, err)
+	assert.Equal(t, want, v)
 }
 
 func TestEval_MapLiteral_Empty(t *testing.T) {
 	v := evalExpr(t, `{}`)
-	m, ok := v.(map[string]any)
+	m, ok := v.(*stdlib.Map)
 	require.True(t, ok)
-	assert.Empty(t, m)
+	assert.Zero(t, m.Len())
 }
 
 func TestEval_FString_Interpolation(t *testing.T) {
@@ -265,3 +348,220 @@ for i in [1, 2, 3, 4]:
 	require.True(t, ok)
 	assert.Equal(t, 7, v)
 }
+
+func TestEval_MethodCall_MutSelfUpdatesReceiver(t *testing.T) {
+	e := execProgram(t, `struct Counter:
+    mut count: int
+
+    fn bump(mut self, by: int):
+        self.count = self.count + by
+
+    fn get(self) -> int:
+        return self.count
+
+let c = Counter(count: 1)
+c.bump(2)
+let n = c.get()
+`)
+	v, ok := e.scope.Get("n")
+	require.True(t, ok)
+	assert.Equal(t, 3, v)
+}
+
+func TestEval_InterfaceCall_DispatchesOnRuntimeType(t *testing.T) {
+	e := execProgram(t, `interface Named:
+    fn label(self) -> str
+
+struct Dog:
+    name: str
+
+    fn label(self) -> str:
+        return "dog " + self.name
+
+struct Cat:
+    name: str
+
+    fn label(self) -> str:
+        return "cat " + self.name
+
+fn greet(n: Named) -> str:
+    return "hi " + n.label()
+
+let a = greet(Dog(name: "rex"))
+let b = greet(Cat(name: "tom"))
+`)
+	a, _ := e.scope.Get("a")
+	b, _ := e.scope.Get("b")
+	assert.Equal(t, "hi dog rex", a)
+	assert.Equal(t, "hi cat tom", b)
+}
+
+func TestEval_StructDefaultsAndValidate(t *testing.T) {
+	e := execProgram(t, `struct Age:
+    n: int
+    unit: str = "y"
+
+    fn validate(self) -> Result:
+        if self.n < 0:
+            return err("negative")
+        return ok(self)
+
+let a = Age(n: 3)
+let b = Age(n: 0 - 1)
+`)
+	a, _ := e.scope.Get("a")
+	res := a.(map[string]any)
+	assert.Equal(t, "ok", res["tag"])
+	assert.Equal(t, "y", res["val"].(map[string]any)["unit"])
+	b, _ := e.scope.Get("b")
+	assert.Equal(t, "err", b.(map[string]any)["tag"])
+	assert.Equal(t, "negative", b.(map[string]any)["val"])
+}
+
+func TestEval_StructDefaults_EmptyCallBuildsStruct(t *testing.T) {
+	e := execProgram(t, `struct Bag:
+    items: list[int] = [1, 2]
+    label: str = "bag"
+
+let b = Bag()
+let s = b.label + to_str(len(b.items))
+`)
+	s, _ := e.scope.Get("s")
+	assert.Equal(t, "bag2", s)
+}
+
+func TestEval_Defer_RunsLastFirstWithEarlyArgs(t *testing.T) {
+	e := execProgram(t, `let log = ""
+fn note(x: str):
+    log = log + x
+fn f(n: int) -> int:
+    defer note("]")
+    defer note(to_str(n))
+    n = n * 10
+    note("[")
+    if n > 5:
+        return n
+    return 0
+let v = f(1)
+`)
+	v, _ := e.Scope().Get("v")
+	assert.Equal(t, 10, v)
+	log, _ := e.Scope().Get("log")
+	assert.Equal(t, "[1]", log)
+}
+
+func TestEval_Defer_RunsOnRuntimeError(t *testing.T) {
+	p := parser.New(`let log = ""
+fn note(x: str):
+    log = log + x
+fn f() -> int:
+    defer note("cleanup")
+    return nope()
+f()
+`, "")
+	prog, err := p.Parse()
+	require.NoError(t, err)
+	e := New(nil)
+	err = e.Exec(prog)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "E2071")
+	log, _ := e.Scope().Get("log")
+	assert.Equal(t, "cleanup", log)
+
+	err = New(nil).Exec(&ast.Program{Stmts: []ast.Statement{&ast.DeferStmt{Call: &ast.CallExpr{Func: &ast.VariableExpr{Name: "println"}}}}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "E2064")
+}
+
+func TestEval_Const_ComparesInMatchPatterns(t *testing.T) {
+	e := execProgram(t, `const LIMIT = 2 * 5
+fn label(n: int) -> str:
+    match n:
+        LIMIT =>
+            return "limit"
+        other =>
+            return to_str(other)
+let a = label(10)
+let b = label(LIMIT - 1)
+`)
+	a, _ := e.Scope().Get("a")
+	assert.Equal(t, "limit", a)
+	b, _ := e.Scope().Get("b")
+	assert.Equal(t, "9", b)
+}
+
+func TestEval_DecodeEncodeJSON(t *testing.T) {
+	e := execProgram(t, `struct Pet:
+    @json("pet_name")
+    name: str
+    age: int?
+let good = decode_json(Pet, "{\"pet_name\": \"rex\"}")
+let bad = decode_json(Pet, "{\"pet_name\": \"rex\", \"age\": \"old\"}")
+let out = encode_json(Pet(name: "tom", age: 2))
+`)
+	good, _ := e.Scope().Get("good")
+	assert.Equal(t, map[string]any{"tag": "ok", "val": map[string]any{"__type": "Pet", "name": "rex", "age": nil}}, good)
+	bad, _ := e.Scope().Get("bad")
+	assert.Equal(t, map[string]any{"tag": "err", "val": "$.age: expected int, got string"}, bad)
+	out, _ := e.Scope().Get("out")
+	assert.Equal(t, `{"age":2,"pet_name":"tom"}`, out)
+}
+
+func TestEval_DecodeJSON_AppliesDefaultsAndValidate(t *testing.T) {
+	e := execProgram(t, `struct P:
+    a: int
+    b: str = "d"
+    fn validate(self) -> Result:
+        if self.a < 0:
+            return err("a is negative")
+        return ok(self)
+let good = decode_json(P, "{\"a\": 1}")
+let bad = decode_json(P, "{\"a\": -1, \"b\": \"x\"}")
+`)
+	good, _ := e.Scope().Get("good")
+	assert.Equal(t, map[string]any{"tag": "ok", "val": map[string]any{"__type": "P", "a": 1, "b": "d"}}, good)
+	bad, _ := e.Scope().Get("bad")
+	assert.Equal(t, map[string]any{"tag": "err", "val": "$: a is negative"}, bad)
+}
+
+func TestEval_Sets(t *testing.T) {
+	e := execProgram(t, `let seen = set{3, 1, 3}
+let more: set[int] = set_union(seen, to_set([2, 1]))
+let order = ""
+for x in more:
+    order = order + to_str(x)
+let found = 2 in more
+`)
+	order, _ := e.Scope().Get("order")
+	assert.Equal(t, "312", order)
+	found, _ := e.Scope().Get("found")
+	assert.Equal(t, true, found)
+	assert.Equal(t, true, evalExpr(t, `set{1, 2} == set{2, 1}`))
+	assert.Equal(t, false, evalExpr(t, `"1" in set{1}`))
+}
+
+func TestEval_MapKeysAndEquality(t *testing.T) {
+	e := execProgram(t, `struct Point:
+    x: int
+    y: int
+
+let names: map[int, str] = {}
+names[1] = "one"
+names[2] = "two"
+let hits = {Point(x: 1, y: 2): "a"}
+hits[Point(x: 1, y: 2)] = "b"
+let same = [Point(x: 0, y: 0)] == [Point(x: 0, y: 0)]
+let found = Point(x: 3, y: 4) in [Point(x: 1, y: 1), Point(x: 3, y: 4)]
+`)
+	names, _ := e.Scope().Get("names")
+	want, err := stdlib.MapOf(1, "one", 2, "two")
+	require.NoError(t, err)
+	assert.Equal(t, want, names)
+	hits, _ := e.Scope().Get("hits")
+	assert.Equal(t, 1, hits.(*stdlib.Map).Len())
+	for _, name := range []string{"same", "found"} {
+		v, _ := e.Scope().Get(name)
+		assert.Equal(t, true, v, name)
+	}
+	assert.Equal(t, false, evalExpr(t, `1 == 1.0`))
+}
@@ -11,6 +11,7 @@ type Scope struct {
 	mu     sync.RWMutex
 	parent *Scope
 	vars   map[string]any
+	consts map[string]bool // names in vars declared with `const`
 }
 
 func NewScope(parent *Scope) *Scope {
@@ -23,6 +24,34 @@ func (s *Scope) Set(name string, value any) {
 	s.mu.Unlock()
 }
 
+// SetConst binds a `const`. It reads like any other variable, but match
+// patterns naming it compare against its value instead of binding.
+func (s *Scope) SetConst(name string, value any) {
+	s.mu.Lock()
+	s.vars[name] = value
+	if s.consts == nil {
+		s.consts = map[string]bool{}
+	}
+	s.consts[name] = true
+	s.mu.Unlock()
+}
+
+// IsConst reports whether name resolves to a `const` binding, rather than
+// to a variable declared closer in.
+func (s *Scope) IsConst(name string) bool {
+	s.mu.RLock()
+	_, isVar := s.vars[name]
+	isConst := s.consts[name]
+	s.mu.RUnlock()
+	if isVar {
+		return isConst
+	}
+	if s.parent != nil {
+		return s.parent.IsConst(name)
+	}
+	return false
+}
+
 func (s *Scope) Get(name string) (any, bool) {
 	s.mu.RLock()
 	v, ok := s.vars[name]
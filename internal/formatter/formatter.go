@@ -96,6 +96,8 @@ func (p *printer) stmt(s ast.Statement) {
 		} else {
 			p.writeLine("return " + p.expr(n.Value))
 		}
+	case *ast.DeferStmt:
+		p.writeLine("defer " + p.expr(n.Call))
 	case *ast.BreakStmt:
 		p.writeLine("break")
 	case *ast.ContinueStmt:
@@ -118,7 +120,11 @@ func (p *printer) stmt(s ast.Statement) {
 		p.writeLine("match " + p.expr(n.Expr) + ":")
 		p.depth++
 		for _, arm := range n.Arms {
-			p.writeLine(p.expr(arm.Pattern) + " =>")
+			if arm.Guard != nil {
+				p.writeLine(p.expr(arm.Pattern) + " if " + p.expr(arm.Guard) + " =>")
+			} else {
+				p.writeLine(p.expr(arm.Pattern) + " =>")
+			}
 			p.block(arm.Body)
 		}
 		p.depth--
@@ -126,6 +132,20 @@ func (p *printer) stmt(s ast.Statement) {
 		p.fnDecl(n)
 	case *ast.StructDecl:
 		p.structDecl(n)
+	case *ast.InterfaceDecl:
+		p.interfaceDecl(n)
+	case *ast.TypeAliasDecl:
+		prefix := ""
+		if n.Pub {
+			prefix = "pub "
+		}
+		p.writeLine(fmt.Sprintf("%stype %s = %s", prefix, n.Name, n.Target))
+	case *ast.ConstDecl:
+		prefix := ""
+		if n.Pub {
+			prefix = "pub "
+		}
+		p.writeLine(fmt.Sprintf("%sconst %s = %s", prefix, n.Name, p.expr(n.Value)))
 	case *ast.MetaBlock:
 		p.metaBlock(n)
 	case *ast.PlanBlock:
@@ -168,6 +188,7 @@ func (p *printer) block(b *ast.Block) {
 }
 
 func (p *printer) fnDecl(n *ast.FnDecl) {
+	p.attributes(n.Attrs)
 	parts := make([]string, len(n.Params))
 	for i, param := range n.Params {
 		parts[i] = param.String()
@@ -180,11 +201,16 @@ func (p *printer) fnDecl(n *ast.FnDecl) {
 	if n.RetType != "" {
 		sig += " -> " + n.RetType
 	}
+	if n.Body == nil {
+		p.writeLine(sig)
+		return
+	}
 	p.writeLine(sig + ":")
 	p.block(n.Body)
 }
 
 func (p *printer) structDecl(n *ast.StructDecl) {
+	p.attributes(n.Attrs)
 	prefix := ""
 	if n.Pub {
 		prefix = "pub "
@@ -192,7 +218,39 @@ func (p *printer) structDecl(n *ast.StructDecl) {
 	p.writeLine(fmt.Sprintf("%sstruct %s:", prefix, n.Name))
 	p.depth++
 	for _, f := range n.Fields {
-		p.writeLine(f.String())
+		p.attributes(f.Attrs)
+		if f.Default == nil {
+			p.writeLine(f.String())
+			continue
+		}
+		def := f
+		def.Default = nil
+		p.writeLine(def.String() + " = " + p.expr(f.Default))
+	}
+	for _, m := range n.Methods {
+		p.fnDecl(m)
+	}
+	p.depth--
+}
+
+// attributes prints a declaration's attributes, one per line.
+func (p *printer) attributes(attrs ast.Attributes) {
+	for _, a := range attrs {
+		p.writeLine(a.String())
+	}
+}
+
+// interfaceDecl prints an interface's body-less method signatures (see
+// fnDecl's nil-Body case).
+func (p *printer) interfaceDecl(n *ast.InterfaceDecl) {
+	prefix := ""
+	if n.Pub {
+		prefix = "pub "
+	}
+	p.writeLine(fmt.Sprintf("%sinterface %s:", prefix, n.Name))
+	p.depth++
+	for _, m := range n.Methods {
+		p.fnDecl(m)
 	}
 	p.depth--
 }
@@ -223,6 +281,7 @@ func (p *printer) metaBlock(n *ast.MetaBlock) {
 // options the next time someone read the "formatted" file - a formatter
 // changing program behavior, not just style, on round-trip.
 func (p *printer) step(n *ast.Step) {
+	p.attributes(n.Attrs)
 	head := fmt.Sprintf("step %q", n.Name)
 	if n.Kind != "" && n.Kind != ast.StepTool {
 		head += " -> " + string(n.Kind)
@@ -274,6 +333,12 @@ func (p *printer) expr(e ast.Expression) string {
 			parts[i] = p.expr(el)
 		}
 		return "[" + strings.Join(parts, ", ") + "]"
+	case *ast.SetLiteralExpr:
+		parts := make([]string, len(n.Elements))
+		for i, el := range n.Elements {
+			parts[i] = p.expr(el)
+		}
+		return "set{" + strings.Join(parts, ", ") + "}"
 	case *ast.MapLiteralExpr:
 		parts := make([]string, len(n.Keys))
 		for i, k := range n.Keys {
@@ -281,7 +346,28 @@ func (p *printer) expr(e ast.Expression) string {
 		}
 		return "{" + strings.Join(parts, ", ") + "}"
 	case *ast.IndexExpr:
+		if n.Slice {
+			var lo, hi string
+			if n.Low != nil {
+				lo = p.expr(n.Low)
+			}
+			if n.High != nil {
+				hi = p.expr(n.High)
+			}
+			return fmt.Sprintf("%s[%s:%s]", p.expr(n.Object), lo, hi)
+		}
 		return fmt.Sprintf("%s[%s]", p.expr(n.Object), p.expr(n.Index))
+	case *ast.OrPattern:
+		parts := make([]string, len(n.Alts))
+		for i, a := range n.Alts {
+			parts[i] = p.expr(a)
+		}
+		return strings.Join(parts, " | ")
+	case *ast.RangeExpr:
+		if n.Step != nil {
+			return fmt.Sprintf("%s..%s step %s", p.expr(n.Start), p.expr(n.End), p.expr(n.Step))
+		}
+		return fmt.Sprintf("%s..%s", p.expr(n.Start), p.expr(n.End))
 	case *ast.FieldExpr:
 		return fmt.Sprintf("%s.%s", p.expr(n.Object), n.Field)
 	case *ast.CallExpr:
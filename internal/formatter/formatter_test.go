@@ -127,6 +127,13 @@ func TestFormat_Match(t *testing.T) {
 	assert.Equal(t, src, out)
 }
 
+func TestFormat_MatchGuardsAndAlternatives(t *testing.T) {
+	src := "match x:\n    1|2 =>\n        println(\"small\")\n    n  if n>3 =>\n        println(n)\n"
+	out, err := Format([]byte(src), "t")
+	require.NoError(t, err)
+	assert.Equal(t, "match x:\n    1 | 2 =>\n        println(\"small\")\n    n if n > 3 =>\n        println(n)\n", out)
+}
+
 func TestFormat_FnDeclWithParamsAndRetType(t *testing.T) {
 	out, err := Format([]byte("fn add(a:int,b:int)->int:\n    return a+b\n"), "t")
 	require.NoError(t, err)
@@ -264,3 +271,55 @@ func TestFormat_ParseErrorPropagates(t *testing.T) {
 	_, err := Format([]byte("let = 5\n"), "t")
 	assert.Error(t, err)
 }
+
+func TestFormat_StructMethods(t *testing.T) {
+	src := "struct Counter:\n    mut count: int\n\n    fn bump(mut self,by:int):\n        self.count=self.count+by\n"
+	out, err := Format([]byte(src), "t")
+	require.NoError(t, err)
+	assert.Equal(t, "struct Counter:\n    mut count: int\n    fn bump(mut self, by: int):\n        self.count = self.count + by\n", out)
+}
+
+func TestFormat_InterfaceDecl(t *testing.T) {
+	src := "pub interface Row:\n\n    fn to_row(self)->list[str]\n    fn width(self,pad:int) -> int\n"
+	out, err := Format([]byte(src), "t")
+	require.NoError(t, err)
+	assert.Equal(t, "pub interface Row:\n    fn to_row(self) -> list[str]\n    fn width(self, pad: int) -> int\n", out)
+}
+
+func TestFormat_TypeAliasAndFieldDefaults(t *testing.T) {
+	src := "pub type   UserId=str\nstruct User:\n    id: UserId\n    age:int=18\n"
+	out, err := Format([]byte(src), "t")
+	require.NoError(t, err)
+	assert.Equal(t, "pub type UserId = str\nstruct User:\n    id: UserId\n    age: int = 18\n", out)
+}
+
+func TestFormat_Range(t *testing.T) {
+	out, err := Format([]byte("for i in 0 .. n  step 2:\n    println(i)\n"), "t")
+	require.NoError(t, err)
+	assert.Equal(t, "for i in 0..n step 2:\n    println(i)\n", out)
+}
+
+func TestFormat_Slice(t *testing.T) {
+	out, err := Format([]byte("let a = xs[ 1 :3]\nlet b = s[ : -2]\nlet c = s[:]\n"), "t")
+	require.NoError(t, err)
+	assert.Equal(t, "let a = xs[1:3]\nlet b = s[:-2]\nlet c = s[:]\n", out)
+}
+
+func TestFormat_Defer(t *testing.T) {
+	out, err := Format([]byte("fn f(c: Conn):\n    defer   c.close( 1 )\n"), "t")
+	require.NoError(t, err)
+	assert.Equal(t, "fn f(c: Conn):\n    defer c.close(1)\n", out)
+}
+
+func TestFormat_Const(t *testing.T) {
+	out, err := Format([]byte("pub const   MAX=10*2\nconst NAME = \"x\"\n"), "t")
+	require.NoError(t, err)
+	assert.Equal(t, "pub const MAX = 10 * 2\nconst NAME = \"x\"\n", out)
+}
+
+func TestFormat_Attributes(t *testing.T) {
+	src := "@deprecated( \"old\" )\n@tool(description:\"d\")\nfn f():\n    println(1)\nstruct S:\n    @json( \"X\" )\n    x: int\n    @test_only\n    fn g(self) -> int:\n        return self.x\n"
+	out, err := Format([]byte(src), "t")
+	require.NoError(t, err)
+	assert.Equal(t, "@deprecated(\"old\")\n@tool(description: \"d\")\nfn f():\n    println(1)\nstruct S:\n    @json(\"X\")\n    x: int\n    @test_only\n    fn g(self) -> int:\n        return self.x\n", out)
+}
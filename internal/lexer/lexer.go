@@ -420,11 +420,19 @@ func (l *Lexer) Next() Token {
 		case '.':
 			l.advance()
 			l.hasEmitted = true
+			if l.pos < len(l.src) && l.src[l.pos] == '.' {
+				l.advance()
+				return l.emit(DOTDOT, "..")
+			}
 			return l.emit(DOT, ".")
 		case ':':
 			l.advance()
 			l.hasEmitted = true
 			return l.emit(COLON, ":")
+		case '|':
+			l.advance()
+			l.hasEmitted = true
+			return l.emit(PIPE, "|")
 		case '?':
 			l.advance()
 			l.hasEmitted = true
@@ -277,6 +277,11 @@ func TestLexer_UnbalancedCloseDoesNotUnderflowDepth(t *testing.T) {
 	assert.Equal(t, 0, l.parenDepth)
 }
 
+func TestLexer_DotDotAfterInt(t *testing.T) {
+	kinds := drain(New("0..n 1.5", ""))
+	assert.Equal(t, []Kind{INT, DOTDOT, NAME, FLOAT, EOF}, kinds)
+}
+
 func drain(l *Lexer) []Kind {
 	var kinds []Kind
 	for {
@@ -22,11 +22,13 @@ const (
 	RBRACE   Kind = "}"
 	COMMA    Kind = ","
 	DOT      Kind = "."
+	DOTDOT   Kind = ".."
 	COLON    Kind = ":"
 	ARROW    Kind = "->"
 	FATARROW Kind = "=>"
 	QUESTION Kind = "?"
 	AT       Kind = "@"
+	PIPE     Kind = "|"
 
 	PLUS    Kind = "+"
 	MINUS   Kind = "-"
@@ -45,39 +47,42 @@ const (
 	COMMENT     Kind = "COMMENT"
 	DOC_COMMENT Kind = "DOC_COMMENT"
 
-	AND      Kind = "and"
-	AS       Kind = "as"
-	BREAK    Kind = "break"
-	CONTINUE Kind = "continue"
-	ELIF     Kind = "elif"
-	ELSE     Kind = "else"
-	FALSE    Kind = "false"
-	FN       Kind = "fn"
-	FOR      Kind = "for"
-	IF       Kind = "if"
-	IMPORT   Kind = "import"
-	IN       Kind = "in"
-	LET      Kind = "let"
-	MATCH    Kind = "match"
-	META     Kind = "meta"
-	MUT      Kind = "mut"
-	NIL      Kind = "nil"
-	NOT      Kind = "not"
-	OR       Kind = "or"
-	PLAN     Kind = "plan"
-	PUB      Kind = "pub"
-	RETURN   Kind = "return"
-	STEP     Kind = "step"
-	STRUCT   Kind = "struct"
-	TEST     Kind = "test"
-	TRUE     Kind = "true"
-	WHILE    Kind = "while"
+	AND       Kind = "and"
+	AS        Kind = "as"
+	BREAK     Kind = "break"
+	CONST     Kind = "const"
+	CONTINUE  Kind = "continue"
+	DEFER     Kind = "defer"
+	ELIF      Kind = "elif"
+	ELSE      Kind = "else"
+	FALSE     Kind = "false"
+	FN        Kind = "fn"
+	FOR       Kind = "for"
+	IF        Kind = "if"
+	IMPORT    Kind = "import"
+	IN        Kind = "in"
+	INTERFACE Kind = "interface"
+	LET       Kind = "let"
+	MATCH     Kind = "match"
+	META      Kind = "meta"
+	MUT       Kind = "mut"
+	NIL       Kind = "nil"
+	NOT       Kind = "not"
+	OR        Kind = "or"
+	PLAN      Kind = "plan"
+	PUB       Kind = "pub"
+	RETURN    Kind = "return"
+	STEP      Kind = "step"
+	STRUCT    Kind = "struct"
+	TEST      Kind = "test"
+	TRUE      Kind = "true"
+	WHILE     Kind = "while"
 )
 
 var keywordSet = map[string]Kind{
-	"and": AND, "as": AS, "break": BREAK, "continue": CONTINUE,
+	"and": AND, "as": AS, "break": BREAK, "const": CONST, "continue": CONTINUE, "defer": DEFER,
 	"elif": ELIF, "else": ELSE, "false": FALSE, "fn": FN,
-	"for": FOR, "if": IF, "import": IMPORT, "in": IN, "let": LET,
+	"for": FOR, "if": IF, "import": IMPORT, "in": IN, "interface": INTERFACE, "let": LET,
 	"match": MATCH, "meta": META, "mut": MUT, "nil": NIL, "not": NOT, "or": OR,
 	"plan": PLAN, "pub": PUB, "return": RETURN, "step": STEP,
 	"struct": STRUCT, "test": TEST, "true": TRUE, "while": WHILE,
@@ -9,9 +9,9 @@ import (
 )
 
 var keywordCompletions = []string{
-	"and", "as", "break", "continue", "elif", "else", "false", "fn",
-	"for", "if", "import", "in", "let", "match", "meta", "nil", "not", "or",
-	"plan", "pub", "return", "step", "struct", "true", "while",
+	"and", "as", "break", "const", "continue", "defer", "elif", "else", "false", "fn",
+	"for", "if", "import", "in", "interface", "let", "match", "meta", "nil", "not", "or",
+	"plan", "pub", "return", "step", "struct", "true", "type", "while",
 }
 
 // completion computes completion items for pos. When the cursor immediately
@@ -126,11 +126,27 @@ func (d *document) fieldCompletions(objName string, pos Position) []CompletionIt
 		if s, isStruct := t.(types.Struct); isStruct {
 			names := s.FieldNames()
 			sort.Strings(names)
-			items := make([]CompletionItem, 0, len(names))
+			methods := s.MethodNames()
+			sort.Strings(methods)
+			items := make([]CompletionItem, 0, len(names)+len(methods))
 			for _, name := range names {
 				ft, _ := s.Field(name)
 				items = append(items, CompletionItem{Label: name, Kind: CIKField, Detail: ft.String()})
 			}
+			for _, name := range methods {
+				m, _ := s.Method(name)
+				items = append(items, CompletionItem{Label: name, Kind: CIKMethod, Detail: m.String()})
+			}
+			return items
+		}
+		if i, isInterface := t.(types.Interface); isInterface {
+			methods := i.MethodNames()
+			sort.Strings(methods)
+			items := make([]CompletionItem, 0, len(methods))
+			for _, name := range methods {
+				m, _ := i.Method(name)
+				items = append(items, CompletionItem{Label: name, Kind: CIKMethod, Detail: m.String()})
+			}
 			return items
 		}
 	}
@@ -153,10 +169,16 @@ func (d *document) generalCompletions(pos Position) []CompletionItem {
 	}
 	if d.env != nil {
 		for name, fn := range d.env.Funcs() {
-			items = append(items, CompletionItem{Label: name, Kind: CIKFunction, Detail: fn.String()})
+			items = append(items, CompletionItem{Label: name, Kind: CIKFunction, Detail: fn.String(), Tags: d.symbolTags(name)})
 		}
 		for name, s := range d.env.Structs() {
-			items = append(items, CompletionItem{Label: name, Kind: CIKClass, Detail: s.Name})
+			items = append(items, CompletionItem{Label: name, Kind: CIKClass, Detail: s.Name, Tags: d.symbolTags(name)})
+		}
+		for name, i := range d.env.Interfaces() {
+			items = append(items, CompletionItem{Label: name, Kind: CIKInterface, Detail: "interface " + i.Name})
+		}
+		for name, t := range d.env.Aliases() {
+			items = append(items, CompletionItem{Label: name, Kind: CIKClass, Detail: "type " + name + " = " + t.String()})
 		}
 	}
 	if d.prog != nil {
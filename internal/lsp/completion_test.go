@@ -34,6 +34,38 @@ func TestCompletion_AfterDot_StructFields(t *testing.T) {
 	require.False(t, hasLabel(items, "println"), "dot completion should be type-scoped, not general")
 }
 
+func TestCompletion_AfterDot_ListsMethodsAlongsideFields(t *testing.T) {
+	src := "struct Point:\n    x: int\n    fn norm(self) -> int:\n        return self.x\nlet p = Point(x: 1)\nlet v = p.\n"
+	d := analyzeDoc("/tmp/a.fn", src)
+	items := d.completion(Position{Line: 5, Character: 10})
+	require.True(t, hasLabel(items, "x"))
+	require.True(t, hasLabel(items, "norm"))
+	for _, it := range items {
+		if it.Label == "norm" {
+			require.Equal(t, CIKMethod, it.Kind)
+			require.Equal(t, "() -> int", it.Detail)
+		}
+	}
+}
+
+func TestCompletion_AfterDot_SelfInsideMethod(t *testing.T) {
+	src := "struct Point:\n    x: int\n    fn norm(self) -> int:\n        let v = self.\n        return self.x\n"
+	d := analyzeDoc("/tmp/a.fn", src)
+	items := d.completion(Position{Line: 3, Character: 21})
+	require.True(t, hasLabel(items, "x"))
+	require.True(t, hasLabel(items, "norm"))
+}
+
+func TestCompletion_AfterDot_InterfaceParamListsItsMethods(t *testing.T) {
+	src := "interface Row:\n    fn to_row(self) -> list[str]\nfn render(r: Row) -> int:\n    let v = r.\n    return 0\n"
+	d := analyzeDoc("/tmp/a.fn", src)
+	items := d.completion(Position{Line: 3, Character: 14})
+	require.Len(t, items, 1)
+	require.Equal(t, "to_row", items[0].Label)
+	require.Equal(t, CIKMethod, items[0].Kind)
+	require.Equal(t, "() -> list[str]", items[0].Detail)
+}
+
 func TestCompletion_AfterDot_UnresolvedObject_ReturnsEmpty(t *testing.T) {
 	src := "let v = nope.\n"
 	d := analyzeDoc("/tmp/a.fn", src)
@@ -0,0 +1,63 @@
+package lsp
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/jiejie-dev/funny/v2/internal/testrunner"
+)
+
+// coverageFile is where documentCoverage looks for a report, in the
+// document's directory and each one above it: the file
+// `funny test --cover-json .funny/coverage.json` writes.
+var coverageFile = filepath.Join(".funny", "coverage.json")
+
+// documentCoverage implements the custom funny/coverage request: the lines
+// of the file at path that the coverage report at reportPath (or, if that
+// is empty, the nearest coverageFile) has as never run. Nothing is pushed
+// to the client; an editor asks when it wants to show coverage, so the
+// decorations are opt-in. A file no report covers gets an empty result,
+// and an error only when a report exists but can't be read.
+func documentCoverage(path, reportPath string) (CoverageResult, error) {
+	result := CoverageResult{Uncovered: []Range{}}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return result, err
+	}
+	if reportPath == "" {
+		reportPath = findCoverageReport(filepath.Dir(abs))
+		if reportPath == "" {
+			return result, nil
+		}
+	}
+	report, err := testrunner.ReadCoverage(reportPath)
+	if err != nil {
+		return result, err
+	}
+	fc, ok := report.File(abs)
+	if !ok {
+		return result, nil
+	}
+	result.File = reportPath
+	result.Covered, result.Total, result.Percent = fc.Covered, fc.Total, fc.Percent
+	for _, line := range fc.Uncovered() {
+		result.Uncovered = append(result.Uncovered, lineRange(line-1, line-1))
+	}
+	return result, nil
+}
+
+// findCoverageReport returns the coverageFile in dir or the nearest
+// directory above it, or "" if there is none.
+func findCoverageReport(dir string) string {
+	for {
+		candidate := filepath.Join(dir, coverageFile)
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
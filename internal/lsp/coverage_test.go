@@ -0,0 +1,38 @@
+package lsp
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jiejie-dev/funny/v2/internal/testrunner"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDocumentCoverage_FindsNearestReport(t *testing.T) {
+	root := t.TempDir()
+	lib := filepath.Join(root, "skills", "lib.fn")
+	require.NoError(t, os.MkdirAll(filepath.Dir(lib), 0o755))
+	report := &testrunner.CoverageReport{Files: []testrunner.FileCoverage{{
+		File: lib, Covered: 1, Total: 3, Percent: 100.0 / 3,
+		Lines: []testrunner.LineHits{{Line: 1, Hits: 4}, {Line: 2, Hits: 0}, {Line: 5, Hits: 0}},
+	}}}
+	require.NoError(t, os.MkdirAll(filepath.Join(root, ".funny"), 0o755))
+	f, err := os.Create(filepath.Join(root, ".funny", "coverage.json"))
+	require.NoError(t, err)
+	require.NoError(t, report.WriteJSON(f))
+	require.NoError(t, f.Close())
+
+	got, err := documentCoverage(lib, "")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(root, ".funny", "coverage.json"), got.File)
+	assert.Equal(t, 1, got.Covered)
+	assert.Equal(t, 3, got.Total)
+	assert.Equal(t, []Range{lineRange(1, 1), lineRange(4, 4)}, got.Uncovered)
+
+	other, err := documentCoverage(filepath.Join(root, "other.fn"), "")
+	require.NoError(t, err)
+	assert.Empty(t, other.File)
+	assert.Empty(t, other.Uncovered)
+}
@@ -27,7 +27,8 @@ func (d *document) definition(pos Position) *Location {
 	return nil
 }
 
-// findTopLevelDecl looks for a top-level fn/struct declaration named name.
+// findTopLevelDecl looks for a top-level fn/struct/interface/type/const
+// declaration named name.
 func findTopLevelDecl(prog *ast.Program, name string) ast.Node {
 	for _, s := range prog.Stmts {
 		switch n := s.(type) {
@@ -39,6 +40,18 @@ func findTopLevelDecl(prog *ast.Program, name string) ast.Node {
 			if n.Name == name {
 				return n
 			}
+		case *ast.InterfaceDecl:
+			if n.Name == name {
+				return n
+			}
+		case *ast.TypeAliasDecl:
+			if n.Name == name {
+				return n
+			}
+		case *ast.ConstDecl:
+			if n.Name == name {
+				return n
+			}
 		}
 	}
 	return nil
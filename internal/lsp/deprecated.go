@@ -0,0 +1,64 @@
+package lsp
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/jiejie-dev/funny/v2/internal/ast"
+)
+
+// deprecationDiagnostics returns a hint, tagged so editors strike the
+// name through, at every use of a top-level `@deprecated` fn or struct.
+func (d *document) deprecationDiagnostics() []Diagnostic {
+	var out []Diagnostic
+	for _, s := range d.prog.Stmts {
+		var name string
+		var attrs ast.Attributes
+		switch n := s.(type) {
+		case *ast.FnDecl:
+			name, attrs = n.Name, n.Attrs
+		case *ast.StructDecl:
+			name, attrs = n.Name, n.Attrs
+		default:
+			continue
+		}
+		note, ok := attrs.Deprecated()
+		if !ok {
+			continue
+		}
+		msg := fmt.Sprintf("%s is deprecated", name)
+		if note != "" {
+			msg += ": " + note
+		}
+		for _, pos := range referencesTo(d, name, symGlobal, nil) {
+			if pos == s.Pos() || pos.File != "" && pos.File != d.path {
+				continue
+			}
+			out = append(out, Diagnostic{
+				Range: nameRange(astPosToLSP(pos), len(name)), Severity: SeverityHint,
+				Source: "funny", Message: msg, Tags: []DiagnosticTag{DiagnosticDeprecated},
+			})
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		a, b := out[i].Range.Start, out[j].Range.Start
+		return a.Line < b.Line || a.Line == b.Line && a.Character < b.Character
+	})
+	return out
+}
+
+// deprecatedTags returns the completion/symbol tags for a declaration.
+func deprecatedTags(attrs ast.Attributes) []int {
+	if _, ok := attrs.Deprecated(); ok {
+		return []int{ItemTagDeprecated}
+	}
+	return nil
+}
+
+// symbolTags returns the completion tags for a top-level name.
+func (d *document) symbolTags(name string) []int {
+	if sym, ok := d.docIndex[name]; ok && sym.Deprecated {
+		return []int{ItemTagDeprecated}
+	}
+	return nil
+}
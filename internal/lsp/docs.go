@@ -10,6 +10,13 @@ import (
 
 func formatSymbolDoc(sym docgen.SymbolDoc, kindLabel string) string {
 	var sb strings.Builder
+	if sym.Deprecated {
+		fmt.Fprintf(&sb, "~~%s~~ **Deprecated**", sym.Name)
+		if sym.DeprecationNote != "" {
+			sb.WriteString(": " + sym.DeprecationNote)
+		}
+		sb.WriteString("\n\n")
+	}
 	if sym.Summary != "" {
 		sb.WriteString(sym.Summary)
 		sb.WriteString("\n\n")
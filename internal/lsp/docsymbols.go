@@ -44,6 +44,7 @@ func (d *document) documentSymbols() []DocumentSymbol {
 				Kind:           SKFunction,
 				Range:          lineRange(n.Pos().Line, endLine),
 				SelectionRange: nameTokenRange(toks, n.Pos().Line, n.Name),
+				Tags:           deprecatedTags(n.Attrs),
 			})
 		case *ast.StructDecl:
 			out = append(out, DocumentSymbol{
@@ -52,6 +53,31 @@ func (d *document) documentSymbols() []DocumentSymbol {
 				Range:          lineRange(n.Pos().Line, endLine),
 				SelectionRange: nameTokenRange(toks, n.Pos().Line, n.Name),
 				Children:       structFieldSymbols(n, toks),
+				Tags:           deprecatedTags(n.Attrs),
+			})
+		case *ast.InterfaceDecl:
+			out = append(out, DocumentSymbol{
+				Name:           n.Name,
+				Kind:           SKInterface,
+				Range:          lineRange(n.Pos().Line, endLine),
+				SelectionRange: nameTokenRange(toks, n.Pos().Line, n.Name),
+				Children:       methodSymbols(n.Methods, toks),
+			})
+		case *ast.TypeAliasDecl:
+			out = append(out, DocumentSymbol{
+				Name:           n.Name,
+				Detail:         n.Target,
+				Kind:           SKClass,
+				Range:          lineRange(n.Pos().Line, endLine),
+				SelectionRange: nameTokenRange(toks, n.Pos().Line, n.Name),
+			})
+		case *ast.ConstDecl:
+			out = append(out, DocumentSymbol{
+				Name:           n.Name,
+				Detail:         n.Value.String(),
+				Kind:           SKConstant,
+				Range:          lineRange(n.Pos().Line, endLine),
+				SelectionRange: nameTokenRange(toks, n.Pos().Line, n.Name),
 			})
 		case *ast.PlanBlock:
 			out = append(out, DocumentSymbol{
@@ -85,6 +111,15 @@ func structFieldSymbols(n *ast.StructDecl, toks []lexer.Token) []DocumentSymbol
 		rng := nameTokenRange(toks, n.Pos().Line, f.Name)
 		out = append(out, DocumentSymbol{Name: f.Name, Detail: f.TypeAnn, Kind: SKField, Range: rng, SelectionRange: rng})
 	}
+	return append(out, methodSymbols(n.Methods, toks)...)
+}
+
+func methodSymbols(methods []*ast.FnDecl, toks []lexer.Token) []DocumentSymbol {
+	out := make([]DocumentSymbol, 0, len(methods))
+	for _, m := range methods {
+		rng := nameTokenRange(toks, m.Pos().Line, m.Name)
+		out = append(out, DocumentSymbol{Name: m.Name, Detail: fnSignature(m), Kind: SKMethod, Range: rng, SelectionRange: rng})
+	}
 	return out
 }
 
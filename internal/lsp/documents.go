@@ -15,17 +15,19 @@ import (
 // document holds one open buffer plus the result of its most recent
 // analysis pass (parse -> import resolution -> type check). Analysis is
 // best-effort at every stage: a failure at one stage still keeps whatever
-// was produced by earlier stages, so the editor keeps useful intelligence
-// (diagnostics aside) even while the buffer is in a temporarily broken
-// state, which is the common case while the user is actively typing.
+// was produced by earlier stages, and the parser itself recovers from
+// syntax errors with a partial program, so the editor keeps useful
+// intelligence (diagnostics aside) even while the buffer is in a
+// temporarily broken state, which is the common case while the user is
+// actively typing.
 type document struct {
 	uri     string
 	path    string
 	text    string
 	version int
 
-	prog        *ast.Program // best available AST: resolved+rewritten if that succeeded, else the bare parse
-	env         *types.Env   // best available type environment (populated up to the first error, if any)
+	prog        *ast.Program // best available AST: resolved+rewritten if that succeeded, else the bare (possibly partial) parse
+	env         *types.Env   // best available type environment
 	docIndex    map[string]docgen.SymbolDoc
 	diagnostics []Diagnostic
 }
@@ -39,10 +41,11 @@ func (d *document) analyze() {
 	d.docIndex = nil
 
 	p := parser.New(d.text, d.path)
-	prog, err := p.Parse()
-	if err != nil {
-		d.diagnostics = append(d.diagnostics, errorToDiagnostic(err, d.path))
-		return
+	prog, parseErr := p.Parse()
+	if parseErr != nil {
+		for _, e := range errs.All(parseErr) {
+			d.diagnostics = append(d.diagnostics, errorToDiagnostic(e, d.path))
+		}
 	}
 	d.prog = prog
 
@@ -55,40 +58,38 @@ func (d *document) analyze() {
 		d.prog = resolved
 	}
 
-	if err := types.Check(d.prog, d.env); err != nil {
-		d.diagnostics = append(d.diagnostics, errorToDiagnostic(err, d.path))
+	// A program with syntax errors is still checked, since that is what
+	// fills d.env for hover and completion, but its type errors are not
+	// published: statements dropped by parser recovery would show up as
+	// spurious "undefined" errors further down.
+	if err := types.Check(d.prog, d.env); err != nil && parseErr == nil {
+		for _, e := range errs.All(err) {
+			d.diagnostics = append(d.diagnostics, errorToDiagnostic(e, d.path))
+		}
+	}
+	if parseErr == nil {
+		for _, w := range d.env.Warnings() {
+			diag := errorToDiagnostic(w, d.path)
+			diag.Severity = SeverityWarning
+			d.diagnostics = append(d.diagnostics, diag)
+		}
 	}
 	if d.prog != nil {
 		d.docIndex = docgen.SymbolIndex(d.prog, d.env)
+		d.diagnostics = append(d.diagnostics, d.deprecationDiagnostics()...)
 	}
 }
 
-// errorToDiagnostic converts any error produced by the parser, module
-// resolver, or type checker into an LSP diagnostic. Structured errors
-// (*errs.Error, *types.Error) carry a code and position and are anchored
-// precisely; module-resolution errors additionally wrap the underlying
-// structured error with fmt.Errorf("...: %w", ...) to add import-site
-// context, so errors.As (not a plain type assertion) is required to find
-// it. Anything else (should not normally happen) falls back to a
-// document-start range so the message is still surfaced.
+// errorToDiagnostic converts a single error produced by the parser, module
+// resolver, or type checker into an LSP diagnostic (the type checker's
+// errs.List is split with errs.All first, one diagnostic per entry).
+// Structured errors (*errs.Error) carry a code and position and are
+// anchored precisely; module-resolution errors additionally wrap the
+// underlying structured error with fmt.Errorf("...: %w", ...) to add
+// import-site context, so errors.As (not a plain type assertion) is
+// required to find it. Anything else (should not normally happen) falls
+// back to a document-start range so the message is still surfaced.
 func errorToDiagnostic(err error, docPath string) Diagnostic {
-	var typeErr *types.Error
-	if errors.As(err, &typeErr) {
-		if typeErr.Pos.File != "" && typeErr.Pos.File != docPath {
-			return Diagnostic{
-				Range: pointRange(Position{}), Severity: SeverityError, Code: typeErr.Code,
-				Source: "funny", Message: "in imported module: " + err.Error(),
-			}
-		}
-		msg := typeErr.Message
-		if typeErr.Expected != nil && typeErr.Actual != nil {
-			msg = typeErr.Message + ": expected " + typeErr.Expected.String() + ", got " + typeErr.Actual.String()
-		}
-		return Diagnostic{
-			Range: pointRange(astPosToLSP(typeErr.Pos)), Severity: SeverityError, Code: typeErr.Code,
-			Source: "funny", Message: msg,
-		}
-	}
 	var structErr *errs.Error
 	if errors.As(err, &structErr) {
 		if structErr.Pos.File != "" && structErr.Pos.File != docPath {
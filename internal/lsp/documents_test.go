@@ -33,12 +33,47 @@ func TestAnalyze_ParseError_ProducesDiagnostic(t *testing.T) {
 	require.Equal(t, SeverityError, d.diagnostics[0].Severity)
 }
 
+func TestAnalyze_SyntaxErrors_KeepPartialProgramForIntelligence(t *testing.T) {
+	src := "let a = \nfn add(a: int, b: int) -> int:\n    let y = ]\n    return a + b\nlet bad = (1 +\nlet r = add(1, 2)\n"
+	d := analyzeDoc("/tmp/a.fn", src)
+	require.Len(t, d.diagnostics, 3, "one diagnostic per syntax error and no type errors from the partial program")
+	require.Equal(t, 0, d.diagnostics[0].Range.Start.Line)
+	require.Equal(t, 2, d.diagnostics[1].Range.Start.Line)
+	require.Equal(t, 5, d.diagnostics[2].Range.Start.Line)
+
+	require.NotNil(t, findSymbol(d.documentSymbols(), "add"))
+	h := d.hover(Position{Line: 1, Character: 4})
+	require.NotNil(t, h)
+	require.Contains(t, h.Contents.Value, "fn add")
+	require.True(t, hasLabel(d.completion(Position{Line: 5, Character: 0}), "add"))
+}
+
 func TestAnalyze_TypeError_ProducesDiagnosticWithCode(t *testing.T) {
 	d := analyzeDoc("/tmp/a.fn", "let x: int = \"str\"\n")
 	require.Len(t, d.diagnostics, 1)
 	require.Equal(t, "E2010", d.diagnostics[0].Code)
 }
 
+func TestAnalyze_EveryTypeErrorProducesADiagnostic(t *testing.T) {
+	d := analyzeDoc("/tmp/a.fn", "let x: int = \"str\"\nlet y = x + nope\nfn f() -> int:\n    return \"s\"\n")
+	require.Len(t, d.diagnostics, 3)
+	require.Equal(t, "E2010", d.diagnostics[0].Code)
+	require.Equal(t, "E2001", d.diagnostics[1].Code)
+	require.Equal(t, 1, d.diagnostics[1].Range.Start.Line)
+	require.Equal(t, "E2010", d.diagnostics[2].Code)
+	require.Equal(t, 3, d.diagnostics[2].Range.Start.Line)
+	_, ok := d.env.LookupFunc("f")
+	require.True(t, ok, "checking continues past errors, so later declarations are still known")
+}
+
+func TestAnalyze_UnreachableCode_ProducesWarning(t *testing.T) {
+	d := analyzeDoc("/tmp/a.fn", "fn f() -> int:\n    return 1\n    let dead = 2\n")
+	require.Len(t, d.diagnostics, 1)
+	require.Equal(t, "W2001", d.diagnostics[0].Code)
+	require.Equal(t, SeverityWarning, d.diagnostics[0].Severity)
+	require.Equal(t, 2, d.diagnostics[0].Range.Start.Line)
+}
+
 func TestAnalyze_ValidProgram_NoDiagnostics(t *testing.T) {
 	d := analyzeDoc("/tmp/a.fn", "fn add(a: int, b: int) -> int:\n    return a + b\nlet r = add(1, 2)\nprintln(r)\n")
 	require.Empty(t, d.diagnostics)
@@ -11,15 +11,16 @@ import (
 )
 
 var keywordDocs = map[string]string{
-	"fn": "Declares a function.", "struct": "Declares a struct type.",
-	"let": "Declares a local variable.", "if": "Conditional branch.",
-	"elif": "Else-if branch.", "else": "Else branch.",
+	"fn": "Declares a function.", "struct": "Declares a struct type.", "interface": "Declares a structural interface.",
+	"let": "Declares a local variable.", "const": "Declares a module-level compile-time constant.",
+	"if": "Conditional branch.", "elif": "Else-if branch.", "else": "Else branch.",
 	"for": "Iterates over a list.", "in": "Used in `for x in xs:`.",
 	"while": "Loop while a condition holds.", "match": "Pattern-matches an expression.",
 	"return": "Returns from the current function.", "break": "Exits the nearest loop.",
 	"continue": "Skips to the next loop iteration.", "import": "Imports declarations from another file.",
 	"as": "Aliases an import.", "pub": "Marks a declaration as importable from other files.",
-	"meta": "Declares agent metadata for this skill file.", "plan": "Declares an executable step plan.",
+	"defer": "Runs a call when the enclosing function or plan step exits.", "meta": "Declares agent metadata for this skill file.",
+	"plan": "Declares an executable step plan.",
 	"step": "Declares one step within a `plan` block.", "test": "Declares a unit test (run with `funny test`).", "true": "Boolean literal.",
 	"false": "Boolean literal.", "nil": "The absence of a value.",
 	"and": "Logical AND.", "or": "Logical OR.", "not": "Logical NOT.",
@@ -45,7 +46,7 @@ func (d *document) hover(pos Position) *Hover {
 	if d.prog != nil {
 		locals := localsAt(d.prog, target)
 		if sym, ok := lookupLocal(locals, name); ok {
-			kindLabel := map[string]string{"param": "parameter", "let": "local variable", "for": "loop variable"}[sym.Kind]
+			kindLabel := map[string]string{"param": "parameter", "let": "local variable", "for": "loop variable", "const": "constant"}[sym.Kind]
 			typ := sym.TypeStr
 			if typ == "" {
 				typ = "(inferred)"
@@ -69,6 +70,20 @@ func (d *document) hover(pos Position) *Hover {
 			}
 			return &Hover{Contents: MarkupContent{Kind: "markdown", Value: md}, Range: &rng}
 		}
+		if i, ok := d.env.LookupInterface(name); ok {
+			md := fmt.Sprintf("```funny\ninterface %s:\n%s```\ninterface", name, interfaceMethodsBlock(i))
+			if sym, ok := d.docIndex[name]; ok {
+				md = formatSymbolDoc(sym, "interface")
+			}
+			return &Hover{Contents: MarkupContent{Kind: "markdown", Value: md}, Range: &rng}
+		}
+		if t, ok := d.env.LookupAlias(name); ok {
+			md := fmt.Sprintf("```funny\ntype %s = %s\n```\ntype alias", name, t.String())
+			if sym, ok := d.docIndex[name]; ok {
+				md = formatSymbolDoc(sym, "type alias")
+			}
+			return &Hover{Contents: MarkupContent{Kind: "markdown", Value: md}, Range: &rng}
+		}
 		if t, ok := d.env.LookupVar(name); ok {
 			md := fmt.Sprintf("```funny\n%s: %s\n```\nvariable", name, t.String())
 			return &Hover{Contents: MarkupContent{Kind: "markdown", Value: md}, Range: &rng}
@@ -92,3 +107,14 @@ func structFieldsBlock(s types.Struct) string {
 	}
 	return sb.String()
 }
+
+func interfaceMethodsBlock(i types.Interface) string {
+	names := i.MethodNames()
+	sort.Strings(names)
+	var sb strings.Builder
+	for _, name := range names {
+		m, _ := i.Method(name)
+		sb.WriteString("    fn " + name + m.String() + "\n")
+	}
+	return sb.String()
+}
@@ -40,3 +40,30 @@ let p = Point(x: 1, y: 2)
 	require.Contains(t, h.Contents.Value, "A 2D point")
 	require.Contains(t, h.Contents.Value, "struct Point")
 }
+
+func TestHover_DeprecatedFunction_StruckThrough(t *testing.T) {
+	src := `@deprecated("use add2")
+fn add(a: int, b: int) -> int:
+    return a + b
+
+let r = add(1, 2)
+`
+	d := analyzeDoc("/tmp/a.fn", src)
+	h := d.hover(Position{Line: 4, Character: 9})
+	require.NotNil(t, h)
+	require.Contains(t, h.Contents.Value, "~~add~~ **Deprecated**: use add2")
+
+	require.Len(t, d.diagnostics, 1)
+	diag := d.diagnostics[0]
+	require.Equal(t, SeverityHint, diag.Severity)
+	require.Equal(t, []DiagnosticTag{DiagnosticDeprecated}, diag.Tags)
+	require.Equal(t, Range{Start: Position{Line: 4, Character: 8}, End: Position{Line: 4, Character: 11}}, diag.Range)
+	require.Equal(t, "add is deprecated: use add2", diag.Message)
+
+	items := d.completion(Position{Line: 4, Character: 0})
+	for _, it := range items {
+		if it.Label == "add" {
+			require.Equal(t, []int{ItemTagDeprecated}, it.Tags)
+		}
+	}
+}
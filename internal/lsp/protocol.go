@@ -121,12 +121,19 @@ const (
 	SeverityHint    DiagnosticSeverity = 4
 )
 
+// DiagnosticTag asks the editor to render a diagnostic's range specially;
+// DiagnosticDeprecated is shown struck through.
+type DiagnosticTag int
+
+const DiagnosticDeprecated DiagnosticTag = 2
+
 type Diagnostic struct {
 	Range    Range              `json:"range"`
 	Severity DiagnosticSeverity `json:"severity"`
 	Code     string             `json:"code,omitempty"`
 	Source   string             `json:"source"`
 	Message  string             `json:"message"`
+	Tags     []DiagnosticTag    `json:"tags,omitempty"`
 }
 
 type PublishDiagnosticsParams struct {
@@ -151,22 +158,28 @@ type Hover struct {
 type CompletionItemKind int
 
 const (
-	CIKText     CompletionItemKind = 1
-	CIKMethod   CompletionItemKind = 2
-	CIKFunction CompletionItemKind = 3
-	CIKField    CompletionItemKind = 5
-	CIKVariable CompletionItemKind = 6
-	CIKClass    CompletionItemKind = 7
-	CIKModule   CompletionItemKind = 9
-	CIKKeyword  CompletionItemKind = 14
+	CIKText      CompletionItemKind = 1
+	CIKMethod    CompletionItemKind = 2
+	CIKFunction  CompletionItemKind = 3
+	CIKField     CompletionItemKind = 5
+	CIKVariable  CompletionItemKind = 6
+	CIKClass     CompletionItemKind = 7
+	CIKInterface CompletionItemKind = 8
+	CIKModule    CompletionItemKind = 9
+	CIKKeyword   CompletionItemKind = 14
 )
 
+// ItemTagDeprecated marks a completion item or document symbol as
+// deprecated (CompletionItemTag and SymbolTag share the value).
+const ItemTagDeprecated = 1
+
 type CompletionItem struct {
 	Label         string             `json:"label"`
 	Kind          CompletionItemKind `json:"kind"`
 	Detail        string             `json:"detail,omitempty"`
 	Documentation string             `json:"documentation,omitempty"`
 	InsertText    string             `json:"insertText,omitempty"`
+	Tags          []int              `json:"tags,omitempty"`
 }
 
 type CompletionParams struct {
@@ -265,20 +278,45 @@ type PlanEdge struct {
 	Kind string `json:"kind"`
 }
 
+// --- funny/coverage (custom extension) ---
+//
+// Also funny-specific: the lines of a document that the last `funny test
+// --cover-json` run left uncovered, for an editor that wants to decorate
+// them. See coverage.go.
+
+type CoverageParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+	// CoverageFile is the JSON report to read; empty means the nearest
+	// .funny/coverage.json above the document.
+	CoverageFile string `json:"coverageFile,omitempty"`
+}
+
+// CoverageResult.File is the report the lines came from, or empty when no
+// report covers the document.
+type CoverageResult struct {
+	File      string  `json:"file,omitempty"`
+	Covered   int     `json:"covered"`
+	Total     int     `json:"total"`
+	Percent   float64 `json:"percent"`
+	Uncovered []Range `json:"uncovered"`
+}
+
 // --- Document symbols ---
 
 type SymbolKind int
 
 const (
-	SKFile     SymbolKind = 1
-	SKModule   SymbolKind = 2
-	SKClass    SymbolKind = 5
-	SKMethod   SymbolKind = 6
-	SKField    SymbolKind = 8
-	SKFunction SymbolKind = 12
-	SKVariable SymbolKind = 13
-	SKStruct   SymbolKind = 23
-	SKEvent    SymbolKind = 24 // used for plan `step` nodes
+	SKFile      SymbolKind = 1
+	SKModule    SymbolKind = 2
+	SKClass     SymbolKind = 5
+	SKInterface SymbolKind = 11
+	SKMethod    SymbolKind = 6
+	SKField     SymbolKind = 8
+	SKFunction  SymbolKind = 12
+	SKVariable  SymbolKind = 13
+	SKConstant  SymbolKind = 14
+	SKStruct    SymbolKind = 23
+	SKEvent     SymbolKind = 24 // used for plan `step` nodes
 )
 
 type DocumentSymbol struct {
@@ -288,6 +326,7 @@ type DocumentSymbol struct {
 	Range          Range            `json:"range"`
 	SelectionRange Range            `json:"selectionRange"`
 	Children       []DocumentSymbol `json:"children,omitempty"`
+	Tags           []int            `json:"tags,omitempty"`
 }
 
 type DocumentSymbolParams struct {
@@ -99,6 +99,11 @@ func walkStmtForName(s ast.Statement, name string, out *[]ast.Pos) {
 			*out = append(*out, n.NodePos)
 		}
 		walkExprForName(n.Value, name, out)
+	case *ast.ConstDecl:
+		if n.Name == name {
+			*out = append(*out, n.NodePos)
+		}
+		walkExprForName(n.Value, name, out)
 	case *ast.AssignStmt:
 		walkExprForName(n.Target, name, out)
 		walkExprForName(n.Value, name, out)
@@ -122,6 +127,7 @@ func walkStmtForName(s ast.Statement, name string, out *[]ast.Pos) {
 		walkExprForName(n.Expr, name, out)
 		for _, arm := range n.Arms {
 			walkExprForName(arm.Pattern, name, out)
+			walkExprForName(arm.Guard, name, out)
 			walkBlockForName(arm.Body, name, out)
 		}
 	case *ast.ReturnStmt:
@@ -130,6 +136,8 @@ func walkStmtForName(s ast.Statement, name string, out *[]ast.Pos) {
 		}
 	case *ast.ExprStmt:
 		walkExprForName(n.X, name, out)
+	case *ast.DeferStmt:
+		walkExprForName(n.Call, name, out)
 	case *ast.FnDecl:
 		if n.Name == name {
 			*out = append(*out, n.NodePos)
@@ -144,6 +152,14 @@ func walkStmtForName(s ast.Statement, name string, out *[]ast.Pos) {
 		if n.Name == name {
 			*out = append(*out, n.NodePos)
 		}
+		for _, m := range n.Methods {
+			for _, p := range m.Params {
+				if p.Name == name {
+					*out = append(*out, m.NodePos)
+				}
+			}
+			walkBlockForName(m.Body, name, out)
+		}
 	case *ast.PlanBlock:
 		walkBlockForName(n.Body, name, out)
 	case *ast.Step:
@@ -170,6 +186,10 @@ func walkExprForName(e ast.Expression, name string, out *[]ast.Pos) {
 		for _, el := range n.Elements {
 			walkExprForName(el, name, out)
 		}
+	case *ast.SetLiteralExpr:
+		for _, el := range n.Elements {
+			walkExprForName(el, name, out)
+		}
 	case *ast.MapLiteralExpr:
 		for i := range n.Keys {
 			walkExprForName(n.Keys[i], name, out)
@@ -178,6 +198,16 @@ func walkExprForName(e ast.Expression, name string, out *[]ast.Pos) {
 	case *ast.IndexExpr:
 		walkExprForName(n.Object, name, out)
 		walkExprForName(n.Index, name, out)
+		walkExprForName(n.Low, name, out)
+		walkExprForName(n.High, name, out)
+	case *ast.OrPattern:
+		for _, a := range n.Alts {
+			walkExprForName(a, name, out)
+		}
+	case *ast.RangeExpr:
+		walkExprForName(n.Start, name, out)
+		walkExprForName(n.End, name, out)
+		walkExprForName(n.Step, name, out)
 	case *ast.FieldExpr:
 		walkExprForName(n.Object, name, out)
 	case *ast.CallExpr:
@@ -8,7 +8,7 @@ type localSym struct {
 	Name    string
 	TypeStr string // declared type annotation, "" if inferred/unknown
 	Pos     ast.Pos
-	Kind    string // "param" | "let" | "for"
+	Kind    string // "param" | "let" | "const" | "for" | "match"
 }
 
 // localsAt returns the local symbols in scope at target, in outer-to-inner
@@ -40,15 +40,17 @@ func scanStmts(stmts []ast.Statement, target ast.Pos, acc *[]localSym) {
 		switch n := s.(type) {
 		case *ast.LetStmt:
 			*acc = append(*acc, localSym{Name: n.Name, TypeStr: n.TypeAnn, Pos: n.NodePos, Kind: "let"})
+		case *ast.ConstDecl:
+			*acc = append(*acc, localSym{Name: n.Name, Pos: n.NodePos, Kind: "const"})
 		case *ast.FnDecl:
-			sub := append([]localSym{}, (*acc)...)
-			for _, p := range n.Params {
-				sub = append(sub, localSym{Name: p.Name, TypeStr: p.TypeAnn, Pos: n.NodePos, Kind: "param"})
-			}
-			if n.Body != nil {
-				scanStmts(n.Body.Statements, target, &sub)
+			scanFn(n, target, acc)
+		case *ast.StructDecl:
+			for _, m := range n.Methods {
+				if !before(m.Pos(), target) {
+					break
+				}
+				scanFn(m, target, acc)
 			}
-			*acc = sub
 		case *ast.IfStmt:
 			scanIf(n, target, acc)
 		case *ast.ForStmt:
@@ -70,6 +72,9 @@ func scanStmts(stmts []ast.Statement, target ast.Pos, acc *[]localSym) {
 					continue
 				}
 				sub := append([]localSym{}, (*acc)...)
+				for _, b := range ast.PatternBindings(arm.Pattern) {
+					sub = append(sub, localSym{Name: b.Name, Pos: b.NodePos, Kind: "match"})
+				}
 				scanStmts(arm.Body.Statements, target, &sub)
 				*acc = sub
 			}
@@ -77,6 +82,23 @@ func scanStmts(stmts []ast.Statement, target ast.Pos, acc *[]localSym) {
 	}
 }
 
+// scanFn scopes a function's params (a method's `self` typed as its
+// receiver struct) over its body.
+func scanFn(n *ast.FnDecl, target ast.Pos, acc *[]localSym) {
+	sub := append([]localSym{}, (*acc)...)
+	for i, p := range n.Params {
+		typeStr := p.TypeAnn
+		if i == 0 && n.Receiver != "" {
+			typeStr = n.Receiver
+		}
+		sub = append(sub, localSym{Name: p.Name, TypeStr: typeStr, Pos: n.NodePos, Kind: "param"})
+	}
+	if n.Body != nil {
+		scanStmts(n.Body.Statements, target, &sub)
+	}
+	*acc = sub
+}
+
 func scanIf(n *ast.IfStmt, target ast.Pos, acc *[]localSym) {
 	if n.Then != nil {
 		sub := append([]localSym{}, (*acc)...)
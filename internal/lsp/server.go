@@ -99,6 +99,8 @@ func (s *Server) dispatch(msg *rpcMessage) {
 		s.handleRename(msg)
 	case "funny/planGraph":
 		s.handlePlanGraph(msg)
+	case "funny/coverage":
+		s.handleCoverage(msg)
 	default:
 		if !isNotification(msg) {
 			_ = s.out.writeError(msg.ID, codeMethodNotFound, "method not found: "+msg.Method)
@@ -325,3 +327,16 @@ func (s *Server) handlePlanGraph(msg *rpcMessage) {
 	}
 	_ = s.out.writeResult(msg.ID, d.planGraphs())
 }
+
+func (s *Server) handleCoverage(msg *rpcMessage) {
+	var p CoverageParams
+	if err := json.Unmarshal(msg.Params, &p); err != nil {
+		_ = s.out.writeError(msg.ID, codeInvalidParams, err.Error())
+		return
+	}
+	result, err := documentCoverage(uriToPath(p.TextDocument.URI), p.CoverageFile)
+	if err != nil {
+		s.logf("coverage: %v", err)
+	}
+	_ = s.out.writeResult(msg.ID, result)
+}
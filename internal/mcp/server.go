@@ -4,6 +4,7 @@ package mcp
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -13,9 +14,12 @@ import (
 
 	"github.com/jiejie-dev/funny/v2/internal/ast"
 	"github.com/jiejie-dev/funny/v2/internal/cli"
+	"github.com/jiejie-dev/funny/v2/internal/compiler"
+	"github.com/jiejie-dev/funny/v2/internal/errs"
 	"github.com/jiejie-dev/funny/v2/internal/module"
 	"github.com/jiejie-dev/funny/v2/internal/parser"
 	"github.com/jiejie-dev/funny/v2/internal/types"
+	"github.com/jiejie-dev/funny/v2/internal/vm"
 )
 
 // Run starts the funny MCP server on stdio and blocks until ctx is canceled
@@ -26,9 +30,9 @@ func Run(ctx context.Context) error {
 	mcp.AddTool(server, &mcp.Tool{Name: "ast", Description: "Parse funny source and return the JSON AST."}, astTool)
 	mcp.AddTool(server, &mcp.Tool{Name: "format", Description: "Format funny source code."}, formatTool)
 	mcp.AddTool(server, &mcp.Tool{Name: "list_skills", Description: "List all .fn files in a directory and their meta blocks."}, listSkillsTool)
-	mcp.AddTool(server, &mcp.Tool{Name: "describe_skill", Description: "Describe a single .fn file: meta + plan steps."}, describeSkillTool)
+	mcp.AddTool(server, &mcp.Tool{Name: "describe_skill", Description: "Describe a single .fn file: meta, plan steps and @tool functions."}, describeSkillTool)
 	mcp.AddTool(server, &mcp.Tool{Name: "run_skill", Description: "Execute a .fn file and return the result."}, runSkillTool)
-	mcp.AddTool(server, &mcp.Tool{Name: "lint", Description: "Run type-check only; report errors without executing."}, lintTool)
+	mcp.AddTool(server, &mcp.Tool{Name: "lint", Description: "Run type-check only; report errors and warnings without executing."}, lintTool)
 
 	return server.Run(ctx, &mcp.StdioTransport{})
 }
@@ -98,17 +102,63 @@ func describeSkillTool(ctx context.Context, req *mcp.CallToolRequest, args pathA
 	return nil, skill, nil
 }
 
+// runSkillLimits bounds a run_skill script, so a runaway one (an endless
+// loop, unbounded recursion) fails its call instead of hanging the server.
+var runSkillLimits = vm.Limits{
+	MaxInstructions: 1_000_000_000,
+	MaxCallDepth:    10_000,
+	MaxHeapBytes:    1 << 30,
+}
+
 func runSkillTool(ctx context.Context, req *mcp.CallToolRequest, args pathArg) (*mcp.CallToolResult, any, error) {
 	data, err := readFile(args.Path)
 	if err != nil {
 		return nil, nil, err
 	}
-	if err := cli.Run(data, args.Path); err != nil {
-		return nil, map[string]any{"error": err.Error()}, nil
+	opts := cli.RunOptions{OptLevel: compiler.O1, Context: ctx, Limits: runSkillLimits}
+	if err := cli.RunWithOptions(data, args.Path, opts); err != nil {
+		return nil, runError(err), nil
 	}
 	return nil, map[string]any{"status": "ok"}, nil
 }
 
+// runError reports a failed run_skill: the rendered error, plus its code,
+// message and (for a runtime error) the funny stack trace, innermost call
+// first, with 1-based lines and columns and, for a frame tail calls
+// reused, the number of calls elided, and for one standing for a run of
+// identical frames, the number of repeats folded into it.
+func runError(err error) map[string]any {
+	out := map[string]any{"error": err.Error()}
+	var diag *errs.Error
+	if !errors.As(err, &diag) {
+		return out
+	}
+	out["code"] = diag.Code
+	out["message"] = diag.Message
+	if len(diag.Trace) > 0 {
+		trace := make([]map[string]any, len(diag.Trace))
+		for i, f := range diag.Trace {
+			trace[i] = map[string]any{
+				"function": f.Function,
+				"file":     f.Pos.File,
+				"line":     f.Pos.Line + 1,
+				"col":      f.Pos.Col + 1,
+			}
+			if f.Elided > 0 {
+				trace[i]["elided"] = f.Elided
+			}
+			if f.Repeated > 0 {
+				trace[i]["repeated"] = f.Repeated
+			}
+		}
+		out["trace"] = trace
+	}
+	return out
+}
+
+// lintTool reports a script's parse, import and type errors, or its
+// warnings when there are none, one rendered diagnostic per entry
+// whichever stage found them.
 func lintTool(ctx context.Context, req *mcp.CallToolRequest, args pathArg) (*mcp.CallToolResult, any, error) {
 	data, err := readFile(args.Path)
 	if err != nil {
@@ -117,17 +167,31 @@ func lintTool(ctx context.Context, req *mcp.CallToolRequest, args pathArg) (*mcp
 	p := parser.New(string(data), args.Path)
 	prog, err := p.Parse()
 	if err != nil {
-		return nil, map[string]any{"errors": []string{err.Error()}}, nil
+		return nil, map[string]any{"errors": diagnostics(err)}, nil
 	}
 	prog, err = module.Resolve(prog, args.Path)
 	if err != nil {
-		return nil, map[string]any{"errors": []string{err.Error()}}, nil
+		return nil, map[string]any{"errors": diagnostics(err)}, nil
 	}
 	env := types.NewEnv(nil)
 	if err := types.Check(prog, env); err != nil {
-		return nil, map[string]any{"errors": []string{err.Error()}}, nil
+		return nil, map[string]any{"errors": diagnostics(err)}, nil
 	}
-	return nil, map[string]any{"status": "ok"}, nil
+	out := map[string]any{"status": "ok"}
+	if ws := env.Warnings(); len(ws) > 0 {
+		out["warnings"] = diagnostics(ws)
+	}
+	return nil, out, nil
+}
+
+// diagnostics renders each of the errors err holds (see errs.All).
+func diagnostics(err error) []string {
+	all := errs.All(err)
+	msgs := make([]string, len(all))
+	for i, e := range all {
+		msgs[i] = strings.TrimSuffix(e.Error(), "\n")
+	}
+	return msgs
 }
 
 func extractSkill(path string) (map[string]any, bool) {
@@ -145,21 +209,67 @@ func extractSkill(path string) (map[string]any, bool) {
 		return nil, false
 	}
 	out := map[string]any{"name": filepath.Base(path), "path": path}
+	if ws := env.Warnings(); len(ws) > 0 {
+		// Unknown attributes among them: a misspelled @tool would
+		// otherwise just leave a tool out.
+		out["warnings"] = diagnostics(ws)
+	}
 	var planSteps []string
+	var tools []map[string]any
 	for _, s := range prog.Stmts {
 		switch n := s.(type) {
 		case *ast.MetaBlock:
 			out["meta"] = n.Fields
+		case *ast.FnDecl:
+			// Only `@tool` functions are advertised, and never test
+			// helpers.
+			if n.Attrs.Get("tool") != nil && !n.Attrs.TestOnly() {
+				tools = append(tools, describeTool(n.Name, n.Attrs))
+			}
 		case *ast.PlanBlock:
+			plan := map[string]any{"name": n.Name}
+			var steps []map[string]any
 			if n.Body != nil {
 				for _, stmt := range n.Body.Statements {
 					if step, ok := stmt.(*ast.Step); ok {
 						planSteps = append(planSteps, step.Name)
+						if tool := describeTool(step.Name, step.Attrs); tool != nil {
+							steps = append(steps, tool)
+						}
 					}
 				}
 			}
-			out["plan"] = map[string]any{"name": n.Name, "steps": planSteps}
+			plan["steps"] = planSteps
+			if steps != nil {
+				plan["step_details"] = steps
+			}
+			out["plan"] = plan
 		}
 	}
+	if tools != nil {
+		out["tools"] = tools
+	}
 	return out, true
 }
+
+// describeTool summarizes a declaration's `@tool(description: ...)` and
+// `@deprecated` attributes for a skill description, or returns nil when
+// it has neither.
+func describeTool(name string, attrs ast.Attributes) map[string]any {
+	desc := attrs.ToolDescription()
+	note, deprecated := attrs.Deprecated()
+	if desc == "" && !deprecated {
+		return nil
+	}
+	tool := map[string]any{"name": name}
+	if desc != "" {
+		tool["description"] = desc
+	}
+	if deprecated {
+		tool["deprecated"] = true
+		if note != "" {
+			tool["deprecation_note"] = note
+		}
+	}
+	return tool
+}
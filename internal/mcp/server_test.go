@@ -6,6 +6,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/jiejie-dev/funny/v2/internal/cli"
 	"github.com/stretchr/testify/assert"
@@ -106,6 +107,49 @@ func TestLintTool_TypeError(t *testing.T) {
 	}
 }
 
+func TestLintTool_ReportsEveryTypeError(t *testing.T) {
+	dir := t.TempDir()
+	bad := filepath.Join(dir, "bad.fn")
+	src := "let x: int = \"hello\"\nlet y = missing + 1\nlet z: str = 3\n"
+	require.NoError(t, os.WriteFile(bad, []byte(src), 0o644))
+	_, out, err := lintTool(context.Background(), nil, pathArg{Path: bad})
+	require.NoError(t, err)
+	msgs := out.(map[string]any)["errors"].([]string)
+	require.Len(t, msgs, 3)
+	assert.Contains(t, msgs[0], "E2010")
+	assert.Contains(t, msgs[1], "E2001")
+	assert.Contains(t, msgs[2], "E2010")
+}
+
+func TestLintTool_ReportsEveryParseErrorAlike(t *testing.T) {
+	bad := filepath.Join(t.TempDir(), "bad.fn")
+	require.NoError(t, os.WriteFile(bad, []byte("let = 1\nlet y = 2\nlet = 3\n"), 0o644))
+	_, out, err := lintTool(context.Background(), nil, pathArg{Path: bad})
+	require.NoError(t, err)
+	msgs := out.(map[string]any)["errors"].([]string)
+	require.Len(t, msgs, 2, "one entry per parse error, as for type errors")
+	assert.Contains(t, msgs[0], ":1:")
+	assert.Contains(t, msgs[1], ":3:")
+}
+
+func TestLintTool_WarnsAboutUnknownAttributes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "skill.fn")
+	src := "@descripton(\"Look up a user\")\nfn lookup(id: int) -> str:\n    return \"u\"\n"
+	require.NoError(t, os.WriteFile(path, []byte(src), 0o644))
+	_, out, err := lintTool(context.Background(), nil, pathArg{Path: path})
+	require.NoError(t, err)
+	res := out.(map[string]any)
+	assert.Equal(t, "ok", res["status"])
+	ws := res["warnings"].([]string)
+	require.Len(t, ws, 1)
+	assert.Contains(t, ws[0], "warning[W2002]: unknown attribute @descripton")
+
+	skill, ok := extractSkill(path)
+	require.True(t, ok)
+	assert.Equal(t, ws, skill["warnings"])
+	assert.NotContains(t, skill, "tools")
+}
+
 func TestListSkillsTool_Dir(t *testing.T) {
 	dir := filepath.Join("..", "..", "testdata", "agent")
 	entries, err := os.ReadDir(dir)
@@ -133,3 +177,71 @@ func TestRun_DoesNotPanic(t *testing.T) {
 		t.Logf("Run(canceled ctx) returned %v (expected)", err)
 	}
 }
+
+func TestRunSkillTool_StopsWhenCallIsCancelled(t *testing.T) {
+	t.Setenv("FUNNY_CACHE", "off")
+	path := filepath.Join(t.TempDir(), "spin.fn")
+	require.NoError(t, os.WriteFile(path, []byte("let n = 0\nwhile true:\n    n = n + 1\n"), 0o644))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, out, err := runSkillTool(ctx, nil, pathArg{Path: path})
+	require.NoError(t, err)
+	assert.Contains(t, out.(map[string]any)["error"], "cancelled")
+	assert.Equal(t, "E3001", out.(map[string]any)["code"])
+}
+
+func TestRunSkillTool_ReportsStackTrace(t *testing.T) {
+	t.Setenv("FUNNY_CACHE", "off")
+	path := filepath.Join(t.TempDir(), "boom.fn")
+	require.NoError(t, os.WriteFile(path, []byte("fn at(xs: list[int], i: int) -> int:\n    return xs[i]\n\nat([1], 3)\n"), 0o644))
+	_, out, err := runSkillTool(context.Background(), nil, pathArg{Path: path})
+	require.NoError(t, err)
+	res := out.(map[string]any)
+	assert.Equal(t, "E2051", res["code"])
+	assert.Equal(t, "index out of bounds", res["message"])
+	trace := res["trace"].([]map[string]any)
+	require.Len(t, trace, 2)
+	assert.Equal(t, map[string]any{"function": "at", "file": path, "line": 2, "col": 15}, trace[0])
+	assert.Equal(t, "main", trace[1]["function"])
+	assert.Equal(t, 4, trace[1]["line"])
+}
+
+func TestRunSkillTool_CollapsesDeepRecursion(t *testing.T) {
+	t.Setenv("FUNNY_CACHE", "off")
+	path := filepath.Join(t.TempDir(), "deep.fn")
+	src := "fn down(n: int) -> int:\n    if n == 0:\n        return 1 / n\n    return down(n - 1) + 1\n\ndown(300)\n"
+	require.NoError(t, os.WriteFile(path, []byte(src), 0o644))
+	_, out, err := runSkillTool(context.Background(), nil, pathArg{Path: path})
+	require.NoError(t, err)
+	trace := out.(map[string]any)["trace"].([]map[string]any)
+	require.Len(t, trace, 3)
+	assert.Equal(t, 299, trace[1]["repeated"])
+	assert.NotContains(t, trace[0], "repeated")
+	assert.Equal(t, "main", trace[2]["function"])
+}
+
+func TestExtractSkill_ToolAttributes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "skill.fn")
+	src := `@tool(description: "Look up a user")
+fn lookup(id: int) -> str:
+    return "u"
+
+@deprecated
+fn old() -> int:
+    return 1
+
+plan "p":
+    @tool(description: "Fetch the user")
+    step "fetch":
+        println(lookup(1))
+    step "done":
+        println(2)
+`
+	require.NoError(t, os.WriteFile(path, []byte(src), 0o644))
+	skill, ok := extractSkill(path)
+	require.True(t, ok)
+	assert.Equal(t, []map[string]any{{"name": "lookup", "description": "Look up a user"}}, skill["tools"])
+	plan := skill["plan"].(map[string]any)
+	assert.Equal(t, []string{"fetch", "done"}, plan["steps"])
+	assert.Equal(t, []map[string]any{{"name": "fetch", "description": "Fetch the user"}}, plan["step_details"])
+}
@@ -1,17 +1,19 @@
 // Package module implements real (disk-backed) resolution of `import`
 // statements: reading the imported file, recursively resolving its own
-// imports, and splicing its `fn`/`struct` declarations into the importing
-// program so that they can be type-checked, evaluated, and compiled like
-// any other top-level declaration.
+// imports, and either keeping every file as a Unit of its own (Load), for
+// the compiler to compile separately and link, or splicing their
+// top-level declarations into the importing program (Resolve) so that
+// they can be type-checked and evaluated like any other top-level
+// declaration.
 //
 // Design summary (see docs/language-manual.md for user-facing behavior):
 //
 //   - Import paths are resolved relative to the *importing file's*
 //     directory (or used as-is if already absolute).
-//   - Only top-level `fn` and `struct` declarations are extracted from an
-//     imported file; any other top-level statement in a dependency file
-//     (let, expr, meta, plan, ...) is ignored. Dependency files are treated
-//     purely as function/struct libraries.
+//   - Only top-level `fn`, `struct`, `interface`, `type` and `const`
+//     declarations are extracted from an imported file; any other top-level statement in a
+//     dependency file (let, expr, meta, plan, ...) is ignored. Dependency
+//     files are treated purely as function/type libraries.
 //   - `import "path"` (no alias) merges the module's `pub` functions into
 //     the importer's flat namespace under their original bare names, so
 //     they're called directly (`add(1, 2)`).
@@ -20,13 +22,19 @@
 //     means "call the pub function `add` from that module". This mirrors
 //     Python's `import numpy as np` semantics: `np` is a local nickname,
 //     not a rename of numpy's internals.
-//   - Struct types (pub or not) are always merged under their original bare
-//     name, regardless of alias, since there is no `m.Point(...)` literal
-//     syntax; only functions support alias-qualified calls.
+//   - Struct, interface and alias types (pub or not) are always merged
+//     under their original bare name, regardless of alias, since there is no
+//     `m.Point(...)` literal syntax; only functions support alias-qualified
+//     calls.
 //   - A module's own private (non-`pub`) functions are hygienically
-//     renamed (e.g. `helper#3`) so they can never collide with, or be
-//     called directly by, code outside that module, while still being
-//     reachable from that module's own `pub` functions.
+//     renamed to a qualified name (`lib::helper`; see QualifiedName) so
+//     they can never collide with, or be called directly by, code outside
+//     that module, while still being reachable from that module's own
+//     `pub` functions. Private constants
+//     are renamed the same way; `pub const` keeps its bare name, so the
+//     importer can use it directly (`MAX_RETRIES`). A function parameter,
+//     `let` or `for` variable that shadows one of its own module's private
+//     constants is an error (E1106), since uses of it would be renamed.
 //   - Every dependency file is resolved and merged at most once per run,
 //     even if reached via multiple import paths (diamond dependencies).
 //   - Circular imports and duplicate top-level symbol names (across
@@ -37,6 +45,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/jiejie-dev/funny/v2/internal/ast"
@@ -48,12 +57,14 @@ import (
 // resolvedModule is the fully-processed result of resolving one dependency
 // file. ownDecls holds only *this file's* fn/struct declarations (already
 // privacy-renamed and alias-rewritten); directDeps lists the modules it
-// itself imports. Flattening the transitive graph into a single decl list
-// happens once, globally, in flatten() - never eagerly per file - so that a
-// module reached via two different import paths (a diamond dependency)
-// still ends up in the final program exactly once.
+// itself imports. Ordering the transitive graph happens once, globally, in
+// flatten() - never eagerly per file - so that a module reached via two
+// different import paths (a diamond dependency) still ends up in the
+// final program exactly once.
 type resolvedModule struct {
 	path       string
+	name       string // qualifier of its private symbols; see moduleName
+	source     []byte
 	ownDecls   []ast.Statement
 	directDeps []*resolvedModule
 	pubFuncs   map[string]bool
@@ -64,7 +75,79 @@ type resolver struct {
 	cache    map[string]*resolvedModule
 	inFlight map[string]bool
 	stack    []string
-	counter  int
+	names    map[string]bool // module names handed out so far
+}
+
+// Unit is one file of a program's import graph: its own top-level
+// declarations, with its private functions and constants already renamed
+// to their qualified names, and the units it imports. compiler.CompileUnit
+// compiles a unit into a bytecode.Module of its own, and bytecode.Link
+// joins those into the program that runs.
+type Unit struct {
+	Path   string          // absolute path of an imported file; as given for Graph.Main
+	Name   string          // qualifier of its private symbols (`lib` in `lib::helper`)
+	Source []byte          // the file's source; nil for Graph.Main
+	Decls  []ast.Statement // fn, struct, interface, type and const declarations; every statement for Graph.Main
+	Deps   []*Unit         // units it imports directly, in import order
+}
+
+// Graph is a program's import graph: the program itself, and every file
+// its imports reach, each once.
+type Graph struct {
+	Main  *Unit
+	Units []*Unit // imported files, dependencies before dependents
+	prog  *ast.Program
+}
+
+// Visible returns the units whose declarations u can see, dependencies
+// before dependents: every unit u's imports reach, directly or not.
+// Since Program splices them all into one namespace, that's what the type
+// checker lets u use.
+func (u *Unit) Visible() []*Unit {
+	seen := map[*Unit]bool{}
+	var out []*Unit
+	var visit func(d *Unit)
+	visit = func(d *Unit) {
+		if seen[d] {
+			return
+		}
+		seen[d] = true
+		for _, dep := range d.Deps {
+			visit(dep)
+		}
+		out = append(out, d)
+	}
+	for _, dep := range u.Deps {
+		visit(dep)
+	}
+	return out
+}
+
+// Program returns the graph spliced back into one Program, the imported
+// declarations ahead of the program's own statements: what the type
+// checker and the evaluator work on.
+func (g *Graph) Program() *ast.Program {
+	if len(g.Units) == 0 {
+		return g.prog
+	}
+	var stmts []ast.Statement
+	for _, u := range g.Units {
+		stmts = append(stmts, u.Decls...)
+	}
+	return &ast.Program{NodePos: g.prog.NodePos, Stmts: append(stmts, g.Main.Decls...)}
+}
+
+// Files returns the absolute paths of the imported files, sorted.
+func (g *Graph) Files() []string {
+	if len(g.Units) == 0 {
+		return nil
+	}
+	files := make([]string, len(g.Units))
+	for i, u := range g.Units {
+		files[i] = u.Path
+	}
+	sort.Strings(files)
+	return files
 }
 
 // Resolve expands every top-level `import` statement reachable from prog
@@ -73,14 +156,36 @@ type resolver struct {
 // prog's own statements. mainPath is used only to resolve relative import
 // paths; prog is not re-read from it.
 func Resolve(prog *ast.Program, mainPath string) (*ast.Program, error) {
+	out, _, err := ResolveFiles(prog, mainPath)
+	return out, err
+}
+
+// ResolveFiles is Resolve, also returning the absolute paths of the files
+// the imports read (prog's own file not included), sorted. The compile
+// cache hashes them to tell when a cached compile of prog is stale.
+func ResolveFiles(prog *ast.Program, mainPath string) (*ast.Program, []string, error) {
+	g, err := Load(prog, mainPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	return g.Program(), g.Files(), nil
+}
+
+// Load reads and resolves every file prog's imports reach, returning the
+// import graph without splicing it: each file stays a Unit of its own, so
+// it can be compiled, and cached, on its own. The rules, and the errors,
+// are those of Resolve; prog's alias calls are rewritten in place.
+func Load(prog *ast.Program, mainPath string) (*Graph, error) {
+	g := &Graph{Main: &Unit{Path: mainPath, Decls: prog.Stmts}, prog: prog}
 	if !hasImports(prog) {
-		return prog, nil
+		return g, nil
 	}
 	absMain := mainAbsPath(mainPath)
 	r := &resolver{
 		cache:    map[string]*resolvedModule{},
 		inFlight: map[string]bool{absMain: true},
 		stack:    []string{absMain},
+		names:    map[string]bool{},
 	}
 
 	directDeps, aliases, err := r.resolveImportsOf(prog, absMain)
@@ -96,7 +201,7 @@ func Resolve(prog *ast.Program, mainPath string) (*ast.Program, error) {
 	}
 
 	global := map[string]string{}
-	depDecls, err := flatten(directDeps, global)
+	order, err := flatten(directDeps, global)
 	if err != nil {
 		return nil, err
 	}
@@ -113,11 +218,19 @@ func Resolve(prog *ast.Program, mainPath string) (*ast.Program, error) {
 		global[name] = absMain
 	}
 
-	out := &ast.Program{
-		NodePos: prog.NodePos,
-		Stmts:   append(append([]ast.Statement{}, depDecls...), prog.Stmts...),
+	units := map[*resolvedModule]*Unit{}
+	for _, m := range order {
+		u := &Unit{Path: m.path, Name: m.name, Source: m.source, Decls: m.ownDecls}
+		for _, dep := range m.directDeps {
+			u.Deps = append(u.Deps, units[dep])
+		}
+		units[m] = u
+		g.Units = append(g.Units, u)
 	}
-	return out, nil
+	for _, dep := range directDeps {
+		g.Main.Deps = append(g.Main.Deps, units[dep])
+	}
+	return g, nil
 }
 
 // flatten walks the dependency graph rooted at deps in DFS post-order
@@ -126,9 +239,9 @@ func Resolve(prog *ast.Program, mainPath string) (*ast.Program, error) {
 // safe. seenNames accumulates symbol -> owning-module-path for duplicate
 // detection and is also useful to the caller for checking the importer's
 // own top-level names against it afterwards.
-func flatten(deps []*resolvedModule, seenNames map[string]string) ([]ast.Statement, error) {
+func flatten(deps []*resolvedModule, seenNames map[string]string) ([]*resolvedModule, error) {
 	visited := map[string]bool{}
-	var out []ast.Statement
+	var out []*resolvedModule
 	var visit func(m *resolvedModule) error
 	visit = func(m *resolvedModule) error {
 		if visited[m.path] {
@@ -150,7 +263,7 @@ func flatten(deps []*resolvedModule, seenNames map[string]string) ([]ast.Stateme
 				seenNames[name] = m.path
 			}
 		}
-		out = append(out, m.ownDecls...)
+		out = append(out, m)
 		return nil
 	}
 	for _, m := range deps {
@@ -253,13 +366,13 @@ func (r *resolver) resolveFile(path string) (*resolvedModule, error) {
 		return nil, err
 	}
 
-	r.counter++
-	modID := r.counter
+	name := r.moduleName(path)
 
 	var ownDecls []ast.Statement
 	privateRename := map[string]string{}
 	pubFuncs := map[string]bool{}
 	pubStructs := map[string]bool{}
+	privateConsts := map[string]string{}
 	for _, s := range prog.Stmts {
 		switch n := s.(type) {
 		case *ast.FnDecl:
@@ -267,36 +380,46 @@ func (r *resolver) resolveFile(path string) (*resolvedModule, error) {
 			if n.Pub {
 				pubFuncs[n.Name] = true
 			} else {
-				privateRename[n.Name] = fmt.Sprintf("%s#%d", n.Name, modID)
+				privateRename[n.Name] = QualifiedName(name, n.Name)
 			}
 		case *ast.StructDecl:
 			ownDecls = append(ownDecls, n)
 			if n.Pub {
 				pubStructs[n.Name] = true
 			}
+		case *ast.InterfaceDecl, *ast.TypeAliasDecl:
+			ownDecls = append(ownDecls, n)
+		case *ast.ConstDecl:
+			ownDecls = append(ownDecls, n)
+			if !n.Pub {
+				privateConsts[n.Name] = QualifiedName(name, n.Name)
+			}
 		}
 	}
 
-	ctx := &rewriteCtx{aliases: aliases, privateRename: privateRename}
+	ctx := &rewriteCtx{aliases: aliases, privateRename: privateRename, privateConsts: privateConsts}
 	for _, s := range ownDecls {
-		fn, ok := s.(*ast.FnDecl)
-		if !ok {
-			continue
-		}
-		if err := rewriteBlockRefs(fn.Body, ctx); err != nil {
+		if err := rewriteStmtRefs(s, ctx); err != nil {
 			return nil, err
 		}
 	}
 	for _, s := range ownDecls {
-		if fn, ok := s.(*ast.FnDecl); ok {
-			if newName, ok := privateRename[fn.Name]; ok {
-				fn.Name = newName
+		switch n := s.(type) {
+		case *ast.FnDecl:
+			if newName, ok := privateRename[n.Name]; ok {
+				n.Name = newName
+			}
+		case *ast.ConstDecl:
+			if newName, ok := privateConsts[n.Name]; ok {
+				n.Name = newName
 			}
 		}
 	}
 
 	mod := &resolvedModule{
 		path:       path,
+		name:       name,
+		source:     data,
 		ownDecls:   ownDecls,
 		directDeps: directDeps,
 		pubFuncs:   pubFuncs,
@@ -306,6 +429,27 @@ func (r *resolver) resolveFile(path string) (*resolvedModule, error) {
 	return mod, nil
 }
 
+// moduleName returns the name of the module at path, the qualifier of
+// its private symbols: the file's name without its extension, and a
+// number to tell it from an earlier module of the same name.
+func (r *resolver) moduleName(path string) string {
+	base := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	name := base
+	for n := 2; r.names[name]; n++ {
+		name = fmt.Sprintf("%s#%d", base, n)
+	}
+	r.names[name] = true
+	return name
+}
+
+// QualifiedName returns the name a module's private function or constant
+// is known by outside the module's own source: `lib::helper` for `helper`
+// of module lib. No funny identifier can spell it, so only the module
+// itself reaches it, yet errors and stack traces say which module it's in.
+func QualifiedName(module, name string) string {
+	return module + "::" + name
+}
+
 func resolveImportPath(baseDir, importPath string) (string, error) {
 	if strings.TrimSpace(importPath) == "" {
 		return "", fmt.Errorf("empty import path")
@@ -330,6 +474,12 @@ func declName(s ast.Statement) (string, bool) {
 		return n.Name, true
 	case *ast.StructDecl:
 		return n.Name, true
+	case *ast.InterfaceDecl:
+		return n.Name, true
+	case *ast.TypeAliasDecl:
+		return n.Name, true
+	case *ast.ConstDecl:
+		return n.Name, true
 	}
 	return "", false
 }
@@ -342,14 +492,29 @@ func toErrsPos(p ast.Pos) errs.Position {
 	return errs.Position{File: p.File, Line: p.Line, Col: p.Col}
 }
 
-// rewriteCtx carries the two kinds of call-site rewrites that must be
+// rewriteCtx carries the kinds of reference rewrites that must be
 // applied while walking a file's function bodies:
 //   - aliases: `alias.field(...)` -> plain call of the module's pub `field`
 //   - privateRename: bare call of one of *this file's own* private
 //     functions -> its hygienic name
+//   - privateConsts: use of one of this file's own private constants ->
+//     its hygienic name
 type rewriteCtx struct {
 	aliases       map[string]*resolvedModule
 	privateRename map[string]string
+	privateConsts map[string]string
+}
+
+// checkShadow rejects a local binding named after one of the module's
+// private constants: every use of the name is renamed to the constant's
+// hygienic name, so the local would be unreachable.
+func (ctx *rewriteCtx) checkShadow(name string, pos ast.Pos) error {
+	if _, ok := ctx.privateConsts[name]; !ok {
+		return nil
+	}
+	return errs.New("E1106",
+		fmt.Sprintf("%s shadows a private constant of the same module", name),
+		toErrsPos(pos), "rename the local binding")
 }
 
 func rewriteBlockRefs(b *ast.Block, ctx *rewriteCtx) error {
@@ -367,6 +532,11 @@ func rewriteBlockRefs(b *ast.Block, ctx *rewriteCtx) error {
 func rewriteStmtRefs(s ast.Statement, ctx *rewriteCtx) error {
 	switch n := s.(type) {
 	case *ast.LetStmt:
+		if err := ctx.checkShadow(n.Name, n.NodePos); err != nil {
+			return err
+		}
+		return rewriteExprRefs(n.Value, ctx)
+	case *ast.ConstDecl:
 		return rewriteExprRefs(n.Value, ctx)
 	case *ast.AssignStmt:
 		if err := rewriteExprRefs(n.Target, ctx); err != nil {
@@ -375,6 +545,8 @@ func rewriteStmtRefs(s ast.Statement, ctx *rewriteCtx) error {
 		return rewriteExprRefs(n.Value, ctx)
 	case *ast.ExprStmt:
 		return rewriteExprRefs(n.X, ctx)
+	case *ast.DeferStmt:
+		return rewriteExprRefs(n.Call, ctx)
 	case *ast.ReturnStmt:
 		if n.Value == nil {
 			return nil
@@ -394,6 +566,9 @@ func rewriteStmtRefs(s ast.Statement, ctx *rewriteCtx) error {
 		}
 		return rewriteBlockRefs(n.ElseBlock, ctx)
 	case *ast.ForStmt:
+		if err := ctx.checkShadow(n.Name, n.NodePos); err != nil {
+			return err
+		}
 		if err := rewriteExprRefs(n.Iterable, ctx); err != nil {
 			return err
 		}
@@ -411,13 +586,33 @@ func rewriteStmtRefs(s ast.Statement, ctx *rewriteCtx) error {
 			if err := rewriteExprRefs(arm.Pattern, ctx); err != nil {
 				return err
 			}
+			if err := rewriteExprRefs(arm.Guard, ctx); err != nil {
+				return err
+			}
 			if err := rewriteBlockRefs(arm.Body, ctx); err != nil {
 				return err
 			}
 		}
 		return nil
 	case *ast.FnDecl:
+		for _, param := range n.Params {
+			if err := ctx.checkShadow(param.Name, n.NodePos); err != nil {
+				return err
+			}
+		}
 		return rewriteBlockRefs(n.Body, ctx)
+	case *ast.StructDecl:
+		for _, f := range n.Fields {
+			if err := rewriteExprRefs(f.Default, ctx); err != nil {
+				return err
+			}
+		}
+		for _, m := range n.Methods {
+			if err := rewriteStmtRefs(m, ctx); err != nil {
+				return err
+			}
+		}
+		return nil
 	case *ast.Block:
 		return rewriteBlockRefs(n, ctx)
 	}
@@ -426,7 +621,12 @@ func rewriteStmtRefs(s ast.Statement, ctx *rewriteCtx) error {
 
 func rewriteExprRefs(e ast.Expression, ctx *rewriteCtx) error {
 	switch n := e.(type) {
-	case nil, *ast.LiteralExpr, *ast.VariableExpr:
+	case nil, *ast.LiteralExpr:
+		return nil
+	case *ast.VariableExpr:
+		if newName, ok := ctx.privateConsts[n.Name]; ok {
+			n.Name = newName
+		}
 		return nil
 	case *ast.BinaryExpr:
 		if err := rewriteExprRefs(n.Left, ctx); err != nil {
@@ -444,6 +644,13 @@ func rewriteExprRefs(e ast.Expression, ctx *rewriteCtx) error {
 			}
 		}
 		return nil
+	case *ast.SetLiteralExpr:
+		for _, el := range n.Elements {
+			if err := rewriteExprRefs(el, ctx); err != nil {
+				return err
+			}
+		}
+		return nil
 	case *ast.MapLiteralExpr:
 		for i := range n.Keys {
 			if err := rewriteExprRefs(n.Keys[i], ctx); err != nil {
@@ -455,10 +662,26 @@ func rewriteExprRefs(e ast.Expression, ctx *rewriteCtx) error {
 		}
 		return nil
 	case *ast.IndexExpr:
-		if err := rewriteExprRefs(n.Object, ctx); err != nil {
-			return err
+		for _, sub := range []ast.Expression{n.Object, n.Index, n.Low, n.High} {
+			if err := rewriteExprRefs(sub, ctx); err != nil {
+				return err
+			}
+		}
+		return nil
+	case *ast.OrPattern:
+		for _, sub := range n.Alts {
+			if err := rewriteExprRefs(sub, ctx); err != nil {
+				return err
+			}
 		}
-		return rewriteExprRefs(n.Index, ctx)
+		return nil
+	case *ast.RangeExpr:
+		for _, sub := range []ast.Expression{n.Start, n.End, n.Step} {
+			if err := rewriteExprRefs(sub, ctx); err != nil {
+				return err
+			}
+		}
+		return nil
 	case *ast.FieldExpr:
 		return rewriteExprRefs(n.Object, ctx)
 	case *ast.StructLiteralExpr:
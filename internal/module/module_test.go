@@ -83,13 +83,7 @@ func TestResolve_UnaliasedImport_DoesNotExposePrivateHelper(t *testing.T) {
 	names := fnNames(out)
 	assert.Contains(t, names, "add")
 	assert.NotContains(t, names, "helper")
-	found := false
-	for _, n := range names {
-		if n != "add" {
-			found = true
-		}
-	}
-	assert.True(t, found, "expected a hygienically-renamed private helper to still be present")
+	assert.Contains(t, names, "math::helper", "expected the private helper under its qualified name")
 }
 
 func TestResolve_AliasedImport_RewritesFieldCallToBareName(t *testing.T) {
@@ -253,3 +247,80 @@ func TestResolve_NestedImportAliasCall_Rewritten(t *testing.T) {
 	assert.Contains(t, names, "compute")
 	assert.Contains(t, names, "sin_ish")
 }
+
+func TestResolve_Const_PubMergedPrivateRenamed(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"limits.fn": "const STEP = 2\npub const MAX = 10 * STEP\npub fn next(x: int) -> int:\n    return x + STEP\n",
+		"main.fn":   "import \"limits.fn\"\nprintln(next(MAX))\n",
+	})
+	mainPath := filepath.Join(dir, "main.fn")
+	prog := parseFile(t, mainPath)
+
+	out, err := Resolve(prog, mainPath)
+	require.NoError(t, err)
+	var consts []string
+	for _, s := range out.Stmts {
+		if c, ok := s.(*ast.ConstDecl); ok {
+			consts = append(consts, c.String())
+		}
+	}
+	require.Len(t, consts, 2)
+	assert.Regexp(t, `^const limits::STEP = 2$`, consts[0])
+	assert.Regexp(t, `^pub const MAX = \(?10 \* limits::STEP\)?$`, consts[1])
+}
+
+func TestResolve_Const_LocalShadowingPrivateConstErrors(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"limits.fn": "const STEP = 2\npub fn next(x: int) -> int:\n    let STEP = 3\n    return x + STEP\n",
+		"main.fn":   "import \"limits.fn\"\nprintln(next(1))\n",
+	})
+	mainPath := filepath.Join(dir, "main.fn")
+	prog := parseFile(t, mainPath)
+
+	_, err := Resolve(prog, mainPath)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "E1106")
+}
+
+func TestLoad_KeepsEachFileAsAUnit(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"base.fn": "fn one() -> int:\n    return 1\n\npub fn base_val() -> int:\n    return one()\n",
+		"a.fn":    "import \"base.fn\"\npub fn from_a() -> int:\n    return base_val() + 1\n",
+		"b.fn":    "import \"base.fn\"\npub fn from_b() -> int:\n    return base_val() + 2\n",
+		"main.fn": "import \"a.fn\"\nimport \"b.fn\"\nprintln(from_a() + from_b())\n",
+	})
+	mainPath := filepath.Join(dir, "main.fn")
+	prog := parseFile(t, mainPath)
+
+	g, err := Load(prog, mainPath)
+	require.NoError(t, err)
+	require.Len(t, g.Units, 3)
+	base, a, b := g.Units[0], g.Units[1], g.Units[2]
+	assert.Equal(t, []string{"base", "a", "b"}, []string{base.Name, a.Name, b.Name})
+	assert.Equal(t, []*Unit{a, b}, g.Main.Deps)
+	assert.Equal(t, []*Unit{base}, a.Deps)
+	assert.Equal(t, []*Unit{base}, b.Deps)
+	assert.Equal(t, []*Unit{base, a, b}, g.Main.Visible())
+	assert.Equal(t, []string{"base::one", "base_val"}, fnNames(&ast.Program{Stmts: base.Decls}))
+	assert.Equal(t, mainPath, g.Main.Path)
+	assert.Equal(t, filepath.Join(dir, "base.fn"), base.Path)
+	assert.Contains(t, string(base.Source), "pub fn base_val")
+	assert.Equal(t, []string{"base::one", "base_val", "from_a", "from_b"}, fnNames(g.Program()))
+}
+
+func TestLoad_FilesOfTheSameNameGetDistinctModuleNames(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"x/util.fn": "fn helper() -> int:\n    return 1\n\npub fn x_val() -> int:\n    return helper()\n",
+		"y/util.fn": "fn helper() -> int:\n    return 2\n\npub fn y_val() -> int:\n    return helper()\n",
+		"main.fn":   "import \"x/util.fn\"\nimport \"y/util.fn\"\nprintln(x_val() + y_val())\n",
+	})
+	mainPath := filepath.Join(dir, "main.fn")
+	prog := parseFile(t, mainPath)
+
+	g, err := Load(prog, mainPath)
+	require.NoError(t, err)
+	require.Len(t, g.Units, 2)
+	assert.Equal(t, "util", g.Units[0].Name)
+	assert.Equal(t, "util#2", g.Units[1].Name)
+	assert.Contains(t, fnNames(g.Program()), "util#2::helper")
+}
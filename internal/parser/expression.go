@@ -15,6 +15,7 @@ const (
 	precAnd
 	precNot
 	precCmp
+	precRange
 	precAdd
 	precMul
 	precUnary
@@ -32,6 +33,8 @@ func precedence(k lexer.Kind) int {
 		return precNot
 	case lexer.EQEQ, lexer.NEQ, lexer.LT, lexer.GT, lexer.LTE, lexer.GTE, lexer.IN:
 		return precCmp
+	case lexer.DOTDOT:
+		return precRange
 	case lexer.PLUS, lexer.MINUS:
 		return precAdd
 	case lexer.STAR, lexer.SLASH, lexer.PERCENT:
@@ -56,6 +59,13 @@ func (p *Parser) parseBinary(minPrec int) (ast.Expression, error) {
 		if prec <= minPrec {
 			break
 		}
+		if p.cur.Kind == lexer.DOTDOT {
+			left, err = p.parseRange(left)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
 		opStr := p.cur.Data
 		pos := astPos(p.cur.Pos)
 		p.advance()
@@ -68,6 +78,29 @@ func (p *Parser) parseBinary(minPrec int) (ast.Expression, error) {
 	return left, nil
 }
 
+// parseRange parses the `..End [step Step]` tail of a range whose start
+// has already been parsed. Ranges don't chain: `a..b..c` is an error.
+func (p *Parser) parseRange(start ast.Expression) (ast.Expression, error) {
+	pos := astPos(p.cur.Pos)
+	p.advance()
+	end, err := p.parseBinary(precRange)
+	if err != nil {
+		return nil, err
+	}
+	r := &ast.RangeExpr{NodePos: pos, Start: start, End: end}
+	if p.cur.Kind == lexer.STEP {
+		p.advance()
+		if r.Step, err = p.parseBinary(precRange); err != nil {
+			return nil, err
+		}
+	}
+	if p.cur.Kind == lexer.DOTDOT {
+		return nil, errs.New("E1054", "ranges cannot be chained", errPos(p.cur.Pos),
+			"use a single `start..end [step k]`")
+	}
+	return r, nil
+}
+
 func (p *Parser) parseUnary() (ast.Expression, error) {
 	if p.cur.Kind == lexer.MINUS || p.cur.Kind == lexer.NOT {
 		op := p.cur.Data
@@ -140,14 +173,11 @@ func (p *Parser) parsePostfix() (ast.Expression, error) {
 		case lexer.LBRACK:
 			pos := astPos(p.cur.Pos)
 			p.advance()
-			idx, err := p.parseExpression()
+			idx, err := p.parseIndexOrSlice(pos, left)
 			if err != nil {
 				return nil, err
 			}
-			if _, err := p.expect(lexer.RBRACK); err != nil {
-				return nil, err
-			}
-			left = &ast.IndexExpr{NodePos: pos, Object: left, Index: idx}
+			left = idx
 		case lexer.QUESTION:
 			pos := astPos(p.cur.Pos)
 			p.advance()
@@ -202,6 +232,9 @@ func (p *Parser) parsePrimary() (ast.Expression, error) {
 		}
 		return &ast.FStringExpr{NodePos: pos, Raw: raw, Parts: parts}, nil
 	case lexer.NAME:
+		if p.cur.Data == "set" && p.peek.Kind == lexer.LBRACE {
+			return p.parseSetLiteral()
+		}
 		name := p.cur.Data
 		p.advance()
 		return &ast.VariableExpr{NodePos: pos, Name: name}, nil
@@ -263,6 +296,29 @@ func (p *Parser) parsePrimary() (ast.Expression, error) {
 		errPos(p.cur.Pos), "")
 }
 
+// parseSetLiteral parses `set{a, b, ...}`. `set` is an ordinary name
+// everywhere else; only a `{` straight after it makes a set literal.
+func (p *Parser) parseSetLiteral() (ast.Expression, error) {
+	pos := astPos(p.cur.Pos)
+	p.advance() // `set`
+	p.advance() // `{`
+	var elems []ast.Expression
+	for p.cur.Kind != lexer.RBRACE && p.cur.Kind != lexer.EOF {
+		e, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		elems = append(elems, e)
+		if p.cur.Kind == lexer.COMMA {
+			p.advance()
+		}
+	}
+	if _, err := p.expect(lexer.RBRACE); err != nil {
+		return nil, err
+	}
+	return &ast.SetLiteralExpr{NodePos: pos, Elements: elems}, nil
+}
+
 func (p *Parser) parseStructLiteral(typeName string) (ast.Expression, error) {
 	pos := astPos(p.cur.Pos)
 	p.advance() // consume '('
@@ -294,3 +350,36 @@ func (p *Parser) parseStructLiteral(typeName string) (ast.Expression, error) {
 		Fields:   fields,
 	}, nil
 }
+
+// parseIndexOrSlice parses what follows `[` in a postfix position: an
+// index `[i]` or a slice `[lo:hi]`, where either slice bound may be
+// omitted.
+func (p *Parser) parseIndexOrSlice(pos ast.Pos, obj ast.Expression) (*ast.IndexExpr, error) {
+	var first ast.Expression
+	if p.cur.Kind != lexer.COLON {
+		e, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		first = e
+	}
+	if p.cur.Kind != lexer.COLON {
+		if _, err := p.expect(lexer.RBRACK); err != nil {
+			return nil, err
+		}
+		return &ast.IndexExpr{NodePos: pos, Object: obj, Index: first}, nil
+	}
+	p.advance()
+	var high ast.Expression
+	if p.cur.Kind != lexer.RBRACK {
+		e, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		high = e
+	}
+	if _, err := p.expect(lexer.RBRACK); err != nil {
+		return nil, err
+	}
+	return &ast.IndexExpr{NodePos: pos, Object: obj, Slice: true, Low: first, High: high}, nil
+}
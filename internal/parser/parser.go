@@ -12,6 +12,7 @@ type Parser struct {
 	lx   *lexer.Lexer
 	cur  lexer.Token
 	peek lexer.Token
+	errs errs.List // syntax errors recovered from so far (see recoverStatement)
 }
 
 func New(src, file string) *Parser {
@@ -53,6 +54,10 @@ func (p *Parser) expect(k lexer.Kind) (lexer.Token, *errs.Error) {
 
 func (p *Parser) atEOF() bool { return p.cur.Kind == lexer.EOF }
 
+// Parse parses the whole source. A statement that fails to parse is
+// skipped (see recoverStatement) and parsing carries on, so the returned
+// program is always non-nil: on error it holds every statement that did
+// parse, and the error is an errs.List of all the syntax errors found.
 func (p *Parser) Parse() (*ast.Program, error) {
 	prog := &ast.Program{NodePos: astPos(p.cur.Pos)}
 	for !p.atEOF() {
@@ -62,17 +67,83 @@ func (p *Parser) Parse() (*ast.Program, error) {
 		if p.atEOF() {
 			break
 		}
+		start := p.cur
 		s, err := p.parseStatement()
 		if err != nil {
-			return nil, err
+			p.recoverStatement(err, start)
+			continue
 		}
 		if s != nil {
 			prog.Stmts = append(prog.Stmts, s)
 		}
 	}
+	if len(p.errs) > 0 {
+		return prog, p.errs
+	}
 	return prog, nil
 }
 
+// recoverStatement records err for the statement that began at start and
+// resynchronizes at the next statement boundary: it skips to the end of
+// the line, along with any block indented under it, stopping early at a
+// DEDENT that closes the enclosing block (left for the block's own loop).
+// Inside an unclosed bracket the lexer has already swallowed the line
+// breaks, so a statement keyword that starts a later line is a boundary
+// too. It always moves past start, so a statement that fails without
+// consuming anything can't stall the caller.
+func (p *Parser) recoverStatement(err error, start lexer.Token) {
+	if e, ok := err.(*errs.Error); ok {
+		p.errs = append(p.errs, e)
+	} else {
+		p.errs = append(p.errs, errs.New("E1000", err.Error(), errPos(start.Pos), ""))
+	}
+	// Abandoning a statement inside an unclosed bracket would leave the
+	// lexer suppressing every later NEWLINE and INDENT, swallowing the
+	// rest of the file into this one statement.
+	if st := p.lx.Snapshot(); st.ParenDepth > 0 {
+		st.ParenDepth = 0
+		p.lx.Restore(st)
+	}
+	depth, line := 0, start.Pos.Line
+	for !p.atEOF() {
+		if depth == 0 && p.cur.Pos.Line > line && statementKeywords[p.cur.Kind] {
+			return
+		}
+		line = p.cur.Pos.Line
+		switch p.cur.Kind {
+		case lexer.INDENT:
+			depth++
+		case lexer.DEDENT:
+			if depth == 0 {
+				if p.cur.Pos == start.Pos {
+					p.advance()
+				}
+				return
+			}
+			depth--
+			if depth == 0 {
+				p.advance()
+				return
+			}
+		case lexer.NEWLINE:
+			if depth == 0 && p.peek.Kind != lexer.INDENT {
+				p.advance()
+				return
+			}
+		}
+		p.advance()
+	}
+}
+
+// statementKeywords are the tokens that can only begin a statement.
+var statementKeywords = map[lexer.Kind]bool{
+	lexer.LET: true, lexer.CONST: true, lexer.IF: true, lexer.FOR: true,
+	lexer.WHILE: true, lexer.MATCH: true, lexer.RETURN: true, lexer.BREAK: true,
+	lexer.CONTINUE: true, lexer.DEFER: true, lexer.FN: true, lexer.STRUCT: true,
+	lexer.INTERFACE: true, lexer.META: true, lexer.PLAN: true, lexer.TEST: true,
+	lexer.STEP: true, lexer.IMPORT: true, lexer.PUB: true,
+}
+
 func astPos(p lexer.Position) ast.Pos {
 	return ast.Pos{File: p.File, Line: p.Line, Col: p.Col}
 }
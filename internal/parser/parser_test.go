@@ -1,10 +1,12 @@
 package parser
 
 import (
+	"errors"
 	"os"
 	"testing"
 
 	"github.com/jiejie-dev/funny/v2/internal/ast"
+	"github.com/jiejie-dev/funny/v2/internal/errs"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -156,6 +158,23 @@ func TestParser_Match(t *testing.T) {
 	assert.Len(t, ms.Arms, 2)
 }
 
+func TestParser_MatchPatternsAndGuards(t *testing.T) {
+	src := "match r:\n    1 | 2 =>\n        a\n    ok(v) if v > 0 =>\n        b\n    User(name: n) =>\n        c\n"
+	prog, err := New(src, "").Parse()
+	require.NoError(t, err)
+	arms := prog.Stmts[0].(*ast.MatchStmt).Arms
+	require.Len(t, arms, 3)
+	or := arms[0].Pattern.(*ast.OrPattern)
+	assert.Equal(t, "1 | 2", or.String())
+	assert.Nil(t, arms[0].Guard)
+	assert.Equal(t, "ok(v)", arms[1].Pattern.String())
+	assert.Equal(t, "v > 0", arms[1].Guard.String())
+	assert.IsType(t, &ast.StructLiteralExpr{}, arms[2].Pattern)
+	bound := ast.PatternBindings(arms[2].Pattern)
+	require.Len(t, bound, 1)
+	assert.Equal(t, "n", bound[0].Name)
+}
+
 func TestParser_For(t *testing.T) {
 	src := "for i in items:\n    print(i)\n"
 	p := New(src, "")
@@ -217,6 +236,101 @@ func TestParser_StructDecl_MutFields(t *testing.T) {
 	assert.Equal(t, "label", s.Fields[1].Name)
 }
 
+func TestParser_StructDecl_Methods(t *testing.T) {
+	src := "struct Counter:\n    mut count: int\n    fn get(self) -> int:\n        return self.count\n    fn bump(mut self, by: int):\n        self.count = self.count + by\n"
+	p := New(src, "")
+	prog, err := p.Parse()
+	require.NoError(t, err)
+	s := prog.Stmts[0].(*ast.StructDecl)
+	require.Len(t, s.Fields, 1)
+	require.Len(t, s.Methods, 2)
+	get := s.Method("get")
+	require.NotNil(t, get)
+	assert.Equal(t, "Counter", get.Receiver)
+	assert.Equal(t, "int", get.RetType)
+	assert.False(t, get.Params[0].Mut)
+	bump := s.Method("bump")
+	require.NotNil(t, bump)
+	require.Len(t, bump.Params, 2)
+	assert.True(t, bump.Params[0].Mut)
+	assert.Equal(t, "by", bump.Params[1].Name)
+}
+
+func TestParser_Method_RequiresSelf(t *testing.T) {
+	src := "struct Counter:\n    count: int\n    fn get(x: int) -> int:\n        return x\n"
+	_, err := New(src, "").Parse()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "E1035")
+}
+
+func TestParser_MutParamOutsideMethodRejected(t *testing.T) {
+	src := "fn f(mut self):\n    return\n"
+	_, err := New(src, "").Parse()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "E1036")
+}
+
+func TestParser_InterfaceDecl(t *testing.T) {
+	src := "pub interface Row:\n    fn to_row(self) -> list[str]\n    fn width(self, pad: int) -> int\n"
+	prog, err := New(src, "").Parse()
+	require.NoError(t, err)
+	i := prog.Stmts[0].(*ast.InterfaceDecl)
+	assert.True(t, i.Pub)
+	assert.Equal(t, "Row", i.Name)
+	require.Len(t, i.Methods, 2)
+	assert.Equal(t, "to_row", i.Methods[0].Name)
+	assert.Equal(t, "list[str]", i.Methods[0].RetType)
+	assert.Equal(t, "Row", i.Methods[0].Receiver)
+	assert.Nil(t, i.Methods[0].Body)
+	require.Len(t, i.Methods[1].Params, 2)
+	assert.Equal(t, "pad", i.Methods[1].Params[1].Name)
+}
+
+func TestParser_InterfaceDecl_Errors(t *testing.T) {
+	cases := []struct{ src, want string }{
+		{"interface Row:\n    fn to_row(self) -> list[str]:\n        return []\n", "E1038"},
+		{"interface Row:\n    name: str\n", "E1038"},
+		{"interface Row:\n    fn to_row() -> list[str]\n", "E1035"},
+	}
+	for _, tc := range cases {
+		_, err := New(tc.src, "").Parse()
+		require.Error(t, err, tc.src)
+		assert.Contains(t, err.Error(), tc.want, tc.src)
+	}
+}
+
+func TestParser_TypeAlias(t *testing.T) {
+	src := "type UserId = str\npub type Ids = list[UserId]\nlet type = 1\n"
+	prog, err := New(src, "").Parse()
+	require.NoError(t, err)
+	a := prog.Stmts[0].(*ast.TypeAliasDecl)
+	assert.Equal(t, "UserId", a.Name)
+	assert.Equal(t, "str", a.Target)
+	assert.False(t, a.Pub)
+	b := prog.Stmts[1].(*ast.TypeAliasDecl)
+	assert.True(t, b.Pub)
+	assert.Equal(t, "list[UserId]", b.Target)
+	_, ok := prog.Stmts[2].(*ast.LetStmt)
+	assert.True(t, ok, "`type` stays usable as an identifier")
+
+	_, err = New("type UserId =\n", "").Parse()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "E1039")
+}
+
+func TestParser_StructFieldDefaults(t *testing.T) {
+	src := "struct User:\n    name: str\n    age: int = 18\n    tags: list[str] = []\n"
+	prog, err := New(src, "").Parse()
+	require.NoError(t, err)
+	s := prog.Stmts[0].(*ast.StructDecl)
+	require.Len(t, s.Fields, 3)
+	assert.Nil(t, s.Fields[0].Default)
+	assert.Equal(t, "int", s.Fields[1].TypeAnn)
+	assert.Equal(t, "18", s.Fields[1].Default.String())
+	assert.Equal(t, "list[str]", s.Fields[2].TypeAnn)
+	assert.NotNil(t, s.Fields[2].Default)
+}
+
 func TestParser_PubFn(t *testing.T) {
 	src := "pub fn hello() -> int:\n    return 1\n"
 	p := New(src, "")
@@ -284,3 +398,161 @@ println(r)
 	_, err := p.Parse()
 	assert.NoError(t, err)
 }
+
+func TestParser_RecoversAtStatementBoundaries(t *testing.T) {
+	src := `let a =
+fn f(n: int) -> int:
+    let y = ]
+    return n
+if a ==:
+    println(1)
+    println(2)
+struct P:
+    x: int
+let ok = f(2)
+`
+	prog, err := New(src, "t.fn").Parse()
+	require.Error(t, err)
+	var list errs.List
+	require.True(t, errors.As(err, &list))
+	require.Len(t, list, 3)
+	assert.Equal(t, 0, list[0].Pos.Line)
+	assert.Equal(t, 2, list[1].Pos.Line)
+	assert.Equal(t, 4, list[2].Pos.Line)
+
+	require.NotNil(t, prog)
+	require.Len(t, prog.Stmts, 3, "fn f, struct P and let ok survive; the broken if and its block are skipped")
+	fn := prog.Stmts[0].(*ast.FnDecl)
+	require.Len(t, fn.Body.Statements, 1, "recovery inside a block keeps the block's other statements")
+	assert.IsType(t, &ast.StructDecl{}, prog.Stmts[1])
+	assert.Equal(t, "ok", prog.Stmts[2].(*ast.LetStmt).Name)
+}
+
+func TestParser_RecoversFromUnclosedBracket(t *testing.T) {
+	prog, err := New("let a = (1 +\nlet b = 2\nlet c = 3\n", "").Parse()
+	require.Error(t, err)
+	require.Len(t, errs.All(err), 1)
+	require.Len(t, prog.Stmts, 2, "the statement after the unclosed bracket is still parsed")
+	assert.Equal(t, "b", prog.Stmts[0].(*ast.LetStmt).Name)
+	assert.Equal(t, "c", prog.Stmts[1].(*ast.LetStmt).Name)
+
+	// A bracket that spans lines before the error is skipped as a whole.
+	prog, err = New("let a = foo(1,\n    2 +)\nlet b = 2\n", "").Parse()
+	require.Error(t, err)
+	require.Len(t, prog.Stmts, 1)
+	assert.Equal(t, "b", prog.Stmts[0].(*ast.LetStmt).Name)
+}
+
+func TestParser_RangeExpr(t *testing.T) {
+	prog, err := New("for i in a + 1..n * 2 step k - 1:\n    x\n", "").Parse()
+	require.NoError(t, err)
+	r := prog.Stmts[0].(*ast.ForStmt).Iterable.(*ast.RangeExpr)
+	assert.Equal(t, "a + 1", r.Start.String())
+	assert.Equal(t, "n * 2", r.End.String())
+	assert.Equal(t, "k - 1", r.Step.String())
+
+	prog, err = New("0..3 == xs\n", "").Parse()
+	require.NoError(t, err)
+	cmp := prog.Stmts[0].(*ast.ExprStmt).X.(*ast.BinaryExpr)
+	assert.IsType(t, &ast.RangeExpr{}, cmp.Left, "ranges bind tighter than comparisons")
+
+	_, err = New("0..1..2\n", "").Parse()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "E1054")
+}
+
+func TestParser_SliceExpr(t *testing.T) {
+	cases := []struct{ src, want string }{
+		{"xs[1:3]\n", "xs[1:3]"},
+		{"s[:5]\n", "s[:5]"},
+		{"s[i:]\n", "s[i:]"},
+		{"s[:]\n", "s[:]"},
+	}
+	for _, tc := range cases {
+		prog, err := New(tc.src, "").Parse()
+		require.NoError(t, err, tc.src)
+		idx := prog.Stmts[0].(*ast.ExprStmt).X.(*ast.IndexExpr)
+		assert.True(t, idx.Slice, tc.src)
+		assert.Nil(t, idx.Index, tc.src)
+		assert.Equal(t, tc.want, idx.String())
+	}
+	prog, err := New("xs[1]\n", "").Parse()
+	require.NoError(t, err)
+	assert.False(t, prog.Stmts[0].(*ast.ExprStmt).X.(*ast.IndexExpr).Slice)
+}
+
+func TestParser_Defer(t *testing.T) {
+	prog, err := New("fn f(c: Conn):\n    defer c.close(1)\n", "").Parse()
+	require.NoError(t, err)
+	d := prog.Stmts[0].(*ast.FnDecl).Body.Statements[0].(*ast.DeferStmt)
+	assert.Equal(t, "defer c.close(1)", d.String())
+
+	_, err = New("fn f():\n    defer x + 1\n", "").Parse()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "E1055")
+}
+
+func TestParser_Const(t *testing.T) {
+	prog, err := New("const LIMIT = 10\npub const NAME = \"x\"\n", "").Parse()
+	require.NoError(t, err)
+	require.Len(t, prog.Stmts, 2)
+	assert.Equal(t, "const LIMIT = 10", prog.Stmts[0].(*ast.ConstDecl).String())
+	assert.Equal(t, "pub const NAME = \"x\"", prog.Stmts[1].(*ast.ConstDecl).String())
+
+	_, err = New("const = 1\n", "").Parse()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "E1056")
+}
+
+func TestParser_Attributes(t *testing.T) {
+	src := `@deprecated("use add2")
+@tool(description: "Adds two ints", cost: 1)
+pub fn add(a: int, b: int) -> int:
+    return a + b
+
+@test_only
+struct Fake:
+    @json("the_x")
+    x: int
+    y: int
+    @deprecated
+    fn get(self) -> int:
+        return self.x
+
+plan "p":
+    @tool(description: "fetch")
+    step "s":
+        println(1)
+`
+	prog, err := New(src, "").Parse()
+	require.NoError(t, err)
+	fn := prog.Stmts[0].(*ast.FnDecl)
+	assert.True(t, fn.Pub)
+	require.Len(t, fn.Attrs, 2)
+	assert.Equal(t, `@tool(description: "Adds two ints", cost: 1)`, fn.Attrs[1].String())
+	note, ok := fn.Attrs.Deprecated()
+	assert.True(t, ok)
+	assert.Equal(t, "use add2", note)
+	assert.Equal(t, "Adds two ints", fn.Attrs.ToolDescription())
+
+	st := prog.Stmts[1].(*ast.StructDecl)
+	assert.True(t, st.Attrs.TestOnly())
+	assert.Equal(t, "the_x", st.Fields[0].JSONKey())
+	assert.Equal(t, "y", st.Fields[1].JSONKey())
+	_, ok = st.Methods[0].Attrs.Deprecated()
+	assert.True(t, ok)
+
+	step := prog.Stmts[2].(*ast.PlanBlock).Body.Statements[0].(*ast.Step)
+	assert.Equal(t, "fetch", step.Attrs.ToolDescription())
+
+	bad := map[string]string{
+		"@\nfn f():\n    return\n":                     "E1057",
+		"@tool(description: x)\nfn f():\n    return\n": "E1058",
+		"@test_only\nlet x = 1\n":                      "E1059",
+	}
+	for src, code := range bad {
+		_, err := New(src, "").Parse()
+		require.Error(t, err, src)
+		assert.Contains(t, err.Error(), code, src)
+	}
+}
@@ -0,0 +1,23 @@
+// Tests for `set{a, b, ...}` literal parsing: `set` followed directly by
+// `{` is a literal, and an ordinary name everywhere else.
+package parser
+
+import (
+	"testing"
+
+	"github.com/jiejie-dev/funny/v2/internal/ast"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSetLiteral(t *testing.T) {
+	prog, err := New("set{1, 2, 3}\nset{}\nlet set = 1\nset + 1\n", "").Parse()
+	require.NoError(t, err)
+	s := prog.Stmts[0].(*ast.ExprStmt).X.(*ast.SetLiteralExpr)
+	require.Len(t, s.Elements, 3)
+	assert.Equal(t, "set{1, 2, 3}", s.String())
+	empty := prog.Stmts[1].(*ast.ExprStmt).X.(*ast.SetLiteralExpr)
+	assert.Empty(t, empty.Elements)
+	bin := prog.Stmts[3].(*ast.ExprStmt).X.(*ast.BinaryExpr)
+	assert.Equal(t, "set", bin.Left.(*ast.VariableExpr).Name)
+}
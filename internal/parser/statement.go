@@ -65,6 +65,8 @@ func (p *Parser) parseStatement() (ast.Statement, error) {
 	switch p.cur.Kind {
 	case lexer.LET:
 		return p.parseLet()
+	case lexer.CONST:
+		return p.parseConst()
 	case lexer.IF:
 		return p.parseIf()
 	case lexer.FOR:
@@ -81,10 +83,14 @@ func (p *Parser) parseStatement() (ast.Statement, error) {
 	case lexer.CONTINUE:
 		p.advance()
 		return &ast.ContinueStmt{NodePos: astPos(p.cur.Pos)}, nil
+	case lexer.DEFER:
+		return p.parseDefer()
 	case lexer.FN:
 		return p.parseFnDecl()
 	case lexer.STRUCT:
 		return p.parseStructDecl()
+	case lexer.INTERFACE:
+		return p.parseInterfaceDecl()
 	case lexer.META:
 		return p.parseMeta()
 	case lexer.PLAN:
@@ -97,7 +103,12 @@ func (p *Parser) parseStatement() (ast.Statement, error) {
 		return p.parseImport()
 	case lexer.PUB:
 		return p.parsePub()
+	case lexer.AT:
+		return p.parseAttributed()
 	case lexer.NAME:
+		if p.cur.Data == "type" && p.peek.Kind == lexer.NAME {
+			return p.parseTypeAlias()
+		}
 		return p.parseAssignOrExpr()
 	case lexer.COMMENT, lexer.DOC_COMMENT:
 		text := p.cur.Data
@@ -152,6 +163,25 @@ func (p *Parser) parseLet() (ast.Statement, error) {
 	}
 	return &ast.LetStmt{NodePos: pos, Name: name, TypeAnn: typeAnn, Value: val}, nil
 }
+
+func (p *Parser) parseConst() (ast.Statement, error) {
+	pos := astPos(p.cur.Pos)
+	p.advance()
+	if p.cur.Kind != lexer.NAME {
+		return nil, errs.New("E1056", "expected constant name after `const`", errPos(p.cur.Pos), "")
+	}
+	name := p.cur.Data
+	p.advance()
+	if _, err := p.expect(lexer.EQ); err != nil {
+		return nil, err
+	}
+	val, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+	return &ast.ConstDecl{NodePos: pos, Name: name, Value: val}, nil
+}
+
 func (p *Parser) parseBlock() (*ast.Block, error) {
 	pos := astPos(p.cur.Pos)
 	if p.cur.Kind == lexer.NEWLINE {
@@ -171,9 +201,11 @@ func (p *Parser) parseBlock() (*ast.Block, error) {
 		if p.cur.Kind == lexer.DEDENT || p.cur.Kind == lexer.EOF {
 			break
 		}
+		start := p.cur
 		s, err := p.parseStatement()
 		if err != nil {
-			return nil, err
+			p.recoverStatement(err, start)
+			continue
 		}
 		if s != nil {
 			block.Statements = append(block.Statements, s)
@@ -291,10 +323,17 @@ func (p *Parser) parseMatch() (ast.Statement, error) {
 		if p.cur.Kind == lexer.DEDENT {
 			break
 		}
-		pattern, err := p.parseExpression()
+		pattern, err := p.parsePattern()
 		if err != nil {
 			return nil, err
 		}
+		var guard ast.Expression
+		if p.cur.Kind == lexer.IF {
+			p.advance()
+			if guard, err = p.parseExpression(); err != nil {
+				return nil, err
+			}
+		}
 		if _, err := p.expect(lexer.FATARROW); err != nil {
 			return nil, err
 		}
@@ -302,7 +341,7 @@ func (p *Parser) parseMatch() (ast.Statement, error) {
 		if err != nil {
 			return nil, err
 		}
-		arms = append(arms, ast.MatchArm{Pattern: pattern, Body: body})
+		arms = append(arms, ast.MatchArm{Pattern: pattern, Guard: guard, Body: body})
 	}
 	if p.cur.Kind == lexer.DEDENT {
 		p.advance()
@@ -310,6 +349,29 @@ func (p *Parser) parseMatch() (ast.Statement, error) {
 	return &ast.MatchStmt{NodePos: pos, Expr: expr, Arms: arms}, nil
 }
 
+// parsePattern parses a match arm's pattern: one or more `|`-separated
+// alternatives, each an expression (see ast.MatchArm for how they're read).
+func (p *Parser) parsePattern() (ast.Expression, error) {
+	pos := astPos(p.cur.Pos)
+	first, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+	if p.cur.Kind != lexer.PIPE {
+		return first, nil
+	}
+	or := &ast.OrPattern{NodePos: pos, Alts: []ast.Expression{first}}
+	for p.cur.Kind == lexer.PIPE {
+		p.advance()
+		alt, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		or.Alts = append(or.Alts, alt)
+	}
+	return or, nil
+}
+
 func (p *Parser) parseReturn() (ast.Statement, error) {
 	pos := astPos(p.cur.Pos)
 	p.advance()
@@ -322,6 +384,102 @@ func (p *Parser) parseReturn() (ast.Statement, error) {
 	}
 	return &ast.ReturnStmt{NodePos: pos, Value: val}, nil
 }
+
+// parseDefer parses `defer <call>`. Only a call can be deferred; anything
+// else would have no effect to delay.
+func (p *Parser) parseDefer() (ast.Statement, error) {
+	pos := astPos(p.cur.Pos)
+	p.advance()
+	start := p.cur.Pos
+	expr, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+	call, ok := expr.(*ast.CallExpr)
+	if !ok {
+		return nil, errs.New("E1055", "defer expects a function or method call", errPos(start), "")
+	}
+	return &ast.DeferStmt{NodePos: pos, Call: call}, nil
+}
+
+// parseAttributed parses the attribute lines in front of a declaration
+// and attaches them to it. Only `fn`, `struct` and plan `step`
+// declarations take attributes.
+func (p *Parser) parseAttributed() (ast.Statement, error) {
+	attrs, err := p.parseAttributes()
+	if err != nil {
+		return nil, err
+	}
+	declTok := p.cur
+	s, err := p.parseStatement()
+	if err != nil {
+		return nil, err
+	}
+	switch n := s.(type) {
+	case *ast.FnDecl:
+		n.Attrs = attrs
+	case *ast.StructDecl:
+		n.Attrs = attrs
+	case *ast.Step:
+		n.Attrs = attrs
+	default:
+		return nil, errs.New("E1059", "attributes only apply to `fn`, `struct` and `step` declarations", errPos(declTok.Pos), "")
+	}
+	return s, nil
+}
+
+// parseAttributes parses consecutive `@name` / `@name(args)` lines. An
+// argument is a literal, optionally named (`description: "..."`).
+func (p *Parser) parseAttributes() (ast.Attributes, error) {
+	var attrs ast.Attributes
+	for p.cur.Kind == lexer.AT {
+		pos := astPos(p.cur.Pos)
+		p.advance()
+		if p.cur.Kind != lexer.NAME {
+			return nil, errs.New("E1057", "expected attribute name after `@`", errPos(p.cur.Pos), "")
+		}
+		attr := &ast.Attribute{NodePos: pos, Name: p.cur.Data}
+		p.advance()
+		if p.cur.Kind == lexer.LPAREN {
+			p.advance()
+			for p.cur.Kind != lexer.RPAREN {
+				var arg ast.AttrArg
+				if p.cur.Kind == lexer.NAME && p.peek.Kind == lexer.COLON {
+					arg.Name = p.cur.Data
+					p.advance()
+					p.advance()
+				}
+				valTok := p.cur
+				val, err := p.parseExpression()
+				if err != nil {
+					return nil, err
+				}
+				lit, ok := val.(*ast.LiteralExpr)
+				if !ok || lit.Value == nil {
+					return nil, errs.New("E1058", fmt.Sprintf("attribute argument must be a literal, got `%s`", val), errPos(valTok.Pos), "")
+				}
+				arg.Value = lit
+				attr.Args = append(attr.Args, arg)
+				if p.cur.Kind != lexer.COMMA {
+					break
+				}
+				p.advance()
+			}
+			if _, err := p.expect(lexer.RPAREN); err != nil {
+				return nil, err
+			}
+		}
+		attrs = append(attrs, attr)
+		if _, err := p.expect(lexer.NEWLINE); err != nil {
+			return nil, err
+		}
+		for p.cur.Kind == lexer.NEWLINE {
+			p.advance()
+		}
+	}
+	return attrs, nil
+}
+
 func (p *Parser) parsePub() (ast.Statement, error) {
 	p.advance()
 	switch p.cur.Kind {
@@ -339,11 +497,66 @@ func (p *Parser) parsePub() (ast.Statement, error) {
 		}
 		s.(*ast.StructDecl).Pub = true
 		return s, nil
+	case lexer.CONST:
+		c, err := p.parseConst()
+		if err != nil {
+			return nil, err
+		}
+		c.(*ast.ConstDecl).Pub = true
+		return c, nil
+	case lexer.INTERFACE:
+		i, err := p.parseInterfaceDecl()
+		if err != nil {
+			return nil, err
+		}
+		i.(*ast.InterfaceDecl).Pub = true
+		return i, nil
+	case lexer.NAME:
+		if p.cur.Data == "type" {
+			a, err := p.parseTypeAlias()
+			if err != nil {
+				return nil, err
+			}
+			a.(*ast.TypeAliasDecl).Pub = true
+			return a, nil
+		}
 	}
-	return nil, errs.New("E1030", "`pub` must precede `fn` or `struct`", errPos(p.cur.Pos), "")
+	return nil, errs.New("E1030", "`pub` must precede `fn`, `struct`, `interface`, `type` or `const`", errPos(p.cur.Pos), "")
 }
 
 func (p *Parser) parseFnDecl() (ast.Statement, error) {
+	fn, err := p.parseFn("")
+	if err != nil {
+		return nil, err
+	}
+	return fn, nil
+}
+
+// parseFn parses a `fn` declaration. receiver is the enclosing struct's
+// name for a method declared inside a struct body (see parseStructDecl),
+// or "" for a free function.
+func (p *Parser) parseFn(receiver string) (*ast.FnDecl, error) {
+	fn, err := p.parseFnHeader(receiver)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(lexer.COLON); err != nil {
+		return nil, err
+	}
+	body, err := p.parseBlock()
+	if err != nil {
+		return nil, err
+	}
+	fn.Body = body
+	return fn, nil
+}
+
+// parseFnHeader parses `fn name(params) -> ret` up to (not including) the
+// `:` that opens the body, so interface declarations can reuse it for
+// their body-less method signatures. Methods must take `self` (or
+// `mut self`) as their first, unannotated parameter; `mut` is rejected
+// anywhere else.
+func (p *Parser) parseFnHeader(receiver string) (*ast.FnDecl, error) {
 	pos := astPos(p.cur.Pos)
 	p.advance()
 	if p.cur.Kind != lexer.NAME {
@@ -356,6 +569,15 @@ func (p *Parser) parseFnDecl() (ast.Statement, error) {
 	}
 	var params []ast.Param
 	for p.cur.Kind != lexer.RPAREN && p.cur.Kind != lexer.EOF {
+		mut := false
+		if p.cur.Kind == lexer.MUT {
+			mutPos := p.cur.Pos
+			p.advance()
+			if receiver == "" || len(params) > 0 || p.cur.Kind != lexer.NAME || p.cur.Data != "self" {
+				return nil, errs.New("E1036", "`mut` is only allowed on a method's `self` receiver", errPos(mutPos), "")
+			}
+			mut = true
+		}
 		if p.cur.Kind != lexer.NAME {
 			return nil, errs.New("E1032", "expected parameter name", errPos(p.cur.Pos), "")
 		}
@@ -366,27 +588,25 @@ func (p *Parser) parseFnDecl() (ast.Statement, error) {
 			p.advance()
 			ptype = p.consumeTypeAnn(lexer.COMMA, lexer.RPAREN)
 		}
-		params = append(params, ast.Param{Name: pname, TypeAnn: ptype})
+		params = append(params, ast.Param{Name: pname, TypeAnn: ptype, Mut: mut})
 		if p.cur.Kind == lexer.COMMA {
 			p.advance()
 		}
 	}
+	if receiver != "" && (len(params) == 0 || params[0].Name != "self" || params[0].TypeAnn != "") {
+		return nil, errs.New("E1035",
+			fmt.Sprintf("method %s.%s must take `self` as its first parameter", receiver, name),
+			errPos(p.cur.Pos), "declare it as `fn "+name+"(self, ...)` or `fn "+name+"(mut self, ...)`")
+	}
 	if _, err := p.expect(lexer.RPAREN); err != nil {
 		return nil, err
 	}
 	var retType string
 	if p.cur.Kind == lexer.ARROW {
 		p.advance()
-		retType = p.consumeTypeAnn(lexer.COLON)
-	}
-	if _, err := p.expect(lexer.COLON); err != nil {
-		return nil, err
+		retType = p.consumeTypeAnn(lexer.COLON, lexer.NEWLINE)
 	}
-	body, err := p.parseBlock()
-	if err != nil {
-		return nil, err
-	}
-	return &ast.FnDecl{NodePos: pos, Name: name, Params: params, RetType: retType, Body: body}, nil
+	return &ast.FnDecl{NodePos: pos, Name: name, Receiver: receiver, Params: params, RetType: retType}, nil
 }
 
 func (p *Parser) parseStructDecl() (ast.Statement, error) {
@@ -407,6 +627,7 @@ func (p *Parser) parseStructDecl() (ast.Statement, error) {
 		return nil, err
 	}
 	var fields []ast.Param
+	var methods []*ast.FnDecl
 	for p.cur.Kind != lexer.DEDENT && p.cur.Kind != lexer.EOF {
 		for p.cur.Kind == lexer.NEWLINE {
 			p.advance()
@@ -414,6 +635,19 @@ func (p *Parser) parseStructDecl() (ast.Statement, error) {
 		if p.cur.Kind == lexer.DEDENT || p.cur.Kind == lexer.EOF {
 			break
 		}
+		attrs, err := p.parseAttributes()
+		if err != nil {
+			return nil, err
+		}
+		if p.cur.Kind == lexer.FN {
+			m, err := p.parseFn(name)
+			if err != nil {
+				return nil, err
+			}
+			m.Attrs = attrs
+			methods = append(methods, m)
+			continue
+		}
 		mut := false
 		if p.cur.Kind == lexer.MUT {
 			p.advance()
@@ -427,14 +661,89 @@ func (p *Parser) parseStructDecl() (ast.Statement, error) {
 		var ftype string
 		if p.cur.Kind == lexer.COLON {
 			p.advance()
-			ftype = p.consumeTypeAnn(lexer.NEWLINE)
+			ftype = p.consumeTypeAnn(lexer.NEWLINE, lexer.EQ)
 		}
-		fields = append(fields, ast.Param{Name: fname, TypeAnn: ftype, Mut: mut})
+		var def ast.Expression
+		if p.cur.Kind == lexer.EQ {
+			p.advance()
+			var err error
+			if def, err = p.parseExpression(); err != nil {
+				return nil, err
+			}
+		}
+		fields = append(fields, ast.Param{Name: fname, TypeAnn: ftype, Mut: mut, Default: def, Attrs: attrs})
 	}
 	if p.cur.Kind == lexer.DEDENT {
 		p.advance()
 	}
-	return &ast.StructDecl{NodePos: pos, Name: name, Fields: fields}, nil
+	return &ast.StructDecl{NodePos: pos, Name: name, Fields: fields, Methods: methods}, nil
+}
+
+// parseTypeAlias parses `type Name = <type annotation>`. `type` is not a
+// reserved word (it stays usable as a field or variable name); it only
+// starts an alias at statement level when followed by a name.
+func (p *Parser) parseTypeAlias() (ast.Statement, error) {
+	pos := astPos(p.cur.Pos)
+	p.advance() // `type`
+	name := p.cur.Data
+	p.advance()
+	if _, err := p.expect(lexer.EQ); err != nil {
+		return nil, err
+	}
+	target := p.consumeTypeAnn(lexer.NEWLINE)
+	if target == "" {
+		return nil, errs.New("E1039", fmt.Sprintf("expected a type after `type %s =`", name), errPos(p.cur.Pos), "")
+	}
+	return &ast.TypeAliasDecl{NodePos: pos, Name: name, Target: target}, nil
+}
+
+// parseInterfaceDecl parses an interface: an indented list of method
+// signatures (`fn name(self, ...) -> ret`, no body). Each signature is an
+// FnDecl with a nil Body whose Receiver is the interface's name.
+func (p *Parser) parseInterfaceDecl() (ast.Statement, error) {
+	pos := astPos(p.cur.Pos)
+	p.advance()
+	if p.cur.Kind != lexer.NAME {
+		return nil, errs.New("E1037", "expected interface name", errPos(p.cur.Pos), "")
+	}
+	name := p.cur.Data
+	p.advance()
+	if _, err := p.expect(lexer.COLON); err != nil {
+		return nil, err
+	}
+	if p.cur.Kind == lexer.NEWLINE {
+		p.advance()
+	}
+	if _, err := p.expect(lexer.INDENT); err != nil {
+		return nil, err
+	}
+	var methods []*ast.FnDecl
+	for p.cur.Kind != lexer.DEDENT && p.cur.Kind != lexer.EOF {
+		for p.cur.Kind == lexer.NEWLINE {
+			p.advance()
+		}
+		if p.cur.Kind == lexer.DEDENT || p.cur.Kind == lexer.EOF {
+			break
+		}
+		if p.cur.Kind != lexer.FN {
+			return nil, errs.New("E1038", "expected `fn` method signature in interface", errPos(p.cur.Pos),
+				"interfaces only list methods, e.g. `fn to_row(self) -> list[str]`")
+		}
+		m, err := p.parseFnHeader(name)
+		if err != nil {
+			return nil, err
+		}
+		if p.cur.Kind == lexer.COLON {
+			return nil, errs.New("E1038",
+				fmt.Sprintf("interface method %s.%s cannot have a body", name, m.Name),
+				errPos(p.cur.Pos), "implement it in a struct instead")
+		}
+		methods = append(methods, m)
+	}
+	if p.cur.Kind == lexer.DEDENT {
+		p.advance()
+	}
+	return &ast.InterfaceDecl{NodePos: pos, Name: name, Methods: methods}, nil
 }
 func (p *Parser) parseMeta() (ast.Statement, error) {
 	pos := astPos(p.cur.Pos)
@@ -666,9 +975,11 @@ func (p *Parser) parseBlockFromIndentedStatements() (*ast.Block, error) {
 		if p.cur.Kind == lexer.DEDENT || p.cur.Kind == lexer.EOF {
 			break
 		}
+		start := p.cur
 		s, err := p.parseStatement()
 		if err != nil {
-			return nil, err
+			p.recoverStatement(err, start)
+			continue
 		}
 		if s != nil {
 			block.Statements = append(block.Statements, s)
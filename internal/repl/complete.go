@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"github.com/jiejie-dev/funny/v2/internal/ast"
+	"github.com/jiejie-dev/funny/v2/internal/errs"
 	"github.com/jiejie-dev/funny/v2/internal/lexer"
 	"github.com/jiejie-dev/funny/v2/internal/parser"
 	"github.com/jiejie-dev/funny/v2/internal/types"
@@ -38,8 +39,12 @@ func InputStatus(src string) (complete bool, err error) {
 	return true, nil
 }
 
+// isIncompleteError reports whether err looks like input that simply hasn't
+// been finished yet. Only the last syntax error is considered: that is the
+// one at the end of the cell, where unfinished input would stop.
 func isIncompleteError(err error) bool {
-	s := err.Error()
+	all := errs.All(err)
+	s := all[len(all)-1].Error()
 	return strings.Contains(s, "INDENT") ||
 		strings.Contains(s, "DEDENT") ||
 		strings.Contains(s, "expected `)`") ||
@@ -48,8 +53,8 @@ func isIncompleteError(err error) bool {
 }
 
 var replKeywords = []string{
-	"let", "if", "elif", "else", "for", "while", "match", "fn", "struct",
-	"return", "break", "continue", "import", "pub", "plan", "step", "meta",
+	"let", "const", "if", "elif", "else", "for", "while", "match", "fn", "struct",
+	"return", "break", "continue", "defer", "import", "pub", "plan", "step", "meta",
 	"guard", "parallel", "branch", "delay", "not", "in", "true", "false", "nil",
 }
 
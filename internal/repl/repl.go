@@ -136,6 +136,12 @@ func formatBinding(v any) string {
 		return fmt.Sprintf("fn %s(...)", x.Name)
 	case *ast.StructDecl:
 		return fmt.Sprintf("struct %s", x.Name)
+	case *ast.InterfaceDecl:
+		return fmt.Sprintf("interface %s", x.Name)
+	case *ast.TypeAliasDecl:
+		return fmt.Sprintf("type %s = %s", x.Name, x.Target)
+	case *ast.ConstDecl:
+		return fmt.Sprintf("const %s = %s", x.Name, x.Value)
 	default:
 		return FormatValue(v)
 	}
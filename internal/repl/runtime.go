@@ -65,6 +65,12 @@ func declBindings(stmts []ast.Statement) map[string]any {
 			out[n.Name] = n
 		case *ast.StructDecl:
 			out[n.Name] = n
+		case *ast.InterfaceDecl:
+			out[n.Name] = n
+		case *ast.TypeAliasDecl:
+			out[n.Name] = n
+		case *ast.ConstDecl:
+			out[n.Name] = n
 		}
 	}
 	return out
@@ -25,7 +25,7 @@ import (
 var Names = map[string]bool{
 	"print": true, "println": true, "len": true, "to_str": true, "to_int": true,
 	"to_float": true, "type_of": true, "ok": true, "err": true,
-	"to_json": true, "parse_json": true, "now": true, "time_format": true,
+	"to_json": true, "parse_json": true, "decode_json": true, "encode_json": true, "now": true, "time_format": true,
 	"sqrt": true, "pow": true, "abs": true,
 	"str_upper": true, "str_lower": true, "str_contains": true, "str_split": true,
 	"regex_match": true, "regex_replace": true,
@@ -33,6 +33,7 @@ var Names = map[string]bool{
 	"md5": true, "sha256": true, "b64_encode": true, "b64_decode": true,
 	"jwt_encode": true, "jwt_decode": true, "sql_open": true, "append": true,
 	"assert": true, "assert_eq": true,
+	"to_set": true, "set_union": true, "set_intersection": true, "set_difference": true,
 }
 
 // SideEffectOnly reports builtins that produce no meaningful return value.
@@ -69,6 +70,10 @@ func Call(name string, args []any) (any, error) {
 			return len(val), nil
 		case []any:
 			return len(val), nil
+		case *Map:
+			return val.Len(), nil
+		case *Set:
+			return val.Len(), nil
 		default:
 			return reflect.ValueOf(val).Len(), nil
 		}
@@ -146,11 +151,38 @@ func Call(name string, args []any) (any, error) {
 			return "str", nil
 		case []any:
 			return "list", nil
-		case map[string]any:
+		case map[string]any, *Map, *Struct:
 			return "map", nil
+		case *Set:
+			return "set", nil
 		default:
 			return "unknown", nil
 		}
+	case "to_set":
+		if len(args) != 1 {
+			return nil, fmt.Errorf("to_set() takes exactly 1 argument")
+		}
+		lst, ok := args[0].([]any)
+		if !ok {
+			return nil, fmt.Errorf("to_set() argument must be a list")
+		}
+		return SetOf(lst...)
+	case "set_union", "set_intersection", "set_difference":
+		if len(args) != 2 {
+			return nil, fmt.Errorf("%s() takes exactly 2 arguments", name)
+		}
+		a, okA := args[0].(*Set)
+		b, okB := args[1].(*Set)
+		if !okA || !okB {
+			return nil, fmt.Errorf("%s() arguments must be sets", name)
+		}
+		switch name {
+		case "set_union":
+			return a.Union(b), nil
+		case "set_intersection":
+			return a.Intersection(b), nil
+		}
+		return a.Difference(b), nil
 	case "ok":
 		if len(args) != 1 {
 			return nil, fmt.Errorf("ok() takes exactly 1 argument")
@@ -183,6 +215,22 @@ func Call(name string, args []any) (any, error) {
 			return nil, fmt.Errorf("parse_json: invalid JSON: %v", err)
 		}
 		return v, nil
+	case "decode_json", "encode_json":
+		// The compiler and evaluator pass the schema (see Schema.Encode)
+		// ahead of the script's own argument: decode_json(User, s) runs
+		// as decode_json(<schema of User>, s).
+		if name == "decode_json" {
+			return DecodeJSON(args, nil)
+		}
+		schema, err := schemaArg(name, args)
+		if err != nil {
+			return nil, err
+		}
+		s, err := encodeJSON(schema, args[1])
+		if err != nil {
+			return nil, fmt.Errorf("encode_json: %v", err)
+		}
+		return s, nil
 	case "now":
 		return int(time.Now().Unix()), nil
 	case "time_format":
@@ -380,8 +428,8 @@ func Call(name string, args []any) (any, error) {
 		if len(args) != 2 {
 			return nil, fmt.Errorf("assert_eq() takes exactly 2 arguments")
 		}
-		if !valuesEqual(args[0], args[1]) {
-			return nil, fmt.Errorf("assert_eq failed: %v != %v", args[0], args[1])
+		if !Equal(args[0], args[1]) {
+			return nil, fmt.Errorf("assert_eq failed: %s != %s", Literal(args[0]), Literal(args[1]))
 		}
 		return nil, nil
 	default:
@@ -398,13 +446,3 @@ func toFloat(val any) float64 {
 	}
 	panic(fmt.Sprintf("stdlib: expected number, got %T", val))
 }
-
-func valuesEqual(a, b any) bool {
-	if a == b {
-		return true
-	}
-	if fmt.Sprintf("%v", a) == fmt.Sprintf("%v", b) {
-		return true
-	}
-	return false
-}
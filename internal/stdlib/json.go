@@ -1,6 +1,16 @@
 package stdlib
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/jiejie-dev/funny/v2/internal/typederror"
+)
 
 // ConvertJSON converts a generic Go value (from json.Unmarshal) into funny
 // runtime values using []any and map[string]any.
@@ -31,30 +41,70 @@ func ConvertJSON(x any) any {
 	}
 }
 
-func toGoForJSON(val any) any {
+// toGoForJSON converts a runtime value to one encoding/json can marshal.
+// A map's int keys become decimal strings, as encoding/json writes a Go
+// map[int]V; any other non-str key has no JSON form.
+func toGoForJSON(val any) (any, error) {
 	switch v := val.(type) {
 	case nil:
-		return nil
+		return nil, nil
 	case bool, int, float64, string:
-		return v
+		return v, nil
 	case []any:
 		out := make([]any, len(v))
 		for i, e := range v {
-			out[i] = toGoForJSON(e)
+			x, err := toGoForJSON(e)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = x
 		}
-		return out
+		return out, nil
 	case map[string]any:
 		out := make(map[string]any, len(v))
 		for k, e := range v {
-			out[k] = toGoForJSON(e)
+			x, err := toGoForJSON(e)
+			if err != nil {
+				return nil, err
+			}
+			out[k] = x
 		}
-		return out
+		return out, nil
+	case *Struct:
+		return toGoForJSON(v.Map())
+	case *Map:
+		out := make(map[string]any, v.Len())
+		for _, e := range v.Entries() {
+			var k string
+			switch key := e.Key.(type) {
+			case string:
+				k = key
+			case int:
+				k = strconv.Itoa(key)
+			default:
+				return nil, fmt.Errorf("map key %s has no JSON form: JSON object keys are strings", Literal(e.Key))
+			}
+			x, err := toGoForJSON(e.Value)
+			if err != nil {
+				return nil, err
+			}
+			out[k] = x
+		}
+		return out, nil
+	case *Set:
+		// A set has no JSON form of its own; it is written as a list in
+		// Sorted order, so equal sets always encode the same way.
+		return toGoForJSON(v.Sorted())
 	}
-	return val
+	return val, nil
 }
 
 func marshalJSON(val any) (string, error) {
-	canonical, err := json.Marshal(toGoForJSON(val))
+	goVal, err := toGoForJSON(val)
+	if err != nil {
+		return "", err
+	}
+	canonical, err := json.Marshal(goVal)
 	if err != nil {
 		return "", err
 	}
@@ -68,3 +118,323 @@ func parseJSON(s string) (any, error) {
 	}
 	return ConvertJSON(x), nil
 }
+
+// StructHooks finish the structs decode_json builds the way a struct
+// literal is finished: Default evaluates the declared default of a field
+// the document omits, and Validate runs a struct's validate method and
+// returns its Result. The VM and the evaluator each supply their own;
+// an error from either aborts the run rather than failing the decode.
+type StructHooks interface {
+	Default(structName, field string) (any, error)
+	Validate(structName string, value any) (any, error)
+}
+
+// hookError marks an error raised by a StructHooks call, which decodeJSON
+// passes on instead of reporting as an err Result.
+type hookError struct{ err error }
+
+func (e hookError) Error() string { return e.err.Error() }
+func (e hookError) Unwrap() error { return e.err }
+
+// DecodeJSON runs decode_json(schema, s) with hooks filling in omitted
+// defaulted fields and validating each struct. Call runs it without
+// hooks, so there a defaulted field is required like any other.
+func DecodeJSON(args []any, hooks StructHooks) (any, error) {
+	schema, err := schemaArg("decode_json", args)
+	if err != nil {
+		return nil, err
+	}
+	s, ok := args[1].(string)
+	if !ok {
+		return nil, fmt.Errorf("decode_json() requires a string argument")
+	}
+	return decodeJSON(schema, s, hooks)
+}
+
+// decodeJSON parses s and checks it against schema's root struct. It
+// returns ok(value), with every struct tagged with its __type, or
+// err("<path>: <problem>") naming where the document first differs, e.g.
+// `$.items[2].price: expected float, got string`. A struct whose validate
+// method returns err(e) fails the decode with `<path>: <e>`.
+func decodeJSON(schema *Schema, s string, hooks StructHooks) (map[string]any, error) {
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	var x any
+	if err := dec.Decode(&x); err != nil {
+		return MakeResult("err", fmt.Sprintf("invalid JSON: %v", err)), nil
+	}
+	if dec.More() {
+		return MakeResult("err", "invalid JSON: trailing data after the document"), nil
+	}
+	v, err := schema.decode(schema.Root, x, "$", hooks)
+	if err != nil {
+		var herr hookError
+		if errors.As(err, &herr) {
+			return nil, herr.err
+		}
+		return MakeResult("err", err.Error()), nil
+	}
+	return MakeResult("ok", v), nil
+}
+
+func (s *Schema) decode(t *SchemaType, x any, path string, hooks StructHooks) (any, error) {
+	if t.Kind == "optional" {
+		if x == nil {
+			return nil, nil
+		}
+		return s.decode(t.Elem, x, path, hooks)
+	}
+	mismatch := func() error {
+		return fmt.Errorf("%s: expected %s, got %s", path, t, jsonKind(x))
+	}
+	switch t.Kind {
+	case "any":
+		return plainJSON(x), nil
+	case "str":
+		if v, ok := x.(string); ok {
+			return v, nil
+		}
+	case "bool":
+		if v, ok := x.(bool); ok {
+			return v, nil
+		}
+	case "int":
+		if n, ok := x.(json.Number); ok {
+			if v, err := strconv.Atoi(n.String()); err == nil {
+				return v, nil
+			}
+			return nil, fmt.Errorf("%s: expected int, got %s", path, n)
+		}
+	case "float":
+		if n, ok := x.(json.Number); ok {
+			v, err := n.Float64()
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", path, err)
+			}
+			return v, nil
+		}
+	case "list":
+		if elems, ok := x.([]any); ok {
+			out := make([]any, len(elems))
+			for i, e := range elems {
+				v, err := s.decode(t.Elem, e, fmt.Sprintf("%s[%d]", path, i), hooks)
+				if err != nil {
+					return nil, err
+				}
+				out[i] = v
+			}
+			return out, nil
+		}
+	case "set":
+		// A set is written as a list (see toGoForJSON); repeated
+		// elements collapse into one.
+		if elems, ok := x.([]any); ok {
+			out := NewSet(len(elems))
+			for i, e := range elems {
+				v, err := s.decode(t.Elem, e, fmt.Sprintf("%s[%d]", path, i), hooks)
+				if err != nil {
+					return nil, err
+				}
+				if err := out.Add(v); err != nil {
+					return nil, fmt.Errorf("%s[%d]: %v", path, i, err)
+				}
+			}
+			return out, nil
+		}
+	case "map":
+		if obj, ok := x.(map[string]any); ok {
+			out := NewMap(len(obj))
+			for _, k := range sortedKeys(obj) {
+				v, err := s.decode(t.Elem, obj[k], jsonPath(path, k), hooks)
+				if err != nil {
+					return nil, err
+				}
+				out.Set(k, v)
+			}
+			return out, nil
+		}
+	case "struct":
+		if obj, ok := x.(map[string]any); ok {
+			return s.decodeStruct(t.Name, obj, path, hooks)
+		}
+	}
+	return nil, mismatch()
+}
+
+// decodeStruct decodes obj as struct name. Every key must be one of its
+// fields' and every field must be present, unless its type is optional or,
+// given hooks, it has a default. With hooks, the struct is then validated
+// as a literal would be.
+func (s *Schema) decodeStruct(name string, obj map[string]any, path string, hooks StructHooks) (any, error) {
+	fields := map[string]any{}
+	known := map[string]bool{}
+	for _, f := range s.Structs[name] {
+		known[f.Key] = true
+		x, present := obj[f.Key]
+		if !present {
+			if f.Default && hooks != nil {
+				v, err := hooks.Default(name, f.Name)
+				if err != nil {
+					return nil, hookError{err}
+				}
+				fields[f.Name] = v
+				continue
+			}
+			if f.Type.Kind == "optional" {
+				fields[f.Name] = nil
+				continue
+			}
+			return nil, fmt.Errorf("%s: missing field %q of %s", path, f.Key, name)
+		}
+		v, err := s.decode(f.Type, x, jsonPath(path, f.Key), hooks)
+		if err != nil {
+			return nil, err
+		}
+		fields[f.Name] = v
+	}
+	for _, k := range sortedKeys(obj) {
+		if !known[k] {
+			return nil, fmt.Errorf("%s: unknown field %q for %s", jsonPath(path, k), k, name)
+		}
+	}
+	v := typederror.TagStruct(name, fields)
+	if hooks == nil || !s.Validated[name] {
+		return v, nil
+	}
+	res, err := hooks.Validate(name, v)
+	if err != nil {
+		return nil, hookError{err}
+	}
+	if m, ok := res.(map[string]any); ok && m["tag"] == "err" {
+		return nil, fmt.Errorf("%s: %v", path, m["val"])
+	}
+	return v, nil
+}
+
+// String names t the way the type checker does: `list[int]`, `User?`.
+func (t *SchemaType) String() string {
+	switch t.Kind {
+	case "list":
+		return "list[" + t.Elem.String() + "]"
+	case "set":
+		return "set[" + t.Elem.String() + "]"
+	case "map":
+		return "map[str, " + t.Elem.String() + "]"
+	case "optional":
+		return t.Elem.String() + "?"
+	case "struct":
+		return t.Name
+	}
+	return t.Kind
+}
+
+// jsonKind names the JSON type of a decoded value, for error messages.
+func jsonKind(x any) string {
+	switch x.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "bool"
+	case json.Number:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	}
+	return "object"
+}
+
+// jsonPath appends an object key to path: `.key` for plain names and
+// `["key"]` for anything else.
+func jsonPath(path, key string) string {
+	plain := key != ""
+	for i, c := range key {
+		if !(c == '_' || unicode.IsLetter(c) || (i > 0 && unicode.IsDigit(c))) {
+			plain = false
+			break
+		}
+	}
+	if plain {
+		return path + "." + key
+	}
+	return fmt.Sprintf("%s[%q]", path, key)
+}
+
+// plainJSON converts a document decoded with UseNumber to the values
+// parse_json produces, whose numbers are all floats.
+func plainJSON(x any) any {
+	switch v := x.(type) {
+	case json.Number:
+		f, _ := v.Float64()
+		return f
+	case []any:
+		out := make([]any, len(v))
+		for i, e := range v {
+			out[i] = plainJSON(e)
+		}
+		return out
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, e := range v {
+			out[k] = plainJSON(e)
+		}
+		return out
+	}
+	return x
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// encodeJSON serializes val like to_json, except that struct values are
+// written with the keys their `@json` attributes give and without their
+// __type tag.
+func encodeJSON(schema *Schema, val any) (string, error) {
+	return marshalJSON(schema.rename(val))
+}
+
+func (s *Schema) rename(val any) any {
+	switch v := val.(type) {
+	case []any:
+		out := make([]any, len(v))
+		for i, e := range v {
+			out[i] = s.rename(e)
+		}
+		return out
+	case map[string]any:
+		if fields, ok := s.Structs[typederror.TypeOf(v)]; ok {
+			out := make(map[string]any, len(fields))
+			for _, f := range fields {
+				if fv, present := v[f.Name]; present {
+					out[f.Key] = s.rename(fv)
+				}
+			}
+			return out
+		}
+		out := make(map[string]any, len(v))
+		for k, e := range v {
+			out[k] = s.rename(e)
+		}
+		return out
+	case *Struct:
+		return s.rename(v.Map())
+	case *Map:
+		out := NewMap(v.Len())
+		for _, e := range v.Entries() {
+			out.Set(e.Key, s.rename(e.Value))
+		}
+		return out
+	case *Set:
+		// Renamed struct elements lose their __type and can't be hashed
+		// again, so the set becomes the list it is written as.
+		return s.rename(v.Sorted())
+	}
+	return val
+}
@@ -0,0 +1,149 @@
+package stdlib
+
+import (
+	"testing"
+
+	"github.com/jiejie-dev/funny/v2/internal/ast"
+	"github.com/jiejie-dev/funny/v2/internal/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// jsonDecls parses struct and alias declarations for schema tests.
+func jsonDecls(t *testing.T, src string) TypeDecls {
+	t.Helper()
+	prog, err := parser.New(src, "").Parse()
+	require.NoError(t, err)
+	decls := TypeDecls{Structs: map[string]*ast.StructDecl{}, Aliases: map[string]string{}}
+	for _, s := range prog.Stmts {
+		switch d := s.(type) {
+		case *ast.StructDecl:
+			decls.Structs[d.Name] = d
+		case *ast.TypeAliasDecl:
+			decls.Aliases[d.Name] = d.Target
+		}
+	}
+	return decls
+}
+
+const jsonNodeSrc = `type Label = str
+struct Node:
+    @json("node-id")
+    id: int
+    label: Label
+    weight: float
+    info: map[str, any]
+    parent: Node?
+    children: list[Node]
+`
+
+func decodeNode(t *testing.T, doc string) map[string]any {
+	t.Helper()
+	schema, err := DecodeSchema("Node", jsonDecls(t, jsonNodeSrc))
+	require.NoError(t, err)
+	v, err := Call("decode_json", []any{schema.Encode(), doc})
+	require.NoError(t, err)
+	return v.(map[string]any)
+}
+
+func TestDecodeJSON_BuildsTaggedStructs(t *testing.T) {
+	r := decodeNode(t, `{"node-id": 1, "label": "root", "weight": 2, "info": {"k": [1]},
+		"children": [{"node-id": 2, "label": "leaf", "weight": 0.5, "info": {}, "parent": null, "children": []}]}`)
+	require.Equal(t, "ok", r["tag"], r["val"])
+	root := r["val"].(map[string]any)
+	assert.Equal(t, "Node", root["__type"])
+	assert.Equal(t, 1, root["id"])
+	assert.Equal(t, 2.0, root["weight"])
+	info, err := MapOf("k", []any{1.0})
+	require.NoError(t, err)
+	assert.Equal(t, info, root["info"])
+	assert.Nil(t, root["parent"])
+	leaf := root["children"].([]any)[0].(map[string]any)
+	assert.Equal(t, "Node", leaf["__type"])
+	assert.Equal(t, "leaf", leaf["label"])
+}
+
+func TestDecodeJSON_ErrorsNameThePath(t *testing.T) {
+	cases := map[string]string{
+		`{"node-id": 1.5, "label": "a", "weight": 1, "info": {}, "children": []}`:               `$["node-id"]: expected int, got 1.5`,
+		`{"node-id": 1, "label": "a", "weight": 1, "info": {}, "children": [{"node-id": "x"}]}`: `$.children[0]["node-id"]: expected int, got string`,
+		`{"node-id": 1, "label": "a", "weight": 1, "info": {}}`:                                 `$: missing field "children" of Node`,
+		`{"node-id": 1, "label": "a", "weight": 1, "info": {}, "children": [], "id": 1}`:        `$.id: unknown field "id" for Node`,
+		`{"node-id": 1, "label": null, "weight": 1, "info": {}, "children": []}`:                "$.label: expected str, got null",
+		`[1]`:            "$: expected Node, got array",
+		`{"node-id": 1,`: "invalid JSON",
+	}
+	for doc, want := range cases {
+		r := decodeNode(t, doc)
+		require.Equal(t, "err", r["tag"], doc)
+		assert.Contains(t, r["val"], want, doc)
+	}
+}
+
+// fakeHooks stands in for a backend's StructHooks: defaults come from a
+// table and validate rejects a negative n.
+type fakeHooks map[string]any
+
+func (h fakeHooks) Default(structName, field string) (any, error) {
+	return h[structName+"."+field], nil
+}
+
+func (h fakeHooks) Validate(structName string, value any) (any, error) {
+	if value.(map[string]any)["n"].(int) < 0 {
+		return MakeResult("err", "n is negative"), nil
+	}
+	return MakeResult("ok", value), nil
+}
+
+func TestDecodeJSON_HooksFillDefaultsAndValidate(t *testing.T) {
+	schema, err := DecodeSchema("Box", jsonDecls(t, `struct P:
+    n: int
+    s: str = "d"
+    fn validate(self) -> Result:
+        return ok(self)
+struct Box:
+    items: list[P]
+`))
+	require.NoError(t, err)
+	hooks := fakeHooks{"P.s": "d"}
+	v, err := DecodeJSON([]any{schema.Encode(), `{"items": [{"n": 1}, {"n": 2, "s": "x"}]}`}, hooks)
+	require.NoError(t, err)
+	r := v.(map[string]any)
+	require.Equal(t, "ok", r["tag"], r["val"])
+	items := r["val"].(map[string]any)["items"].([]any)
+	assert.Equal(t, "d", items[0].(map[string]any)["s"])
+	assert.Equal(t, "x", items[1].(map[string]any)["s"])
+
+	v, err = DecodeJSON([]any{schema.Encode(), `{"items": [{"n": 1}, {"n": -1}]}`}, hooks)
+	require.NoError(t, err)
+	assert.Equal(t, MakeResult("err", "$.items[1]: n is negative"), v)
+
+	// Without hooks a defaulted field is as required as any other.
+	v, err = Call("decode_json", []any{schema.Encode(), `{"items": [{"n": 1}]}`})
+	require.NoError(t, err)
+	assert.Equal(t, MakeResult("err", `$.items[0]: missing field "s" of P`), v)
+}
+
+func TestDecodeJSON_MapKeysNeedingQuotesInPath(t *testing.T) {
+	schema, err := DecodeSchema("S", jsonDecls(t, "struct S:\n    m: map[str, int]\n"))
+	require.NoError(t, err)
+	v, err := Call("decode_json", []any{schema.Encode(), `{"m": {"a b": true}}`})
+	require.NoError(t, err)
+	assert.Equal(t, `$.m["a b"]: expected int, got bool`, v.(map[string]any)["val"])
+}
+
+func TestEncodeJSON_RenamesFieldsAndDropsType(t *testing.T) {
+	schema := EncodeSchema(jsonDecls(t, jsonNodeSrc))
+	leaf := map[string]any{"__type": "Node", "id": 2, "label": "leaf", "children": []any{}}
+	root := map[string]any{"__type": "Node", "id": 1, "label": "root", "children": []any{leaf}, "info": map[string]any{"id": 3}}
+	s, err := Call("encode_json", []any{schema.Encode(), root})
+	require.NoError(t, err)
+	assert.Equal(t, `{"children":[{"children":[],"label":"leaf","node-id":2}],"info":{"id":3},"label":"root","node-id":1}`, s)
+}
+
+func TestDecodeSchema_RejectsTypesWithoutJSONForm(t *testing.T) {
+	_, err := DecodeSchema("S", jsonDecls(t, "struct S:\n    m: map[int, str]\n"))
+	assert.ErrorContains(t, err, "JSON object keys are strings")
+	_, err = DecodeSchema("str", jsonDecls(t, ""))
+	assert.Error(t, err)
+}
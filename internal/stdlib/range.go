@@ -0,0 +1,65 @@
+package stdlib
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrZeroStep is the error of a range whose step is zero, which would
+// never make progress.
+var ErrZeroStep = errors.New("range step must not be zero")
+
+// RangeArgs converts the runtime values of `start..end step k` to ints. A
+// nil step (omitted) is 1; a zero step is ErrZeroStep.
+func RangeArgs(start, end, step any) (int, int, int, error) {
+	if step == nil {
+		step = 1
+	}
+	vals := [3]int{}
+	for i, v := range []any{start, end, step} {
+		n, ok := v.(int)
+		if !ok {
+			return 0, 0, 0, fmt.Errorf("range bounds must be int, got %T", v)
+		}
+		vals[i] = n
+	}
+	if vals[2] == 0 {
+		return 0, 0, 0, ErrZeroStep
+	}
+	return vals[0], vals[1], vals[2], nil
+}
+
+// InRange reports whether a counter at i is still inside the half-open
+// range towards end: below end for a positive step, above it for a
+// negative one. RangeArgs rejects a zero step, which would never make
+// progress.
+func InRange(i, end, step int) bool {
+	switch {
+	case step > 0:
+		return i < end
+	case step < 0:
+		return i > end
+	}
+	return false
+}
+
+// RangeLen is the number of values in `start..end step k`.
+func RangeLen(start, end, step int) int {
+	if !InRange(start, end, step) {
+		return 0
+	}
+	if step < 0 {
+		start, end, step = -start, -end, -step
+	}
+	return (end-start-1)/step + 1
+}
+
+// Range materializes `start..end step k` as a list, for ranges used as a
+// value rather than directly as a for-loop iterable.
+func Range(start, end, step int) []any {
+	out := make([]any, 0, RangeLen(start, end, step))
+	for i := start; InRange(i, end, step); i += step {
+		out = append(out, i)
+	}
+	return out
+}
@@ -0,0 +1,201 @@
+package stdlib
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/jiejie-dev/funny/v2/internal/ast"
+	"github.com/jiejie-dev/funny/v2/internal/types"
+)
+
+// Schema is the shape decode_json checks a JSON document against, and the
+// field-to-key mapping encode_json writes structs with. The compiler and
+// evaluator build it from the program's declarations and pass it to the
+// builtin as a JSON string (see Encode), so it sits in the constant pool
+// like any other string literal.
+type Schema struct {
+	Root      *SchemaType              `json:"root,omitempty"` // decode_json's target; nil for encode_json
+	Structs   map[string][]SchemaField `json:"structs"`
+	Validated map[string]bool          `json:"validated,omitempty"` // structs with a validate method
+}
+
+// SchemaType is one node of a schema: a primitive kind ("int", "float",
+// "str", "bool", "any"), "list", "set" or "map" of Elem, "optional" Elem, or a
+// "struct" looked up in Schema.Structs by Name.
+type SchemaType struct {
+	Kind string      `json:"kind"`
+	Elem *SchemaType `json:"elem,omitempty"`
+	Name string      `json:"name,omitempty"`
+}
+
+// SchemaField is a struct field and the JSON object key it is read from
+// and written to. Type is nil in encode_json's schema, which only renames.
+// Default marks a field with a declared default, which a document may
+// omit.
+type SchemaField struct {
+	Name    string      `json:"name"`
+	Key     string      `json:"key"`
+	Type    *SchemaType `json:"type,omitempty"`
+	Default bool        `json:"default,omitempty"`
+}
+
+// TypeDecls are the declarations a schema resolves type names against.
+type TypeDecls struct {
+	Structs map[string]*ast.StructDecl
+	Aliases map[string]string // alias name → target annotation
+}
+
+// DecodeSchema builds decode_json's schema for struct root: its fields and
+// those of every struct they reach.
+func DecodeSchema(root string, decls TypeDecls) (*Schema, error) {
+	s := &Schema{Structs: map[string][]SchemaField{}}
+	t, err := s.resolve(types.Primitive(root), decls, 0)
+	if err != nil {
+		return nil, err
+	}
+	if t.Kind != "struct" {
+		return nil, fmt.Errorf("decode_json: %s is not a struct", root)
+	}
+	s.Root = t
+	return s, nil
+}
+
+// EncodeSchema builds encode_json's schema: the JSON key of every field
+// of every struct.
+func EncodeSchema(decls TypeDecls) *Schema {
+	s := &Schema{Structs: map[string][]SchemaField{}}
+	for name, d := range decls.Structs {
+		fields := make([]SchemaField, len(d.Fields))
+		for i, f := range d.Fields {
+			fields[i] = SchemaField{Name: f.Name, Key: f.JSONKey()}
+		}
+		s.Structs[name] = fields
+	}
+	return s
+}
+
+// maxAliasDepth bounds alias-to-alias resolution, so a cyclic alias (which
+// the type checker rejects) can't recurse forever.
+const maxAliasDepth = 32
+
+// resolve converts a type annotation to a schema node, adding the fields
+// of any struct it names to s.
+func (s *Schema) resolve(t types.Type, decls TypeDecls, depth int) (*SchemaType, error) {
+	switch tt := t.(type) {
+	case types.List:
+		elem, err := s.resolve(tt.Elem, decls, depth)
+		if err != nil {
+			return nil, err
+		}
+		return &SchemaType{Kind: "list", Elem: elem}, nil
+	case types.Set:
+		elem, err := s.resolve(tt.Elem, decls, depth)
+		if err != nil {
+			return nil, err
+		}
+		return &SchemaType{Kind: "set", Elem: elem}, nil
+	case types.Map:
+		if key, ok := tt.Key.(types.Primitive); !ok || key != "str" {
+			return nil, fmt.Errorf("map key type %s: JSON object keys are strings", tt.Key)
+		}
+		elem, err := s.resolve(tt.Value, decls, depth)
+		if err != nil {
+			return nil, err
+		}
+		return &SchemaType{Kind: "map", Elem: elem}, nil
+	case types.Optional:
+		elem, err := s.resolve(tt.Inner, decls, depth)
+		if err != nil {
+			return nil, err
+		}
+		return &SchemaType{Kind: "optional", Elem: elem}, nil
+	case types.Primitive:
+		name := string(tt)
+		switch name {
+		case "int", "float", "str", "bool", "any":
+			return &SchemaType{Kind: name}, nil
+		}
+		if d, ok := decls.Structs[name]; ok {
+			if err := s.addStruct(d, decls); err != nil {
+				return nil, err
+			}
+			return &SchemaType{Kind: "struct", Name: name}, nil
+		}
+		if target, ok := decls.Aliases[name]; ok && depth < maxAliasDepth {
+			at, err := types.ParseType(target)
+			if err != nil {
+				return nil, err
+			}
+			return s.resolve(at, decls, depth+1)
+		}
+	}
+	return nil, fmt.Errorf("type %s has no JSON form", t)
+}
+
+// addStruct adds d's fields to s, once; a struct that refers to itself
+// resolves to the entry already being filled in.
+func (s *Schema) addStruct(d *ast.StructDecl, decls TypeDecls) error {
+	if _, done := s.Structs[d.Name]; done {
+		return nil
+	}
+	fields := make([]SchemaField, len(d.Fields))
+	s.Structs[d.Name] = fields
+	if d.Method("validate") != nil {
+		if s.Validated == nil {
+			s.Validated = map[string]bool{}
+		}
+		s.Validated[d.Name] = true
+	}
+	for i, f := range d.Fields {
+		ft, err := types.ParseType(f.TypeAnn)
+		if err != nil {
+			return fmt.Errorf("field %s.%s: %v", d.Name, f.Name, err)
+		}
+		st, err := s.resolve(ft, decls, 0)
+		if err != nil {
+			return fmt.Errorf("field %s.%s: %v", d.Name, f.Name, err)
+		}
+		fields[i] = SchemaField{Name: f.Name, Key: f.JSONKey(), Type: st, Default: f.Default != nil}
+	}
+	return nil
+}
+
+// Encode serializes s for passing to decode_json or encode_json.
+func (s *Schema) Encode() string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
+
+// schemaCache holds decoded schemas by their encoding: a decode_json call
+// site passes the same string every time it runs.
+var schemaCache sync.Map
+
+// schemaArg checks the arguments of decode_json or encode_json, a schema
+// and the script's own argument, and returns the parsed schema.
+func schemaArg(name string, args []any) (*Schema, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("%s() takes a schema and 1 argument", name)
+	}
+	src, ok := args[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("%s() requires a schema", name)
+	}
+	schema, err := parseSchema(src)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return schema, nil
+}
+
+func parseSchema(src string) (*Schema, error) {
+	if s, ok := schemaCache.Load(src); ok {
+		return s.(*Schema), nil
+	}
+	s := &Schema{}
+	if err := json.Unmarshal([]byte(src), s); err != nil {
+		return nil, fmt.Errorf("malformed schema: %v", err)
+	}
+	schemaCache.Store(src, s)
+	return s, nil
+}
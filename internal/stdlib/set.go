@@ -0,0 +1,160 @@
+package stdlib
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Set is the runtime value of a `set[T]`. Elements are ints, strs, bools
+// or structs, compared the way Equal compares them (and hashed the way Map
+// keys are), and iterate in the order they were first added.
+type Set struct {
+	index map[any]int // hash key (see hashKey) → position in elems
+	elems []any
+}
+
+// NewSet returns an empty set with room for n elements.
+func NewSet(n int) *Set {
+	return &Set{index: make(map[any]int, n), elems: make([]any, 0, n)}
+}
+
+// SetOf builds a set from elems, dropping duplicates.
+func SetOf(elems ...any) (*Set, error) {
+	s := NewSet(len(elems))
+	for _, e := range elems {
+		if err := s.Add(e); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Len returns the number of elements.
+func (s *Set) Len() int { return len(s.elems) }
+
+// Elems returns the elements in insertion order. The slice is the set's
+// own; callers must not modify it.
+func (s *Set) Elems() []any { return s.elems }
+
+// Has reports whether the set holds an element equal to v.
+func (s *Set) Has(v any) bool {
+	h, err := hashKey(v)
+	if err != nil {
+		return false
+	}
+	_, ok := s.index[h]
+	return ok
+}
+
+// Add adds v unless an equal element is already there. Elements that
+// aren't ints, strs, bools or structs are an error.
+func (s *Set) Add(v any) error {
+	h, err := hashKey(v)
+	if err != nil {
+		return fmt.Errorf("%s can't be a set element: elements are int, str, bool or a struct", typeName(v))
+	}
+	if _, ok := s.index[h]; ok {
+		return nil
+	}
+	s.index[h] = len(s.elems)
+	s.elems = append(s.elems, v)
+	return nil
+}
+
+// Union returns the elements of s followed by those of o that s lacks.
+func (s *Set) Union(o *Set) *Set {
+	out := NewSet(s.Len() + o.Len())
+	for _, e := range s.elems {
+		out.Add(e)
+	}
+	for _, e := range o.elems {
+		out.Add(e)
+	}
+	return out
+}
+
+// Intersection returns the elements of s that o also holds, in s's order.
+func (s *Set) Intersection(o *Set) *Set {
+	out := NewSet(0)
+	for _, e := range s.elems {
+		if o.Has(e) {
+			out.Add(e)
+		}
+	}
+	return out
+}
+
+// Difference returns the elements of s that o doesn't hold, in s's order.
+func (s *Set) Difference(o *Set) *Set {
+	out := NewSet(0)
+	for _, e := range s.elems {
+		if !o.Has(e) {
+			out.Add(e)
+		}
+	}
+	return out
+}
+
+// Sorted returns the elements in a fixed order that doesn't depend on how
+// the set was built: ints ascending, strs lexically, false before true,
+// and structs by their canonical encoding. JSON output uses it, so equal
+// sets encode identically.
+func (s *Set) Sorted() []any {
+	out := make([]any, len(s.elems))
+	copy(out, s.elems)
+	keys := make([]string, len(out))
+	for i, e := range out {
+		var b strings.Builder
+		writeKey(&b, e)
+		keys[i] = b.String()
+	}
+	sort.Sort(bySetOrder{out, keys})
+	return out
+}
+
+// String formats s like a set literal: `set{1, 2}`.
+func (s *Set) String() string {
+	var b strings.Builder
+	b.WriteString("set{")
+	for i, e := range s.elems {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(Literal(e))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// bySetOrder sorts elements for Set.Sorted, carrying each element's
+// encoding alongside it.
+type bySetOrder struct {
+	elems []any
+	keys  []string
+}
+
+func (o bySetOrder) Len() int { return len(o.elems) }
+
+func (o bySetOrder) Swap(i, j int) {
+	o.elems[i], o.elems[j] = o.elems[j], o.elems[i]
+	o.keys[i], o.keys[j] = o.keys[j], o.keys[i]
+}
+
+func (o bySetOrder) Less(i, j int) bool {
+	switch a := o.elems[i].(type) {
+	case int:
+		if b, ok := o.elems[j].(int); ok {
+			return a < b
+		}
+	case string:
+		if b, ok := o.elems[j].(string); ok {
+			return a < b
+		}
+	case bool:
+		if b, ok := o.elems[j].(bool); ok {
+			return !a && b
+		}
+	}
+	return o.keys[i] < o.keys[j]
+}
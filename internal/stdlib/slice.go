@@ -0,0 +1,59 @@
+package stdlib
+
+import "fmt"
+
+// Slice returns obj[lo:hi] for a list or a string (sliced by rune). A nil
+// bound is omitted: lo defaults to 0 and hi to the length. A negative
+// bound counts from the end, and bounds are then clamped to [0, len], so
+// slicing never fails on range - `xs[5:]` of a 3-element list is empty.
+// List slices are copies, so appending to or assigning into one never
+// affects the original.
+func Slice(obj, lo, hi any) (any, error) {
+	switch v := obj.(type) {
+	case []any:
+		start, end, err := sliceBounds(len(v), lo, hi)
+		if err != nil {
+			return nil, err
+		}
+		out := make([]any, end-start)
+		copy(out, v[start:end])
+		return out, nil
+	case string:
+		runes := []rune(v)
+		start, end, err := sliceBounds(len(runes), lo, hi)
+		if err != nil {
+			return nil, err
+		}
+		return string(runes[start:end]), nil
+	}
+	return nil, fmt.Errorf("cannot slice %T", obj)
+}
+
+func sliceBounds(n int, lo, hi any) (int, int, error) {
+	start, err := sliceBound(n, lo, 0)
+	if err != nil {
+		return 0, 0, err
+	}
+	end, err := sliceBound(n, hi, n)
+	if err != nil {
+		return 0, 0, err
+	}
+	if end < start {
+		end = start
+	}
+	return start, end, nil
+}
+
+func sliceBound(n int, b any, def int) (int, error) {
+	if b == nil {
+		return def, nil
+	}
+	i, ok := b.(int)
+	if !ok {
+		return 0, fmt.Errorf("slice bound must be int, got %T", b)
+	}
+	if i < 0 {
+		i += n
+	}
+	return min(max(i, 0), n), nil
+}
@@ -0,0 +1,46 @@
+package stdlib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSlice_BoundsDefaultNegativeAndClamp(t *testing.T) {
+	xs := []any{1, 2, 3, 4, 5}
+	cases := []struct {
+		lo, hi any
+		want   []any
+	}{
+		{1, 3, []any{2, 3}},
+		{nil, 2, []any{1, 2}},
+		{-2, nil, []any{4, 5}},
+		{nil, nil, xs},
+		{3, 1, []any{}},
+		{-10, 10, xs},
+		{7, nil, []any{}},
+	}
+	for _, tc := range cases {
+		got, err := Slice(xs, tc.lo, tc.hi)
+		require.NoError(t, err)
+		assert.Equal(t, tc.want, got, "[%v:%v]", tc.lo, tc.hi)
+	}
+}
+
+func TestSlice_StringsByRuneAndCopies(t *testing.T) {
+	got, err := Slice("héllo", 1, -1)
+	require.NoError(t, err)
+	assert.Equal(t, "éll", got)
+
+	xs := []any{1, 2, 3}
+	ys, err := Slice(xs, nil, nil)
+	require.NoError(t, err)
+	ys.([]any)[0] = 99
+	assert.Equal(t, 1, xs[0])
+
+	_, err = Slice(xs, "a", nil)
+	assert.Error(t, err)
+	_, err = Slice(3, nil, nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,83 @@
+package stdlib
+
+import (
+	"fmt"
+
+	"github.com/jiejie-dev/funny/v2/internal/typederror"
+)
+
+// StructType is the runtime layout of a struct type: its name and its
+// fields in declaration order. Every value of the type shares one.
+type StructType struct {
+	Name   string
+	Fields []string
+	index  map[string]int // field name → slot
+}
+
+// NewStructType returns the layout of struct name with the given fields.
+func NewStructType(name string, fields []string) *StructType {
+	index := make(map[string]int, len(fields))
+	for i, f := range fields {
+		index[f] = i
+	}
+	return &StructType{Name: name, Fields: fields, index: index}
+}
+
+// Slot returns the index of the field called name.
+func (t *StructType) Slot(name string) (int, bool) {
+	i, ok := t.index[name]
+	return i, ok
+}
+
+// Struct is the VM's runtime value of a struct: its type and one value per
+// field, in the type's field order. The compiler resolves most field
+// accesses to a slot, so reading a field doesn't hash its name.
+//
+// Everywhere a struct is observed from outside the VM it behaves like the
+// map the evaluator represents it with, field names to values plus the
+// type name under typederror.StructTypeField: Map returns that map, it
+// prints the same, and Equal, map keys and to_json treat the two forms
+// alike.
+type Struct struct {
+	Type   *StructType
+	Fields []any
+}
+
+// StructName returns the struct's type name, for typederror.TypeOf.
+func (s *Struct) StructName() string { return s.Type.Name }
+
+// Get returns the field called name. typederror.StructTypeField names the
+// type, as it does in the map form.
+func (s *Struct) Get(name string) (any, bool) {
+	if i, ok := s.Type.Slot(name); ok {
+		return s.Fields[i], true
+	}
+	if name == typederror.StructTypeField {
+		return s.Type.Name, true
+	}
+	return nil, false
+}
+
+// Set assigns the field called name, reporting whether the struct has it.
+func (s *Struct) Set(name string, value any) bool {
+	i, ok := s.Type.Slot(name)
+	if ok {
+		s.Fields[i] = value
+	}
+	return ok
+}
+
+// Map returns the struct's map form, tagged with its type name. Field
+// values are shared, not copied.
+func (s *Struct) Map() map[string]any {
+	out := make(map[string]any, len(s.Fields)+1)
+	for i, f := range s.Type.Fields {
+		out[f] = s.Fields[i]
+	}
+	return typederror.TagStruct(s.Type.Name, out)
+}
+
+// String formats the struct as its map form prints.
+func (s *Struct) String() string {
+	return fmt.Sprint(s.Map())
+}
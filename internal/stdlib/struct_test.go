@@ -0,0 +1,40 @@
+package stdlib
+
+import (
+	"testing"
+
+	"github.com/jiejie-dev/funny/v2/internal/typederror"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStruct_BehavesLikeItsMapForm(t *testing.T) {
+	pointType := NewStructType("Point", []string{"x", "y"})
+	p := &Struct{Type: pointType, Fields: []any{1, 2}}
+
+	assert.Equal(t, point(1, 2), p.Map())
+	assert.Equal(t, "Point", typederror.TypeOf(p))
+	assert.Equal(t, Literal(point(1, 2)), Literal(p))
+	x, ok := p.Get("x")
+	assert.True(t, ok)
+	assert.Equal(t, 1, x)
+	name, _ := p.Get(typederror.StructTypeField)
+	assert.Equal(t, "Point", name)
+	assert.False(t, p.Set("z", 3))
+
+	// Equal, and interchangeable as map keys, with each other and with the
+	// map form the evaluator and decode_json produce.
+	assert.True(t, Equal(p, &Struct{Type: pointType, Fields: []any{1, 2}}))
+	assert.True(t, Equal(p, point(1, 2)))
+	assert.True(t, Equal(point(1, 2), p))
+	assert.False(t, Equal(p, point(2, 1)))
+	m, err := MapOf(p, "found")
+	require.NoError(t, err)
+	got, ok := m.Get(point(1, 2))
+	assert.True(t, ok)
+	assert.Equal(t, "found", got)
+
+	out, err := marshalJSON([]any{p})
+	require.NoError(t, err)
+	assert.Equal(t, `[{"__type":"Point","x":1,"y":2}]`, out)
+}
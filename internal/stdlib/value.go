@@ -0,0 +1,331 @@
+package stdlib
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jiejie-dev/funny/v2/internal/typederror"
+)
+
+// Map is the runtime value of a `map[K, V]`. Keys are ints, strs, bools or
+// structs, compared the way Equal compares them, so the int key 1 and the
+// str key "1" are different entries. Entries keep their insertion order,
+// which is the order they print and iterate in.
+//
+// A struct key is hashed when its entry is stored: changing the struct's
+// fields afterwards doesn't move the entry.
+type Map struct {
+	index   map[any]int // hash key (see hashKey) → position in entries
+	entries []MapEntry
+}
+
+// MapEntry is one key/value pair of a Map.
+type MapEntry struct {
+	Key   any
+	Value any
+}
+
+// NewMap returns an empty map with room for n entries.
+func NewMap(n int) *Map {
+	return &Map{index: make(map[any]int, n), entries: make([]MapEntry, 0, n)}
+}
+
+// MapOf builds a map from alternating keys and values.
+func MapOf(kvs ...any) (*Map, error) {
+	m := NewMap(len(kvs) / 2)
+	for i := 0; i+1 < len(kvs); i += 2 {
+		if err := m.Set(kvs[i], kvs[i+1]); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// Len returns the number of entries.
+func (m *Map) Len() int { return len(m.entries) }
+
+// Entries returns the entries in insertion order. The slice is the map's
+// own; callers must not modify it.
+func (m *Map) Entries() []MapEntry { return m.entries }
+
+// Get returns the value stored under key.
+func (m *Map) Get(key any) (any, bool) {
+	h, err := hashKey(key)
+	if err != nil {
+		return nil, false
+	}
+	i, ok := m.index[h]
+	if !ok {
+		return nil, false
+	}
+	return m.entries[i].Value, true
+}
+
+// Set stores value under key, replacing any value already there. Keys
+// that aren't ints, strs, bools or structs are an error.
+func (m *Map) Set(key, value any) error {
+	h, err := hashKey(key)
+	if err != nil {
+		return err
+	}
+	if i, ok := m.index[h]; ok {
+		m.entries[i].Value = value
+		return nil
+	}
+	m.index[h] = len(m.entries)
+	m.entries = append(m.entries, MapEntry{Key: key, Value: value})
+	return nil
+}
+
+// String formats m like a map literal: `{"a": 1, 2: "b"}`.
+func (m *Map) String() string {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, e := range m.entries {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(Literal(e.Key))
+		b.WriteString(": ")
+		b.WriteString(Literal(e.Value))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// Literal formats a value for messages that show keys and values: strs
+// quoted, anything else as print shows it.
+func Literal(v any) string {
+	if s, ok := v.(string); ok {
+		return strconv.Quote(s)
+	}
+	if v == nil {
+		return "nil"
+	}
+	return fmt.Sprint(v)
+}
+
+// structKey is the hash key of a struct map key: its canonical encoding
+// (see writeKey), typed so it can't collide with a str key.
+type structKey string
+
+// hashKey returns the Go map key that stands for a runtime map key: ints,
+// strs and bools stand for themselves, and a struct for its encoding.
+func hashKey(k any) (any, error) {
+	switch v := k.(type) {
+	case int, string, bool:
+		return v, nil
+	case map[string]any:
+		if typederror.TypeOf(v) != "" {
+			var b strings.Builder
+			if err := writeKey(&b, v); err != nil {
+				return nil, err
+			}
+			return structKey(b.String()), nil
+		}
+	case *Struct:
+		return hashKey(v.Map())
+	}
+	return nil, fmt.Errorf("%s can't be a map key: keys are int, str, bool or a struct", typeName(k))
+}
+
+// writeKey writes the canonical encoding of v, which is the same for two
+// values exactly when Equal says they are equal. Each value starts with a
+// letter for its kind, so 1 and "1" encode differently.
+func writeKey(b *strings.Builder, v any) error {
+	switch x := v.(type) {
+	case nil:
+		b.WriteString("n;")
+	case bool:
+		fmt.Fprintf(b, "b%t;", x)
+	case int:
+		fmt.Fprintf(b, "i%d;", x)
+	case float64:
+		if x == 0 {
+			x = 0 // -0 and 0 are equal
+		}
+		fmt.Fprintf(b, "f%s;", strconv.FormatFloat(x, 'g', -1, 64))
+	case string:
+		fmt.Fprintf(b, "s%d:%s", len(x), x)
+	case []any:
+		fmt.Fprintf(b, "l%d[", len(x))
+		for _, e := range x {
+			if err := writeKey(b, e); err != nil {
+				return err
+			}
+		}
+		b.WriteByte(']')
+	case map[string]any:
+		keys := sortedKeys(x)
+		fmt.Fprintf(b, "r%d{", len(keys))
+		for _, k := range keys {
+			fmt.Fprintf(b, "%d:%s", len(k), k)
+			if err := writeKey(b, x[k]); err != nil {
+				return err
+			}
+		}
+		b.WriteByte('}')
+	case *Struct:
+		return writeKey(b, x.Map())
+	case *Map:
+		parts := make([]string, len(x.entries))
+		for i, e := range x.entries {
+			var eb strings.Builder
+			if err := writeKey(&eb, e.Key); err != nil {
+				return err
+			}
+			if err := writeKey(&eb, e.Value); err != nil {
+				return err
+			}
+			parts[i] = eb.String()
+		}
+		sort.Strings(parts)
+		fmt.Fprintf(b, "m%d{%s}", len(parts), strings.Join(parts, ""))
+	case *Set:
+		parts := make([]string, len(x.elems))
+		for i, e := range x.elems {
+			var eb strings.Builder
+			if err := writeKey(&eb, e); err != nil {
+				return err
+			}
+			parts[i] = eb.String()
+		}
+		sort.Strings(parts)
+		fmt.Fprintf(b, "t%d{%s}", len(parts), strings.Join(parts, ""))
+	default:
+		return fmt.Errorf("%s can't be part of a map key", typeName(v))
+	}
+	return nil
+}
+
+// Equal reports whether two runtime values are equal. It is the one
+// definition of `==` shared by the VM's EQ_* opcodes, IN_LIST, `match`
+// value patterns and assert_eq, in both execution paths:
+//
+//   - values of different types are never equal: 1 != "1" and 1 != 1.0;
+//   - lists are equal when their elements are, pairwise;
+//   - maps are equal when they hold equal values under the same keys,
+//     whatever order the keys were added in;
+//   - sets are equal when they hold the same elements, in any order;
+//   - structs and Results are equal when they are the same type (or tag)
+//     and their fields are equal.
+//
+// Values with no structural form (functions, host values) are equal only
+// to themselves.
+func Equal(a, b any) bool {
+	switch x := a.(type) {
+	case nil:
+		return b == nil
+	case int:
+		y, ok := b.(int)
+		return ok && x == y
+	case float64:
+		y, ok := b.(float64)
+		return ok && x == y
+	case string:
+		y, ok := b.(string)
+		return ok && x == y
+	case bool:
+		y, ok := b.(bool)
+		return ok && x == y
+	case []any:
+		y, ok := b.([]any)
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !Equal(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]any:
+		y, ok := b.(map[string]any)
+		if s, isStruct := b.(*Struct); isStruct {
+			y, ok = s.Map(), true
+		}
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for k, xv := range x {
+			yv, ok := y[k]
+			if !ok || !Equal(xv, yv) {
+				return false
+			}
+		}
+		return true
+	case *Struct:
+		if y, ok := b.(*Struct); ok && x.Type == y.Type {
+			for i := range x.Fields {
+				if !Equal(x.Fields[i], y.Fields[i]) {
+					return false
+				}
+			}
+			return true
+		}
+		return Equal(x.Map(), b)
+	case *Map:
+		y, ok := b.(*Map)
+		if !ok || x.Len() != y.Len() {
+			return false
+		}
+		for _, e := range x.entries {
+			yv, ok := y.Get(e.Key)
+			if !ok || !Equal(e.Value, yv) {
+				return false
+			}
+		}
+		return true
+	case *Set:
+		y, ok := b.(*Set)
+		if !ok || x.Len() != y.Len() {
+			return false
+		}
+		for _, e := range x.elems {
+			if !y.Has(e) {
+				return false
+			}
+		}
+		return true
+	}
+	return sameHostValue(a, b)
+}
+
+// sameHostValue compares values Equal has no structural rule for, which
+// may be of types Go can't compare with == (a func, say).
+func sameHostValue(a, b any) (eq bool) {
+	defer func() {
+		if recover() != nil {
+			eq = false
+		}
+	}()
+	return a == b
+}
+
+// typeName names a runtime value's type the way type_of does.
+func typeName(v any) string {
+	switch v.(type) {
+	case nil:
+		return "nil"
+	case bool:
+		return "bool"
+	case int:
+		return "int"
+	case float64:
+		return "float"
+	case string:
+		return "str"
+	case []any:
+		return "list"
+	case *Set:
+		return "set"
+	case map[string]any, *Map, *Struct:
+		if t := typederror.TypeOf(v); t != "" {
+			return t
+		}
+		return "map"
+	}
+	return "unknown"
+}
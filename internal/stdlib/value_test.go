@@ -0,0 +1,114 @@
+package stdlib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func point(x, y int) map[string]any {
+	return map[string]any{"__type": "Point", "x": x, "y": y}
+}
+
+func TestMap_KeysKeepTheirType(t *testing.T) {
+	m, err := MapOf(1, "int", "1", "str", true, "bool", point(1, 2), "struct")
+	require.NoError(t, err)
+	assert.Equal(t, 4, m.Len())
+	for key, want := range map[any]string{1: "int", "1": "str", true: "bool"} {
+		got, ok := m.Get(key)
+		require.True(t, ok, key)
+		assert.Equal(t, want, got)
+	}
+	got, ok := m.Get(point(1, 2)) // an equal struct, not the same one
+	require.True(t, ok)
+	assert.Equal(t, "struct", got)
+	_, ok = m.Get(point(2, 1))
+	assert.False(t, ok)
+
+	require.NoError(t, m.Set(1, "again"))
+	assert.Equal(t, 4, m.Len())
+	small, _ := MapOf(1, "a", "1", nil)
+	assert.Equal(t, `{1: "a", "1": nil}`, small.String())
+
+	assert.Error(t, m.Set(1.5, "x"))
+	assert.Error(t, m.Set([]any{1}, "x"))
+}
+
+func TestEqual(t *testing.T) {
+	m1, _ := MapOf("a", 1, "b", []any{2})
+	m2, _ := MapOf("b", []any{2}, "a", 1)
+	m3, _ := MapOf("a", 1, "b", []any{3})
+	equal := [][2]any{
+		{nil, nil},
+		{1, 1},
+		{"a", "a"},
+		{[]any{1, "x", []any{true}}, []any{1, "x", []any{true}}},
+		{m1, m2},
+		{point(1, 2), point(1, 2)},
+		{MakeResult("ok", []any{1}), MakeResult("ok", []any{1})},
+	}
+	for _, c := range equal {
+		assert.True(t, Equal(c[0], c[1]), "%v == %v", c[0], c[1])
+	}
+	unequal := [][2]any{
+		{1, "1"},
+		{1, 1.0},
+		{nil, 0},
+		{[]any{1}, []any{1, 1}},
+		{m1, m3},
+		{point(1, 2), map[string]any{"__type": "Size", "x": 1, "y": 2}},
+		{MakeResult("ok", 1), MakeResult("err", 1)},
+	}
+	for _, c := range unequal {
+		assert.False(t, Equal(c[0], c[1]), "%v != %v", c[0], c[1])
+	}
+	f := func() {}
+	assert.False(t, Equal(f, f)) // no panic on Go-incomparable values
+}
+
+func TestSet(t *testing.T) {
+	s, err := SetOf(3, 1, 3, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []any{3, 1, 2}, s.Elems())
+	assert.True(t, s.Has(1))
+	assert.False(t, s.Has("1"))
+	assert.Equal(t, "set{3, 1, 2}", s.String())
+	assert.Error(t, s.Add(1.5))
+
+	o, _ := SetOf(2, 4)
+	assert.Equal(t, []any{3, 1, 2, 4}, s.Union(o).Elems())
+	assert.Equal(t, []any{2}, s.Intersection(o).Elems())
+	assert.Equal(t, []any{3, 1}, s.Difference(o).Elems())
+
+	reordered, _ := SetOf(1, 2, 3)
+	assert.True(t, Equal(s, reordered))
+	assert.False(t, Equal(s, o))
+
+	out, err := Call("to_json", []any{s})
+	require.NoError(t, err)
+	assert.Equal(t, `[1,2,3]`, out)
+	words, _ := SetOf("b", "a")
+	out, err = Call("to_json", []any{words})
+	require.NoError(t, err)
+	assert.Equal(t, `["a","b"]`, out)
+}
+
+func TestCall_AssertEq_IsTypeAware(t *testing.T) {
+	_, err := Call("assert_eq", []any{1, "1"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `1 != "1"`)
+	_, err = Call("assert_eq", []any{[]any{1, 2}, []any{1, 2}})
+	assert.NoError(t, err)
+}
+
+func TestCall_ToJSON_MapKeys(t *testing.T) {
+	m, _ := MapOf(2, "b", 1, "a")
+	s, err := Call("to_json", []any{m})
+	require.NoError(t, err)
+	assert.Equal(t, `{"1":"a","2":"b"}`, s)
+
+	m, _ = MapOf(true, 1)
+	_, err = Call("to_json", []any{m})
+	assert.Error(t, err)
+}
@@ -0,0 +1,160 @@
+package testrunner
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/jiejie-dev/funny/v2/internal/vm"
+)
+
+// CoverageReport is the line coverage of a test run: for every file the
+// tests ran code from, other than the *_test.fn files themselves, which
+// lines have code and whether the tests reached them.
+type CoverageReport struct {
+	Files   []FileCoverage `json:"files"`
+	Covered int            `json:"covered"`
+	Total   int            `json:"total"`
+	Percent float64        `json:"percent"`
+}
+
+// FileCoverage is the line coverage of one file. Lines lists every line
+// with code, in order; a line with zero hits was never reached.
+type FileCoverage struct {
+	File    string     `json:"file"`
+	Covered int        `json:"covered"`
+	Total   int        `json:"total"`
+	Percent float64    `json:"percent"`
+	Lines   []LineHits `json:"lines"`
+}
+
+// LineHits is how many instructions on a 1-based line ran.
+type LineHits struct {
+	Line int   `json:"line"`
+	Hits int64 `json:"hits"`
+}
+
+// Uncovered returns the lines of f the tests never reached.
+func (f *FileCoverage) Uncovered() []int {
+	var out []int
+	for _, l := range f.Lines {
+		if l.Hits == 0 {
+			out = append(out, l.Line)
+		}
+	}
+	return out
+}
+
+// newCoverageReport folds what cov counted into a report, sorted by file.
+func newCoverageReport(cov *vm.Coverage) *CoverageReport {
+	r := &CoverageReport{Files: []FileCoverage{}}
+	for file, lines := range cov.Lines() {
+		if strings.HasSuffix(file, "_test.fn") {
+			continue
+		}
+		fc := FileCoverage{File: file, Lines: make([]LineHits, 0, len(lines))}
+		for line, hits := range lines {
+			fc.Lines = append(fc.Lines, LineHits{Line: line, Hits: hits})
+			if hits > 0 {
+				fc.Covered++
+			}
+		}
+		sort.Slice(fc.Lines, func(i, j int) bool { return fc.Lines[i].Line < fc.Lines[j].Line })
+		fc.Total = len(fc.Lines)
+		fc.Percent = percent(fc.Covered, fc.Total)
+		r.Files = append(r.Files, fc)
+		r.Covered += fc.Covered
+		r.Total += fc.Total
+	}
+	sort.Slice(r.Files, func(i, j int) bool { return r.Files[i].File < r.Files[j].File })
+	r.Percent = percent(r.Covered, r.Total)
+	return r
+}
+
+// percent returns covered out of total as a percentage; nothing to cover
+// counts as fully covered.
+func percent(covered, total int) float64 {
+	if total == 0 {
+		return 100
+	}
+	return float64(covered) * 100 / float64(total)
+}
+
+// WriteSummary writes a table of each file's coverage, and the total, to
+// w. Files under the working directory are shown relative to it.
+func (r *CoverageReport) WriteSummary(w io.Writer) error {
+	wd, _ := os.Getwd()
+	names := make([]string, len(r.Files))
+	width := len("total")
+	for i, f := range r.Files {
+		names[i] = f.File
+		if rel, err := filepath.Rel(wd, f.File); err == nil && !strings.HasPrefix(rel, "..") {
+			names[i] = rel
+		}
+		width = max(width, len(names[i]))
+	}
+	row := func(name string, covered, total int, pct float64) error {
+		_, err := fmt.Fprintf(w, "%-*s  %5.1f%%  (%d/%d lines)\n", width, name, pct, covered, total)
+		return err
+	}
+	for i, f := range r.Files {
+		if err := row(names[i], f.Covered, f.Total, f.Percent); err != nil {
+			return err
+		}
+	}
+	return row("total", r.Covered, r.Total, r.Percent)
+}
+
+// WriteLCOV writes the report to w in the LCOV tracefile format that
+// genhtml, Codecov and editor coverage plugins read.
+func (r *CoverageReport) WriteLCOV(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("TN:\n")
+	for _, f := range r.Files {
+		fmt.Fprintf(&b, "SF:%s\n", f.File)
+		for _, l := range f.Lines {
+			fmt.Fprintf(&b, "DA:%d,%d\n", l.Line, l.Hits)
+		}
+		fmt.Fprintf(&b, "LF:%d\nLH:%d\nend_of_record\n", f.Total, f.Covered)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteJSON writes the report to w as indented JSON, the format
+// ReadCoverage reads back.
+func (r *CoverageReport) WriteJSON(w io.Writer) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// ReadCoverage reads a report written by WriteJSON from the file at path.
+func ReadCoverage(path string) (*CoverageReport, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var r CoverageReport
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &r, nil
+}
+
+// File returns the coverage of the file at path, if the report has it.
+func (r *CoverageReport) File(path string) (*FileCoverage, bool) {
+	for i := range r.Files {
+		if r.Files[i].File == path {
+			return &r.Files[i], true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,76 @@
+package testrunner
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeCoverageFixture writes a library and a test that runs part of it
+// to a temporary directory, and returns the directory.
+func writeCoverageFixture(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "lib.fn"), []byte(`pub fn sign(x: int) -> int:
+    if x > 0:
+        return 1
+    elif x < 0:
+        return -1
+    else:
+        return 0
+
+pub fn unused(x: int) -> int:
+    return x * 2
+`), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "lib_test.fn"), []byte(`import "./lib.fn"
+
+test "positive":
+    assert_eq(sign(5), 1)
+
+test "zero":
+    assert_eq(sign(0), 0)
+`), 0o644))
+	return dir
+}
+
+func TestRun_Coverage(t *testing.T) {
+	dir := writeCoverageFixture(t)
+	report, err := Run(Options{Path: dir, Cover: true})
+	require.NoError(t, err)
+	require.Equal(t, 2, report.Passed)
+	cov := report.Coverage
+	require.NotNil(t, cov)
+	require.Len(t, cov.Files, 1, "the test file itself isn't reported")
+
+	lib := cov.Files[0]
+	assert.True(t, filepath.IsAbs(lib.File))
+	assert.Equal(t, "lib.fn", filepath.Base(lib.File))
+	assert.Equal(t, []int{5, 10}, lib.Uncovered())
+	assert.Equal(t, 4, lib.Covered)
+	assert.Equal(t, 6, lib.Total)
+	assert.InDelta(t, 66.7, cov.Percent, 0.1)
+
+	var lcov strings.Builder
+	require.NoError(t, cov.WriteLCOV(&lcov))
+	assert.Contains(t, lcov.String(), "SF:"+lib.File+"\nDA:2,2\n")
+	assert.Contains(t, lcov.String(), "DA:3,1\n", "one call, one hit")
+	assert.Contains(t, lcov.String(), "DA:5,0\n")
+	assert.Contains(t, lcov.String(), "LF:6\nLH:4\nend_of_record\n")
+
+	var summary strings.Builder
+	require.NoError(t, cov.WriteSummary(&summary))
+	assert.Contains(t, summary.String(), "66.7%  (4/6 lines)\n")
+
+	path := filepath.Join(t.TempDir(), "coverage.json")
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	require.NoError(t, cov.WriteJSON(f))
+	require.NoError(t, f.Close())
+	back, err := ReadCoverage(path)
+	require.NoError(t, err)
+	assert.Equal(t, cov, back)
+}
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/jiejie-dev/funny/v2/internal/ast"
+	"github.com/jiejie-dev/funny/v2/internal/bytecode"
 	"github.com/jiejie-dev/funny/v2/internal/compiler"
 	"github.com/jiejie-dev/funny/v2/internal/module"
 	"github.com/jiejie-dev/funny/v2/internal/parser"
@@ -24,17 +25,19 @@ type CaseResult struct {
 	Duration time.Duration `json:"duration_ns"`
 }
 
-// Report summarizes a test run.
+// Report summarizes a test run. Coverage is set when Options.Cover is.
 type Report struct {
-	Passed int          `json:"passed"`
-	Failed int          `json:"failed"`
-	Tests  []CaseResult `json:"tests"`
+	Passed   int             `json:"passed"`
+	Failed   int             `json:"failed"`
+	Tests    []CaseResult    `json:"tests"`
+	Coverage *CoverageReport `json:"coverage,omitempty"`
 }
 
 // Options configures test discovery and execution.
 type Options struct {
 	Path    string // file or directory (default ".")
 	Verbose bool
+	Cover   bool // record which lines the tests run; see CoverageReport
 }
 
 // Run discovers *_test.fn files and executes `test "name":` blocks.
@@ -55,8 +58,13 @@ func Run(opts Options) (*Report, error) {
 		return nil, fmt.Errorf("no *_test.fn files found under %s", abs)
 	}
 	report := &Report{}
+	var cov *vm.Coverage
+	if opts.Cover {
+		cov = vm.NewCoverage()
+	}
+	libs := libCache{}
 	for _, file := range files {
-		cases, err := runFile(file, opts.Verbose)
+		cases, err := runFile(file, opts.Verbose, cov, libs)
 		if err != nil {
 			return report, err
 		}
@@ -69,6 +77,9 @@ func Run(opts Options) (*Report, error) {
 			}
 		}
 	}
+	if cov != nil {
+		report.Coverage = newCoverageReport(cov)
+	}
 	return report, nil
 }
 
@@ -103,7 +114,7 @@ func discoverTestFiles(path string) ([]string, error) {
 	return files, err
 }
 
-func runFile(file string, verbose bool) ([]CaseResult, error) {
+func runFile(file string, verbose bool, cov *vm.Coverage, libs libCache) ([]CaseResult, error) {
 	data, err := os.ReadFile(file)
 	if err != nil {
 		return nil, err
@@ -113,10 +124,11 @@ func runFile(file string, verbose bool) ([]CaseResult, error) {
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", file, err)
 	}
-	prog, err = module.Resolve(prog, file)
+	g, err := module.Load(prog, file)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", file, err)
 	}
+	prog = g.Program()
 	env := types.NewEnv(nil)
 	if err := types.Check(prog, env); err != nil {
 		return nil, fmt.Errorf("%s: %w", file, err)
@@ -125,10 +137,16 @@ func runFile(file string, verbose bool) ([]CaseResult, error) {
 	if len(tests) == 0 {
 		return nil, fmt.Errorf("%s: no test blocks found", file)
 	}
+	deps := make([]*bytecode.Module, len(g.Units))
+	for i, u := range g.Units {
+		if deps[i], err = libs.compile(u); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+	}
 	var results []CaseResult
 	for _, tb := range tests {
 		start := time.Now()
-		runErr := runOne(prog, file, tb)
+		runErr := runOne(g.Main, deps, tb, cov)
 		cr := CaseResult{
 			File:     file,
 			Name:     tb.Name,
@@ -171,22 +189,55 @@ func collectTests(prog *ast.Program) []*ast.TestBlock {
 	return out
 }
 
-func runOne(full *ast.Program, file string, tb *ast.TestBlock) error {
-	harness := harnessProgram(full, tb)
-	mod, err := compiler.Compile(harness, file)
+// libCache holds the compiled modules of the files test files import, so
+// a file every test file imports is compiled once per run. The key is the
+// file's path and the module names of the files it sees, which are part
+// of the names its compile calls their private functions by.
+type libCache map[string]*bytecode.Module
+
+func (c libCache) compile(u *module.Unit) (*bytecode.Module, error) {
+	key := u.Path + "\x00" + u.Name
+	for _, dep := range u.Visible() {
+		key += "\x00" + dep.Name
+	}
+	if mod, ok := c[key]; ok {
+		return mod, nil
+	}
+	mod, err := compiler.CompileUnit(u)
+	if err != nil {
+		return nil, fmt.Errorf("compile %s: %w", u.Path, err)
+	}
+	c[key] = mod
+	return mod, nil
+}
+
+// runOne runs test block tb of the test file main, linked with the
+// compiled modules of the files it imports, counting the code it runs in
+// cov if that isn't nil.
+func runOne(main *module.Unit, deps []*bytecode.Module, tb *ast.TestBlock, cov *vm.Coverage) error {
+	harness := &module.Unit{Path: main.Path, Decls: harnessStmts(main.Decls, tb), Deps: main.Deps}
+	entry, err := compiler.CompileUnit(harness)
+	if err != nil {
+		return fmt.Errorf("compile test %q: %w", tb.Name, err)
+	}
+	mod, err := bytecode.Link(entry, deps...)
 	if err != nil {
 		return fmt.Errorf("compile test %q: %w", tb.Name, err)
 	}
 	m := vm.New(mod)
+	m.SetCoverage(cov)
 	if _, err := m.Run(); err != nil {
 		return err
 	}
 	return nil
 }
 
-func harnessProgram(full *ast.Program, tb *ast.TestBlock) *ast.Program {
+// harnessStmts returns the statements of a test file that run test block
+// tb: the file's own, without its test, plan and meta blocks, followed by
+// tb's body.
+func harnessStmts(file []ast.Statement, tb *ast.TestBlock) []ast.Statement {
 	var stmts []ast.Statement
-	for _, s := range full.Stmts {
+	for _, s := range file {
 		switch s.(type) {
 		case *ast.TestBlock, *ast.PlanBlock, *ast.MetaBlock:
 			continue
@@ -196,5 +247,5 @@ func harnessProgram(full *ast.Program, tb *ast.TestBlock) *ast.Program {
 	if tb.Body != nil {
 		stmts = append(stmts, tb.Body.Statements...)
 	}
-	return &ast.Program{Stmts: stmts}
+	return stmts
 }
@@ -7,11 +7,14 @@ import "fmt"
 const StructTypeField = "__type"
 
 // TypeOf reports the logical error/type name for a runtime value.
-// String payloads are "str"; struct maps with __type use that name.
+// String payloads are "str"; struct maps with __type use that name, as do
+// the VM's struct values (anything with a StructName method).
 func TypeOf(val any) string {
 	switch v := val.(type) {
 	case string:
 		return "str"
+	case interface{ StructName() string }:
+		return v.StructName()
 	case map[string]any:
 		if t, ok := v[StructTypeField].(string); ok && t != "" {
 			return t
@@ -0,0 +1,77 @@
+package types
+
+import (
+	"fmt"
+
+	"github.com/jiejie-dev/funny/v2/internal/ast"
+)
+
+// checkAttributes checks the arguments of the attributes the toolchain
+// itself reads (E2068). Any other attribute is metadata for outside tools
+// and is accepted as written, with a warning, since it's as likely to be a
+// misspelling of one of them (see warnUnknownAttr).
+func checkAttributes(attrs ast.Attributes, env *Env, onStep bool) {
+	for _, a := range attrs {
+		var err *Error
+		switch a.Name {
+		case "deprecated":
+			err = checkStringAttr(a, "message", false)
+		case "tool":
+			err = checkStringAttr(a, "description", true)
+		case "json":
+			err = New("E2068", "@json applies to struct fields", a.NodePos)
+		case "test_only":
+			if len(a.Args) > 0 {
+				err = New("E2068", "@test_only takes no arguments", a.NodePos)
+			} else if onStep {
+				err = New("E2068", "@test_only applies to `fn` and `struct` declarations, not steps", a.NodePos)
+			}
+		default:
+			warnUnknownAttr(a, env)
+		}
+		if err != nil {
+			env.report(err)
+		}
+	}
+}
+
+// knownAttrs lists the attributes the toolchain reads, for
+// warnUnknownAttr's hint.
+const knownAttrs = "@deprecated, @tool, @json and @test_only"
+
+// warnUnknownAttr warns (W2002) about an attribute the toolchain doesn't
+// read, which `@descripton` or `@tool_only` would otherwise pass for
+// without a word.
+func warnUnknownAttr(a *ast.Attribute, env *Env) {
+	w := New("W2002", fmt.Sprintf("unknown attribute @%s", a.Name), a.NodePos)
+	w.Hint = "funny reads " + knownAttrs + "; any other attribute is only kept for outside tools"
+	env.warn(w)
+}
+
+// checkStringAttr checks an attribute taking a single string argument,
+// written either positionally or as `name: "..."`.
+func checkStringAttr(a *ast.Attribute, name string, required bool) *Error {
+	if len(a.Args) == 0 {
+		if required {
+			return New("E2068", fmt.Sprintf("@%s requires a %s", a.Name, name), a.NodePos)
+		}
+		return nil
+	}
+	arg := a.Args[0]
+	if len(a.Args) > 1 || (arg.Name != "" && arg.Name != name) {
+		return New("E2068", fmt.Sprintf("@%s takes a single argument, its %s", a.Name, name), a.NodePos)
+	}
+	if _, ok := arg.Value.Value.(string); !ok {
+		return New("E2068", fmt.Sprintf("@%s %s must be a string, got %s", a.Name, name, arg.Value), a.NodePos)
+	}
+	return nil
+}
+
+// checkTestOnlyUse rejects a use of a `@test_only` function, method or
+// struct outside `test` blocks and other `@test_only` declarations (E2069).
+func checkTestOnlyUse(name string, pos ast.Pos, env *Env) error {
+	if !env.IsTestOnly(name) || env.InTestScope() {
+		return nil
+	}
+	return New("E2069", fmt.Sprintf("%s is @test_only: use it only in a `test` block or another @test_only declaration", name), pos)
+}
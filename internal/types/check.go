@@ -2,8 +2,11 @@ package types
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/jiejie-dev/funny/v2/internal/ast"
+	"github.com/jiejie-dev/funny/v2/internal/errs"
 	"github.com/jiejie-dev/funny/v2/internal/strfmt"
 )
 
@@ -26,12 +29,16 @@ func CheckExpr(expr ast.Expression, env *Env) (Type, error) {
 		return checkCallExpr(n, env)
 	case *ast.IndexExpr:
 		return checkIndexExpr(n, env)
+	case *ast.RangeExpr:
+		return checkRangeExpr(n, env)
 	case *ast.FieldExpr:
 		return checkFieldExpr(n, env)
 	case *ast.ListExpr:
 		return checkListLiteral(n, env)
 	case *ast.MapLiteralExpr:
 		return checkMapLiteral(n, env)
+	case *ast.SetLiteralExpr:
+		return checkSetLiteral(n, env)
 	case *ast.StructLiteralExpr:
 		return checkStructLiteral(n, env)
 	case *ast.SubExpr:
@@ -44,6 +51,18 @@ func CheckExpr(expr ast.Expression, env *Env) (Type, error) {
 	return nil, New("E2099", fmt.Sprintf("type checker: unsupported expression %T", expr), expr.Pos())
 }
 
+// checkOperand checks a sub-expression whose failure need not abandon the
+// enclosing expression: the error is reported to the running Check and
+// the operand is poisoned as Invalid, so its siblings are still checked
+// and nothing that uses it reports again.
+func checkOperand(expr ast.Expression, env *Env) (Type, error) {
+	t, err := CheckExpr(expr, env)
+	if err != nil && env.report(err) {
+		return Invalid{}, nil
+	}
+	return t, err
+}
+
 // checkTry type-checks `expr?`. The accepted operand is the inner expression's
 // type. When the operand is a Result, `?` propagates Err (early-returns from
 // the current function) but does NOT unwrap the Ok value: the type of `expr?`
@@ -110,11 +129,11 @@ func checkBinaryExpr(n *ast.BinaryExpr, env *Env) (Type, error) {
 		}
 		return checkFieldExpr(&ast.FieldExpr{NodePos: n.NodePos, Object: n.Left, Field: varExpr.Name}, env)
 	}
-	leftT, err := CheckExpr(n.Left, env)
+	leftT, err := checkOperand(n.Left, env)
 	if err != nil {
 		return nil, err
 	}
-	rightT, err := CheckExpr(n.Right, env)
+	rightT, err := checkOperand(n.Right, env)
 	if err != nil {
 		return nil, err
 	}
@@ -135,12 +154,20 @@ func checkBinaryExpr(n *ast.BinaryExpr, env *Env) (Type, error) {
 		}
 		return Primitive("bool"), nil
 	case "in":
-		rightList, ok := rightT.(List)
-		if !ok {
-			return nil, New("E2050", fmt.Sprintf("'in' requires list on right side, got %s", rightT), n.NodePos)
+		if isInvalid(rightT) {
+			return Primitive("bool"), nil
+		}
+		var elem Type
+		switch rt := rightT.(type) {
+		case List:
+			elem = rt.Elem
+		case Set:
+			elem = rt.Elem
+		default:
+			return nil, New("E2050", fmt.Sprintf("'in' requires list or set on right side, got %s", rightT), n.NodePos)
 		}
-		if !Equal(leftT, rightList.Elem) {
-			return nil, NewMismatch(n.NodePos, rightList.Elem, leftT)
+		if !Equal(leftT, elem) {
+			return nil, NewMismatch(n.NodePos, elem, leftT)
 		}
 		return Primitive("bool"), nil
 	}
@@ -191,6 +218,8 @@ var builtinTypeNames = map[string]bool{
 	"type_of":       true,
 	"to_json":       true,
 	"parse_json":    true,
+	"decode_json":   true,
+	"encode_json":   true,
 	"now":           true,
 	"time_format":   true,
 	"sqrt":          true,
@@ -216,6 +245,11 @@ var builtinTypeNames = map[string]bool{
 	"append":        true,
 	"assert":        true,
 	"assert_eq":     true,
+	// to_set and the set_* builtins are checked by checkSetCall.
+	"to_set":           true,
+	"set_union":        true,
+	"set_intersection": true,
+	"set_difference":   true,
 }
 
 // builtinResultReturns lists builtins that return a Result, so the `?` operator
@@ -320,6 +354,9 @@ func builtinReturnType(name string, argTypes []Type) Type {
 }
 
 func checkCallExpr(n *ast.CallExpr, env *Env) (Type, error) {
+	if fe, ok := n.Func.(*ast.FieldExpr); ok {
+		return checkMethodCall(n, fe, env)
+	}
 	varName, ok := n.Func.(*ast.VariableExpr)
 	if !ok {
 		return nil, New("E2070", "only direct function calls supported in M2-A", n.NodePos)
@@ -333,7 +370,7 @@ func checkCallExpr(n *ast.CallExpr, env *Env) (Type, error) {
 				fmt.Sprintf("%s expects 1 arg, got %d", varName.Name, len(n.Args)),
 				n.NodePos)
 		}
-		argT, err := CheckExpr(n.Args[0], env)
+		argT, err := checkOperand(n.Args[0], env)
 		if err != nil {
 			return nil, err
 		}
@@ -342,6 +379,12 @@ func checkCallExpr(n *ast.CallExpr, env *Env) (Type, error) {
 		}
 		return Result{Ok: Primitive("str"), Err: argT}, nil
 	}
+	if varName.Name == "decode_json" || varName.Name == "encode_json" {
+		return checkJSONCall(n, varName.Name, env)
+	}
+	if setBuiltins[varName.Name] {
+		return checkSetCall(n, varName.Name, env)
+	}
 	if builtinTypeNames[varName.Name] {
 		// Builtin call arguments used to go completely unchecked (this
 		// branch returned before ever looking at n.Args), so something
@@ -350,7 +393,7 @@ func checkCallExpr(n *ast.CallExpr, env *Env) (Type, error) {
 		// of a proper E2001 here.
 		argTypes := make([]Type, len(n.Args))
 		for i, arg := range n.Args {
-			t, err := CheckExpr(arg, env)
+			t, err := checkOperand(arg, env)
 			if err != nil {
 				return nil, err
 			}
@@ -360,35 +403,119 @@ func checkCallExpr(n *ast.CallExpr, env *Env) (Type, error) {
 	}
 	fn, ok := env.LookupFunc(varName.Name)
 	if !ok {
+		if _, isStruct := env.LookupStruct(varName.Name); isStruct {
+			if lit, ok := n.EmptyStructLiteral(); ok {
+				return checkStructLiteral(lit, env)
+			}
+		}
 		return nil, New("E2002", fmt.Sprintf("undefined function: %s", varName.Name), n.NodePos)
 	}
+	if err := checkTestOnlyUse(varName.Name, n.NodePos, env); err != nil {
+		return nil, err
+	}
+	return checkCallArgs(varName.Name, fn, n, env)
+}
+
+// checkMethodCall type-checks `obj.method(args)`: the receiver must be a
+// struct or interface declaring the method, and the arguments are checked
+// against the method's signature (which excludes the implicit `self`).
+func checkMethodCall(n *ast.CallExpr, fe *ast.FieldExpr, env *Env) (Type, error) {
+	objT, err := checkOperand(fe.Object, env)
+	if err != nil {
+		return nil, err
+	}
+	switch recv := objT.(type) {
+	case Invalid:
+		for _, arg := range n.Args {
+			if _, err := checkOperand(arg, env); err != nil {
+				return nil, err
+			}
+		}
+		return Invalid{}, nil
+	case Struct:
+		m, ok := recv.Method(fe.Field)
+		if !ok {
+			return nil, New("E2056", fmt.Sprintf("struct %s has no method %q", recv.Name, fe.Field), n.NodePos)
+		}
+		if err := checkTestOnlyUse(recv.Name+"."+fe.Field, n.NodePos, env); err != nil {
+			return nil, err
+		}
+		if recv.MutSelf[fe.Field] && rootVarName(fe.Object) == "self" && env.ReadOnlySelf() {
+			return nil, New("E2010", fmt.Sprintf("cannot call `mut self` method %s.%s: method receiver is not `mut self`", recv.Name, fe.Field), n.NodePos)
+		}
+		return checkCallArgs(recv.Name+"."+fe.Field, m, n, env)
+	case Interface:
+		m, ok := recv.Method(fe.Field)
+		if !ok {
+			return nil, New("E2056", fmt.Sprintf("interface %s has no method %q", recv.Name, fe.Field), n.NodePos)
+		}
+		return checkCallArgs(recv.Name+"."+fe.Field, m, n, env)
+	}
+	return nil, New("E2070", fmt.Sprintf("method call requires a struct or interface receiver, got %s", objT), n.NodePos)
+}
+
+// checkCallArgs checks a call's argument count and types against fn.
+func checkCallArgs(name string, fn Func, n *ast.CallExpr, env *Env) (Type, error) {
 	if len(n.Args) != fn.Arity() {
 		return nil, New("E2020",
-			fmt.Sprintf("%s expects %d args, got %d", varName.Name, fn.Arity(), len(n.Args)),
+			fmt.Sprintf("%s expects %d args, got %d", name, fn.Arity(), len(n.Args)),
 			n.NodePos)
 	}
 	for i, arg := range n.Args {
-		argT, err := CheckExpr(arg, env)
+		argT, err := checkExprAs(arg, fn.Params[i], env)
 		if err != nil {
-			return nil, err
+			if !env.report(err) {
+				return nil, err
+			}
+			continue
 		}
-		if !Equal(argT, fn.Params[i]) {
+		if !AssignableTo(argT, fn.Params[i]) {
 			return nil, NewMismatch(n.NodePos, fn.Params[i], argT)
 		}
 	}
 	return fn.Return, nil
 }
 
+// checkExprAs checks expr where a value of type expected is wanted. It
+// differs from CheckExpr only for a list literal expected to hold an
+// interface: checkListLiteral would infer the element type from the first
+// element and reject `[Square(...), Rect(...)]`, so here each element is
+// checked against the interface instead.
+func checkExprAs(expr ast.Expression, expected Type, env *Env) (Type, error) {
+	if l, ok := expr.(*ast.ListExpr); ok && len(l.Elements) > 0 {
+		if want, ok := expected.(List); ok {
+			if _, ok := want.Elem.(Interface); ok {
+				for _, el := range l.Elements {
+					t, err := CheckExpr(el, env)
+					if err != nil {
+						return nil, err
+					}
+					if !AssignableTo(t, want.Elem) {
+						return nil, NewMismatch(el.Pos(), want.Elem, t)
+					}
+				}
+				return want, nil
+			}
+		}
+	}
+	return CheckExpr(expr, env)
+}
+
 func checkIndexExpr(n *ast.IndexExpr, env *Env) (Type, error) {
-	objT, err := CheckExpr(n.Object, env)
+	if n.Slice {
+		return checkSliceExpr(n, env)
+	}
+	objT, err := checkOperand(n.Object, env)
 	if err != nil {
 		return nil, err
 	}
-	idxT, err := CheckExpr(n.Index, env)
+	idxT, err := checkOperand(n.Index, env)
 	if err != nil {
 		return nil, err
 	}
 	switch t := objT.(type) {
+	case Invalid:
+		return t, nil
 	case List:
 		if !Equal(idxT, Primitive("int")) {
 			return nil, NewMismatch(n.NodePos, Primitive("int"), idxT)
@@ -403,11 +530,66 @@ func checkIndexExpr(n *ast.IndexExpr, env *Env) (Type, error) {
 	return nil, New("E2050", fmt.Sprintf("cannot index into %s", objT), n.NodePos)
 }
 
+// checkSliceExpr checks `obj[lo:hi]`: obj must be a list or a str, each
+// bound that is present must be an int, and the slice has obj's own type.
+func checkSliceExpr(n *ast.IndexExpr, env *Env) (Type, error) {
+	objT, err := checkOperand(n.Object, env)
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range []ast.Expression{n.Low, n.High} {
+		if b == nil {
+			continue
+		}
+		bt, err := checkOperand(b, env)
+		if err != nil {
+			return nil, err
+		}
+		if !Equal(bt, Primitive("int")) {
+			return nil, NewMismatch(b.Pos(), Primitive("int"), bt)
+		}
+	}
+	switch t := objT.(type) {
+	case Invalid, List:
+		return t, nil
+	case Primitive:
+		if t == "str" {
+			return t, nil
+		}
+	}
+	return nil, New("E2050", fmt.Sprintf("cannot slice %s; only lists and strings can be sliced", objT), n.NodePos)
+}
+
+// checkRangeExpr checks `start..end [step k]`: every part must be an int
+// and the range is a list[int]. A constant zero step is rejected here
+// since it would never make progress; the runtime rejects any other.
+func checkRangeExpr(n *ast.RangeExpr, env *Env) (Type, error) {
+	for _, part := range []ast.Expression{n.Start, n.End, n.Step} {
+		if part == nil {
+			continue
+		}
+		pt, err := checkOperand(part, env)
+		if err != nil {
+			return nil, err
+		}
+		if !Equal(pt, Primitive("int")) {
+			return nil, NewMismatch(part.Pos(), Primitive("int"), pt)
+		}
+	}
+	if step, ok := constInt(n.Step, env); ok && step == 0 {
+		return nil, New("E2060", "range step must not be zero", n.Step.Pos())
+	}
+	return List{Elem: Primitive("int")}, nil
+}
+
 func checkFieldExpr(n *ast.FieldExpr, env *Env) (Type, error) {
-	objT, err := CheckExpr(n.Object, env)
+	objT, err := checkOperand(n.Object, env)
 	if err != nil {
 		return nil, err
 	}
+	if isInvalid(objT) {
+		return objT, nil
+	}
 	if s, ok := objT.(Struct); ok {
 		f, ok := s.Field(n.Field)
 		if !ok {
@@ -441,12 +623,12 @@ func checkListLiteral(n *ast.ListExpr, env *Env) (Type, error) {
 	if len(n.Elements) == 0 {
 		return nil, New("E2011", "cannot infer type of empty list; add type annotation", n.NodePos)
 	}
-	first, err := CheckExpr(n.Elements[0], env)
+	first, err := checkOperand(n.Elements[0], env)
 	if err != nil {
 		return nil, err
 	}
 	for i := 1; i < len(n.Elements); i++ {
-		t, err := CheckExpr(n.Elements[i], env)
+		t, err := checkOperand(n.Elements[i], env)
 		if err != nil {
 			return nil, err
 		}
@@ -463,23 +645,23 @@ func checkMapLiteral(n *ast.MapLiteralExpr, env *Env) (Type, error) {
 	if len(n.Keys) == 0 {
 		return nil, New("E2011", "cannot infer type of empty map; add type annotation", n.NodePos)
 	}
-	keyT, err := CheckExpr(n.Keys[0], env)
+	keyT, err := checkOperand(n.Keys[0], env)
 	if err != nil {
 		return nil, err
 	}
-	valT, err := CheckExpr(n.Values[0], env)
+	valT, err := checkOperand(n.Values[0], env)
 	if err != nil {
 		return nil, err
 	}
 	for i := 1; i < len(n.Keys); i++ {
-		kt, err := CheckExpr(n.Keys[i], env)
+		kt, err := checkOperand(n.Keys[i], env)
 		if err != nil {
 			return nil, err
 		}
 		if !Equal(kt, keyT) {
 			return nil, NewMismatch(n.Keys[i].Pos(), keyT, kt)
 		}
-		vt, err := CheckExpr(n.Values[i], env)
+		vt, err := checkOperand(n.Values[i], env)
 		if err != nil {
 			return nil, err
 		}
@@ -487,7 +669,11 @@ func checkMapLiteral(n *ast.MapLiteralExpr, env *Env) (Type, error) {
 			return nil, NewMismatch(n.Values[i].Pos(), valT, vt)
 		}
 	}
-	return Map{Key: keyT, Value: valT}, nil
+	m := Map{Key: keyT, Value: valT}
+	if err := checkMapKeys(m, n.NodePos, env); err != nil {
+		return nil, err
+	}
+	return m, nil
 }
 
 func checkStructLiteral(n *ast.StructLiteralExpr, env *Env) (Type, error) {
@@ -495,29 +681,109 @@ func checkStructLiteral(n *ast.StructLiteralExpr, env *Env) (Type, error) {
 	if !ok {
 		return nil, New("E2053", fmt.Sprintf("undefined struct type: %s", n.TypeName), n.NodePos)
 	}
+	if err := checkTestOnlyUse(n.TypeName, n.NodePos, env); err != nil {
+		return nil, err
+	}
 	for fname, expr := range n.Fields {
 		expected, ok := s.Field(fname)
 		if !ok {
 			return nil, New("E2054", fmt.Sprintf("struct %s has no field %q", n.TypeName, fname), n.NodePos)
 		}
-		actual, err := CheckExpr(expr, env)
+		actual, err := checkOperand(expr, env)
 		if err != nil {
 			return nil, err
 		}
-		if !Equal(actual, expected) {
-			return nil, NewMismatch(expr.Pos(), expected, actual)
+		if !AssignableTo(actual, expected) {
+			if err := NewMismatch(expr.Pos(), expected, actual); !env.report(err) {
+				return nil, err
+			}
 		}
 	}
+	var missing []string
+	for fname := range s.Fields {
+		if _, given := n.Fields[fname]; !given && !s.HasDefault(fname) {
+			missing = append(missing, fname)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return nil, New("E2057",
+			fmt.Sprintf("struct %s literal is missing field(s) %s", n.TypeName, strings.Join(missing, ", ")),
+			n.NodePos)
+	}
+	if r, ok := s.Validated(); ok {
+		return r, nil
+	}
 	return s, nil
 }
 
-// Check type-checks a full program.
+// Check type-checks a full program. It does not stop at the first error:
+// a failing statement is recorded and checking carries on with the next
+// one (and inside an expression, with the failing operand's siblings; see
+// checkOperand). Every error found is returned together as an errs.List,
+// in the order they were found; nil means the program is well-typed.
 func Check(prog *ast.Program, env *Env) error {
-	for _, s := range prog.Stmts {
-		if err := checkStmt(s, env); err != nil {
-			return err
+	var reported, warned []error
+	savedReported, savedWarned, savedExhaustive := env.reported, env.warned, env.exhaustive
+	env.reported, env.warned, env.exhaustive = &reported, &warned, map[*ast.MatchStmt]bool{}
+	defer func() { env.reported, env.warned, env.exhaustive = savedReported, savedWarned, savedExhaustive }()
+	checkStmts(prog.Stmts, env)
+	env.warnings = toErrsList(warned)
+	for _, w := range env.warnings {
+		w.Warning = true
+	}
+	if len(reported) == 0 {
+		return nil
+	}
+	return toErrsList(reported)
+}
+
+// toErrsList converts the errors collected by Check to the shared form.
+func toErrsList(found []error) errs.List {
+	if len(found) == 0 {
+		return nil
+	}
+	list := make(errs.List, 0, len(found))
+	for _, err := range found {
+		switch e := err.(type) {
+		case *Error:
+			list = append(list, e.ToErrs())
+		case *errs.Error:
+			list = append(list, e)
+		default:
+			list = append(list, errs.New("E2099", err.Error(), errs.Position{}, ""))
+		}
+	}
+	return list
+}
+
+// checkStmts checks stmts in order, reporting (rather than returning) the
+// error of any statement that fails. A failed `let` still declares its
+// name, as Invalid, so later uses of it aren't reported as undefined.
+// The first statement that control can't reach, after one that always
+// returns, breaks or continues, gets a warning (see flow.go).
+func checkStmts(stmts []ast.Statement, env *Env) {
+	warned := false
+	for i, s := range stmts {
+		err := checkStmt(s, env)
+		if !warned && !completes(s, env) {
+			warned = warnUnreachable(stmts[i+1:], env)
+		}
+		if err == nil {
+			continue
+		}
+		env.report(err)
+		if let, ok := s.(*ast.LetStmt); ok {
+			if _, declared := env.vars[let.Name]; !declared {
+				env.DeclareVar(let.Name, Invalid{})
+			}
 		}
 	}
+}
+
+// checkBlock checks a nested block's statements; see checkStmts.
+func checkBlock(b *ast.Block, env *Env) error {
+	checkStmts(b.Statements, env)
 	return nil
 }
 
@@ -525,6 +791,8 @@ func checkStmt(s ast.Statement, env *Env) error {
 	switch n := s.(type) {
 	case *ast.LetStmt:
 		return checkLet(n, env)
+	case *ast.ConstDecl:
+		return checkConst(n, env)
 	case *ast.AssignStmt:
 		return checkAssign(n, env)
 	case *ast.IfStmt:
@@ -541,10 +809,16 @@ func checkStmt(s ast.Statement, env *Env) error {
 		return checkFnDecl(n, env)
 	case *ast.StructDecl:
 		return checkStructDecl(n, env)
+	case *ast.InterfaceDecl:
+		return checkInterfaceDecl(n, env)
+	case *ast.TypeAliasDecl:
+		return checkTypeAlias(n, env)
 	case *ast.BreakStmt:
 		return checkBreak(n, env)
 	case *ast.ContinueStmt:
 		return checkContinue(n, env)
+	case *ast.DeferStmt:
+		return checkDefer(n, env)
 	case *ast.ExprStmt:
 		return checkExprStmt(n, env)
 	case *ast.PlanBlock:
@@ -565,55 +839,70 @@ func checkExprStmt(n *ast.ExprStmt, env *Env) error {
 }
 
 func checkLet(n *ast.LetStmt, env *Env) error {
+	if env.consts[n.Name] {
+		return New("E2065", fmt.Sprintf("cannot redeclare constant %s", n.Name), n.NodePos)
+	}
 	// `let xs: list[int] = []` (or `map[...]{}`) is the only way to seed an
 	// accumulator that starts empty - e.g. collecting valid entries while
 	// looping over parsed input with append(). checkListLiteral/
 	// checkMapLiteral raise E2011 "cannot infer type of empty list/map" for
 	// *any* empty literal, since they have no element to infer Elem/Value
 	// from; but here a declared annotation already says what the container
-	// should hold, so the empty literal can be trusted instead of rejected.
-	if n.TypeAnn != "" && isEmptyContainerLiteral(n.Value) {
-		declared, err := ParseType(n.TypeAnn)
+	// should hold, so the empty literal can be trusted instead of rejected
+	// (see checkAssignable).
+	if n.TypeAnn == "" {
+		valT, err := checkOperand(n.Value, env)
 		if err != nil {
-			return New("E2012", fmt.Sprintf("invalid type annotation %q: %v", n.TypeAnn, err), n.NodePos)
+			return err
 		}
-		declared = resolveNamedType(declared, env)
+		env.DeclareVar(n.Name, valT)
+		return nil
+	}
+	declared, err := ParseType(n.TypeAnn)
+	if err != nil {
+		return New("E2012", fmt.Sprintf("invalid type annotation %q: %v", n.TypeAnn, err), n.NodePos)
+	}
+	declared = resolveNamedType(declared, env)
+	env.DeclareVar(n.Name, declared)
+	if err := checkMapKeys(declared, n.NodePos, env); err != nil {
+		return err
+	}
+	return checkAssignable(n.Value, declared, n.NodePos, env)
+}
+
+// checkAssignable checks that value can initialize something declared as
+// declared: an empty `[]`/`{}` literal takes its element types from a
+// list/map declaration, and anything else must check (via checkExprAs) to
+// a type Equal to declared.
+func checkAssignable(value ast.Expression, declared Type, pos ast.Pos, env *Env) error {
+	if isEmptyContainerLiteral(value) {
 		switch declared.(type) {
-		case List, Map:
-			env.DeclareVar(n.Name, declared)
+		case List, Map, Set:
 			return nil
 		}
 	}
-	valT, err := CheckExpr(n.Value, env)
+	valT, err := checkExprAs(value, declared, env)
 	if err != nil {
 		return err
 	}
-	var declared Type
-	if n.TypeAnn != "" {
-		declared, err = ParseType(n.TypeAnn)
-		if err != nil {
-			return New("E2012", fmt.Sprintf("invalid type annotation %q: %v", n.TypeAnn, err), n.NodePos)
-		}
-		declared = resolveNamedType(declared, env)
-		if !Equal(valT, declared) {
-			return NewMismatch(n.NodePos, declared, valT)
-		}
-	} else {
-		declared = valT
+	if !AssignableTo(valT, declared) {
+		return NewMismatch(pos, declared, valT)
 	}
-	env.DeclareVar(n.Name, declared)
 	return nil
 }
 
-// isEmptyContainerLiteral reports whether n is an empty list/map literal
-// (`[]` or `{}`), which checkListLiteral/checkMapLiteral can't type-check
-// on their own since they have no element to infer from.
+// isEmptyContainerLiteral reports whether n is an empty list/map/set
+// literal (`[]`, `{}` or `set{}`), which checkListLiteral/checkMapLiteral/
+// checkSetLiteral can't type-check on their own since they have no element
+// to infer from.
 func isEmptyContainerLiteral(n ast.Expression) bool {
 	switch v := n.(type) {
 	case *ast.ListExpr:
 		return len(v.Elements) == 0
 	case *ast.MapLiteralExpr:
 		return len(v.Keys) == 0
+	case *ast.SetLiteralExpr:
+		return len(v.Elements) == 0
 	}
 	return false
 }
@@ -622,6 +911,9 @@ func checkAssign(n *ast.AssignStmt, env *Env) error {
 	if fe, ok := n.Target.(*ast.FieldExpr); ok {
 		return checkFieldAssign(fe, n.Value, n.NodePos, env)
 	}
+	if v, ok := n.Target.(*ast.VariableExpr); ok && env.IsConst(v.Name) {
+		return New("E2065", fmt.Sprintf("cannot assign to constant %s", v.Name), n.NodePos)
+	}
 	valT, err := CheckExpr(n.Value, env)
 	if err != nil {
 		return err
@@ -630,7 +922,7 @@ func checkAssign(n *ast.AssignStmt, env *Env) error {
 	if err != nil {
 		return err
 	}
-	if !Equal(valT, targetT) {
+	if !AssignableTo(valT, targetT) {
 		return NewMismatch(n.NodePos, targetT, valT)
 	}
 	return nil
@@ -648,6 +940,9 @@ func checkFieldAssign(fe *ast.FieldExpr, value ast.Expression, pos ast.Pos, env
 	if !s.IsMutable(fe.Field) {
 		return New("E2010", fmt.Sprintf("field %s.%s is not mutable; declare with mut", s.Name, fe.Field), pos)
 	}
+	if rootVarName(fe.Object) == "self" && env.ReadOnlySelf() {
+		return New("E2010", fmt.Sprintf("cannot assign to self.%s: method receiver is not `mut self`", fe.Field), pos)
+	}
 	fieldT, ok := s.Field(fe.Field)
 	if !ok {
 		return New("E2052", fmt.Sprintf("struct %s has no field %q", s.Name, fe.Field), pos)
@@ -656,85 +951,77 @@ func checkFieldAssign(fe *ast.FieldExpr, value ast.Expression, pos ast.Pos, env
 	if err != nil {
 		return err
 	}
-	if !Equal(valT, fieldT) {
+	if !AssignableTo(valT, fieldT) {
 		return NewMismatch(pos, fieldT, valT)
 	}
 	return nil
 }
 
-func checkIf(n *ast.IfStmt, env *Env) error {
-	condT, err := CheckExpr(n.Cond, env)
-	if err != nil {
-		return err
+// rootVarName returns the variable at the base of a field/index chain
+// (`a` for `a.b[0].c`), or "" if the chain is rooted in something else.
+func rootVarName(e ast.Expression) string {
+	for {
+		switch n := e.(type) {
+		case *ast.VariableExpr:
+			return n.Name
+		case *ast.FieldExpr:
+			e = n.Object
+		case *ast.IndexExpr:
+			e = n.Object
+		default:
+			return ""
+		}
 	}
-	if !Equal(condT, Primitive("bool")) {
-		return NewMismatch(n.NodePos, Primitive("bool"), condT)
+}
+
+// checkCond checks an if/while condition. A bad condition is reported
+// without abandoning the statement, so its body is still checked.
+func checkCond(cond ast.Expression, pos ast.Pos, env *Env) {
+	condT, err := checkOperand(cond, env)
+	if err == nil && !Equal(condT, Primitive("bool")) {
+		err = NewMismatch(pos, Primitive("bool"), condT)
 	}
-	if err := Check(n.Then.ToProgram(), env); err != nil {
-		return err
+	if err != nil {
+		env.report(err)
 	}
+}
+
+func checkIf(n *ast.IfStmt, env *Env) error {
+	checkCond(n.Cond, n.NodePos, env)
+	checkBlock(n.Then, env)
 	if n.ElseIf != nil {
 		return checkIf(n.ElseIf, env)
 	}
 	if n.ElseBlock != nil {
-		return Check(n.ElseBlock.ToProgram(), env)
+		return checkBlock(n.ElseBlock, env)
 	}
 	return nil
 }
 
 func checkFor(n *ast.ForStmt, env *Env) error {
-	iterT, err := CheckExpr(n.Iterable, env)
+	iterT, err := checkOperand(n.Iterable, env)
 	if err != nil {
 		return err
 	}
-	listT, ok := iterT.(List)
-	if !ok {
-		return New("E2050", fmt.Sprintf("for-in requires list, got %s", iterT), n.NodePos)
+	var elem Type = Invalid{}
+	if !isInvalid(iterT) {
+		switch it := iterT.(type) {
+		case List:
+			elem = it.Elem
+		case Set:
+			elem = it.Elem
+		default:
+			env.report(New("E2050", fmt.Sprintf("for-in requires list or set, got %s", iterT), n.NodePos))
+		}
 	}
 	bodyEnv := NewEnv(env)
-	bodyEnv.DeclareVar(n.Name, listT.Elem)
-	return Check(n.Body.ToProgram(), bodyEnv.WithLoopBody())
+	bodyEnv.DeclareVar(n.Name, elem)
+	return checkBlock(n.Body, bodyEnv.WithLoopBody())
 }
 
 func checkWhile(n *ast.WhileStmt, env *Env) error {
-	condT, err := CheckExpr(n.Cond, env)
-	if err != nil {
-		return err
-	}
-	if !Equal(condT, Primitive("bool")) {
-		return NewMismatch(n.NodePos, Primitive("bool"), condT)
-	}
-	return Check(n.Body.ToProgram(), env.WithLoopBody())
-}
-
-func checkMatch(n *ast.MatchStmt, env *Env) error {
-	scrT, err := CheckExpr(n.Expr, env)
-	if err != nil {
-		return err
-	}
-	for _, arm := range n.Arms {
-		if err := checkMatchPattern(arm.Pattern, scrT, env, n.NodePos); err != nil {
-			return err
-		}
-		if err := Check(arm.Body.ToProgram(), env); err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
-func checkMatchPattern(pattern ast.Expression, scrT Type, env *Env, pos ast.Pos) error {
-	if v, ok := pattern.(*ast.VariableExpr); ok && v.Name == "_" {
-		return nil
-	}
-	patT, err := CheckExpr(pattern, env)
-	if err != nil {
-		return err
-	}
-	if !Equal(patT, scrT) {
-		return NewMismatch(pos, scrT, patT)
-	}
-	return nil
+	checkCond(n.Cond, n.NodePos, env)
+	return checkBlock(n.Body, env.WithLoopBody())
 }
 
 func checkBreak(n *ast.BreakStmt, env *Env) error {
@@ -744,6 +1031,16 @@ func checkBreak(n *ast.BreakStmt, env *Env) error {
 	return nil
 }
 
+// checkDefer checks the deferred call like any other call; its result is
+// discarded.
+func checkDefer(n *ast.DeferStmt, env *Env) error {
+	if !env.InDeferScope() {
+		return New("E2064", "defer outside a function or plan step", n.NodePos)
+	}
+	_, err := CheckExpr(n.Call, env)
+	return err
+}
+
 func checkContinue(n *ast.ContinueStmt, env *Env) error {
 	if !env.InLoop() {
 		return New("E2013", "continue outside for/while", n.NodePos)
@@ -767,64 +1064,222 @@ func checkReturn(n *ast.ReturnStmt, env *Env) error {
 	if !ok {
 		return nil
 	}
-	if !Equal(valT, expected) {
+	if !AssignableTo(valT, expected) {
 		return NewMismatch(n.NodePos, expected, valT)
 	}
 	return nil
 }
 
 func checkFnDecl(n *ast.FnDecl, env *Env) error {
+	checkAttributes(n.Attrs, env, false)
+	sig, err := fnSignature(n, n.Params, env)
+	if err != nil {
+		return err
+	}
+	env.DeclareFunc(n.Name, sig)
+	if n.Attrs.TestOnly() {
+		env.DeclareTestOnly(n.Name)
+	}
+	return checkFnBody(n, sig, n.Params, env)
+}
+
+// fnSignature builds the Func type for a declaration from its (explicitly
+// annotated) params and return type. For methods the caller passes
+// n.Params[1:], leaving out the implicit `self` receiver. A missing or
+// malformed annotation is reported and that slot poisoned as Invalid, so
+// the function is still declared and its body and callers still checked.
+func fnSignature(n *ast.FnDecl, params []ast.Param, env *Env) (Func, error) {
 	var retType Type = Primitive("nil")
 	if n.RetType != "" {
-		var err error
-		retType, err = ParseType(n.RetType)
+		t, err := ParseType(n.RetType)
 		if err != nil {
-			return New("E2012", fmt.Sprintf("invalid return type %q: %v", n.RetType, err), n.NodePos)
+			if err := New("E2012", fmt.Sprintf("invalid return type %q: %v", n.RetType, err), n.NodePos); !env.report(err) {
+				return Func{}, err
+			}
+			t = Invalid{}
 		}
-		retType = resolveNamedType(retType, env)
+		retType = resolveNamedType(t, env)
 	}
 	var paramTypes []Type
-	for _, p := range n.Params {
-		if p.TypeAnn == "" {
-			return New("E2013", fmt.Sprintf("parameter %q missing type annotation", p.Name), n.NodePos)
+	for _, p := range params {
+		var err *Error
+		pt, perr := ParseType(p.TypeAnn)
+		switch {
+		case p.TypeAnn == "":
+			err = New("E2013", fmt.Sprintf("parameter %q missing type annotation", p.Name), n.NodePos)
+		case perr != nil:
+			err = New("E2012", fmt.Sprintf("invalid type for parameter %q: %v", p.Name, perr), n.NodePos)
 		}
-		pt, err := ParseType(p.TypeAnn)
 		if err != nil {
-			return New("E2012", fmt.Sprintf("invalid type for parameter %q: %v", p.Name, err), n.NodePos)
+			if !env.report(err) {
+				return Func{}, err
+			}
+			pt = Invalid{}
 		}
 		paramTypes = append(paramTypes, resolveNamedType(pt, env))
 	}
-	env.DeclareFunc(n.Name, Func{Params: paramTypes, Return: retType})
-	bodyEnv := NewEnv(env)
-	bodyEnv.DeclareVar("__return_type__", retType)
-	for i, p := range n.Params {
-		bodyEnv.DeclareVar(p.Name, paramTypes[i])
+	sig := Func{Params: paramTypes, Return: retType}
+	if err := checkMapKeys(sig, n.NodePos, env); err != nil && !env.report(err) {
+		return Func{}, err
 	}
-	return Check(n.Body.ToProgram(), bodyEnv)
+	return sig, nil
 }
 
+// checkFnBody checks a function body in a fresh scope with params bound
+// to sig's parameter types. env must already hold any bindings the body
+// may reference (including, for methods, `self`).
+func checkFnBody(n *ast.FnDecl, sig Func, params []ast.Param, env *Env) error {
+	bodyEnv := NewEnv(env)
+	bodyEnv.DeclareVar("__return_type__", sig.Return)
+	bodyEnv.canDefer = true
+	bodyEnv.inTest = n.Attrs.TestOnly()
+	for i, p := range params {
+		bodyEnv.DeclareVar(p.Name, sig.Params[i])
+	}
+	checkBlock(n.Body, bodyEnv)
+	return checkAllPathsReturn(n, sig.Return, bodyEnv)
+}
+
+// checkStructDecl declares the struct type, then its method signatures
+// (so method bodies can call each other via self regardless of order),
+// then checks each method body with `self` bound to the struct. Field
+// defaults may not refer to variables (see Env.WithoutOuterVars). A
+// `validate` method, if any, must return a Result: literals of the
+// struct then produce Result[Struct, E] (see Struct.Validated). A method
+// whose receiver isn't `mut self` is checked in an env with
+// Env.ReadOnlySelf set, so neither an assignment through self (even to a
+// `mut` field, see checkFieldAssign) nor a call to a `mut self` method on
+// it (see checkMethodCall) is allowed there.
 func checkStructDecl(n *ast.StructDecl, env *Env) error {
 	fields := map[string]Type{}
 	mutable := map[string]bool{}
+	defaults := map[string]bool{}
 	for _, f := range n.Fields {
+		var ft Type = Invalid{}
 		if f.TypeAnn == "" {
-			return New("E2013", fmt.Sprintf("struct field %q missing type annotation", f.Name), n.NodePos)
-		}
-		ft, err := ParseType(f.TypeAnn)
-		if err != nil {
-			return New("E2012", fmt.Sprintf("invalid type for field %q: %v", f.Name, err), n.NodePos)
+			env.report(New("E2013", fmt.Sprintf("struct field %q missing type annotation", f.Name), n.NodePos))
+		} else if t, err := ParseType(f.TypeAnn); err != nil {
+			env.report(New("E2012", fmt.Sprintf("invalid type for field %q: %v", f.Name, err), n.NodePos))
+		} else {
+			ft = resolveNamedType(t, env)
+			if err := checkMapKeys(ft, n.NodePos, env); err != nil {
+				env.report(err)
+			}
 		}
-		fields[f.Name] = resolveNamedType(ft, env)
+		fields[f.Name] = ft
 		if f.Mut {
 			mutable[f.Name] = true
 		}
+		if f.Default != nil {
+			if err := checkAssignable(f.Default, ft, f.Default.Pos(), env.WithoutOuterVars()); err != nil {
+				env.report(err)
+			}
+			defaults[f.Name] = true
+		}
+	}
+	methods := map[string]Func{}
+	mutSelf := map[string]bool{}
+	s := Struct{Name: n.Name, Fields: fields, Mutable: mutable, Defaults: defaults, Methods: methods, MutSelf: mutSelf}
+	env.DeclareStruct(n.Name, s)
+	checkAttributes(n.Attrs, env, false)
+	checkFieldAttributes(n, env)
+	if n.Attrs.TestOnly() {
+		env.DeclareTestOnly(n.Name)
+	}
+	for _, m := range n.Methods {
+		checkAttributes(m.Attrs, env, false)
+		if m.Attrs.TestOnly() {
+			env.DeclareTestOnly(n.Name + "." + m.Name)
+		}
+	}
+	for _, m := range n.Methods {
+		if _, dup := fields[m.Name]; dup {
+			env.report(New("E2055", fmt.Sprintf("struct %s has both a field and a method named %q", n.Name, m.Name), m.NodePos))
+			continue
+		}
+		if _, dup := methods[m.Name]; dup {
+			env.report(New("E2055", fmt.Sprintf("struct %s declares method %q twice", n.Name, m.Name), m.NodePos))
+			continue
+		}
+		sig, err := fnSignature(m, m.Params[1:], env)
+		if err != nil {
+			return err
+		}
+		methods[m.Name] = sig
+		if m.Params[0].Mut {
+			mutSelf[m.Name] = true
+		}
+	}
+	if v, ok := methods["validate"]; ok {
+		if !isResultType(v.Return) || v.Arity() != 0 {
+			env.report(New("E2058",
+				fmt.Sprintf("%s.validate must be declared as `fn validate(self) -> Result`, got %s", n.Name, v),
+				n.Method("validate").NodePos))
+			delete(methods, "validate")
+		}
+	}
+	for _, m := range n.Methods {
+		if _, ok := methods[m.Name]; !ok {
+			continue
+		}
+		selfEnv := NewEnv(env)
+		selfEnv.inTest = n.Attrs.TestOnly()
+		selfEnv.DeclareVar("self", s)
+		selfEnv.selfIsRO = !m.Params[0].Mut
+		if err := checkFnBody(m, methods[m.Name], m.Params[1:], selfEnv); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkInterfaceDecl declares the interface type. Its method map is
+// filled in after the declaration so a signature may mention the
+// interface itself (e.g. `fn same(self, other: Shape) -> bool`).
+func checkInterfaceDecl(n *ast.InterfaceDecl, env *Env) error {
+	methods := map[string]Func{}
+	env.DeclareInterface(n.Name, Interface{Name: n.Name, Methods: methods})
+	for _, m := range n.Methods {
+		if _, dup := methods[m.Name]; dup {
+			return New("E2055", fmt.Sprintf("interface %s declares method %q twice", n.Name, m.Name), m.NodePos)
+		}
+		sig, err := fnSignature(m, m.Params[1:], env)
+		if err != nil {
+			return err
+		}
+		methods[m.Name] = sig
 	}
-	env.DeclareStruct(n.Name, Struct{Name: n.Name, Fields: fields, Mutable: mutable})
 	return nil
 }
 
+// checkTypeAlias declares `type Name = Target`. The target is resolved
+// once here, so later annotations naming the alias resolve to exactly the
+// same Type as spelling out the target (aliases are transparent).
+func checkTypeAlias(n *ast.TypeAliasDecl, env *Env) error {
+	if builtinTypeName(n.Name) {
+		return New("E2059", fmt.Sprintf("cannot redefine builtin type %s", n.Name), n.NodePos)
+	}
+	t, err := ParseType(n.Target)
+	if err != nil {
+		return New("E2012", fmt.Sprintf("invalid type for alias %s: %v", n.Name, err), n.NodePos)
+	}
+	env.DeclareAlias(n.Name, resolveNamedType(t, env))
+	return nil
+}
+
+// builtinTypeName reports whether name is a type the checker understands
+// without any declaration.
+func builtinTypeName(name string) bool {
+	switch name {
+	case "int", "float", "str", "bool", "nil", "any", "Result", "list", "map":
+		return true
+	}
+	return false
+}
+
 // resolveNamedType rewrites bare type names that refer to a known struct
-// into their full Struct type (with fields populated), recursing into
+// (or interface, or alias) into their full Struct (or Interface, or target)
+// type (with fields populated), recursing into
 // compound types (list/map/optional/Result/func). ParseType has no access
 // to the environment, so a struct type annotation like `Point` initially
 // comes back as an opaque Primitive("Point"); left as-is, it would never
@@ -845,11 +1300,19 @@ func resolveNamedType(t Type, env *Env) Type {
 		if s, ok := env.LookupStruct(string(tt)); ok {
 			return s
 		}
+		if i, ok := env.LookupInterface(string(tt)); ok {
+			return i
+		}
+		if a, ok := env.LookupAlias(string(tt)); ok {
+			return a
+		}
 		return tt
 	case List:
 		return List{Elem: resolveNamedType(tt.Elem, env)}
 	case Map:
 		return Map{Key: resolveNamedType(tt.Key, env), Value: resolveNamedType(tt.Value, env)}
+	case Set:
+		return Set{Elem: resolveNamedType(tt.Elem, env)}
 	case Optional:
 		return Optional{Inner: resolveNamedType(tt.Inner, env)}
 	case Result:
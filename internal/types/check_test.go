@@ -1,9 +1,11 @@
 package types
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/jiejie-dev/funny/v2/internal/ast"
+	"github.com/jiejie-dev/funny/v2/internal/errs"
 	"github.com/jiejie-dev/funny/v2/internal/parser"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -74,6 +76,66 @@ func TestCheck_MapLiteral_LetWithAnnotation(t *testing.T) {
 	assert.True(t, vt.Equal(Map{Key: Primitive("str"), Value: Primitive("int")}))
 }
 
+func TestCheck_MapKeyTypes(t *testing.T) {
+	decls := "struct Point:\n    x: int\n    tags: list[str]\nstruct Handler:\n    run: (int) -> int\n"
+	ok := []string{
+		"let m: map[int, str] = {}",
+		"let m: map[bool, int] = {true: 1}",
+		"let m = {Point(x: 1, tags: [\"a\"]): 1}",
+	}
+	for _, src := range ok {
+		prog, err := parser.New(decls+src+"\n", "t").Parse()
+		require.NoError(t, err)
+		assert.NoError(t, Check(prog, NewEnv(nil)), src)
+	}
+	bad := []string{
+		"let m: map[float, str] = {}",
+		"let m = {1.5: \"x\"}",
+		"let m: list[map[list[int], str]] = []",
+		"let m: map[Handler, int] = {}",
+		"fn f() -> map[float, int]:\n    return {1.5: 1}",
+	}
+	for _, src := range bad {
+		prog, err := parser.New(decls+src+"\n", "t").Parse()
+		require.NoError(t, err)
+		err = Check(prog, NewEnv(nil))
+		require.Error(t, err, src)
+		assert.Contains(t, err.Error(), "E2077", src)
+	}
+}
+
+func TestCheck_SetTypes(t *testing.T) {
+	decls := "struct Point:\n    x: int\n"
+	ok := []string{
+		"let s = set{1, 2}\nlet b: bool = 1 in s",
+		"let s: set[str] = set{}\nfor x in s:\n    let y: str = x",
+		"let s = set{Point(x: 1)}",
+		"let s: set[int] = set_union(to_set([1, 2]), set{3})",
+		"let n: int = len(set_difference(set{1}, set{}))",
+	}
+	for _, src := range ok {
+		prog, err := parser.New(decls+src+"\n", "t").Parse()
+		require.NoError(t, err)
+		assert.NoError(t, Check(prog, NewEnv(nil)), src)
+	}
+	bad := map[string]string{
+		"let s = set{}":                         "E2011",
+		"let s = set{1, \"a\"}":                 "expected int",
+		"let s = set{1.5}":                      "E2078",
+		"let s: set[list[int]] = set{}":         "E2078",
+		"let b = \"a\" in set{1}":               "expected int",
+		"let s = set_union(set{1}, set{\"a\"})": "expected set[int]",
+		"let s = to_set(1)":                     "E2050",
+	}
+	for src, want := range bad {
+		prog, err := parser.New(decls+src+"\n", "t").Parse()
+		require.NoError(t, err)
+		err = Check(prog, NewEnv(nil))
+		require.Error(t, err, src)
+		assert.Contains(t, err.Error(), want, src)
+	}
+}
+
 func TestCheck_IndexExpr_MapReadUsesKeyType(t *testing.T) {
 	env := NewEnv(nil)
 	env.DeclareVar("m", Map{Key: Primitive("str"), Value: Primitive("int")})
@@ -869,6 +931,110 @@ match code:
 	require.Error(t, err)
 }
 
+const matchUserSrc = `struct User:
+    name: str
+    age: int
+fn lookup(id: int) -> Result:
+    return ok(id)
+`
+
+func TestCheck_MatchPatterns_TypeTheirBindings(t *testing.T) {
+	prog, err := parser.New(matchUserSrc+`let u = User(name: "a", age: 3)
+match u:
+    User(name: n, age: a) if a > 18 =>
+        let s: str = n
+    User(name: "root", age: _) | User(name: "admin", age: _) =>
+        let x = 1
+    other =>
+        let y: int = other.age
+match lookup(1):
+    ok(v) =>
+        println(v)
+    err(e) =>
+        println(e)
+`, "").Parse()
+	require.NoError(t, err)
+	require.NoError(t, Check(prog, NewEnv(nil)))
+
+	prog, err = parser.New(matchUserSrc+`let u = User(name: "a", age: 3)
+match u:
+    User(name: n, age: a) =>
+        let s: str = a
+`, "").Parse()
+	require.NoError(t, err)
+	err = Check(prog, NewEnv(nil))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "E2010")
+}
+
+func TestCheck_MatchPatterns_Rejected(t *testing.T) {
+	cases := map[string]string{
+		"ok pattern on a non-Result":    "match 1:\n    ok(v) =>\n        let x = v\n",
+		"unknown struct field":          "let u = User(name: \"a\", age: 3)\nmatch u:\n    User(nick: n) =>\n        let x = n\n",
+		"alternatives bind differently": "match lookup(1):\n    ok(v) | err(e) =>\n        let x = 1\n",
+		"non-bool guard":                "match 1:\n    n if n =>\n        let x = 1\n",
+	}
+	codes := map[string]string{
+		"ok pattern on a non-Result":    "E2063",
+		"unknown struct field":          "E2054",
+		"alternatives bind differently": "E2062",
+		"non-bool guard":                "E2010",
+	}
+	for name, body := range cases {
+		prog, err := parser.New(matchUserSrc+body, "").Parse()
+		require.NoError(t, err, name)
+		err = Check(prog, NewEnv(nil))
+		require.Error(t, err, name)
+		assert.Contains(t, err.Error(), codes[name], name)
+	}
+}
+
+// A pattern that fails to check still declares its names, as Invalid, so
+// only the pattern itself is reported, not every use of its bindings.
+func TestCheck_MatchPatterns_FailedPatternStillBinds(t *testing.T) {
+	cases := map[string]string{
+		"unknown struct":       "match lookup(1):\n    ok(Usr(name: n)) =>\n        println(n)\n",
+		"unknown struct field": "let u = User(name: \"a\", age: 3)\nmatch u:\n    User(nick: n, age: a) if a > 1 =>\n        println(n)\n",
+		"ok on a non-Result":   "match 1:\n    ok(v) =>\n        println(v)\n",
+	}
+	for name, body := range cases {
+		prog, err := parser.New(matchUserSrc+body, "").Parse()
+		require.NoError(t, err, name)
+		err = Check(prog, NewEnv(nil))
+		require.Error(t, err, name)
+		var list errs.List
+		require.True(t, errors.As(err, &list), name)
+		assert.Len(t, list, 1, name)
+		assert.NotContains(t, err.Error(), "E2001", name)
+	}
+}
+
+func TestCheck_Match_UnreachableArms(t *testing.T) {
+	unreachable := []string{
+		"match 1:\n    _ =>\n        let a = 1\n    2 =>\n        let b = 2\n",
+		"match 1:\n    1 | 2 =>\n        let a = 1\n    2 =>\n        let b = 2\n",
+		"match true:\n    true =>\n        let a = 1\n    false =>\n        let b = 2\n    _ =>\n        let c = 3\n",
+		"match lookup(1):\n    ok(_) =>\n        let a = 1\n    err(e) =>\n        let b = 2\n    ok(v) =>\n        let c = 3\n",
+		"match 1:\n    n =>\n        let a = n\n    _ =>\n        let b = 2\n",
+	}
+	for _, body := range unreachable {
+		prog, err := parser.New(matchUserSrc+body, "").Parse()
+		require.NoError(t, err, body)
+		err = Check(prog, NewEnv(nil))
+		require.Error(t, err, body)
+		assert.Contains(t, err.Error(), "E2061", body)
+	}
+	reachable := []string{
+		"match 1:\n    n if n > 2 =>\n        let a = n\n    _ =>\n        let b = 2\n",
+		"match lookup(1):\n    ok(1) =>\n        let a = 1\n    ok(v) =>\n        let b = 2\n    err(_) =>\n        let c = 3\n",
+	}
+	for _, body := range reachable {
+		prog, err := parser.New(matchUserSrc+body, "").Parse()
+		require.NoError(t, err, body)
+		assert.NoError(t, Check(prog, NewEnv(nil)), body)
+	}
+}
+
 func TestCheck_BreakOutsideLoop(t *testing.T) {
 	src := `break
 `
@@ -924,3 +1090,538 @@ func TestCheck_ExprStmt_TypeMismatchInCallArgs(t *testing.T) {
 	err = Check(prog, env)
 	require.Error(t, err)
 }
+
+const counterWithMethods = `struct Counter:
+    mut count: int
+    label: str
+
+    fn get(self) -> int:
+        return self.count
+
+    fn bump(mut self, by: int):
+        self.count = self.count + by
+
+    fn describe(self) -> str:
+        return self.label + to_str(self.get())
+`
+
+func TestCheck_MethodCall_Ok(t *testing.T) {
+	src := counterWithMethods + `
+let c = Counter(count: 0, label: "hits")
+c.bump(2)
+let n: int = c.get()
+let s: str = c.describe()
+`
+	p := parser.New(src, "")
+	prog, err := p.Parse()
+	require.NoError(t, err)
+	env := NewEnv(nil)
+	require.NoError(t, Check(prog, env))
+	s, ok := env.LookupStruct("Counter")
+	require.True(t, ok)
+	m, ok := s.Method("bump")
+	require.True(t, ok)
+	assert.Equal(t, 1, m.Arity(), "self is not part of the method signature")
+}
+
+func TestCheck_MethodCall_Errors(t *testing.T) {
+	cases := []struct {
+		call string
+		want string
+	}{
+		{`c.missing()`, `no method "missing"`},
+		{`c.bump("x")`, "expected int"},
+		{`c.bump()`, "expects 1 args"},
+		{`let n: str = c.get()`, "expected str"},
+	}
+	for _, tc := range cases {
+		src := counterWithMethods + "\nlet c = Counter(count: 0, label: \"hits\")\n" + tc.call + "\n"
+		p := parser.New(src, "")
+		prog, err := p.Parse()
+		require.NoError(t, err, tc.call)
+		err = Check(prog, NewEnv(nil))
+		require.Error(t, err, tc.call)
+		assert.Contains(t, err.Error(), tc.want, tc.call)
+	}
+}
+
+func TestCheck_Method_NonMutSelfCannotAssign(t *testing.T) {
+	src := `struct Counter:
+    mut count: int
+
+    fn reset(self):
+        self.count = 0
+`
+	p := parser.New(src, "")
+	prog, err := p.Parse()
+	require.NoError(t, err)
+	err = Check(prog, NewEnv(nil))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "not `mut self`")
+}
+
+func TestCheck_Method_NonMutSelfCannotCallMutSelfMethod(t *testing.T) {
+	src := `struct Counter:
+    mut count: int
+
+    fn inc(mut self, by: int):
+        self.count = self.count + by
+
+    fn peek(self) -> int:
+        return self.count
+
+    fn bump(mut self) -> int:
+        self.inc(1)
+        return self.peek()
+`
+	prog, err := parser.New(src, "").Parse()
+	require.NoError(t, err)
+	require.NoError(t, Check(prog, NewEnv(nil)), "a `mut self` method may call either kind")
+
+	prog, err = parser.New(src+"\n    fn bad(self):\n        self.inc(1)\n", "").Parse()
+	require.NoError(t, err)
+	err = Check(prog, NewEnv(nil))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cannot call `mut self` method Counter.inc")
+}
+
+func TestCheck_Method_MutSelfStillRespectsImmutableFields(t *testing.T) {
+	src := `struct Counter:
+    label: str
+
+    fn rename(mut self, l: str):
+        self.label = l
+`
+	p := parser.New(src, "")
+	prog, err := p.Parse()
+	require.NoError(t, err)
+	err = Check(prog, NewEnv(nil))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "not mutable")
+}
+
+func TestCheck_Method_NameClashesWithField(t *testing.T) {
+	src := `struct User:
+    name: str
+
+    fn name(self) -> str:
+        return self.name
+`
+	p := parser.New(src, "")
+	prog, err := p.Parse()
+	require.NoError(t, err)
+	err = Check(prog, NewEnv(nil))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "both a field and a method")
+}
+
+const rowInterface = `interface Row:
+    fn to_row(self) -> list[str]
+
+struct User:
+    name: str
+
+    fn to_row(self) -> list[str]:
+        return [self.name]
+
+struct Point:
+    x: int
+    y: int
+
+    fn to_row(self) -> list[str]:
+        return [to_str(self.x), to_str(self.y)]
+
+fn render(r: Row) -> int:
+    return len(r.to_row())
+`
+
+func TestCheck_Interface_StructsSatisfyStructurally(t *testing.T) {
+	src := rowInterface + `
+let a = render(User(name: "ann"))
+let b = render(Point(x: 1, y: 2))
+let r: Row = Point(x: 3, y: 4)
+let rows: list[Row] = [User(name: "bo"), Point(x: 5, y: 6)]
+`
+	prog, err := parser.New(src, "").Parse()
+	require.NoError(t, err)
+	env := NewEnv(nil)
+	require.NoError(t, Check(prog, env))
+	i, ok := env.LookupInterface("Row")
+	require.True(t, ok)
+	_, ok = i.Method("to_row")
+	assert.True(t, ok)
+	r, _ := env.LookupVar("r")
+	assert.Equal(t, "Row", r.String())
+}
+
+func TestCheck_Interface_MissingOrMismatchedMethodRejected(t *testing.T) {
+	cases := []struct {
+		decl string
+		want string
+	}{
+		{"struct Tag:\n    name: str\n", `struct Tag does not implement Row: method "to_row"`},
+		{"struct Tag:\n    name: str\n    fn to_row(self) -> str:\n        return self.name\n", `method "to_row" is missing or has a different signature`},
+	}
+	for _, tc := range cases {
+		src := rowInterface + tc.decl + "render(Tag(name: \"x\"))\n"
+		prog, err := parser.New(src, "").Parse()
+		require.NoError(t, err, tc.decl)
+		err = Check(prog, NewEnv(nil))
+		require.Error(t, err, tc.decl)
+		assert.Contains(t, err.Error(), "E2010", tc.decl)
+		assert.Contains(t, err.Error(), tc.want, tc.decl)
+	}
+}
+
+func TestCheck_Interface_OnlyDeclaredMethodsCallable(t *testing.T) {
+	src := rowInterface + `
+fn bad(r: Row) -> str:
+    return r.name
+`
+	prog, err := parser.New(src, "").Parse()
+	require.NoError(t, err)
+	err = Check(prog, NewEnv(nil))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "E2051")
+
+	src = rowInterface + "fn worse(r: Row):\n    r.to_json()\n"
+	prog, err = parser.New(src, "").Parse()
+	require.NoError(t, err)
+	err = Check(prog, NewEnv(nil))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `interface Row has no method "to_json"`)
+}
+
+func TestAssignableTo_InterfaceVsStruct(t *testing.T) {
+	sig := Func{Return: Primitive("str")}
+	iface := Interface{Name: "Named", Methods: map[string]Func{"name": sig}}
+	yes := Struct{Name: "A", Methods: map[string]Func{"name": sig, "extra": sig}}
+	no := Struct{Name: "B", Methods: map[string]Func{"name": {Return: Primitive("int")}}}
+	assert.True(t, AssignableTo(yes, iface))
+	assert.True(t, AssignableTo(yes, Optional{Inner: iface}))
+	assert.False(t, AssignableTo(iface, yes), "an interface may hold another struct")
+	assert.False(t, AssignableTo(no, iface))
+	assert.False(t, Equal(iface, yes), "Equal is symmetric, so it leaves interfaces out")
+	assert.False(t, Equal(yes, iface))
+	assert.False(t, AssignableTo(iface, Interface{Name: "Other", Methods: iface.Methods}), "interfaces compare by name")
+}
+
+func TestCheck_Interface_NotAssignableToStruct(t *testing.T) {
+	const decls = `interface Named:
+    fn name(self) -> str
+
+struct A:
+    fn name(self) -> str:
+        return "a"
+
+fn want_a(a: A) -> str:
+    return a.name()
+`
+	for _, fn := range []string{
+		"fn first(x: Named) -> str:\n    return want_a(x)\n",
+		"fn first(x: Named) -> str:\n    let a: A = x\n    return a.name()\n",
+		"fn first(x: Named) -> A:\n    return x\n",
+	} {
+		prog, err := parser.New(decls+fn, "").Parse()
+		require.NoError(t, err, fn)
+		err = Check(prog, NewEnv(nil))
+		require.Error(t, err, fn)
+		assert.Contains(t, err.Error(), "E2010", fn)
+		assert.Contains(t, err.Error(), "got Named", fn)
+	}
+}
+
+func TestCheck_StructDefaults_FillOmittedFields(t *testing.T) {
+	src := "struct User:\n    name: str\n    age: int = 18\nlet u = User(name: \"a\")\nlet n: int = u.age\n"
+	prog, err := parser.New(src, "").Parse()
+	require.NoError(t, err)
+	env := NewEnv(nil)
+	require.NoError(t, Check(prog, env))
+	s, ok := env.LookupStruct("User")
+	require.True(t, ok)
+	assert.True(t, s.HasDefault("age"))
+	assert.False(t, s.HasDefault("name"))
+
+	prog, err = parser.New("struct User:\n    name: str\n    age: int = 18\nlet u = User(age: 3)\n", "").Parse()
+	require.NoError(t, err)
+	err = Check(prog, NewEnv(nil))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "E2057")
+	assert.Contains(t, err.Error(), "name")
+}
+
+func TestCheck_StructDefaults_EmptyCallBuildsStruct(t *testing.T) {
+	src := "struct Bag:\n    items: list[int] = []\n    label: str = \"bag\"\nlet b = Bag()\nlet l: str = b.label\n"
+	prog, err := parser.New(src, "").Parse()
+	require.NoError(t, err)
+	env := NewEnv(nil)
+	require.NoError(t, Check(prog, env))
+	b, _ := env.LookupVar("b")
+	assert.Equal(t, "Bag", b.(Struct).Name)
+
+	prog, err = parser.New("struct User:\n    name: str\n    age: int = 18\nlet u = User()\n", "").Parse()
+	require.NoError(t, err)
+	err = Check(prog, NewEnv(nil))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "E2057", "a field without a default is still required")
+}
+
+func TestCheck_StructDefaults_Rejected(t *testing.T) {
+	cases := []struct{ src, want string }{
+		{"struct User:\n    age: int = \"old\"\n", "E2010"},
+		{"let base = 1\nstruct User:\n    age: int = base\n", "E2001"},
+	}
+	for _, tc := range cases {
+		prog, err := parser.New(tc.src, "").Parse()
+		require.NoError(t, err, tc.src)
+		err = Check(prog, NewEnv(nil))
+		require.Error(t, err, tc.src)
+		assert.Contains(t, err.Error(), tc.want, tc.src)
+	}
+}
+
+func TestCheck_TypeAlias_IsTransparent(t *testing.T) {
+	src := "type UserId = str\ntype Ids = list[UserId]\nfn first(ids: Ids) -> UserId:\n    return ids[0]\nlet s: str = first([\"a\"])\n"
+	prog, err := parser.New(src, "").Parse()
+	require.NoError(t, err)
+	env := NewEnv(nil)
+	require.NoError(t, Check(prog, env))
+	tgt, ok := env.LookupAlias("Ids")
+	require.True(t, ok)
+	assert.Equal(t, "list[str]", tgt.String())
+
+	for _, bad := range []string{"type int = str\n", "type UserId = str\nlet n: UserId = 1\n"} {
+		prog, err := parser.New(bad, "").Parse()
+		require.NoError(t, err, bad)
+		require.Error(t, Check(prog, NewEnv(nil)), bad)
+	}
+	prog, err = parser.New("type int = str\n", "").Parse()
+	require.NoError(t, err)
+	assert.Contains(t, Check(prog, NewEnv(nil)).Error(), "E2059")
+}
+
+func TestCheck_ValidateHook(t *testing.T) {
+	src := `struct Age:
+    n: int
+
+    fn validate(self) -> Result:
+        if self.n < 0:
+            return err("negative")
+        return ok(self)
+
+let a = Age(n: 3)
+
+fn make(n: int) -> Result:
+    return Age(n: n)
+`
+	prog, err := parser.New(src, "").Parse()
+	require.NoError(t, err)
+	env := NewEnv(nil)
+	require.NoError(t, Check(prog, env))
+	at, ok := env.LookupVar("a")
+	require.True(t, ok)
+	r, ok := at.(Result)
+	require.True(t, ok, "constructing a struct with validate yields a Result")
+	assert.Equal(t, "Age", r.Ok.(Struct).Name)
+	assert.Equal(t, Primitive("str"), r.Err)
+
+	bad := "struct Age:\n    n: int\n\n    fn validate(self) -> bool:\n        return true\n"
+	prog, err = parser.New(bad, "").Parse()
+	require.NoError(t, err)
+	err = Check(prog, NewEnv(nil))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "E2058")
+}
+
+func TestCheck_ReportsEveryError(t *testing.T) {
+	src := `let a: int = "x"
+let b = a + undefined1
+fn f(n: int) -> str:
+    let y = nope(n)
+    return n
+for x in 5:
+    println(x.foo)
+let p = missing_fn()
+let q = p.field + b
+`
+	prog, err := parser.New(src, "t.fn").Parse()
+	require.NoError(t, err)
+	env := NewEnv(nil)
+	err = Check(prog, env)
+	require.Error(t, err)
+	var list errs.List
+	require.True(t, errors.As(err, &list))
+	var codes []string
+	var lines []int
+	for _, e := range list {
+		codes = append(codes, e.Code)
+		lines = append(lines, e.Pos.Line)
+	}
+	assert.Equal(t, []string{"E2010", "E2001", "E2002", "E2010", "E2050", "E2002"}, codes)
+	assert.Equal(t, []int{0, 1, 3, 4, 5, 7}, lines, "poisoned values (x, p) don't cascade")
+	_, ok := env.LookupFunc("f")
+	assert.True(t, ok)
+	assert.Contains(t, err.Error(), "undefined variable: undefined1")
+	assert.Contains(t, err.Error(), "for-in requires list")
+}
+
+func TestCheck_BadSignatureStillDeclaresFunction(t *testing.T) {
+	src := "fn f(n) -> int:\n    return 1\nlet x: int = f(2)\nlet y: str = f(3)\n"
+	prog, err := parser.New(src, "").Parse()
+	require.NoError(t, err)
+	err = Check(prog, NewEnv(nil))
+	require.Error(t, err)
+	var list errs.List
+	require.True(t, errors.As(err, &list))
+	require.Len(t, list, 2)
+	assert.Equal(t, "E2013", list[0].Code)
+	assert.Equal(t, "E2010", list[1].Code)
+}
+
+func TestCheck_Range(t *testing.T) {
+	env := NewEnv(nil)
+	env.DeclareVar("n", Primitive("int"))
+	got, err := CheckExpr(parseExpr(t, `0..n step 2`), env)
+	require.NoError(t, err)
+	assert.Equal(t, List{Elem: Primitive("int")}, got)
+
+	_, err = CheckExpr(parseExpr(t, `0.."a"`), env)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "E2010")
+	_, err = CheckExpr(parseExpr(t, `0..n step 0`), env)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "E2060")
+
+	// A step folded from constants is caught too; one only known at
+	// runtime is left to the runtime.
+	prog, err := parser.New("const STEP = 2\nfor i in 0..4 step STEP - 2 * 1:\n    print(i)\n", "").Parse()
+	require.NoError(t, err)
+	err = Check(prog, NewEnv(nil))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "E2060")
+	_, err = CheckExpr(parseExpr(t, `0..4 step n - n`), env)
+	assert.NoError(t, err)
+}
+
+func TestCheck_Slice(t *testing.T) {
+	env := NewEnv(nil)
+	env.DeclareVar("xs", List{Elem: Primitive("int")})
+	env.DeclareVar("s", Primitive("str"))
+	got, err := CheckExpr(parseExpr(t, `xs[1:-1]`), env)
+	require.NoError(t, err)
+	assert.Equal(t, List{Elem: Primitive("int")}, got)
+	got, err = CheckExpr(parseExpr(t, `s[:2]`), env)
+	require.NoError(t, err)
+	assert.Equal(t, Primitive("str"), got)
+
+	_, err = CheckExpr(parseExpr(t, `xs["a":]`), env)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "E2010")
+	env.DeclareVar("m", Map{Key: Primitive("str"), Value: Primitive("int")})
+	_, err = CheckExpr(parseExpr(t, `m[1:]`), env)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "E2050")
+}
+
+func TestCheck_Defer(t *testing.T) {
+	ok := []string{
+		"fn f(n: int):\n    defer println(n)\n    if n > 0:\n        defer println(n - 1)\n",
+		"plan \"p\":\n    step \"s\":\n        defer println(1)\n",
+	}
+	for _, src := range ok {
+		prog, err := parser.New(src, "").Parse()
+		require.NoError(t, err, src)
+		assert.NoError(t, Check(prog, NewEnv(nil)), src)
+	}
+	bad := map[string]string{
+		"defer println(1)\n":                                                   "E2064",
+		"plan \"p\":\n    defer println(1)\n":                                  "E2064",
+		"fn f():\n    defer println(nope)\n":                                   "E2001",
+		"plan \"p\":\n    step \"s\" -> parallel:\n        defer println(1)\n": "E2064",
+	}
+	for src, code := range bad {
+		prog, err := parser.New(src, "").Parse()
+		require.NoError(t, err, src)
+		err = Check(prog, NewEnv(nil))
+		require.Error(t, err, src)
+		assert.Contains(t, err.Error(), code, src)
+	}
+}
+
+func TestCheck_Const(t *testing.T) {
+	ok := []string{
+		"const A = 2\nconst B = A * 3 + 1\nlet x: int = B\n",
+		"const NAME = \"n\" + \"x\"\nconst ON = not false\nfn f() -> str:\n    return NAME\n",
+		"const LIMIT = 3\nmatch 3:\n    LIMIT =>\n        println(1)\n    _ =>\n        println(2)\n",
+		"const A = 1\nfn f():\n    let A = \"shadow\"\n    A = \"ok\"\n",
+	}
+	for _, src := range ok {
+		prog, err := parser.New(src, "").Parse()
+		require.NoError(t, err, src)
+		assert.NoError(t, Check(prog, NewEnv(nil)), src)
+	}
+	bad := map[string]string{
+		"const A = 1\nA = 2\n":              "E2065",
+		"const A = 1\nfn f():\n    A = 2\n": "E2065",
+		"const A = 1\nconst A = 2\n":        "E2065",
+		"const A = 1\nlet A = 2\n":          "E2065",
+		"let x = 1\nconst A = x + 1\n":      "E2066",
+		"const A = len(\"ab\")\n":           "E2066",
+		"const A = [1, 2]\n":                "E2066",
+		"fn f():\n    const A = 1\n":        "E2067",
+		"const LIMIT = 3\nmatch \"s\":\n    LIMIT =>\n        println(1)\n": "E2010",
+	}
+	for src, code := range bad {
+		prog, err := parser.New(src, "").Parse()
+		require.NoError(t, err, src)
+		err = Check(prog, NewEnv(nil))
+		require.Error(t, err, src)
+		assert.Contains(t, err.Error(), code, src)
+	}
+}
+
+func TestCheck_Attributes(t *testing.T) {
+	ok := []string{
+		"@deprecated\n@tool(\"adds\")\n@custom(1, 2.5)\nfn f():\n    println(1)\n",
+		"@test_only\nfn fake() -> int:\n    return 1\n@test_only\nfn fake2() -> int:\n    return fake()\ntest \"t\":\n    assert_eq(fake2(), 1)\n",
+		"@test_only\nstruct Fake:\n    x: int\ntest \"t\":\n    let f = Fake(x: 1)\n",
+		"plan \"p\":\n    @tool(description: \"fetch\")\n    @deprecated(message: \"old\")\n    step \"s\":\n        println(1)\n",
+	}
+	for _, src := range ok {
+		prog, err := parser.New(src, "").Parse()
+		require.NoError(t, err, src)
+		assert.NoError(t, Check(prog, NewEnv(nil)), src)
+	}
+	bad := map[string]string{
+		"@deprecated(1)\nfn f():\n    println(1)\n":                                                                       "E2068",
+		"@tool\nfn f():\n    println(1)\n":                                                                                "E2068",
+		"@tool(name: \"x\")\nfn f():\n    println(1)\n":                                                                   "E2068",
+		"@test_only(true)\nfn f():\n    println(1)\n":                                                                     "E2068",
+		"plan \"p\":\n    @test_only\n    step \"s\":\n        println(1)\n":                                              "E2068",
+		"@test_only\nfn fake() -> int:\n    return 1\nlet x = fake()\n":                                                   "E2069",
+		"@test_only\nstruct Fake:\n    x: int\nlet f = Fake(x: 1)\n":                                                      "E2069",
+		"struct S:\n    x: int\n    @test_only\n    fn dbg(self) -> int:\n        return self.x\nlet v = S(x: 1).dbg()\n": "E2069",
+	}
+	for src, code := range bad {
+		prog, err := parser.New(src, "").Parse()
+		require.NoError(t, err, src)
+		err = Check(prog, NewEnv(nil))
+		require.Error(t, err, src)
+		assert.Contains(t, err.Error(), code, src)
+	}
+}
+
+func TestCheck_Attributes_UnknownOnesWarn(t *testing.T) {
+	src := "@descripton(\"adds\")\nfn f():\n    println(1)\nstruct S:\n    @jsn(\"x\")\n    x: int\nplan \"p\":\n    @tool_only\n    step \"s\":\n        println(1)\n"
+	prog, err := parser.New(src, "").Parse()
+	require.NoError(t, err)
+	env := NewEnv(nil)
+	require.NoError(t, Check(prog, env), "an unknown attribute is still kept for outside tools")
+	ws := env.Warnings()
+	require.Len(t, ws, 3)
+	for i, name := range []string{"@descripton", "@jsn", "@tool_only"} {
+		assert.Equal(t, "W2002", ws[i].Code)
+		assert.Equal(t, "unknown attribute "+name, ws[i].Message)
+	}
+	assert.Contains(t, ws[0].Hint, "@deprecated, @tool, @json and @test_only")
+}
@@ -0,0 +1,121 @@
+package types
+
+import (
+	"fmt"
+
+	"github.com/jiejie-dev/funny/v2/internal/ast"
+)
+
+// constOperators are the operators a constant's value may use; the
+// compiler folds each of them (see compiler.foldBinary).
+var constOperators = map[string]bool{
+	"+": true, "-": true, "*": true, "/": true, "%": true,
+	"==": true, "!=": true, "<": true, ">": true, "<=": true, ">=": true,
+	"and": true, "or": true, "not": true,
+}
+
+// checkConst checks a `const` declaration. Constants live at module level
+// only (the env Check was called with), can't be redeclared, and must be
+// an int, float, str or bool computed from literals and earlier constants
+// (E2066), so the compiler can fold every use into a PUSH_*.
+func checkConst(n *ast.ConstDecl, env *Env) error {
+	if env.reported == nil {
+		return New("E2067", fmt.Sprintf("const %s must be declared at module level", n.Name), n.NodePos)
+	}
+	if _, dup := env.vars[n.Name]; dup {
+		return New("E2065", fmt.Sprintf("%s is already declared", n.Name), n.NodePos)
+	}
+	if part := nonConstPart(n.Value, env); part != nil {
+		env.DeclareConst(n.Name, Invalid{})
+		return New("E2066", fmt.Sprintf("const %s: `%s` is not a compile-time constant", n.Name, part), part.Pos())
+	}
+	t, err := checkOperand(n.Value, env)
+	if err != nil {
+		env.DeclareConst(n.Name, Invalid{})
+		return err
+	}
+	switch t {
+	case Primitive("int"), Primitive("float"), Primitive("str"), Primitive("bool"):
+	default:
+		if !isInvalid(t) {
+			env.DeclareConst(n.Name, Invalid{})
+			return New("E2066", fmt.Sprintf("const %s must be an int, float, str or bool, got %s", n.Name, t), n.NodePos)
+		}
+	}
+	env.DeclareConst(n.Name, t)
+	env.setConstValue(n.Name, n.Value)
+	return nil
+}
+
+// constInt evaluates an int expression made of literals, constants and
+// the arithmetic constOperators, as the compiler would fold it. ok is
+// false for anything else, and for a division by zero.
+func constInt(e ast.Expression, env *Env) (v int, ok bool) {
+	switch n := e.(type) {
+	case *ast.LiteralExpr:
+		v, ok = n.Value.(int)
+		return v, ok
+	case *ast.VariableExpr:
+		if value, isConst := env.constValue(n.Name); isConst {
+			return constInt(value, env)
+		}
+	case *ast.SubExpr:
+		return constInt(n.Inner, env)
+	case *ast.UnaryExpr:
+		if x, ok := constInt(n.Expr, env); ok && n.Op == "-" {
+			return -x, true
+		}
+	case *ast.BinaryExpr:
+		l, lok := constInt(n.Left, env)
+		r, rok := constInt(n.Right, env)
+		if !lok || !rok {
+			return 0, false
+		}
+		switch n.Op {
+		case "+":
+			return l + r, true
+		case "-":
+			return l - r, true
+		case "*":
+			return l * r, true
+		case "/", "%":
+			if r == 0 {
+				return 0, false
+			}
+			if n.Op == "/" {
+				return l / r, true
+			}
+			return l % r, true
+		}
+	}
+	return 0, false
+}
+
+// nonConstPart returns the first part of e that can't be evaluated at
+// compile time, or nil if there is none.
+func nonConstPart(e ast.Expression, env *Env) ast.Expression {
+	switch n := e.(type) {
+	case *ast.LiteralExpr:
+		if n.Value != nil {
+			return nil
+		}
+	case *ast.VariableExpr:
+		if env.IsConst(n.Name) {
+			return nil
+		}
+	case *ast.SubExpr:
+		return nonConstPart(n.Inner, env)
+	case *ast.UnaryExpr:
+		if constOperators[n.Op] {
+			return nonConstPart(n.Expr, env)
+		}
+	case *ast.BinaryExpr:
+		if constOperators[n.Op] {
+			if part := nonConstPart(n.Left, env); part != nil {
+				return part
+			}
+			return nonConstPart(n.Right, env)
+		}
+	}
+	return e
+}
@@ -1,21 +1,44 @@
 package types
 
-// Env is a type environment that tracks variables, functions, and structs.
+import (
+	"github.com/jiejie-dev/funny/v2/internal/ast"
+	"github.com/jiejie-dev/funny/v2/internal/errs"
+)
+
+// Env is a type environment that tracks variables, functions, structs,
+// and interfaces.
 type Env struct {
-	parent    *Env
-	vars      map[string]Type
-	funcs     map[string]Func
-	structs   map[string]Struct
-	loopDepth int // nesting depth of for/while loops for break/continue checking
+	parent     *Env
+	vars       map[string]Type
+	consts     map[string]bool           // names in vars declared by `const`
+	constVals  map[string]ast.Expression // the value of each valid constant in consts
+	testOnly   map[string]bool           // `@test_only` functions, methods (Struct.method) and structs
+	funcs      map[string]Func
+	structs    map[string]Struct
+	interfaces map[string]Interface
+	aliases    map[string]Type
+	hideVars   bool                    // LookupVar stops here (see WithoutOuterVars)
+	loopDepth  int                     // nesting depth of for/while loops for break/continue checking
+	canDefer   bool                    // a function or plan step body: `defer` is allowed
+	inTest     bool                    // a `test` block or `@test_only` body: test-only names are usable
+	selfIsRO   bool                    // a method body whose receiver isn't `mut self`
+	reported   *[]error                // errors collected by the running Check (root env only)
+	warned     *[]error                // warnings collected by the running Check (root env only)
+	exhaustive map[*ast.MatchStmt]bool // matches whose arms cover every value (root env only)
+	warnings   errs.List               // warnings from the last Check over this env
 }
 
 // NewEnv creates a new Env, optionally nested inside parent.
 func NewEnv(parent *Env) *Env {
 	return &Env{
-		parent:  parent,
-		vars:    map[string]Type{},
-		funcs:   map[string]Func{},
-		structs: map[string]Struct{},
+		parent:     parent,
+		vars:       map[string]Type{},
+		consts:     map[string]bool{},
+		testOnly:   map[string]bool{},
+		funcs:      map[string]Func{},
+		structs:    map[string]Struct{},
+		interfaces: map[string]Interface{},
+		aliases:    map[string]Type{},
 	}
 }
 
@@ -31,17 +54,172 @@ func (e *Env) InLoop() bool {
 	return e.loopDepth > 0
 }
 
+// InDeferScope reports whether `defer` is valid here: somewhere inside a
+// function or plan step body.
+func (e *Env) InDeferScope() bool {
+	for env := e; env != nil; env = env.parent {
+		if env.canDefer {
+			return true
+		}
+	}
+	return false
+}
+
+// InTestScope reports whether `@test_only` declarations may be used here:
+// inside a `test` block or the body of another `@test_only` declaration.
+func (e *Env) InTestScope() bool {
+	for env := e; env != nil; env = env.parent {
+		if env.inTest {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadOnlySelf reports whether `self` here is the receiver of a method
+// not declared `mut self`, through which nothing may be mutated.
+func (e *Env) ReadOnlySelf() bool {
+	for env := e; env != nil; env = env.parent {
+		if env.selfIsRO {
+			return true
+		}
+	}
+	return false
+}
+
+// DeclareTestOnly marks a function, method (as "Struct.method") or struct
+// as `@test_only`.
+func (e *Env) DeclareTestOnly(name string) {
+	e.testOnly[name] = true
+}
+
+// IsTestOnly reports whether name was declared `@test_only`.
+func (e *Env) IsTestOnly(name string) bool {
+	for env := e; env != nil; env = env.parent {
+		if env.testOnly[name] {
+			return true
+		}
+	}
+	return false
+}
+
+// WithoutOuterVars returns a child env in which no enclosing variable is
+// visible (functions and types still are). Struct field defaults are
+// checked in one, since they are evaluated wherever a literal omits the
+// field rather than where the struct is declared.
+func (e *Env) WithoutOuterVars() *Env {
+	child := NewEnv(e)
+	child.hideVars = true
+	return child
+}
+
+// report records err with the Check running over this env (or an
+// enclosing one). It returns false when there is none, e.g. when CheckExpr
+// is called directly; the caller then returns err as usual.
+func (e *Env) report(err error) bool {
+	for env := e; env != nil; env = env.parent {
+		if env.reported != nil {
+			*env.reported = append(*env.reported, err)
+			return true
+		}
+	}
+	return false
+}
+
+// warn records a warning with the Check running over this env (or an
+// enclosing one); without one it is dropped.
+func (e *Env) warn(w error) {
+	for env := e; env != nil; env = env.parent {
+		if env.warned != nil {
+			*env.warned = append(*env.warned, w)
+			return
+		}
+	}
+}
+
+// Warnings returns the warnings found by the last Check over e, such as
+// unreachable code. They don't make Check fail.
+func (e *Env) Warnings() errs.List {
+	return e.warnings
+}
+
+// markExhaustive records that m's unguarded arms cover every value of its
+// scrutinee, for the flow analysis in flow.go.
+func (e *Env) markExhaustive(m *ast.MatchStmt) {
+	for env := e; env != nil; env = env.parent {
+		if env.exhaustive != nil {
+			env.exhaustive[m] = true
+			return
+		}
+	}
+}
+
+// isExhaustive reports whether m was marked by markExhaustive.
+func (e *Env) isExhaustive(m *ast.MatchStmt) bool {
+	for env := e; env != nil; env = env.parent {
+		if env.exhaustive != nil {
+			return env.exhaustive[m]
+		}
+	}
+	return false
+}
+
 // DeclareVar defines a variable in this scope (no parent traversal).
 func (e *Env) DeclareVar(name string, t Type) {
 	e.vars[name] = t
 }
 
+// DeclareConst defines a constant in this scope: a variable that can't be
+// reassigned.
+func (e *Env) DeclareConst(name string, t Type) {
+	e.vars[name] = t
+	e.consts[name] = true
+}
+
+// setConstValue records the expression the constant name was declared
+// with, for constInt.
+func (e *Env) setConstValue(name string, value ast.Expression) {
+	if e.constVals == nil {
+		e.constVals = map[string]ast.Expression{}
+	}
+	e.constVals[name] = value
+}
+
+// constValue returns the expression name was declared with if it
+// resolves to a valid constant.
+func (e *Env) constValue(name string) (ast.Expression, bool) {
+	for env := e; env != nil; env = env.parent {
+		if _, ok := env.vars[name]; ok {
+			v, isConst := env.constVals[name]
+			return v, isConst
+		}
+		if env.hideVars {
+			return nil, false
+		}
+	}
+	return nil, false
+}
+
+// IsConst reports whether name resolves to a constant, rather than to a
+// variable (or to a binding that shadows a constant).
+func (e *Env) IsConst(name string) bool {
+	for env := e; env != nil; env = env.parent {
+		if _, ok := env.vars[name]; ok {
+			return env.consts[name]
+		}
+		if env.hideVars {
+			return false
+		}
+	}
+	return false
+}
+
 // LookupVar finds a variable, walking up parent scopes.
 func (e *Env) LookupVar(name string) (Type, bool) {
 	if t, ok := e.vars[name]; ok {
 		return t, true
 	}
-	if e.parent != nil {
+	if e.parent != nil && !e.hideVars {
 		return e.parent.LookupVar(name)
 	}
 	return nil, false
@@ -79,6 +257,39 @@ func (e *Env) LookupStruct(name string) (Struct, bool) {
 	return Struct{}, false
 }
 
+// DeclareInterface registers an interface type in this scope.
+func (e *Env) DeclareInterface(name string, i Interface) {
+	e.interfaces[name] = i
+}
+
+// LookupInterface finds an interface type by name.
+func (e *Env) LookupInterface(name string) (Interface, bool) {
+	if i, ok := e.interfaces[name]; ok {
+		return i, true
+	}
+	if e.parent != nil {
+		return e.parent.LookupInterface(name)
+	}
+	return Interface{}, false
+}
+
+// DeclareAlias registers a type alias in this scope. t is the alias's
+// already-resolved target type.
+func (e *Env) DeclareAlias(name string, t Type) {
+	e.aliases[name] = t
+}
+
+// LookupAlias finds a type alias's target by name.
+func (e *Env) LookupAlias(name string) (Type, bool) {
+	if t, ok := e.aliases[name]; ok {
+		return t, true
+	}
+	if e.parent != nil {
+		return e.parent.LookupAlias(name)
+	}
+	return nil, false
+}
+
 // Funcs returns the functions declared directly in this scope (not
 // including parent scopes). Used by tooling (e.g. the LSP server) that
 // needs to enumerate available symbols; not used by the type checker
@@ -93,6 +304,18 @@ func (e *Env) Structs() map[string]Struct {
 	return e.structs
 }
 
+// Interfaces returns the interface types declared directly in this scope
+// (not including parent scopes). See Funcs for usage notes.
+func (e *Env) Interfaces() map[string]Interface {
+	return e.interfaces
+}
+
+// Aliases returns the type aliases declared directly in this scope (not
+// including parent scopes). See Funcs for usage notes.
+func (e *Env) Aliases() map[string]Type {
+	return e.aliases
+}
+
 // Vars returns the variables declared directly in this scope (not
 // including parent scopes). See Funcs for usage notes.
 func (e *Env) Vars() map[string]Type {
@@ -110,6 +333,12 @@ func (e *Env) Has(name string) bool {
 	if _, ok := e.structs[name]; ok {
 		return true
 	}
+	if _, ok := e.interfaces[name]; ok {
+		return true
+	}
+	if _, ok := e.aliases[name]; ok {
+		return true
+	}
 	if e.parent != nil {
 		return e.parent.Has(name)
 	}
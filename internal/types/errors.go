@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/jiejie-dev/funny/v2/internal/ast"
+	"github.com/jiejie-dev/funny/v2/internal/errs"
 )
 
 // Error is a type-checking error.
@@ -22,15 +23,36 @@ func New(code, msg string, pos ast.Pos) *Error {
 }
 
 // NewMismatch creates a type-mismatch error with both types annotated.
+// When a struct fails to satisfy an interface, the hint names the method
+// it is missing (or declares with the wrong signature).
 func NewMismatch(pos ast.Pos, expected, actual Type) *Error {
+	hint := fmt.Sprintf("expected %s here", expected)
+	if i, ok := expected.(Interface); ok {
+		if s, ok := actual.(Struct); ok {
+			if m := i.MissingMethod(s); m != "" {
+				hint = fmt.Sprintf("struct %s does not implement %s: method %q is missing or has a different signature", s.Name, i.Name, m)
+			}
+		}
+	}
 	return &Error{
 		Code:     "E2010",
 		Message:  fmt.Sprintf("type mismatch: expected %s, got %s", expected, actual),
 		Pos:      pos,
 		Expected: expected,
 		Actual:   actual,
-		Hint:     fmt.Sprintf("expected %s here", expected),
+		Hint:     hint,
+	}
+}
+
+// ToErrs converts e to the shared *errs.Error form, folding the expected and
+// actual types into the message the same way Format does.
+func (e *Error) ToErrs() *errs.Error {
+	msg := e.Message
+	if e.Expected != nil && e.Actual != nil {
+		msg = fmt.Sprintf("%s: expected %s, got %s", e.Message, e.Expected, e.Actual)
 	}
+	pos := errs.Position{File: e.Pos.File, Line: e.Pos.Line, Col: e.Pos.Col}
+	return errs.New(e.Code, msg, pos, e.Hint)
 }
 
 // Error implements the error interface.
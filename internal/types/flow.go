@@ -0,0 +1,199 @@
+package types
+
+import (
+	"fmt"
+
+	"github.com/jiejie-dev/funny/v2/internal/ast"
+)
+
+// completes reports whether control can continue past s. It can't past a
+// `return`, `break` or `continue`; an if/elif/else whose every branch
+// can't complete; an exhaustive match (see Env.markExhaustive) whose every
+// arm can't; or a `while true` loop with no `break` out of it. s must
+// already have been checked, so its match coverage is known.
+func completes(s ast.Statement, env *Env) bool {
+	switch n := s.(type) {
+	case *ast.ReturnStmt, *ast.BreakStmt, *ast.ContinueStmt:
+		return false
+	case *ast.IfStmt:
+		if n.ElseBlock == nil {
+			return true
+		}
+		for b := n; b != nil; b = b.ElseIf {
+			if fallsThrough(b.Then, env) {
+				return true
+			}
+		}
+		return fallsThrough(n.ElseBlock, env)
+	case *ast.MatchStmt:
+		if !env.isExhaustive(n) {
+			return true
+		}
+		for _, arm := range n.Arms {
+			if fallsThrough(arm.Body, env) {
+				return true
+			}
+		}
+		return false
+	case *ast.WhileStmt:
+		lit, ok := n.Cond.(*ast.LiteralExpr)
+		return !ok || lit.Value != true || breaksOut(n.Body)
+	}
+	return true
+}
+
+// fallsThrough reports whether control can run off the end of b.
+func fallsThrough(b *ast.Block, env *Env) bool {
+	if b == nil {
+		return true
+	}
+	for _, s := range b.Statements {
+		if !completes(s, env) {
+			return false
+		}
+	}
+	return true
+}
+
+// breaksOut reports whether a loop body holds a `break` for that loop,
+// rather than for a loop nested inside it.
+func breaksOut(b *ast.Block) bool {
+	if b == nil {
+		return false
+	}
+	for _, s := range b.Statements {
+		switch n := s.(type) {
+		case *ast.BreakStmt:
+			return true
+		case *ast.IfStmt:
+			for e := n; e != nil; e = e.ElseIf {
+				if breaksOut(e.Then) {
+					return true
+				}
+			}
+			if breaksOut(n.ElseBlock) {
+				return true
+			}
+		case *ast.MatchStmt:
+			for _, arm := range n.Arms {
+				if breaksOut(arm.Body) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// warnUnreachable warns (W2001) at the first statement of rest, which
+// follows one that never completes. Comments don't count. It reports
+// whether there was a statement to warn about.
+func warnUnreachable(rest []ast.Statement, env *Env) bool {
+	for _, s := range rest {
+		if _, ok := s.(*ast.CommentStmt); ok {
+			continue
+		}
+		w := New("W2001", "unreachable code", s.Pos())
+		w.Hint = "the statement before it always returns, breaks or continues"
+		env.warn(w)
+		return true
+	}
+	return false
+}
+
+// checkAllPathsReturn reports a function declared to return a value whose
+// body can run off the end, which would return nil instead (E2074).
+func checkAllPathsReturn(n *ast.FnDecl, ret Type, env *Env) error {
+	if isInvalid(ret) || Equal(ret, Primitive("nil")) || !fallsThrough(n.Body, env) {
+		return nil
+	}
+	err := New("E2074", fmt.Sprintf("missing return: function %s can reach the end of its body without returning %s", n.Name, ret), n.NodePos)
+	err.Hint = "add a `return` at the end of the body, or an `else` branch that returns"
+	return err
+}
+
+// Kinds of value a step body can leave when it finishes; see stepOutcomes.
+const (
+	withValue uint8 = 1 << iota
+	withoutValue
+)
+
+// stepOutcomes walks a plan step body: the body's value is that of its
+// last statement run, a bare expression or `return <value>` giving one and
+// anything else not. It returns what the paths ending in a `return` leave
+// (returned) and what those that run off the end leave (last; zero when
+// none can). Like completes, it needs b checked, for match coverage.
+func stepOutcomes(b *ast.Block, env *Env) (returned, last uint8) {
+	last = withoutValue
+	if b == nil {
+		return returned, last
+	}
+	for _, s := range b.Statements {
+		switch n := s.(type) {
+		case *ast.ReturnStmt:
+			if n.Value != nil {
+				return returned | withValue, 0
+			}
+			return returned | withoutValue, 0
+		case *ast.ExprStmt:
+			last = withValue
+		case *ast.IfStmt:
+			last = 0
+			for e := n; e != nil; e = e.ElseIf {
+				r, l := stepOutcomes(e.Then, env)
+				returned, last = returned|r, last|l
+			}
+			if n.ElseBlock != nil {
+				r, l := stepOutcomes(n.ElseBlock, env)
+				returned, last = returned|r, last|l
+			} else {
+				last |= withoutValue
+			}
+			if last == 0 {
+				return returned, 0
+			}
+		case *ast.MatchStmt:
+			last = 0
+			for _, arm := range n.Arms {
+				r, l := stepOutcomes(arm.Body, env)
+				returned, last = returned|r, last|l
+			}
+			if !env.isExhaustive(n) {
+				last |= withoutValue
+			}
+			if last == 0 {
+				return returned, 0
+			}
+		case *ast.WhileStmt:
+			r, _ := stepOutcomes(n.Body, env)
+			returned |= r
+			last = withoutValue
+			if lit, ok := n.Cond.(*ast.LiteralExpr); ok && lit.Value == true {
+				return returned, 0
+			}
+		case *ast.ForStmt:
+			r, _ := stepOutcomes(n.Body, env)
+			returned |= r
+			last = withoutValue
+		default:
+			last = withoutValue
+		}
+	}
+	return returned, last
+}
+
+// checkStepResult reports a `guard` or `transform` step - one whose value
+// is consumed, as the guard's assertion or the next step's __result - that
+// leaves a value on some paths but not on others (E2075).
+func checkStepResult(s *ast.Step, env *Env) error {
+	if s.Kind != ast.StepGuard && s.Kind != ast.StepTransform {
+		return nil
+	}
+	returned, last := stepOutcomes(s.Body, env)
+	if returned|last != withValue|withoutValue {
+		return nil
+	}
+	err := New("E2075", fmt.Sprintf("step %q produces a value on some paths but not others", s.Name), s.NodePos)
+	err.Hint = "end every path in a bare expression or `return <value>`, e.g. add an `else` branch"
+	return err
+}
@@ -0,0 +1,148 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/jiejie-dev/funny/v2/internal/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// checkFlow checks src and returns the env holding its warnings and the
+// error.
+func checkFlow(t *testing.T, src string) (*Env, error) {
+	t.Helper()
+	prog, err := parser.New(src, "").Parse()
+	require.NoError(t, err)
+	env := NewEnv(nil)
+	return env, Check(prog, env)
+}
+
+func TestCheck_MissingReturn(t *testing.T) {
+	missing := map[string]string{
+		"if without else":       "fn f(x: int) -> int:\n    if x > 0:\n        return 1\n",
+		"elif without else":     "fn f(x: int) -> int:\n    if x > 0:\n        return 1\n    elif x < 0:\n        return 2\n",
+		"branch falls through":  "fn f(x: int) -> int:\n    if x > 0:\n        return 1\n    else:\n        let y = 2\n",
+		"empty body":            "fn f() -> str:\n    pass\n",
+		"loop may not run":      "fn f(xs: list[int]) -> int:\n    for x in xs:\n        return x\n",
+		"while true with break": "fn f() -> int:\n    while true:\n        break\n",
+		"non-exhaustive match":  "fn f(x: int) -> int:\n    match x:\n        1 =>\n            return 1\n        2 =>\n            return 2\n",
+	}
+	for name, src := range missing {
+		t.Run(name, func(t *testing.T) {
+			_, err := checkFlow(t, src)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), "E2074")
+		})
+	}
+}
+
+func TestCheck_AllPathsReturn(t *testing.T) {
+	ok := map[string]string{
+		"if/elif/else":     "fn f(x: int) -> int:\n    if x > 0:\n        return 1\n    elif x < 0:\n        return 2\n    else:\n        return 0\n",
+		"trailing return":  "fn f(x: int) -> int:\n    if x > 0:\n        return 1\n    return 0\n",
+		"while true":       "fn f(x: int) -> int:\n    while true:\n        if x > 3:\n            return x\n        x = x + 1\n",
+		"exhaustive match": "fn f(x: int) -> int:\n    match x:\n        1 =>\n            return 1\n        _ =>\n            return 0\n",
+		"no return type":   "fn f(x: int):\n    if x > 0:\n        return\n",
+	}
+	for name, src := range ok {
+		t.Run(name, func(t *testing.T) {
+			_, err := checkFlow(t, src)
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestCheck_UnreachableCode_Warns(t *testing.T) {
+	env, err := checkFlow(t, `fn f(x: int) -> int:
+    if x > 0:
+        return 1
+    else:
+        return 2
+    # a comment is not reported
+    let dead = 3
+    let deader = 4
+    return dead
+for i in [1, 2]:
+    continue
+    println(i)
+`)
+	require.NoError(t, err)
+	ws := env.Warnings()
+	require.Len(t, ws, 2)
+	assert.Equal(t, "W2001", ws[0].Code)
+	assert.Equal(t, 6, ws[0].Pos.Line)
+	assert.True(t, ws[0].Warning)
+	assert.Contains(t, ws[0].Format(), "warning[W2001]")
+	assert.Equal(t, 11, ws[1].Pos.Line)
+
+	env, _ = checkFlow(t, "fn f() -> int:\n    return 1\n")
+	assert.Empty(t, env.Warnings())
+}
+
+func TestCheck_ConsumedStepResult(t *testing.T) {
+	_, err := checkFlow(t, `plan "p":
+    step "check" -> guard:
+        let n = 3
+        if n > 0:
+            n > 1
+`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "E2075")
+
+	_, err = checkFlow(t, `plan "p":
+    step "shape" -> transform:
+        let n = 3
+        if n > 0:
+            return n
+        let m = 1
+`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "E2075")
+
+	// Every path yielding, or none (a guard that asserts nothing), is fine,
+	// and a `tool` step's result isn't checked.
+	_, err = checkFlow(t, `plan "p":
+    step "check" -> guard:
+        let n = 3
+        if n > 0:
+            return n > 1
+        n == 0
+    step "setup" -> guard:
+        let m = 1
+    step "work" -> tool:
+        if m > 0:
+            m
+`)
+	assert.NoError(t, err)
+
+	// A match whose arms all return ends every path it covers; one that
+	// isn't exhaustive can still run past it.
+	_, err = checkFlow(t, `plan "p":
+    step "check" -> guard:
+        let r = ok(1)
+        if r.tag == "none":
+            return false
+        match r:
+            ok(v) =>
+                return v > 0
+            err(e) =>
+                return false
+    step "loop" -> transform:
+        for x in [1, 2]:
+            if x > 1:
+                return x
+        0
+`)
+	assert.NoError(t, err)
+
+	_, err = checkFlow(t, `plan "p":
+    step "check" -> guard:
+        let n = 3
+        match n:
+            1 =>
+                return true
+`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "E2075")
+}
@@ -0,0 +1,124 @@
+package types
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/jiejie-dev/funny/v2/internal/ast"
+)
+
+// checkJSONCall checks decode_json(Type, s), which returns Result[Type,
+// str], and encode_json(v), which returns str. Type must name a struct
+// whose fields - and those of the structs they hold - all have a JSON
+// form (E2076).
+func checkJSONCall(n *ast.CallExpr, name string, env *Env) (Type, error) {
+	want := 1
+	if name == "decode_json" {
+		want = 2
+	}
+	if len(n.Args) != want {
+		return nil, New("E2020", fmt.Sprintf("%s expects %d args, got %d", name, want, len(n.Args)), n.NodePos)
+	}
+	if name == "encode_json" {
+		if _, err := checkOperand(n.Args[0], env); err != nil {
+			return nil, err
+		}
+		return Primitive("str"), nil
+	}
+	typeName, ok := n.Args[0].(*ast.VariableExpr)
+	if !ok {
+		return nil, New("E2076", fmt.Sprintf("decode_json's first argument must be a struct name, got `%s`", n.Args[0]), n.Args[0].Pos())
+	}
+	s, ok := env.LookupStruct(typeName.Name)
+	if !ok {
+		return nil, New("E2076", fmt.Sprintf("decode_json's first argument must be a struct name, got `%s`", typeName.Name), typeName.NodePos)
+	}
+	if err := checkTestOnlyUse(s.Name, typeName.NodePos, env); err != nil {
+		return nil, err
+	}
+	if err := checkJSONForm(s, s.Name, env, map[string]bool{}); err != nil {
+		return nil, New("E2076", "decode_json: "+err.Error(), typeName.NodePos)
+	}
+	if err := checkAssignable(n.Args[1], Primitive("str"), n.Args[1].Pos(), env); err != nil {
+		return nil, err
+	}
+	return Result{Ok: s, Err: Primitive("str")}, nil
+}
+
+// checkJSONForm reports the first part of t, reached through where (e.g.
+// "User.tags"), that JSON can't hold: functions, interfaces, Results and
+// maps with non-str keys. Structs already in seen are being checked.
+func checkJSONForm(t Type, where string, env *Env, seen map[string]bool) error {
+	switch tt := t.(type) {
+	case Invalid:
+		return nil
+	case Primitive:
+		switch tt {
+		case "int", "float", "str", "bool", "any":
+			return nil
+		}
+		if s, ok := env.LookupStruct(string(tt)); ok {
+			return checkJSONForm(s, where, env, seen)
+		}
+		if a, ok := env.LookupAlias(string(tt)); ok {
+			return checkJSONForm(a, where, env, seen)
+		}
+	case List:
+		return checkJSONForm(tt.Elem, where, env, seen)
+	case Set:
+		return checkJSONForm(tt.Elem, where, env, seen)
+	case Map:
+		if !Equal(tt.Key, Primitive("str")) {
+			return fmt.Errorf("%s has type %s, but JSON object keys are strings", where, tt)
+		}
+		return checkJSONForm(tt.Value, where, env, seen)
+	case Optional:
+		return checkJSONForm(tt.Inner, where, env, seen)
+	case Struct:
+		if seen[tt.Name] {
+			return nil
+		}
+		seen[tt.Name] = true
+		names := make([]string, 0, len(tt.Fields))
+		for fname := range tt.Fields {
+			names = append(names, fname)
+		}
+		sort.Strings(names)
+		for _, fname := range names {
+			if err := checkJSONForm(tt.Fields[fname], tt.Name+"."+fname, env, seen); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("%s has type %s, which has no JSON form", where, t)
+}
+
+// checkFieldAttributes checks the attributes of a struct field: `@json`
+// takes the JSON key (E2068), and the declaration-only attributes don't
+// apply.
+func checkFieldAttributes(sd *ast.StructDecl, env *Env) {
+	keys := map[string]string{}
+	for _, f := range sd.Fields {
+		for _, a := range f.Attrs {
+			var err *Error
+			switch a.Name {
+			case "json":
+				err = checkStringAttr(a, "name", true)
+			case "tool", "test_only":
+				err = New("E2068", fmt.Sprintf("@%s applies to declarations, not struct fields", a.Name), a.NodePos)
+			case "deprecated":
+			default:
+				warnUnknownAttr(a, env)
+			}
+			if err != nil {
+				env.report(err)
+			}
+		}
+		key := f.JSONKey()
+		if other, dup := keys[key]; dup {
+			env.report(New("E2068", fmt.Sprintf("fields %s and %s of %s both use the JSON key %q", other, f.Name, sd.Name, key), sd.NodePos))
+		}
+		keys[key] = f.Name
+	}
+}
@@ -0,0 +1,75 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/jiejie-dev/funny/v2/internal/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const jsonUserSrc = `struct Address:
+    city: str
+    zip: str?
+struct User:
+    @json("user_name")
+    name: str
+    home: Address
+    tags: list[str]
+    extra: map[str, int]
+`
+
+func TestCheck_DecodeJSON_TypesItsResult(t *testing.T) {
+	prog, err := parser.New(jsonUserSrc+`fn city(s: str) -> str:
+    match decode_json(User, s):
+        ok(u) =>
+            let n: str = u.name
+            return u.home.city
+        err(e) =>
+            return e
+let out: str = encode_json(User(name: "a", home: Address(city: "c", zip: nil), tags: ["t"], extra: {"k": 1}))
+`, "").Parse()
+	require.NoError(t, err)
+	assert.NoError(t, Check(prog, NewEnv(nil)))
+}
+
+func TestCheck_DecodeJSON_Rejected(t *testing.T) {
+	cases := map[string]string{
+		"not a struct":        `decode_json(str, "{}")`,
+		"unknown struct":      `decode_json(Nope, "{}")`,
+		"non-str document":    `decode_json(User, 1)`,
+		"wrong arity":         `decode_json(User)`,
+		"non-str map key":     "struct Bad:\n    m: map[int, str]\ndecode_json(Bad, \"{}\")",
+		"no JSON form":        "struct Bad:\n    r: Result\ndecode_json(Bad, \"{}\")",
+		"encode_json arity":   `encode_json(1, 2)`,
+		"@json on a function": "@json(\"f\")\nfn f():\n    pass",
+		"@json without a key": "struct S:\n    @json\n    a: int",
+		"duplicate JSON keys": "struct S:\n    @json(\"b\")\n    a: int\n    b: int",
+	}
+	codes := map[string]string{
+		"non-str document": "E2010", "wrong arity": "E2020", "encode_json arity": "E2020",
+		"@json on a function": "E2068", "@json without a key": "E2068", "duplicate JSON keys": "E2068",
+	}
+	for name, src := range cases {
+		t.Run(name, func(t *testing.T) {
+			prog, err := parser.New(jsonUserSrc+src+"\n", "").Parse()
+			require.NoError(t, err)
+			err = Check(prog, NewEnv(nil))
+			require.Error(t, err)
+			code := codes[name]
+			if code == "" {
+				code = "E2076"
+			}
+			assert.Contains(t, err.Error(), code)
+		})
+	}
+}
+
+func TestEqual_Optional(t *testing.T) {
+	opt := Optional{Inner: Primitive("str")}
+	assert.True(t, Equal(opt, Primitive("str")))
+	assert.True(t, Equal(opt, Primitive("nil")))
+	assert.True(t, Equal(opt, Optional{Inner: Primitive("str")}))
+	assert.False(t, Equal(opt, Primitive("int")))
+	assert.False(t, Equal(opt, Optional{Inner: Primitive("int")}))
+}
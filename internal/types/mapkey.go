@@ -0,0 +1,116 @@
+package types
+
+import (
+	"fmt"
+
+	"github.com/jiejie-dev/funny/v2/internal/ast"
+)
+
+// checkMapKeys reports the first map type within t whose key type can't
+// key a runtime map (E2077), or set type whose elements can't be hashed the
+// same way (E2078). Keys are ints, strs, bools or structs whose fields
+// compare structurally (see comparable); a float key would miss on
+// rounding, and functions and interfaces have no value to hash.
+func checkMapKeys(t Type, pos ast.Pos, env *Env) error {
+	switch tt := t.(type) {
+	case Map:
+		if !hashable(tt.Key, env) {
+			err := New("E2077", fmt.Sprintf("%s can't be a map key type", hashName(tt.Key)), pos)
+			err.Hint = "map keys are int, str, bool, or a struct whose fields are ints, floats, strs, bools, or optionals, lists or structs of those"
+			return err
+		}
+		return checkMapKeys(tt.Value, pos, env)
+	case Set:
+		if !hashable(tt.Elem, env) {
+			err := New("E2078", fmt.Sprintf("%s can't be a set element type", hashName(tt.Elem)), pos)
+			err.Hint = "set elements are int, str, bool, or a struct whose fields are ints, floats, strs, bools, or optionals, lists or structs of those"
+			return err
+		}
+		return nil
+	case List:
+		return checkMapKeys(tt.Elem, pos, env)
+	case Optional:
+		return checkMapKeys(tt.Inner, pos, env)
+	case Result:
+		if err := checkMapKeys(tt.Ok, pos, env); err != nil {
+			return err
+		}
+		return checkMapKeys(tt.Err, pos, env)
+	case Func:
+		for _, p := range tt.Params {
+			if err := checkMapKeys(p, pos, env); err != nil {
+				return err
+			}
+		}
+		return checkMapKeys(tt.Return, pos, env)
+	}
+	return nil
+}
+
+// hashName names a key or element type in E2077/E2078: a struct by its
+// name rather than its fields.
+func hashName(t Type) string {
+	if s, ok := t.(Struct); ok {
+		return s.Name
+	}
+	return t.String()
+}
+
+// hashable reports whether t can be a map key or set element type.
+func hashable(t Type, env *Env) bool {
+	switch tt := t.(type) {
+	case Invalid:
+		return true
+	case Primitive:
+		switch tt {
+		case "int", "str", "bool":
+			return true
+		}
+		if s, ok := env.LookupStruct(string(tt)); ok {
+			return comparable(s, env, map[string]bool{})
+		}
+		if a, ok := env.LookupAlias(string(tt)); ok {
+			return hashable(a, env)
+		}
+	case Struct:
+		return comparable(tt, env, map[string]bool{})
+	}
+	return false
+}
+
+// comparable reports whether values of t compare structurally, field by
+// field and element by element, all the way down. Structs in seen are
+// already being checked.
+func comparable(t Type, env *Env, seen map[string]bool) bool {
+	switch tt := t.(type) {
+	case Invalid:
+		return true
+	case Primitive:
+		switch tt {
+		case "int", "float", "str", "bool":
+			return true
+		}
+		if s, ok := env.LookupStruct(string(tt)); ok {
+			return comparable(s, env, seen)
+		}
+		if a, ok := env.LookupAlias(string(tt)); ok {
+			return comparable(a, env, seen)
+		}
+	case Optional:
+		return comparable(tt.Inner, env, seen)
+	case List:
+		return comparable(tt.Elem, env, seen)
+	case Struct:
+		if seen[tt.Name] {
+			return true
+		}
+		seen[tt.Name] = true
+		for _, ft := range tt.Fields {
+			if !comparable(ft, env, seen) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
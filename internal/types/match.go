@@ -0,0 +1,311 @@
+package types
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/jiejie-dev/funny/v2/internal/ast"
+)
+
+// checkMatch checks a match statement arm by arm. Each arm's pattern is
+// checked against the scrutinee's type, the names it binds are declared
+// for its guard and body, and an arm that earlier unguarded arms already
+// cover entirely is reported as unreachable (E2061).
+func checkMatch(n *ast.MatchStmt, env *Env) error {
+	scrT, err := checkOperand(n.Expr, env)
+	if err != nil {
+		return err
+	}
+	cov := matchCoverage{lits: map[string]bool{}, env: env}
+	for _, arm := range n.Arms {
+		alts := patternAlts(arm.Pattern)
+		armEnv := NewEnv(env)
+		for name, t := range checkArmPattern(alts, scrT, env) {
+			armEnv.DeclareVar(name, t)
+		}
+		if cov.coversAll(alts) {
+			env.report(New("E2061", fmt.Sprintf("unreachable match arm: earlier arms already cover `%s`", arm.Pattern), arm.Pattern.Pos()))
+		}
+		if arm.Guard != nil {
+			checkCond(arm.Guard, arm.Guard.Pos(), armEnv)
+		} else {
+			for _, alt := range alts {
+				cov.add(alt, scrT)
+			}
+		}
+		checkBlock(arm.Body, armEnv)
+	}
+	if cov.all {
+		env.markExhaustive(n)
+	}
+	return nil
+}
+
+// patternAlts returns a pattern's `|` alternatives (just the pattern
+// itself when it has none).
+func patternAlts(p ast.Expression) []ast.Expression {
+	if or, ok := p.(*ast.OrPattern); ok {
+		return or.Alts
+	}
+	return []ast.Expression{p}
+}
+
+// checkArmPattern checks every alternative of an arm's pattern and returns
+// the names they bind. Alternatives must all bind the same names, with the
+// same types, since the body can't tell which one matched (E2062).
+func checkArmPattern(alts []ast.Expression, scrT Type, env *Env) map[string]Type {
+	var bound map[string]Type
+	for i, alt := range alts {
+		b := map[string]Type{}
+		if err := checkPattern(alt, scrT, b, env); err != nil {
+			env.report(err)
+			bindInvalid(alt, b, env)
+		}
+		if i == 0 {
+			bound = b
+			continue
+		}
+		if !sameBindings(bound, b) {
+			env.report(New("E2062", fmt.Sprintf("`|` alternatives must bind the same names: `%s` binds %s, `%s` binds %s",
+				alts[0], bindingNames(bound), alt, bindingNames(b)), alt.Pos()))
+		}
+	}
+	return bound
+}
+
+// checkPattern checks one pattern against the type t of the value it
+// matches, adding the names it binds to bound.
+func checkPattern(p ast.Expression, t Type, bound map[string]Type, env *Env) error {
+	switch n := p.(type) {
+	case *ast.VariableExpr:
+		if n.Name == "_" {
+			return nil
+		}
+		if env.IsConst(n.Name) {
+			// A constant compares against its value instead of binding.
+			break
+		}
+		if _, dup := bound[n.Name]; dup {
+			return New("E2062", fmt.Sprintf("%s is bound more than once in the same pattern", n.Name), n.NodePos)
+		}
+		bound[n.Name] = t
+		return nil
+	case *ast.OrPattern:
+		return New("E2062", "`|` alternatives are only allowed at the top of a pattern", n.NodePos)
+	case *ast.CallExpr:
+		if tag, ok := resultPatternTag(n); ok {
+			if len(n.Args) != 1 {
+				return New("E2063", fmt.Sprintf("%s(...) pattern takes exactly one sub-pattern", tag), n.NodePos)
+			}
+			if !isInvalid(t) && !isResultType(t) {
+				return New("E2063", fmt.Sprintf("%s(...) pattern requires a Result, got %s", tag, t), n.NodePos)
+			}
+			return checkPattern(n.Args[0], resultPayload(t, tag), bound, env)
+		}
+	case *ast.StructLiteralExpr:
+		s, ok := env.LookupStruct(n.TypeName)
+		if !ok {
+			return New("E2053", fmt.Sprintf("undefined struct type: %s", n.TypeName), n.NodePos)
+		}
+		if !AssignableTo(s, t) {
+			return NewMismatch(n.NodePos, t, s)
+		}
+		for _, fname := range sortedFieldNames(n) {
+			ft, ok := s.Field(fname)
+			if !ok {
+				return New("E2054", fmt.Sprintf("struct %s has no field %q", n.TypeName, fname), n.NodePos)
+			}
+			if err := checkPattern(n.Fields[fname], ft, bound, env); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	patT, err := CheckExpr(p, env)
+	if err != nil {
+		return err
+	}
+	// A bare Result's payload is `any`, which any value may be compared to.
+	if !AssignableTo(patT, t) && t != Primitive("any") {
+		return NewMismatch(p.Pos(), t, patT)
+	}
+	return nil
+}
+
+// bindInvalid adds every name p would bind that isn't in bound yet as
+// Invalid. A pattern that fails to check stops at its first error, so
+// the names after it were never bound; declaring them keeps the arm's
+// guard and body from reporting each use as undefined (E2001) on top of
+// the pattern's own error.
+func bindInvalid(p ast.Expression, bound map[string]Type, env *Env) {
+	switch n := p.(type) {
+	case *ast.VariableExpr:
+		if _, ok := bound[n.Name]; !ok && n.Name != "_" && !env.IsConst(n.Name) {
+			bound[n.Name] = Invalid{}
+		}
+	case *ast.CallExpr:
+		if _, ok := resultPatternTag(n); ok {
+			for _, arg := range n.Args {
+				bindInvalid(arg, bound, env)
+			}
+		}
+	case *ast.StructLiteralExpr:
+		for _, fname := range sortedFieldNames(n) {
+			bindInvalid(n.Fields[fname], bound, env)
+		}
+	}
+}
+
+// resultPatternTag reports whether a call is an `ok(...)` or `err(...)`
+// pattern, and which.
+func resultPatternTag(n *ast.CallExpr) (string, bool) {
+	v, ok := n.Func.(*ast.VariableExpr)
+	if !ok || (v.Name != "ok" && v.Name != "err") {
+		return "", false
+	}
+	return v.Name, true
+}
+
+// resultPayload is the type an ok(...)/err(...) pattern's sub-pattern
+// matches: the Result's Ok or Err type, or `any` for a bare Result (the
+// same type `.val` has there).
+func resultPayload(t Type, tag string) Type {
+	r, ok := t.(Result)
+	if !ok {
+		if isInvalid(t) {
+			return t
+		}
+		return Primitive("any")
+	}
+	if tag == "ok" {
+		return r.Ok
+	}
+	return r.Err
+}
+
+func sortedFieldNames(n *ast.StructLiteralExpr) []string {
+	names := make([]string, 0, len(n.Fields))
+	for name := range n.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sameBindings(a, b map[string]Type) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, t := range a {
+		if u, ok := b[name]; !ok || !Equal(t, u) {
+			return false
+		}
+	}
+	return true
+}
+
+func bindingNames(b map[string]Type) string {
+	if len(b) == 0 {
+		return "nothing"
+	}
+	names := make([]string, 0, len(b))
+	for name := range b {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return fmt.Sprintf("%v", names)
+}
+
+// matchCoverage records what the unguarded arms seen so far catch.
+type matchCoverage struct {
+	all     bool            // an irrefutable arm: no later arm can run
+	lits    map[string]bool // literal values already matched
+	ok, err bool            // every ok(...) / err(...) already matched
+	env     *Env            // resolves constant names, which don't bind
+}
+
+// coversAll reports whether every alternative is already caught.
+func (c *matchCoverage) coversAll(alts []ast.Expression) bool {
+	for _, alt := range alts {
+		if !c.covers(alt) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *matchCoverage) covers(p ast.Expression) bool {
+	if c.all {
+		return true
+	}
+	if key, ok := literalKey(p); ok {
+		return c.lits[key]
+	}
+	if call, ok := p.(*ast.CallExpr); ok {
+		switch tag, _ := resultPatternTag(call); tag {
+		case "ok":
+			return c.ok
+		case "err":
+			return c.err
+		}
+	}
+	return false
+}
+
+func (c *matchCoverage) add(p ast.Expression, scrT Type) {
+	if irrefutable(p, scrT, c.env) {
+		c.all = true
+		return
+	}
+	if key, ok := literalKey(p); ok {
+		c.lits[key] = true
+		if c.lits[literalKeyOf(true)] && c.lits[literalKeyOf(false)] {
+			c.all = true
+		}
+		return
+	}
+	if call, ok := p.(*ast.CallExpr); ok && len(call.Args) == 1 && irrefutable(call.Args[0], nil, c.env) {
+		switch tag, _ := resultPatternTag(call); tag {
+		case "ok":
+			c.ok = true
+		case "err":
+			c.err = true
+		}
+		c.all = c.ok && c.err
+	}
+}
+
+// irrefutable reports whether a pattern matches every value of type t: a
+// wildcard, a binding (but not a constant's name), or a struct pattern of
+// t's own struct type whose field patterns are all irrefutable.
+func irrefutable(p ast.Expression, t Type, env *Env) bool {
+	switch n := p.(type) {
+	case *ast.VariableExpr:
+		return !env.IsConst(n.Name)
+	case *ast.StructLiteralExpr:
+		s, ok := t.(Struct)
+		if !ok || s.Name != n.TypeName {
+			return false
+		}
+		for fname, sub := range n.Fields {
+			ft, _ := s.Field(fname)
+			if !irrefutable(sub, ft, env) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func literalKey(p ast.Expression) (string, bool) {
+	lit, ok := p.(*ast.LiteralExpr)
+	if !ok {
+		return "", false
+	}
+	return literalKeyOf(lit.Value), true
+}
+
+func literalKeyOf(v any) string {
+	return fmt.Sprintf("%T:%#v", v, v)
+}
@@ -82,6 +82,8 @@ func (p *typeParser) parseType() (Type, error) {
 		return p.parseListType()
 	case strings.HasPrefix(p.src[p.pos:], "map["):
 		return p.parseMapType()
+	case strings.HasPrefix(p.src[p.pos:], "set["):
+		return p.parseSetType()
 	case strings.HasPrefix(p.src[p.pos:], "Result["):
 		return p.parseResultType()
 	}
@@ -116,6 +118,18 @@ func (p *typeParser) parseListType() (Type, error) {
 	return List{Elem: elem}, nil
 }
 
+func (p *typeParser) parseSetType() (Type, error) {
+	p.pos += len("set[")
+	elem, err := p.parseType()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(']'); err != nil {
+		return nil, fmt.Errorf("malformed set type: %w", err)
+	}
+	return Set{Elem: elem}, nil
+}
+
 func (p *typeParser) parseMapType() (Type, error) {
 	p.pos += len("map[")
 	key, err := p.parseType()
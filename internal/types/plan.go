@@ -22,6 +22,7 @@ func checkPlanBlock(n *ast.PlanBlock, env *Env) error {
 	for _, stmt := range n.Body.Statements {
 		switch s := stmt.(type) {
 		case *ast.Step:
+			checkAttributes(s.Attrs, env, true)
 			if s.Retry != nil {
 				for _, typ := range s.Retry.On {
 					if typ == "str" {
@@ -43,14 +44,20 @@ func checkPlanBlock(n *ast.PlanBlock, env *Env) error {
 				}
 			}
 			if s.Body != nil {
-				if err := Check(s.Body.ToProgram(), env); err != nil {
-					return err
+				// Step bodies share the plan's scope (a `let` in one
+				// step is visible to the next), so the env is marked
+				// for `defer` only while the body is checked. The
+				// statements of a parallel step run independently and
+				// have no body exit to defer to.
+				env.canDefer = s.Kind != ast.StepParallel
+				checkBlock(s.Body, env)
+				env.canDefer = false
+				if err := checkStepResult(s, env); err != nil {
+					env.report(err)
 				}
 			}
 		default:
-			if err := checkStmt(stmt, env); err != nil {
-				return err
-			}
+			checkStmts([]ast.Statement{stmt}, env)
 		}
 	}
 	return nil
@@ -0,0 +1,81 @@
+package types
+
+import (
+	"fmt"
+
+	"github.com/jiejie-dev/funny/v2/internal/ast"
+)
+
+// setBuiltins are the builtins checkSetCall types: to_set(list[T]) is a
+// set[T], and the other three take two sets of the same type and return
+// another.
+var setBuiltins = map[string]bool{
+	"to_set":           true,
+	"set_union":        true,
+	"set_intersection": true,
+	"set_difference":   true,
+}
+
+// checkSetLiteral infers a set's element type from its first element and
+// checks every other element against it, mirroring checkListLiteral. The
+// element type must be hashable (E2078).
+func checkSetLiteral(n *ast.SetLiteralExpr, env *Env) (Type, error) {
+	if len(n.Elements) == 0 {
+		return nil, New("E2011", "cannot infer type of empty set; add type annotation", n.NodePos)
+	}
+	first, err := checkOperand(n.Elements[0], env)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range n.Elements[1:] {
+		t, err := checkOperand(e, env)
+		if err != nil {
+			return nil, err
+		}
+		if !Equal(t, first) {
+			return nil, NewMismatch(e.Pos(), first, t)
+		}
+	}
+	s := Set{Elem: first}
+	if err := checkMapKeys(s, n.NodePos, env); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// checkSetCall checks a call to one of setBuiltins.
+func checkSetCall(n *ast.CallExpr, name string, env *Env) (Type, error) {
+	want := 2
+	if name == "to_set" {
+		want = 1
+	}
+	if len(n.Args) != want {
+		return nil, New("E2020", fmt.Sprintf("%s expects %d args, got %d", name, want, len(n.Args)), n.NodePos)
+	}
+	first, err := checkOperand(n.Args[0], env)
+	if err != nil {
+		return nil, err
+	}
+	if isInvalid(first) {
+		return Invalid{}, nil
+	}
+	if name == "to_set" {
+		lt, ok := first.(List)
+		if !ok {
+			return nil, New("E2050", fmt.Sprintf("to_set requires a list, got %s", first), n.Args[0].Pos())
+		}
+		s := Set{Elem: lt.Elem}
+		if err := checkMapKeys(s, n.NodePos, env); err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+	st, ok := first.(Set)
+	if !ok {
+		return nil, New("E2050", fmt.Sprintf("%s requires sets, got %s", name, first), n.Args[0].Pos())
+	}
+	if err := checkAssignable(n.Args[1], st, n.Args[1].Pos(), env); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
@@ -2,9 +2,15 @@ package types
 
 import "github.com/jiejie-dev/funny/v2/internal/ast"
 
+// checkTestBlock checks a test body, in which `@test_only` declarations
+// are usable. Like a plan step, the body shares the enclosing scope, so
+// the env is only marked while it is checked.
 func checkTestBlock(n *ast.TestBlock, env *Env) error {
 	if n.Body == nil {
 		return nil
 	}
-	return Check(n.Body.ToProgram(), env)
+	saved := env.inTest
+	env.inTest = true
+	defer func() { env.inTest = saved }()
+	return checkBlock(n.Body, env)
 }
@@ -1,5 +1,7 @@
 package types
 
+import "sort"
+
 // Type is the sealed interface for all type system types.
 // Only types in this package can implement it (private marker).
 type Type interface {
@@ -18,15 +20,29 @@ func (p Primitive) Equal(other Type) bool {
 }
 func (p Primitive) typeMarker() {}
 
+// Invalid is the poison type given to an expression (or declaration) that
+// failed to check. It equals every type, so once an error has been
+// reported for it, its uses don't report a cascade of follow-on errors.
+type Invalid struct{}
+
+func (Invalid) String() string        { return "<invalid>" }
+func (Invalid) Equal(other Type) bool { return true }
+func (Invalid) typeMarker()           {}
+
 // Equal is a convenience for comparing two Types.
 // Returns false if either is nil.
 // Special case: bare `Result` (Primitive "Result") matches any Result[T, E],
 // supporting Result as a top-level placeholder when concrete Ok/Err types
 // don't matter (e.g., a function returning any Result).
+// Invalid matches anything. Equal is symmetric; a struct used where an
+// interface is expected goes through AssignableTo.
 func Equal(a, b Type) bool {
 	if a == nil || b == nil {
 		return false
 	}
+	if isInvalid(a) || isInvalid(b) {
+		return true
+	}
 	if p, ok := a.(Primitive); ok && string(p) == "Result" {
 		if _, isResult := b.(Result); isResult {
 			return true
@@ -37,9 +53,39 @@ func Equal(a, b Type) bool {
 			return true
 		}
 	}
+	// An optional T? holds nil or a T, so either is accepted where one is
+	// expected (a struct literal's field, a decoded optional field).
+	if o, ok := a.(Optional); ok && o.holds(b) {
+		return true
+	}
+	if o, ok := b.(Optional); ok && o.holds(a) {
+		return true
+	}
 	return a.Equal(b)
 }
 
+// AssignableTo reports whether a value of type v may be used where target
+// is expected: an argument, a return value, a `let`, an assignment or a
+// struct literal's field. It's Equal, plus one direction Equal leaves
+// out: a struct may be used as any Interface it implements (also inside
+// an optional), which is what makes interfaces structural, since passing
+// a struct to an interface-typed parameter needs no declaration linking
+// the two. An interface-typed value is never assignable to a struct, even
+// one implementing it: it may hold another struct.
+func AssignableTo(v, target Type) bool {
+	if Equal(v, target) {
+		return true
+	}
+	switch t := target.(type) {
+	case Interface:
+		s, ok := v.(Struct)
+		return ok && t.ImplementedBy(s)
+	case Optional:
+		return AssignableTo(v, t.Inner)
+	}
+	return false
+}
+
 // List is a homogeneous list type: list[T].
 type List struct {
 	Elem Type
@@ -69,11 +115,35 @@ func (m Map) Equal(other Type) bool {
 }
 func (m Map) typeMarker() {}
 
+// Set is an unordered collection of distinct elements: set[T]. Like map
+// keys, elements must be hashable (see hashable).
+type Set struct {
+	Elem Type
+}
+
+func (s Set) String() string {
+	return "set[" + s.Elem.String() + "]"
+}
+func (s Set) Equal(other Type) bool {
+	o, ok := other.(Set)
+	return ok && Equal(s.Elem, o.Elem)
+}
+func (s Set) typeMarker() {}
+
 // Struct is a user-defined struct type with named fields.
+//
+// Methods is keyed by method name; each signature excludes the implicit
+// `self` receiver. It is deliberately not part of Equal: a struct's
+// identity is its name and fields, and the map is shared by every copy of
+// the Struct value taken after checkStructDecl declares it, so methods
+// declared later in the same struct body are visible through all of them.
 type Struct struct {
-	Name    string
-	Fields  map[string]Type
-	Mutable map[string]bool // field name → declared with `mut`
+	Name     string
+	Fields   map[string]Type
+	Mutable  map[string]bool // field name → declared with `mut`
+	Defaults map[string]bool // field name → declared with a default value
+	Methods  map[string]Func
+	MutSelf  map[string]bool // method name → receiver declared `mut self`
 }
 
 func (s Struct) String() string {
@@ -106,6 +176,43 @@ func (s Struct) IsMutable(name string) bool {
 	return s.Mutable[name]
 }
 
+// HasDefault reports whether field name was declared with a default value,
+// so struct literals may omit it.
+func (s Struct) HasDefault(name string) bool {
+	return s.Defaults[name]
+}
+
+// Validated reports whether s declares a `validate` hook, and if so the
+// type its literals produce: Result[s, E], where E is the hook's Err type.
+func (s Struct) Validated() (Result, bool) {
+	v, ok := s.Methods["validate"]
+	if !ok {
+		return Result{}, false
+	}
+	if r, ok := v.Return.(Result); ok {
+		return Result{Ok: s, Err: r.Err}, true
+	}
+	if isResultType(v.Return) {
+		return Result{Ok: s, Err: Primitive("str")}, true
+	}
+	return Result{}, false
+}
+
+func isInvalid(t Type) bool {
+	_, ok := t.(Invalid)
+	return ok
+}
+
+// isResultType reports whether t is a Result, either parameterised or the
+// bare `Result` annotation.
+func isResultType(t Type) bool {
+	if _, ok := t.(Result); ok {
+		return true
+	}
+	p, ok := t.(Primitive)
+	return ok && string(p) == "Result"
+}
+
 func (s Struct) typeMarker() {}
 
 // Field looks up a field by name. Returns (nil, false) if not found.
@@ -114,6 +221,23 @@ func (s Struct) Field(name string) (Type, bool) {
 	return t, ok
 }
 
+// Method looks up a method signature by name. Returns (Func{}, false) if
+// the struct declares no such method.
+func (s Struct) Method(name string) (Func, bool) {
+	f, ok := s.Methods[name]
+	return f, ok
+}
+
+// MethodNames returns the names of the struct's methods, in no particular
+// order (mirrors FieldNames).
+func (s Struct) MethodNames() []string {
+	out := make([]string, 0, len(s.Methods))
+	for k := range s.Methods {
+		out = append(out, k)
+	}
+	return out
+}
+
 func (s Struct) FieldNames() []string {
 	out := make([]string, 0, len(s.Fields))
 	for k := range s.Fields {
@@ -122,6 +246,67 @@ func (s Struct) FieldNames() []string {
 	return out
 }
 
+// Interface is a structural interface type: a named set of method
+// signatures, each excluding the implicit `self` receiver. Like
+// Struct.Methods, the map is shared by every copy taken after
+// checkInterfaceDecl declares it.
+//
+// Two interfaces are Equal only if they have the same name. Comparing
+// their method sets instead would recurse forever on interfaces whose
+// methods mention each other; structural matching is reserved for the
+// struct-to-interface case (see ImplementedBy and the package Equal).
+type Interface struct {
+	Name    string
+	Methods map[string]Func
+}
+
+func (i Interface) String() string { return i.Name }
+
+func (i Interface) Equal(other Type) bool {
+	o, ok := other.(Interface)
+	return ok && i.Name == o.Name
+}
+
+func (i Interface) typeMarker() {}
+
+// Method looks up a method signature by name. Returns (Func{}, false) if
+// the interface declares no such method.
+func (i Interface) Method(name string) (Func, bool) {
+	f, ok := i.Methods[name]
+	return f, ok
+}
+
+// MethodNames returns the names of the interface's methods, in no
+// particular order (mirrors Struct.MethodNames).
+func (i Interface) MethodNames() []string {
+	out := make([]string, 0, len(i.Methods))
+	for k := range i.Methods {
+		out = append(out, k)
+	}
+	return out
+}
+
+// ImplementedBy reports whether s declares every method of i with an
+// equal signature.
+func (i Interface) ImplementedBy(s Struct) bool {
+	return i.MissingMethod(s) == ""
+}
+
+// MissingMethod returns the name of a method of i that s lacks or declares
+// with a different signature, or "" if s implements i. Names are tried in
+// sorted order so error messages are deterministic.
+func (i Interface) MissingMethod(s Struct) string {
+	names := i.MethodNames()
+	sort.Strings(names)
+	for _, name := range names {
+		sm, ok := s.Methods[name]
+		if !ok || !Equal(sm, i.Methods[name]) {
+			return name
+		}
+	}
+	return ""
+}
+
 // Func is a function type: (params) -> return.
 type Func struct {
 	Params []Type
@@ -190,3 +375,17 @@ func (o Optional) Equal(other Type) bool {
 }
 
 func (o Optional) typeMarker() {}
+
+// holds reports whether a value of type t is one an o can hold: nil or
+// its inner type.
+func (o Optional) holds(t Type) bool {
+	switch tt := t.(type) {
+	case Optional:
+		return false // compared by Optional.Equal
+	case Primitive:
+		if tt == "nil" {
+			return true
+		}
+	}
+	return Equal(o.Inner, t)
+}
@@ -58,6 +58,41 @@ func BenchmarkFib_Interpreter_ExecOnly(b *testing.B) {
 	}
 }
 
+// scanLoopSrc counts matches in a loop of cheap typed instructions, the
+// shape of a log-scanning skill, so its time is mostly dispatch.
+const scanLoopSrc = `let hits = 0
+let i = 0
+while i < 100000:
+    if i % 7 == 3:
+        hits = hits + 1
+    i = i + 1
+hits
+`
+
+func BenchmarkScanLoop_VM_ExecOnly(b *testing.B) {
+	prog, err := parser.New(scanLoopSrc, "scan.fn").Parse()
+	if err != nil {
+		b.Fatal(err)
+	}
+	if err := types.Check(prog, types.NewEnv(nil)); err != nil {
+		b.Fatal(err)
+	}
+	mod, err := compiler.Compile(prog, "scan.fn")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		got, err := New(mod).Run()
+		if err != nil {
+			b.Fatal(err)
+		}
+		if got != 14286 {
+			b.Fatalf("hits = %v", got)
+		}
+	}
+}
+
 func TestFib_SpeedupRatio(t *testing.T) {
 	mod, prog := precompiledFib(t)
 	const iters = 30
@@ -25,9 +25,24 @@ func (v *VM) execCallBuiltin(nameIdx int) error {
 	}
 	v.stack = v.stack[:start]
 
+	if info.Name == "append" && arity == 2 {
+		if lst, ok := args[0].([]any); ok {
+			if err := v.allocate(int64(len(lst)+1) * valueSize); err != nil {
+				return err
+			}
+		}
+	}
+	if info.Name == "decode_json" {
+		ret, err := stdlib.DecodeJSON(args, structHooks{v})
+		if err != nil {
+			return err
+		}
+		v.stack = append(v.stack, ret)
+		return nil
+	}
 	ret, err := stdlib.Call(info.Name, args)
 	if err != nil {
-		return fmt.Errorf("vm: %v", err)
+		return errorf(codeBuiltin, "%w", err)
 	}
 	if stdlib.SideEffectOnly(info.Name) {
 		return nil
@@ -35,3 +50,17 @@ func (v *VM) execCallBuiltin(nameIdx int) error {
 	v.stack = append(v.stack, ret)
 	return nil
 }
+
+// structHooks lets decode_json finish a decoded struct as a struct
+// literal is finished, by calling the functions the compiler emits for it:
+// "Struct.field.default" for each omitted field with a default, then
+// "Struct.validate".
+type structHooks struct{ v *VM }
+
+func (h structHooks) Default(structName, field string) (any, error) {
+	return h.v.callNamed(structName + "." + field + ".default")
+}
+
+func (h structHooks) Validate(structName string, value any) (any, error) {
+	return h.v.callNamed(structName+".validate", value)
+}
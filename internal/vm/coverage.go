@@ -0,0 +1,73 @@
+package vm
+
+import "github.com/jiejie-dev/funny/v2/internal/bytecode"
+
+// Coverage counts how many times the runs of the VMs it's attached to
+// enter each source line (see SetCoverage and Lines). One Coverage can collect several runs of several
+// modules, such as the test harnesses of one `funny test`.
+type Coverage struct {
+	hits  map[*bytecode.Function][]int64 // per instruction that enters a line
+	order []*bytecode.Function           // functions in the order first seen
+}
+
+// NewCoverage returns an empty Coverage.
+func NewCoverage() *Coverage {
+	return &Coverage{hits: map[*bytecode.Function][]int64{}}
+}
+
+// SetCoverage attaches c to the VM's later runs; nil detaches it. Every
+// line the module has code for counts from now on, run or not. A run with
+// coverage goes through the same per-instruction loop as a debugged one.
+func (v *VM) SetCoverage(c *Coverage) {
+	v.cover = c
+	if c == nil {
+		return
+	}
+	for _, fn := range v.mod.Functions {
+		if _, ok := c.hits[fn]; !ok {
+			c.hits[fn] = make([]int64, len(fn.Code))
+			c.order = append(c.order, fn)
+		}
+	}
+}
+
+// hit counts the instruction at ip in frame's function if it enters a
+// line: one other than the line of the instruction the frame ran before
+// it. A line's several instructions, including those that run after a
+// call it makes returns, then count once each time the line runs.
+func (c *Coverage) hit(frame *Frame, ip int) {
+	fn := frame.fn
+	if ip >= len(fn.Locations) || fn.Locations[ip].IsZero() {
+		return
+	}
+	line := fn.Locations[ip].Line + 1
+	if line == frame.line {
+		return
+	}
+	frame.line = line
+	if hits := c.hits[fn]; ip < len(hits) {
+		hits[ip]++
+	}
+}
+
+// Lines returns, for every file with code in a covered module, the
+// 1-based lines that have code and how many times each ran. A line with a
+// zero count was never reached.
+func (c *Coverage) Lines() map[string]map[int]int64 {
+	out := map[string]map[int]int64{}
+	for _, fn := range c.order {
+		for ip, n := range c.hits[fn] {
+			if ip >= len(fn.Locations) || fn.Locations[ip].IsZero() {
+				continue
+			}
+			loc := fn.Locations[ip]
+			lines := out[loc.File]
+			if lines == nil {
+				lines = map[int]int64{}
+				out[loc.File] = lines
+			}
+			lines[loc.Line+1] += n
+		}
+	}
+	return out
+}
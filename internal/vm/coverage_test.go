@@ -0,0 +1,56 @@
+package vm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCoverage_CountsLinesRunAndNot(t *testing.T) {
+	m := New(compileSrc(t, `fn pick(x: int) -> int:
+    if x > 0:
+        return 1
+    return 2
+
+pick(5)
+`))
+	cov := NewCoverage()
+	m.SetCoverage(cov)
+	_, err := m.Run()
+	require.NoError(t, err)
+
+	lines := cov.Lines()["t.fn"]
+	require.NotNil(t, lines)
+	// A line counts once each time it runs, not once per instruction.
+	assert.Equal(t, int64(1), lines[2], "the condition ran")
+	assert.Equal(t, int64(1), lines[3])
+	assert.Contains(t, lines, 4)
+	assert.Zero(t, lines[4], "the second return never ran")
+	assert.Equal(t, int64(1), lines[6])
+
+	// A second run of the same module adds to the counts.
+	m.SetCoverage(cov)
+	_, err = m.Run()
+	require.NoError(t, err)
+	assert.Equal(t, 2*lines[3], cov.Lines()["t.fn"][3])
+}
+
+func TestCoverage_CountsLoopIterations(t *testing.T) {
+	m := New(compileSrc(t, `fn inc(x: int) -> int:
+    return x + 1
+
+let i = 0
+while i < 3:
+    i = inc(i)
+`))
+	cov := NewCoverage()
+	m.SetCoverage(cov)
+	_, err := m.Run()
+	require.NoError(t, err)
+
+	lines := cov.Lines()["t.fn"]
+	assert.Equal(t, int64(3), lines[2], "one per call")
+	assert.Equal(t, int64(4), lines[5], "three passes and the exit")
+	assert.Equal(t, int64(3), lines[6], "the call returning doesn't count again")
+}
@@ -17,6 +17,9 @@ const (
 	ActionQuit
 )
 
+// errDebugStopped ends a run the debugger quit.
+var errDebugStopped = fmt.Errorf("debug: stopped")
+
 // DebugEvent describes the VM state at a pause point.
 type DebugEvent struct {
 	FnIndex    int
@@ -26,6 +29,17 @@ type DebugEvent struct {
 	Location   bytecode.SourceLoc
 	Stack      []bytecode.Value
 	Locals     []NamedValue
+	CallStack  []CallFrame // active calls, innermost (this one) first
+}
+
+// CallFrame is one active call in a DebugEvent's call stack: its function
+// and where it is, the paused instruction for the innermost call and the
+// call it is waiting on for the others. Elided counts the calls the frame
+// ran before and gave up to tail calls; they are no longer on the stack.
+type CallFrame struct {
+	FnName   string
+	Location bytecode.SourceLoc
+	Elided   int
 }
 
 // NamedValue pairs a local slot name with its runtime value.
@@ -133,6 +147,19 @@ func (v *VM) buildDebugEvent(frame *Frame, loc bytecode.SourceLoc) DebugEvent {
 			break
 		}
 	}
+	calls := make([]CallFrame, 0, len(v.frames))
+	calls = append(calls, CallFrame{FnName: frame.fn.Name, Location: loc, Elided: frame.elided})
+	for i := len(v.frames) - 1; i >= 0; i-- {
+		caller := &v.frames[i]
+		if caller == frame {
+			continue
+		}
+		callLoc := bytecode.SourceLoc{}
+		if ip := caller.ip - 1; ip >= 0 && ip < len(caller.fn.Locations) {
+			callLoc = caller.fn.Locations[ip]
+		}
+		calls = append(calls, CallFrame{FnName: caller.fn.Name, Location: callLoc, Elided: caller.elided})
+	}
 	return DebugEvent{
 		FnIndex:     fnIdx,
 		FnName:      frame.fn.Name,
@@ -141,7 +168,17 @@ func (v *VM) buildDebugEvent(frame *Frame, loc bytecode.SourceLoc) DebugEvent {
 		Location:    loc,
 		Stack:       stack,
 		Locals:      locals,
+		CallStack:   calls,
+	}
+}
+
+// ElidedLabel describes n calls elided by tail calls, for call stack
+// views.
+func ElidedLabel(n int) string {
+	if n == 1 {
+		return "1 tail call elided"
 	}
+	return fmt.Sprintf("%d tail calls elided", n)
 }
 
 func normalizeDebugFile(file string) string {
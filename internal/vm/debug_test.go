@@ -20,7 +20,7 @@ func TestDebugger_BreakpointAndStep(t *testing.T) {
 
 	var log []string
 	dbg := NewDebugger(func(ev DebugEvent) (DebugAction, error) {
-		log = append(log, ev.Location.Display()+":"+string(ev.Instruction.Op))
+		log = append(log, ev.Location.Display()+":"+ev.Instruction.Op.String())
 		if len(log) >= 3 {
 			return ActionQuit, nil
 		}
@@ -71,3 +71,30 @@ func TestInstructionStringInDebug(t *testing.T) {
 	instr := bytecode.Instruction{Op: bytecode.PUSH_INT, Arg: 3}
 	assert.True(t, strings.Contains(instr.String(), "PUSH_INT"))
 }
+
+func TestDebugger_CallStackMarksElidedFrames(t *testing.T) {
+	m := New(compileSrc(t, `fn down(n: int) -> int:
+    if n == 0:
+        return 0
+    return down(n - 1)
+
+down(2)
+`))
+	var stack []CallFrame
+	dbg := NewDebugger(func(ev DebugEvent) (DebugAction, error) {
+		if ev.Location.Line != 2 {
+			return ActionContinue, nil // RunDebug pauses on the first instruction
+		}
+		stack = ev.CallStack
+		return ActionQuit, nil
+	})
+	dbg.SetBreakpoint("t.fn", 3)
+	_, err := m.RunDebug(dbg)
+	require.Error(t, err)
+	require.Len(t, stack, 2)
+	assert.Equal(t, CallFrame{FnName: "down", Location: stack[0].Location, Elided: 2}, stack[0])
+	assert.Equal(t, 2, stack[0].Location.Line)
+	assert.Equal(t, "main", stack[1].FnName)
+	assert.Equal(t, 5, stack[1].Location.Line)
+	assert.Equal(t, "2 tail calls elided", ElidedLabel(stack[0].Elided))
+}
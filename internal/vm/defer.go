@@ -0,0 +1,118 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/jiejie-dev/funny/v2/internal/bytecode"
+)
+
+// deferred is a call registered by DEFER, with its arguments already
+// evaluated.
+type deferred struct {
+	info bytecode.DeferInfo
+	args []bytecode.Value
+}
+
+// execDefer handles DEFER infoIdx: it moves the call's arguments off the
+// operand stack and onto frame's defer list.
+func (v *VM) execDefer(frame *Frame, infoIdx int) error {
+	info, ok := v.mod.Constants[infoIdx].(bytecode.DeferInfo)
+	if !ok {
+		return fmt.Errorf("vm: DEFER operand is not a DeferInfo")
+	}
+	if len(v.stack) < info.Arity {
+		return fmt.Errorf("vm: DEFER expects %d args, got %d", info.Arity, len(v.stack))
+	}
+	base := len(v.stack) - info.Arity
+	args := make([]bytecode.Value, info.Arity)
+	copy(args, v.stack[base:])
+	v.stack = v.stack[:base]
+	frame.defers = append(frame.defers, deferred{info: info, args: args})
+	return nil
+}
+
+// runDefers runs defers last-registered first. A failing call doesn't
+// stop the rest; every error is returned, joined.
+func (v *VM) runDefers(defers []deferred) error {
+	var errs []error
+	for i := len(defers) - 1; i >= 0; i-- {
+		if err := v.callSync(defers[i]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// callSync performs d's call and runs it to completion before returning,
+// on top of whatever frames are already active. Its result is discarded:
+// the operand stack is left as it was found.
+func (v *VM) callSync(d deferred) error {
+	depth, height := len(v.frames), len(v.stack)
+	v.stack = append(v.stack, d.args...)
+	var err error
+	switch d.info.Op {
+	case bytecode.CALL:
+		err = v.execCallFast(d.info.Arg)
+	case bytecode.CALL_BUILTIN:
+		err = v.execCallBuiltin(d.info.Arg)
+	case bytecode.CALL_METHOD:
+		err = v.execCallMethod(d.info.Arg)
+	default:
+		err = fmt.Errorf("vm: cannot defer %s", d.info.Op)
+	}
+	if err == nil {
+		err = v.runFrames(depth)
+	}
+	if err != nil {
+		err = v.unwind(depth, v.traced(err))
+	}
+	v.stack = v.stack[:height]
+	return err
+}
+
+// callNamed calls the module function name with args and runs it to
+// completion, like callSync, returning its result.
+func (v *VM) callNamed(name string, args ...bytecode.Value) (bytecode.Value, error) {
+	fnIdx, ok := v.function(name)
+	if !ok {
+		return nil, fmt.Errorf("vm: undefined function %s", name)
+	}
+	depth, height := len(v.frames), len(v.stack)
+	v.stack = append(v.stack, args...)
+	err := v.execCallFast(fnIdx)
+	if err == nil {
+		err = v.runFrames(depth)
+	}
+	if err != nil {
+		err = v.unwind(depth, v.traced(err))
+		v.stack = v.stack[:height]
+		return nil, err
+	}
+	var ret bytecode.Value
+	if len(v.stack) > height {
+		ret = v.stack[len(v.stack)-1]
+	}
+	v.stack = v.stack[:height]
+	return ret, nil
+}
+
+// unwind pops frames down to depth after err, running each frame's
+// deferred calls on the way out, and returns err joined with any error
+// those calls raise. After an error that stopped the run (see stopped)
+// the calls run with the limits suspended, so they aren't stopped in turn.
+func (v *VM) unwind(depth int, err error) error {
+	if stopped(err) {
+		defer v.suspendLimits()()
+	}
+	for len(v.frames) > depth {
+		fi := len(v.frames) - 1
+		defers := v.frames[fi].defers
+		v.releaseLocals(v.frames[fi].locals)
+		v.frames = v.frames[:fi]
+		if derr := v.runDefers(defers); derr != nil {
+			err = errors.Join(err, derr)
+		}
+	}
+	return err
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/jiejie-dev/funny/v2/internal/bytecode"
+	"github.com/jiejie-dev/funny/v2/internal/typederror"
 )
 
 // acquireLocals returns a locals slice with length n, reusing pooled storage.
@@ -44,6 +45,9 @@ func (v *VM) execCallFast(fnIdx int) error {
 	if fnIdx < 0 || fnIdx >= len(v.mod.Functions) {
 		return fmt.Errorf("vm: CALL invalid function index %d", fnIdx)
 	}
+	if err := v.checkCallDepth(); err != nil {
+		return err
+	}
 	callee := v.mod.Functions[fnIdx]
 	n := callee.Arity
 	if len(v.stack) < n {
@@ -60,6 +64,79 @@ func (v *VM) execCallFast(fnIdx int) error {
 	return nil
 }
 
+// execTailCall handles TAIL_CALL fnIdx: the callee replaces the function
+// running in frame fi, taking over its frame (and its locals storage, when
+// big enough) rather than pushing one, so tail recursion runs in constant
+// stack. frame.elided counts the calls replaced, for stack traces.
+//
+// A frame with deferred calls can't be replaced, because they must run
+// when it returns; there TAIL_CALL is an ordinary CALL, and the RETURN
+// the compiler emits after it returns the callee's result.
+func (v *VM) execTailCall(fi int, fnIdx int) error {
+	frame := &v.frames[fi]
+	if len(frame.defers) > 0 {
+		return v.execCallFast(fnIdx)
+	}
+	if fnIdx < 0 || fnIdx >= len(v.mod.Functions) {
+		return fmt.Errorf("vm: TAIL_CALL invalid function index %d", fnIdx)
+	}
+	callee := v.mod.Functions[fnIdx]
+	n := callee.Arity
+	if len(v.stack) < n {
+		return fmt.Errorf("vm: TAIL_CALL %s expects %d args, got %d", callee.Name, n, len(v.stack))
+	}
+	locals := frame.locals
+	if cap(locals) >= callee.NumLocals && callee.NumLocals > 0 {
+		locals = locals[:callee.NumLocals]
+		clear(locals)
+	} else {
+		v.releaseLocals(locals)
+		locals = v.acquireLocals(callee.NumLocals)
+	}
+	base := len(v.stack) - n
+	copy(locals, v.stack[base:])
+	v.stack = v.stack[:base]
+	*frame = Frame{fn: callee, locals: locals, elided: frame.elided + 1}
+	return nil
+}
+
+// execCallMethod handles CALL_METHOD infoIdx: it looks up the
+// "Type.method" function for the runtime struct type of the receiver
+// sitting below the arguments, then calls it like CALL (the receiver
+// becomes the callee's `self` local).
+func (v *VM) execCallMethod(infoIdx int) error {
+	info, ok := v.mod.Constants[infoIdx].(bytecode.MethodInfo)
+	if !ok {
+		return fmt.Errorf("vm: CALL_METHOD operand is not a MethodInfo")
+	}
+	if len(v.stack) < info.Arity+1 {
+		return fmt.Errorf("vm: CALL_METHOD %s expects %d args, got %d", info.Name, info.Arity+1, len(v.stack))
+	}
+	recv := v.stack[len(v.stack)-1-info.Arity]
+	typeName := typederror.TypeOf(recv)
+	if typeName == "" {
+		return fmt.Errorf("vm: cannot call method %s on %T", info.Name, recv)
+	}
+	fnIdx, ok := v.function(typeName + "." + info.Name)
+	if !ok {
+		return errorf("E2072", "%s has no method %s", typeName, info.Name)
+	}
+	return v.execCallFast(fnIdx)
+}
+
+// function returns the index of the module function called name, such as
+// a method's "Type.method".
+func (v *VM) function(name string) (int, bool) {
+	if v.methods == nil {
+		v.methods = make(map[string]int, len(v.mod.Functions))
+		for i, fn := range v.mod.Functions {
+			v.methods[fn.Name] = i
+		}
+	}
+	fnIdx, ok := v.methods[name]
+	return fnIdx, ok
+}
+
 // execReturnFast handles RETURN with locals pooling.
 func (v *VM) execReturnFast() error {
 	if len(v.frames) == 0 {
@@ -71,6 +148,12 @@ func (v *VM) execReturnFast() error {
 		retVal = v.stack[len(v.stack)-1]
 		v.stack = v.stack[:len(v.stack)-1]
 	}
+	if defers := v.frames[fi].defers; len(defers) > 0 {
+		v.frames[fi].defers = nil
+		if err := v.runDefers(defers); err != nil {
+			return err
+		}
+	}
 	v.releaseLocals(v.frames[fi].locals)
 	v.frames = v.frames[:fi]
 	if retVal != nil {
@@ -113,6 +196,15 @@ func (v *VM) step(fi int, instr bytecode.Instruction) error {
 			return fmt.Errorf("vm: STORE_LOCAL %d out of range", instr.Arg)
 		}
 		frame.locals[instr.Arg] = (*stack)[len(*stack)-1]
+	case bytecode.STORE_LOCAL_POP:
+		if len(*stack) == 0 {
+			return fmt.Errorf("vm: STORE_LOCAL_POP on empty stack")
+		}
+		if instr.Arg >= len(frame.locals) {
+			return fmt.Errorf("vm: STORE_LOCAL_POP %d out of range", instr.Arg)
+		}
+		frame.locals[instr.Arg] = (*stack)[len(*stack)-1]
+		*stack = (*stack)[:len(*stack)-1]
 	case bytecode.ADD_INT:
 		if len(*stack) < 2 {
 			return fmt.Errorf("vm: ADD_INT underflow")
@@ -138,7 +230,7 @@ func (v *VM) step(fi int, instr bytecode.Instruction) error {
 		*stack = (*stack)[:len(*stack)-2]
 		*stack = append(*stack, a < b)
 	case bytecode.JUMP:
-		frame.ip = instr.Arg
+		return v.jump(frame, instr.Arg)
 	case bytecode.JUMP_IF_FALSE:
 		if len(*stack) == 0 {
 			return fmt.Errorf("vm: JUMP_IF_FALSE on empty stack")
@@ -146,10 +238,12 @@ func (v *VM) step(fi int, instr bytecode.Instruction) error {
 		cond := (*stack)[len(*stack)-1]
 		*stack = (*stack)[:len(*stack)-1]
 		if b, ok := cond.(bool); ok && !b {
-			frame.ip = instr.Arg
+			return v.jump(frame, instr.Arg)
 		}
 	case bytecode.CALL:
 		return v.execCallFast(instr.Arg)
+	case bytecode.TAIL_CALL:
+		return v.execTailCall(fi, instr.Arg)
 	case bytecode.RETURN:
 		return v.execReturnFast()
 	case bytecode.HALT:
@@ -162,18 +256,37 @@ func (v *VM) step(fi int, instr bytecode.Instruction) error {
 
 var errHalt = fmt.Errorf("halt")
 
+// jump moves frame to target, passing a checkpoint when the jump goes
+// backward (see VM.checkpoint).
+func (v *VM) jump(frame *Frame, target int) error {
+	if target < frame.ip {
+		if err := v.checkpoint(); err != nil {
+			return err
+		}
+	}
+	frame.ip = target
+	return nil
+}
+
 func (v *VM) stepSlow(fi int, instr bytecode.Instruction) error {
 	frame := &v.frames[fi]
 	switch instr.Op {
 	case bytecode.ADD_FLOAT, bytecode.SUB_FLOAT, bytecode.MUL_FLOAT, bytecode.DIV_FLOAT,
 		bytecode.MUL_INT, bytecode.DIV_INT, bytecode.MOD_INT, bytecode.ADD_STR:
 		a, b := v.pop2()
+		if instr.Op == bytecode.ADD_STR {
+			as, _ := a.(string)
+			bs, _ := b.(string)
+			if err := v.allocate(int64(len(as) + len(bs))); err != nil {
+				return err
+			}
+		}
 		res, err := v.execArith(instr.Op, a, b)
 		if err != nil {
 			return err
 		}
 		v.stack = append(v.stack, res)
-	case bytecode.EQ_INT, bytecode.EQ_STR, bytecode.EQ_BOOL, bytecode.EQ_NIL, bytecode.EQ_FLOAT,
+	case bytecode.EQ_INT, bytecode.EQ_STR, bytecode.EQ_BOOL, bytecode.EQ_NIL, bytecode.EQ_FLOAT, bytecode.EQ_VALUE,
 		bytecode.GT_INT, bytecode.LTE_INT, bytecode.GTE_INT,
 		bytecode.LT_FLOAT, bytecode.GT_FLOAT, bytecode.LTE_FLOAT, bytecode.GTE_FLOAT,
 		bytecode.AND_BOOL, bytecode.OR_BOOL:
@@ -186,6 +299,13 @@ func (v *VM) stepSlow(fi int, instr bytecode.Instruction) error {
 	case bytecode.IN_LIST:
 		elem, list := v.pop2()
 		v.stack = append(v.stack, v.execInList(elem, list))
+	case bytecode.IN_SET:
+		elem, set := v.pop2()
+		res, err := v.execInSet(elem, set)
+		if err != nil {
+			return err
+		}
+		v.stack = append(v.stack, res)
 	case bytecode.NEG_INT, bytecode.NEG_FLOAT, bytecode.NOT_BOOL:
 		a := v.pop()
 		res, err := v.execUnary(instr.Op, a)
@@ -200,7 +320,7 @@ func (v *VM) stepSlow(fi int, instr bytecode.Instruction) error {
 		cond := v.stack[len(v.stack)-1]
 		v.stack = v.stack[:len(v.stack)-1]
 		if b, ok := cond.(bool); ok && b {
-			frame.ip = instr.Arg
+			return v.jump(frame, instr.Arg)
 		}
 	case bytecode.TRY_OR_RETURN:
 		if len(v.stack) < 1 {
@@ -216,28 +336,69 @@ func (v *VM) stepSlow(fi int, instr bytecode.Instruction) error {
 		if err := v.execCallBuiltin(instr.Arg); err != nil {
 			return err
 		}
+	case bytecode.CALL_METHOD:
+		if err := v.execCallMethod(instr.Arg); err != nil {
+			return err
+		}
+	case bytecode.DEFER:
+		if err := v.execDefer(frame, instr.Arg); err != nil {
+			return err
+		}
 	case bytecode.BUILD_LIST:
+		if err := v.allocate(int64(instr.Arg) * valueSize); err != nil {
+			return err
+		}
 		v.execBuildList(instr.Arg)
 	case bytecode.INDEX:
 		if err := v.execIndex(); err != nil {
 			return err
 		}
+	case bytecode.SLICE:
+		if err := v.execSlice(); err != nil {
+			return err
+		}
+	case bytecode.RANGE:
+		if err := v.execRange(); err != nil {
+			return err
+		}
+	case bytecode.CHECK_STEP:
+		if err := v.execCheckStep(); err != nil {
+			return err
+		}
 	case bytecode.SET_INDEX:
 		if err := v.execSetIndex(); err != nil {
 			return err
 		}
 	case bytecode.BUILD_MAP:
-		v.execBuildMap(instr.Arg)
+		if err := v.allocate(int64(instr.Arg) * 4 * valueSize); err != nil {
+			return err
+		}
+		if err := v.execBuildMap(instr.Arg); err != nil {
+			return err
+		}
+	case bytecode.BUILD_SET:
+		if err := v.allocate(int64(instr.Arg) * 2 * valueSize); err != nil {
+			return err
+		}
+		if err := v.execBuildSet(instr.Arg); err != nil {
+			return err
+		}
 	case bytecode.GET_FIELD:
-		if err := v.execGetField(); err != nil {
+		if err := v.execGetField(instr.Arg); err != nil {
 			return err
 		}
 	case bytecode.SET_FIELD:
-		if err := v.execSetField(); err != nil {
+		if err := v.execSetField(instr.Arg); err != nil {
 			return err
 		}
 	case bytecode.NEW_STRUCT:
-		v.execNewStruct(instr.Arg)
+		if err := v.execNewStruct(instr.Arg); err != nil {
+			return err
+		}
+	case bytecode.WRAP_VALIDATED:
+		if err := v.execWrapValidated(); err != nil {
+			return err
+		}
 	case bytecode.FORMAT_VALUE:
 		if err := v.execFormatValue(instr.Arg); err != nil {
 			return err
@@ -5,8 +5,8 @@ import (
 	"fmt"
 
 	"github.com/jiejie-dev/funny/v2/internal/bytecode"
+	"github.com/jiejie-dev/funny/v2/internal/stdlib"
 	"github.com/jiejie-dev/funny/v2/internal/strfmt"
-	"github.com/jiejie-dev/funny/v2/internal/typederror"
 )
 
 // execArith handles arithmetic operations on the top two stack values.
@@ -29,7 +29,7 @@ func (v *VM) execArith(op bytecode.OpCode, a, b bytecode.Value) (bytecode.Value,
 			return nil, fmt.Errorf("vm: DIV_INT right operand not int")
 		}
 		if bv == 0 {
-			return nil, fmt.Errorf("vm: division by zero")
+			return nil, errorf("E2030", "division by zero")
 		}
 		return av / bv, nil
 	case bytecode.MOD_INT:
@@ -50,18 +50,30 @@ func (v *VM) execArith(op bytecode.OpCode, a, b bytecode.Value) (bytecode.Value,
 
 // execCmp handles comparison and logical operations on the top two stack
 // values. Pops b first, then a, pushes bool result.
+//
+// The EQ_* opcodes name the operand type the compiler expects, which lets
+// them skip straight to a Go comparison; when the operands turn out to be
+// something else (a list, whose tracked type is its element's, or a value
+// the compiler couldn't type) they fall back to stdlib.Equal, the
+// structural equality the evaluator uses too.
 func (v *VM) execCmp(op bytecode.OpCode, a, b bytecode.Value) (bool, error) {
 	switch op {
 	case bytecode.EQ_INT:
-		return a.(int) == b.(int), nil
+		if x, ok := a.(int); ok {
+			if y, ok := b.(int); ok {
+				return x == y, nil
+			}
+		}
+		return stdlib.Equal(a, b), nil
 	case bytecode.EQ_STR:
-		return a.(string) == b.(string), nil
-	case bytecode.EQ_BOOL:
-		return a.(bool) == b.(bool), nil
-	case bytecode.EQ_NIL:
-		return a == nil && b == nil, nil
-	case bytecode.EQ_FLOAT:
-		return a.(float64) == b.(float64), nil
+		if x, ok := a.(string); ok {
+			if y, ok := b.(string); ok {
+				return x == y, nil
+			}
+		}
+		return stdlib.Equal(a, b), nil
+	case bytecode.EQ_BOOL, bytecode.EQ_FLOAT, bytecode.EQ_NIL, bytecode.EQ_VALUE:
+		return stdlib.Equal(a, b), nil
 	case bytecode.LT_INT:
 		return a.(int) < b.(int), nil
 	case bytecode.GT_INT:
@@ -86,20 +98,36 @@ func (v *VM) execCmp(op bytecode.OpCode, a, b bytecode.Value) (bool, error) {
 	return false, fmt.Errorf("vm: unsupported cmp op %s", op)
 }
 
-// execInList implements `elem in list`. Pops list (top) then elem.
+// execInList implements `elem in list`. Pops list (top) then elem, and
+// compares with stdlib.Equal, like `==`. A set reaches it when the
+// compiler couldn't track the right operand's type, and is looked up the
+// way IN_SET looks it up.
 func (v *VM) execInList(elem, list bytecode.Value) bool {
+	if s, ok := list.(*stdlib.Set); ok {
+		return s.Has(elem)
+	}
 	items, ok := list.([]any)
 	if !ok {
 		return false
 	}
 	for _, item := range items {
-		if item == elem {
+		if stdlib.Equal(item, elem) {
 			return true
 		}
 	}
 	return false
 }
 
+// execInSet implements `elem in set` for a right operand the compiler
+// knows is a set.
+func (v *VM) execInSet(elem, set bytecode.Value) (bool, error) {
+	s, ok := set.(*stdlib.Set)
+	if !ok {
+		return false, fmt.Errorf("vm: IN_SET on non-set")
+	}
+	return s.Has(elem), nil
+}
+
 // execUnary handles unary operations on the top stack value.
 func (v *VM) execUnary(op bytecode.OpCode, a bytecode.Value) (bytecode.Value, error) {
 	switch op {
@@ -148,14 +176,23 @@ func (v *VM) execIndex() error {
 	idx := v.stack[len(v.stack)-1]
 	obj := v.stack[len(v.stack)-2]
 	v.stack = v.stack[:len(v.stack)-2]
-	if m, ok := obj.(map[string]bytecode.Value); ok {
+	switch m := obj.(type) {
+	case *stdlib.Map:
+		val, ok := m.Get(idx)
+		if !ok {
+			return errorf("E2051", "key not found: %s", stdlib.Literal(idx))
+		}
+		v.stack = append(v.stack, val)
+		return nil
+	case map[string]bytecode.Value:
+		// A JSON object from parse_json.
 		ks, ok := idx.(string)
 		if !ok {
-			ks = fmt.Sprintf("%v", idx)
+			return fmt.Errorf("vm: INDEX object key not str")
 		}
 		val, ok := m[ks]
 		if !ok {
-			return fmt.Errorf("vm: INDEX map has no key %q", ks)
+			return errorf("E2051", "key not found: %q", ks)
 		}
 		v.stack = append(v.stack, val)
 		return nil
@@ -167,13 +204,20 @@ func (v *VM) execIndex() error {
 	switch val := obj.(type) {
 	case []bytecode.Value:
 		if i < 0 || i >= len(val) {
-			return fmt.Errorf("vm: INDEX list out of range")
+			return errorf("E2051", "index out of bounds")
 		}
 		v.stack = append(v.stack, val[i])
+	case *stdlib.Set:
+		// Only a for-in loop indexes a set (the type checker rejects
+		// `s[i]`): element i in iteration order.
+		if i < 0 || i >= val.Len() {
+			return fmt.Errorf("vm: INDEX set out of range")
+		}
+		v.stack = append(v.stack, val.Elems()[i])
 	case string:
 		runes := []rune(val)
 		if i < 0 || i >= len(runes) {
-			return fmt.Errorf("vm: INDEX string out of range")
+			return errorf("E2051", "index out of bounds")
 		}
 		v.stack = append(v.stack, string(runes[i]))
 	default:
@@ -182,6 +226,60 @@ func (v *VM) execIndex() error {
 	return nil
 }
 
+// execSlice handles SLICE. Pops high, low and object (an omitted bound is
+// nil) and pushes the slice; see stdlib.Slice for the bound rules.
+func (v *VM) execSlice() error {
+	if len(v.stack) < 3 {
+		return fmt.Errorf("vm: SLICE requires 3 stack values")
+	}
+	hi := v.stack[len(v.stack)-1]
+	lo := v.stack[len(v.stack)-2]
+	obj := v.stack[len(v.stack)-3]
+	v.stack = v.stack[:len(v.stack)-3]
+	out, err := stdlib.Slice(obj, lo, hi)
+	if err != nil {
+		return errorf("E2050", "%w", err)
+	}
+	if err := v.allocate(sizeOf(out)); err != nil {
+		return err
+	}
+	v.stack = append(v.stack, out)
+	return nil
+}
+
+// execRange handles RANGE. Pops step, end and start and pushes the list
+// `start..end step k`; see stdlib.InRange for the direction rules.
+func (v *VM) execRange() error {
+	if len(v.stack) < 3 {
+		return fmt.Errorf("vm: RANGE requires 3 stack values")
+	}
+	step := v.stack[len(v.stack)-1]
+	end := v.stack[len(v.stack)-2]
+	start := v.stack[len(v.stack)-3]
+	v.stack = v.stack[:len(v.stack)-3]
+	from, to, by, err := stdlib.RangeArgs(start, end, step)
+	if err != nil {
+		return errorf("E2011", "%w", err)
+	}
+	if err := v.allocate(int64(stdlib.RangeLen(from, to, by)) * valueSize); err != nil {
+		return err
+	}
+	v.stack = append(v.stack, stdlib.Range(from, to, by))
+	return nil
+}
+
+// execCheckStep handles CHECK_STEP, which a for loop over a range runs
+// once on its step when the step isn't a constant.
+func (v *VM) execCheckStep() error {
+	if len(v.stack) == 0 {
+		return fmt.Errorf("vm: CHECK_STEP requires a stack value")
+	}
+	if v.stack[len(v.stack)-1] == 0 {
+		return errorf("E2011", "%w", stdlib.ErrZeroStep)
+	}
+	return nil
+}
+
 // execSetIndex handles SET_INDEX for `obj[idx] = value`. Stack layout on
 // entry (bottom to top): value, object, index. Pops index and object, and
 // leaves value on top of the stack (mirroring STORE_LOCAL's peek-and-store
@@ -201,14 +299,19 @@ func (v *VM) execSetIndex() error {
 			return fmt.Errorf("vm: SET_INDEX list index not int")
 		}
 		if i < 0 || i >= len(o) {
-			return fmt.Errorf("vm: SET_INDEX list out of range")
+			return errorf("E2051", "index out of bounds")
 		}
 		o[i] = val
 		return nil
+	case *stdlib.Map:
+		if err := o.Set(idx, val); err != nil {
+			return errorf("E2050", "%w", err)
+		}
+		return nil
 	case map[string]bytecode.Value:
 		ks, ok := idx.(string)
 		if !ok {
-			ks = fmt.Sprintf("%v", idx)
+			return fmt.Errorf("vm: SET_INDEX object key not str")
 		}
 		o[ks] = val
 		return nil
@@ -216,86 +319,149 @@ func (v *VM) execSetIndex() error {
 	return fmt.Errorf("vm: SET_INDEX on non-list/map")
 }
 
-// execSetField handles SET_FIELD for `obj.field = value`. Stack layout on
-// entry (bottom to top): value, object, field name. Pops field name and object,
+// execSetField handles SET_FIELD infoIdx for `obj.field = value`. Stack
+// layout on entry (bottom to top): value, object. Pops the object and
 // leaves value on top for the compiler's trailing POP.
-func (v *VM) execSetField() error {
-	if len(v.stack) < 3 {
-		return fmt.Errorf("vm: SET_FIELD requires 3 stack values")
-	}
-	fname := v.stack[len(v.stack)-1]
-	obj := v.stack[len(v.stack)-2]
-	val := v.stack[len(v.stack)-3]
-	v.stack = v.stack[:len(v.stack)-2]
-	fs, ok := fname.(string)
+func (v *VM) execSetField(infoIdx int) error {
+	info, ok := v.mod.Constants[infoIdx].(bytecode.FieldInfo)
 	if !ok {
-		return fmt.Errorf("vm: SET_FIELD field name not string")
+		return fmt.Errorf("vm: SET_FIELD operand is not a FieldInfo")
+	}
+	if len(v.stack) < 2 {
+		return fmt.Errorf("vm: SET_FIELD requires 2 stack values")
 	}
+	obj := v.stack[len(v.stack)-1]
+	val := v.stack[len(v.stack)-2]
+	v.stack = v.stack[:len(v.stack)-1]
 	switch o := obj.(type) {
+	case *stdlib.Struct:
+		if i := info.Slot; uint(i) < uint(len(o.Fields)) && o.Type.Fields[i] == info.Name {
+			o.Fields[i] = val
+			return nil
+		}
+		if !o.Set(info.Name, val) {
+			return errorf("E2061", "no field %q", info.Name)
+		}
+		return nil
 	case map[string]bytecode.Value:
-		if _, ok := o[fs]; !ok {
-			return fmt.Errorf("vm: SET_FIELD no field %q", fs)
+		if _, ok := o[info.Name]; !ok {
+			return errorf("E2061", "no field %q", info.Name)
 		}
-		o[fs] = val
+		o[info.Name] = val
 		return nil
+	case *stdlib.Map:
+		if _, ok := o.Get(info.Name); !ok {
+			return errorf("E2061", "no field %q", info.Name)
+		}
+		return o.Set(info.Name, val)
 	}
 	return fmt.Errorf("vm: SET_FIELD on non-map/struct")
 }
 
-// execBuildMap handles BUILD_MAP n. Pops 2n values (alternating key, value), pushes map.
-func (v *VM) execBuildMap(n int) {
-	m := make(map[string]bytecode.Value, n)
-	for i := 0; i < n; i++ {
-		val := v.stack[len(v.stack)-1]
-		v.stack = v.stack[:len(v.stack)-1]
-		key := v.stack[len(v.stack)-1]
-		v.stack = v.stack[:len(v.stack)-1]
-		ks, ok := key.(string)
-		if !ok {
-			ks = fmt.Sprintf("%v", key)
+// execBuildMap handles BUILD_MAP n. Pops 2n values (alternating key,
+// value, the first pair deepest), pushes a *stdlib.Map holding them in
+// that order; a later duplicate key overwrites an earlier one.
+func (v *VM) execBuildMap(n int) error {
+	base := len(v.stack) - 2*n
+	m := stdlib.NewMap(n)
+	for i := base; i < len(v.stack); i += 2 {
+		if err := m.Set(v.stack[i], v.stack[i+1]); err != nil {
+			return errorf("E2050", "%w", err)
 		}
-		m[ks] = val
 	}
-	v.stack = append(v.stack, m)
+	v.stack = append(v.stack[:base], m)
+	return nil
 }
 
-// execGetField handles GET_FIELD. Pops field name then object, pushes value.
-func (v *VM) execGetField() error {
-	if len(v.stack) < 2 {
-		return fmt.Errorf("vm: GET_FIELD requires 2 stack values")
+// execBuildSet handles BUILD_SET n. Pops n elements (the first deepest)
+// and pushes a *stdlib.Set holding them in that order, without repeats.
+func (v *VM) execBuildSet(n int) error {
+	base := len(v.stack) - n
+	s := stdlib.NewSet(n)
+	for _, e := range v.stack[base:] {
+		if err := s.Add(e); err != nil {
+			return errorf("E2050", "%w", err)
+		}
 	}
-	fname := v.stack[len(v.stack)-1]
-	obj := v.stack[len(v.stack)-2]
-	v.stack = v.stack[:len(v.stack)-2]
-	fs, ok := fname.(string)
+	v.stack = append(v.stack[:base], s)
+	return nil
+}
+
+// execGetField handles GET_FIELD infoIdx. Pops the object, pushes the
+// field's value: from its slot when the operand has one, else by name (nil
+// for a field the object lacks, as for a Result's missing `val`).
+func (v *VM) execGetField(infoIdx int) error {
+	info, ok := v.mod.Constants[infoIdx].(bytecode.FieldInfo)
 	if !ok {
-		return fmt.Errorf("vm: GET_FIELD field name not string")
+		return fmt.Errorf("vm: GET_FIELD operand is not a FieldInfo")
 	}
-	switch o := obj.(type) {
-	case map[string]bytecode.Value:
-		if val, ok := o[fs]; ok {
-			v.stack = append(v.stack, val)
-		} else {
-			v.stack = append(v.stack, nil)
+	top := len(v.stack) - 1
+	if top < 0 {
+		return fmt.Errorf("vm: GET_FIELD on empty stack")
+	}
+	switch o := v.stack[top].(type) {
+	case *stdlib.Struct:
+		// The slot is trusted only while it still holds the field, so a
+		// value whose type the compiler got wrong reads by name instead.
+		if i := info.Slot; uint(i) < uint(len(o.Fields)) && o.Type.Fields[i] == info.Name {
+			v.stack[top] = o.Fields[i]
+			return nil
 		}
+		v.stack[top], _ = o.Get(info.Name)
+	case map[string]bytecode.Value:
+		v.stack[top] = o[info.Name]
+	case *stdlib.Map:
+		v.stack[top], _ = o.Get(info.Name)
 	default:
 		return fmt.Errorf("vm: GET_FIELD on non-map/struct")
 	}
 	return nil
 }
 
-// execNewStruct tags the map on top of the stack with its struct type name.
-func (v *VM) execNewStruct(typeIdx int) {
-	if len(v.stack) < 1 {
-		return
+// execNewStruct handles NEW_STRUCT infoIdx: it pops one value per field of
+// the StructInfo's type and pushes the struct holding them.
+func (v *VM) execNewStruct(infoIdx int) error {
+	info, ok := v.mod.Constants[infoIdx].(*bytecode.StructInfo)
+	if !ok {
+		return fmt.Errorf("vm: NEW_STRUCT operand is not a StructInfo")
+	}
+	n := len(info.Fields)
+	if len(v.stack) < n {
+		return fmt.Errorf("vm: NEW_STRUCT %s expects %d fields, got %d", info.Name, n, len(v.stack))
+	}
+	if v.structTypes == nil {
+		v.structTypes = make(map[*bytecode.StructInfo]*stdlib.StructType)
 	}
-	m, ok := v.stack[len(v.stack)-1].(map[string]any)
+	t, ok := v.structTypes[info]
 	if !ok {
-		return
+		t = stdlib.NewStructType(info.Name, info.Fields)
+		v.structTypes[info] = t
 	}
-	if typeName, ok := v.mod.Constants[typeIdx].(string); ok {
-		m[typederror.StructTypeField] = typeName
+	base := len(v.stack) - n
+	fields := make([]bytecode.Value, n)
+	copy(fields, v.stack[base:])
+	v.stack = append(v.stack[:base], &stdlib.Struct{Type: t, Fields: fields})
+	return nil
+}
+
+// execWrapValidated handles WRAP_VALIDATED: [struct, result] → result if
+// it is an err, else ok(struct).
+func (v *VM) execWrapValidated() error {
+	if len(v.stack) < 2 {
+		return fmt.Errorf("vm: WRAP_VALIDATED needs a struct and a Result")
 	}
+	n := len(v.stack)
+	s, res := v.stack[n-2], v.stack[n-1]
+	v.stack = v.stack[:n-2]
+	if !isResult(res) {
+		return fmt.Errorf("vm: validate must return a Result, got %T", res)
+	}
+	if resultTag(res) == "err" {
+		v.stack = append(v.stack, res)
+	} else {
+		v.stack = append(v.stack, makeResult("ok", s))
+	}
+	return nil
 }
 
 // execFormatValue handles FORMAT_VALUE specIdx. Pops a value, formats it
@@ -312,7 +478,7 @@ func (v *VM) execFormatValue(specIdx int) error {
 	val := v.stack[len(v.stack)-1]
 	s, err := strfmt.Format(val, spec)
 	if err != nil {
-		return fmt.Errorf("vm: %v", err)
+		return errorf("E2090", "%w", err)
 	}
 	v.stack[len(v.stack)-1] = s
 	return nil
@@ -8,6 +8,8 @@ import (
 	"testing"
 
 	"github.com/jiejie-dev/funny/v2/internal/bytecode"
+	"github.com/jiejie-dev/funny/v2/internal/stdlib"
+	"github.com/jiejie-dev/funny/v2/internal/typederror"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -380,9 +382,10 @@ func TestVM_BuildMap(t *testing.T) {
 	main.Emit(bytecode.BUILD_MAP, 1)
 	main.Emit(bytecode.HALT, 0)
 	v := runModule(t, main, nil, "k", 42)
-	m, ok := v.(map[string]bytecode.Value)
+	m, ok := v.(*stdlib.Map)
 	require.True(t, ok)
-	assert.Equal(t, 42, m["k"])
+	got, _ := m.Get("k")
+	assert.Equal(t, 42, got)
 }
 
 func TestVM_IndexMap(t *testing.T) {
@@ -466,10 +469,9 @@ func TestVM_GetField(t *testing.T) {
 	main.Emit(bytecode.PUSH_STR, 0) // "k"
 	main.Emit(bytecode.PUSH_INT, 1) // 99
 	main.Emit(bytecode.BUILD_MAP, 1)
-	main.Emit(bytecode.PUSH_STR, 0) // "k" (field name, same deduped constant)
-	main.Emit(bytecode.GET_FIELD, 0)
+	main.Emit(bytecode.GET_FIELD, 2) // FieldInfo{"k", -1}: by name
 	main.Emit(bytecode.HALT, 0)
-	v := runModule(t, main, nil, "k", 99)
+	v := runModule(t, main, nil, "k", 99, bytecode.FieldInfo{Name: "k", Slot: -1})
 	assert.Equal(t, 99, v)
 }
 
@@ -482,28 +484,42 @@ func TestVM_SetField(t *testing.T) {
 	fn.Emit(bytecode.POP, 0)
 	fn.Emit(bytecode.PUSH_INT, 2) // value 5
 	fn.Emit(bytecode.LOAD_LOCAL, 0)
-	fn.Emit(bytecode.PUSH_STR, 0) // "count"
-	fn.Emit(bytecode.SET_FIELD, 0)
+	fn.Emit(bytecode.SET_FIELD, 3) // FieldInfo{"count", -1}
 	fn.Emit(bytecode.POP, 0)
 	fn.Emit(bytecode.LOAD_LOCAL, 0)
-	fn.Emit(bytecode.PUSH_STR, 0) // "count"
-	fn.Emit(bytecode.GET_FIELD, 0)
+	fn.Emit(bytecode.GET_FIELD, 3)
 	fn.Emit(bytecode.HALT, 0)
-	v := runModule(t, fn, nil, "count", 0, 5)
+	v := runModule(t, fn, nil, "count", 0, 5, bytecode.FieldInfo{Name: "count", Slot: -1})
 	assert.Equal(t, 5, v)
 }
 
 func TestVM_NewStruct(t *testing.T) {
-	main := &bytecode.Function{Name: "main", Arity: 0}
-	main.Emit(bytecode.PUSH_STR, 0) // "k"
+	info := &bytecode.StructInfo{Name: "User", Fields: []string{"name", "age"}}
+	main := &bytecode.Function{Name: "main", Arity: 0, NumLocals: 1}
+	main.Emit(bytecode.PUSH_STR, 0) // "ann"
 	main.Emit(bytecode.PUSH_INT, 1) // 7
-	main.Emit(bytecode.BUILD_MAP, 1)
-	main.Emit(bytecode.NEW_STRUCT, 0) // type name at constant[0] = "User"
+	main.Emit(bytecode.NEW_STRUCT, 2)
+	main.Emit(bytecode.STORE_LOCAL, 0)
+	main.Emit(bytecode.PUSH_INT, 5) // 8
+	main.Emit(bytecode.LOAD_LOCAL, 0)
+	main.Emit(bytecode.SET_FIELD, 3) // age, by slot
+	main.Emit(bytecode.POP, 0)
+	main.Emit(bytecode.GET_FIELD, 4) // name, by name
 	main.Emit(bytecode.HALT, 0)
-	v := runModule(t, main, nil, "k", 7) // note: constant[0] is "k" but NEW_STRUCT arg unused
-	m, ok := v.(map[string]bytecode.Value)
-	require.True(t, ok)
-	assert.Equal(t, 7, m["k"])
+	mod := bytecode.NewModule("test")
+	mod.AddFunction(main)
+	for _, c := range []bytecode.Value{"ann", 7, info,
+		bytecode.FieldInfo{Name: "age", Slot: 1}, bytecode.FieldInfo{Name: "name", Slot: -1}, 8} {
+		mod.AddConstant(c)
+	}
+	m := New(mod)
+	v, err := m.Run()
+	require.NoError(t, err)
+	assert.Equal(t, "ann", v)
+	s := m.frames[0].locals[0].(*stdlib.Struct)
+	assert.Equal(t, []bytecode.Value{"ann", 8}, s.Fields)
+	assert.Equal(t, map[string]any{"__type": "User", "name": "ann", "age": 8}, s.Map())
+	assert.Equal(t, "User", typederror.TypeOf(s))
 }
 
 func TestVM_ResultOK(t *testing.T) {
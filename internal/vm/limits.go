@@ -0,0 +1,175 @@
+package vm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/metrics"
+
+	"github.com/jiejie-dev/funny/v2/internal/bytecode"
+)
+
+// Errors that stop a run from outside the program. Whatever a run returns
+// after one of them wraps it, so callers tell them apart with errors.Is; a
+// cancelled run's error also wraps its context's error
+// (context.Canceled or context.DeadlineExceeded).
+var (
+	ErrCancelled        = errors.New("vm: cancelled")
+	ErrInstructionLimit = errors.New("vm: instruction limit exceeded")
+	ErrCallDepthLimit   = errors.New("vm: call depth limit exceeded")
+	ErrHeapLimit        = errors.New("vm: heap limit exceeded")
+)
+
+// Limits bounds the resources a run may use. A zero field means no limit.
+type Limits struct {
+	// MaxInstructions is the number of instructions the run may execute.
+	// It is checked at calls, returns and backward jumps, so a run stops
+	// within one straight-line stretch of code past it.
+	MaxInstructions int64
+	// MaxCallDepth is the number of call frames that may be active at
+	// once (main included), which bounds recursion.
+	MaxCallDepth int
+	// MaxHeapBytes is how far the Go heap may grow while the run is in
+	// progress. It's approximate: the heap is shared with the rest of the
+	// process and sampled every pollInterval instructions, and whenever
+	// the instructions that build strings and collections have allocated
+	// more than the room left at the last sample (see VM.allocate).
+	MaxHeapBytes int64
+}
+
+// pollInterval is how many instructions pass between checks of the
+// context and the heap, which cost more than the instruction count.
+const pollInterval = 1 << 12
+
+// heapMetric is the runtime metric MaxHeapBytes is measured against.
+const heapMetric = "/memory/classes/heap/objects:bytes"
+
+// SetLimits sets the limits later runs are held to.
+func (v *VM) SetLimits(l Limits) {
+	v.limits = l
+}
+
+// RunContext is Run, stopping with an error wrapping ErrCancelled once ctx
+// is done. The context is polled, not watched: a run notices within
+// pollInterval instructions of a call, return or backward jump.
+func (v *VM) RunContext(ctx context.Context) (bytecode.Value, error) {
+	v.ctx = ctx
+	defer func() { v.ctx = nil }()
+	return v.runFrom(0)
+}
+
+// startBudget resets the per-run counters checkpoint compares against.
+func (v *VM) startBudget() {
+	v.steps = 0
+	v.nextPoll = pollInterval
+	v.heapBase = 0
+	v.heapUsed = 0
+	if v.limits.MaxHeapBytes > 0 {
+		v.heapBase = heapBytes()
+	}
+}
+
+// checkpoint stops the run if it has gone over its instruction budget,
+// or, every pollInterval instructions, if its context is done or the heap
+// has grown past its limit. runFrames calls it on every call and return
+// and on backward jumps and tail calls, which every long-running program
+// reaches.
+func (v *VM) checkpoint() error {
+	if max := v.limits.MaxInstructions; max > 0 && v.steps > max {
+		return fmt.Errorf("%w (%d)", ErrInstructionLimit, max)
+	}
+	if v.steps < v.nextPoll {
+		return nil
+	}
+	v.nextPoll = v.steps + pollInterval
+	if v.ctx != nil {
+		select {
+		case <-v.ctx.Done():
+			return fmt.Errorf("%w: %w", ErrCancelled, v.ctx.Err())
+		default:
+		}
+	}
+	if max := v.limits.MaxHeapBytes; max > 0 {
+		v.heapUsed = heapBytes() - v.heapBase
+		if v.heapUsed > max {
+			return fmt.Errorf("%w (%d bytes)", ErrHeapLimit, max)
+		}
+	}
+	return nil
+}
+
+// allocate is called before an instruction allocates about n bytes for a
+// value it builds (a concatenated string, a list, map or set), and fails
+// it if that would take the heap past MaxHeapBytes. Polling alone isn't
+// enough: a loop doubling a string reaches gigabytes within a few hundred
+// instructions, and a Go allocation that big kills the process, which a
+// returned error doesn't. The heap is only sampled again once the bytes
+// charged since the last sample exceed the room left then, so small
+// allocations cost an addition.
+func (v *VM) allocate(n int64) error {
+	max := v.limits.MaxHeapBytes
+	if max <= 0 {
+		return nil
+	}
+	v.heapUsed += n
+	if v.heapUsed <= max {
+		return nil
+	}
+	v.heapUsed = heapBytes() - v.heapBase + n
+	if v.heapUsed > max {
+		return fmt.Errorf("%w (%d bytes)", ErrHeapLimit, max)
+	}
+	return nil
+}
+
+// valueSize is the bytes one element of a list takes (an interface
+// value), which allocate estimates collections by.
+const valueSize = 16
+
+// sizeOf estimates the bytes a string or list value holds, for allocate.
+func sizeOf(val bytecode.Value) int64 {
+	switch x := val.(type) {
+	case string:
+		return int64(len(x))
+	case []bytecode.Value:
+		return int64(len(x)) * valueSize
+	}
+	return 0
+}
+
+// checkCallDepth fails a call that would push more frames than the limit.
+func (v *VM) checkCallDepth() error {
+	if max := v.limits.MaxCallDepth; max > 0 && len(v.frames) >= max {
+		return fmt.Errorf("%w (%d)", ErrCallDepthLimit, max)
+	}
+	return nil
+}
+
+// stopped reports whether err stopped the run from outside the program.
+func stopped(err error) bool {
+	return errors.Is(err, ErrCancelled) || errors.Is(err, ErrInstructionLimit) ||
+		errors.Is(err, ErrCallDepthLimit) || errors.Is(err, ErrHeapLimit)
+}
+
+// suspendLimits lifts the context and the instruction and heap limits
+// until the returned function restores them, the way the evaluator
+// suspends cancellation while deferred calls run: cleanup registered
+// before a run was stopped still runs to completion. The call depth limit
+// stays, as unwinding has already popped the frames that reached it.
+func (v *VM) suspendLimits() (restore func()) {
+	ctx, limits := v.ctx, v.limits
+	v.ctx = nil
+	v.limits = Limits{MaxCallDepth: limits.MaxCallDepth}
+	return func() { v.ctx, v.limits = ctx, limits }
+}
+
+// heapBytes samples the size of the Go heap's live and not-yet-swept
+// objects.
+func heapBytes() int64 {
+	sample := []metrics.Sample{{Name: heapMetric}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() != metrics.KindUint64 {
+		return 0
+	}
+	return int64(sample[0].Value.Uint64())
+}
@@ -0,0 +1,184 @@
+package vm
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jiejie-dev/funny/v2/internal/bytecode"
+	"github.com/jiejie-dev/funny/v2/internal/compiler"
+	"github.com/jiejie-dev/funny/v2/internal/errs"
+	"github.com/jiejie-dev/funny/v2/internal/parser"
+	"github.com/jiejie-dev/funny/v2/internal/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func compileSrc(t *testing.T, src string) *bytecode.Module {
+	t.Helper()
+	prog, err := parser.New(src, "t.fn").Parse()
+	require.NoError(t, err)
+	require.NoError(t, types.Check(prog, types.NewEnv(nil)))
+	mod, err := compiler.Compile(prog, "t.fn")
+	require.NoError(t, err)
+	return mod
+}
+
+const spinSrc = `let n = 0
+while true:
+    n = n + 1
+`
+
+func TestLimits_InstructionBudget(t *testing.T) {
+	m := New(compileSrc(t, spinSrc))
+	m.SetLimits(Limits{MaxInstructions: 10_000})
+	_, err := m.Run()
+	require.ErrorIs(t, err, ErrInstructionLimit)
+	assert.False(t, errors.Is(err, ErrCancelled))
+	assert.Less(t, m.steps, int64(10_100))
+
+	// A program within budget runs to completion.
+	m = New(compileSrc(t, "let x = 1 + 2\nx\n"))
+	m.SetLimits(Limits{MaxInstructions: 10_000})
+	v, err := m.Run()
+	require.NoError(t, err)
+	assert.Equal(t, 3, v)
+}
+
+func TestLimits_RunContextCancels(t *testing.T) {
+	m := New(compileSrc(t, spinSrc))
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := m.RunContext(ctx)
+	require.ErrorIs(t, err, ErrCancelled)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestLimits_CallDepth(t *testing.T) {
+	m := New(compileSrc(t, `fn down(n: int) -> int:
+    return down(n + 1) + 1
+down(0)
+`))
+	m.SetLimits(Limits{MaxCallDepth: 100})
+	_, err := m.Run()
+	require.ErrorIs(t, err, ErrCallDepthLimit)
+	assert.Empty(t, m.frames)
+}
+
+// A tail-recursive function runs in one frame, so the depth limit doesn't
+// stop it; the instruction budget still does.
+func TestLimits_TailCallsRunInOneFrame(t *testing.T) {
+	m := New(compileSrc(t, `fn count(n: int, acc: int) -> int:
+    if n == 0:
+        return acc
+    return count(n - 1, acc + 1)
+
+count(100000, 0)
+`))
+	m.SetLimits(Limits{MaxCallDepth: 10})
+	got, err := m.Run()
+	require.NoError(t, err)
+	assert.Equal(t, 100000, got)
+
+	m = New(compileSrc(t, `fn spin(n: int) -> int:
+    return spin(n + 1)
+
+spin(0)
+`))
+	m.SetLimits(Limits{MaxInstructions: 100000})
+	_, err = m.Run()
+	require.ErrorIs(t, err, ErrInstructionLimit)
+	assert.Empty(t, m.frames)
+}
+
+func TestLimits_Heap(t *testing.T) {
+	m := New(compileSrc(t, `let seen: map[int, str] = {}
+let i = 0
+while true:
+    seen[i] = to_str(i)
+    i = i + 1
+`))
+	m.SetLimits(Limits{MaxHeapBytes: 16 << 20})
+	_, err := m.Run()
+	require.ErrorIs(t, err, ErrHeapLimit)
+}
+
+// A string doubled in a loop outgrows any poll interval: the limit must
+// be enforced before the allocation that would crash the process.
+func TestLimits_HeapCheckedBeforeAllocating(t *testing.T) {
+	m := New(compileSrc(t, `let s = "0123456789abcdef"
+let i = 0
+while i < 40:
+    s = s + s
+    i = i + 1
+len(s)
+`))
+	m.SetLimits(Limits{MaxHeapBytes: 8 << 20})
+	_, err := m.Run()
+	require.ErrorIs(t, err, ErrHeapLimit)
+	assert.Less(t, m.steps, int64(pollInterval), "stopped before the first heap poll")
+	var diag *errs.Error
+	require.ErrorAs(t, err, &diag)
+	assert.Equal(t, "E3004", diag.Code)
+
+	m = New(compileSrc(t, "let xs = 0..1000000000000\nlen(xs)\n"))
+	m.SetLimits(Limits{MaxHeapBytes: 8 << 20})
+	_, err = m.Run()
+	require.ErrorIs(t, err, ErrHeapLimit)
+}
+
+// stoppedSpinSrc loops until the run is stopped. Its deferred call loops
+// too, past both the instruction budget below and a poll of the context,
+// so it only finishes if they are suspended while it runs.
+const stoppedSpinSrc = `fn cleanup():
+    let i = 0
+    while i < 5000:
+        i = i + 1
+    println("cleanup " + to_str(i))
+
+fn spin() -> int:
+    defer cleanup()
+    let n = 0
+    while true:
+        n = n + 1
+    return n
+spin()
+`
+
+// captureStdout returns what run prints to stdout.
+func captureStdout(t *testing.T, run func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	stdout := os.Stdout
+	os.Stdout = w
+	run()
+	os.Stdout = stdout
+	require.NoError(t, w.Close())
+	printed, err := io.ReadAll(r)
+	require.NoError(t, err)
+	return string(printed)
+}
+
+func TestLimits_StopRunsDefers(t *testing.T) {
+	m := New(compileSrc(t, stoppedSpinSrc))
+	m.SetLimits(Limits{MaxInstructions: 1000})
+	var err error
+	printed := captureStdout(t, func() { _, err = m.Run() })
+	require.ErrorIs(t, err, ErrInstructionLimit)
+	assert.Equal(t, "cleanup 5000\n", printed)
+	assert.Equal(t, int64(1000), m.limits.MaxInstructions)
+}
+
+func TestLimits_CancelRunsDefers(t *testing.T) {
+	m := New(compileSrc(t, stoppedSpinSrc))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var err error
+	printed := captureStdout(t, func() { _, err = m.RunContext(ctx) })
+	require.ErrorIs(t, err, ErrCancelled)
+	assert.Equal(t, "cleanup 5000\n", printed)
+}
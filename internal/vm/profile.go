@@ -0,0 +1,271 @@
+package vm
+
+import (
+	"compress/gzip"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/jiejie-dev/funny/v2/internal/errs"
+)
+
+// DefaultProfilePeriod is the number of instructions between the samples
+// `funny run --profile` takes.
+const DefaultProfilePeriod = 1000
+
+// Profiler samples the funny call stack of the runs of the VM it's
+// attached to (see SetProfiler) once every period instructions, and
+// writes what it saw as a pprof profile (see Write), with funny functions
+// and source lines as its symbols. Sampling counts instructions, not
+// time, so a profile is the same from run to run, and a builtin call
+// counts as one instruction however long it takes.
+type Profiler struct {
+	period    int64
+	countdown int64
+	start     time.Time
+	samples   map[string]*profileSample // keyed by stack; see tick
+	order     []*profileSample          // samples in the order first seen
+}
+
+// profileSample is one distinct call stack and how often it was seen.
+type profileSample struct {
+	stack []errs.Frame // innermost call first; Pos is 0-based
+	count int64
+}
+
+// NewProfiler returns a profiler that samples every period instructions
+// (DefaultProfilePeriod if period isn't positive).
+func NewProfiler(period int64) *Profiler {
+	if period <= 0 {
+		period = DefaultProfilePeriod
+	}
+	return &Profiler{
+		period:    period,
+		countdown: period,
+		start:     time.Now(),
+		samples:   map[string]*profileSample{},
+	}
+}
+
+// SetProfiler attaches p to the VM's later runs; nil detaches it. A
+// profiled run goes through the same per-instruction loop as a debugged
+// one, so it runs slower than an unprofiled run.
+func (v *VM) SetProfiler(p *Profiler) {
+	v.prof = p
+}
+
+// tick counts one instruction, sampling v's call stack when the period is
+// up. runFramesDebug calls it with the instruction about to execute
+// already fetched, so frameLoc finds it for the innermost frame.
+func (p *Profiler) tick(v *VM) {
+	if p.countdown--; p.countdown > 0 {
+		return
+	}
+	p.countdown = p.period
+	stack := make([]errs.Frame, 0, len(v.frames))
+	var key strings.Builder
+	for i := len(v.frames) - 1; i >= 0; i-- {
+		frame := &v.frames[i]
+		f := errs.Frame{Function: frame.fn.Name, Pos: frameLoc(frame)}
+		stack = append(stack, f)
+		key.WriteString(f.Function)
+		key.WriteByte(0)
+		key.WriteString(f.Pos.Display())
+		key.WriteByte(0)
+	}
+	s, ok := p.samples[key.String()]
+	if !ok {
+		s = &profileSample{stack: stack}
+		p.samples[key.String()] = s
+		p.order = append(p.order, s)
+	}
+	s.count++
+}
+
+// Write writes the samples taken so far to w as a gzipped pprof profile
+// (the format `go tool pprof` reads). Each sample counts its hits and the
+// instructions they stand for; each location is a funny source line, and
+// its function is the funny function around it.
+func (p *Profiler) Write(w io.Writer) error {
+	zw := gzip.NewWriter(w)
+	if _, err := zw.Write(p.encode()); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// encode returns the profile as a perftools.profiles.Profile message; see
+// https://github.com/google/pprof/blob/main/proto/profile.proto for the
+// field numbers.
+func (p *Profiler) encode() []byte {
+	strs := map[string]int64{"": 0}
+	strTable := []string{""}
+	str := func(s string) int64 {
+		if i, ok := strs[s]; ok {
+			return i
+		}
+		strs[s] = int64(len(strTable))
+		strTable = append(strTable, s)
+		return strs[s]
+	}
+	type funcKey struct{ name, file string }
+	funcs := map[funcKey]uint64{}
+	var funcOrder []funcKey
+	type locKey struct {
+		fn   uint64
+		line int
+	}
+	locs := map[locKey]uint64{}
+	var locOrder []locKey
+
+	var b protoBuffer
+	valueType := func(field int, typ, unit string) {
+		b.message(field, func(b *protoBuffer) {
+			b.int64(1, str(typ))
+			b.int64(2, str(unit))
+		})
+	}
+	valueType(1, "samples", "count")
+	valueType(1, "instructions", "count")
+	for _, s := range p.order {
+		ids := make([]uint64, len(s.stack))
+		for i, f := range s.stack {
+			fk := funcKey{f.Function, f.Pos.File}
+			fid, ok := funcs[fk]
+			if !ok {
+				fid = uint64(len(funcOrder) + 1)
+				funcs[fk] = fid
+				funcOrder = append(funcOrder, fk)
+			}
+			line := 0
+			if f.Pos != (errs.Position{}) {
+				line = f.Pos.Line + 1
+			}
+			lk := locKey{fid, line}
+			lid, ok := locs[lk]
+			if !ok {
+				lid = uint64(len(locOrder) + 1)
+				locs[lk] = lid
+				locOrder = append(locOrder, lk)
+			}
+			ids[i] = lid
+		}
+		b.message(2, func(b *protoBuffer) {
+			b.packedUint64(1, ids)
+			b.packedInt64(2, []int64{s.count, s.count * p.period})
+		})
+	}
+	// One mapping, flagged as fully symbolized, so pprof doesn't look for
+	// a binary to symbolize the locations against.
+	b.message(3, func(b *protoBuffer) {
+		b.uint64(1, 1)
+		b.bool(7, true)
+		b.bool(8, true)
+		b.bool(9, true)
+	})
+	for i, lk := range locOrder {
+		b.message(4, func(b *protoBuffer) {
+			b.uint64(1, uint64(i+1))
+			b.uint64(2, 1)
+			b.message(4, func(b *protoBuffer) {
+				b.uint64(1, lk.fn)
+				b.int64(2, int64(lk.line))
+			})
+		})
+	}
+	for i, fk := range funcOrder {
+		b.message(5, func(b *protoBuffer) {
+			b.uint64(1, uint64(i+1))
+			b.int64(2, str(fk.name))
+			b.int64(3, str(fk.name))
+			b.int64(4, str(fk.file))
+		})
+	}
+	periodType := str("instructions")
+	countUnit := str("count")
+	b.int64(9, p.start.UnixNano())
+	b.int64(10, int64(time.Since(p.start)))
+	b.message(11, func(b *protoBuffer) {
+		b.int64(1, periodType)
+		b.int64(2, countUnit)
+	})
+	b.int64(12, p.period)
+	// The string table goes last, once everything above has added to it.
+	for _, s := range strTable {
+		b.string(6, s)
+	}
+	return b.data
+}
+
+// protoBuffer appends protocol buffer fields to data. Only the wire types
+// a pprof profile uses are supported: varints, and length-delimited
+// strings, packed varints and messages.
+type protoBuffer struct {
+	data []byte
+}
+
+func (b *protoBuffer) varint(x uint64) {
+	for x >= 0x80 {
+		b.data = append(b.data, byte(x)|0x80)
+		x >>= 7
+	}
+	b.data = append(b.data, byte(x))
+}
+
+// tag appends a field's key: its number and wire type (0 varint, 2
+// length-delimited).
+func (b *protoBuffer) tag(field, wireType int) {
+	b.varint(uint64(field)<<3 | uint64(wireType))
+}
+
+// uint64 appends a varint field; a zero value, the default, is omitted.
+func (b *protoBuffer) uint64(field int, x uint64) {
+	if x == 0 {
+		return
+	}
+	b.tag(field, 0)
+	b.varint(x)
+}
+
+func (b *protoBuffer) int64(field int, x int64) {
+	b.uint64(field, uint64(x))
+}
+
+func (b *protoBuffer) bool(field int, x bool) {
+	if x {
+		b.uint64(field, 1)
+	}
+}
+
+// string appends a string field. Unlike the scalars it's written even when
+// empty, since string_table must start with "".
+func (b *protoBuffer) string(field int, s string) {
+	b.tag(field, 2)
+	b.varint(uint64(len(s)))
+	b.data = append(b.data, s...)
+}
+
+func (b *protoBuffer) packedUint64(field int, xs []uint64) {
+	b.message(field, func(b *protoBuffer) {
+		for _, x := range xs {
+			b.varint(x)
+		}
+	})
+}
+
+func (b *protoBuffer) packedInt64(field int, xs []int64) {
+	b.message(field, func(b *protoBuffer) {
+		for _, x := range xs {
+			b.varint(uint64(x))
+		}
+	})
+}
+
+// message appends a length-delimited field holding what body appends.
+func (b *protoBuffer) message(field int, body func(*protoBuffer)) {
+	var inner protoBuffer
+	body(&inner)
+	b.tag(field, 2)
+	b.varint(uint64(len(inner.data)))
+	b.data = append(b.data, inner.data...)
+}
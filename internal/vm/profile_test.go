@@ -0,0 +1,81 @@
+package vm
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProfiler_AttributesSamplesToFunctionsAndLines(t *testing.T) {
+	m := New(compileSrc(t, `fn busy() -> int:
+    let s = 0
+    for i in 0..20000:
+        s = s + i
+    return s
+
+busy()
+`))
+	p := NewProfiler(100)
+	m.SetProfiler(p)
+	_, err := m.Run()
+	require.NoError(t, err)
+
+	require.NotEmpty(t, p.order)
+	var total, inBusy int64
+	for _, s := range p.order {
+		total += s.count
+		require.NotEmpty(t, s.stack)
+		assert.Equal(t, "main", s.stack[len(s.stack)-1].Function)
+		if s.stack[0].Function == "busy" {
+			inBusy += s.count
+			assert.Contains(t, []int{1, 2, 3, 4}, s.stack[0].Pos.Line)
+			assert.Equal(t, 6, s.stack[1].Pos.Line, "main's frame is at the call")
+		}
+	}
+	assert.Equal(t, m.steps/100, total)
+	assert.Greater(t, inBusy, total*9/10)
+}
+
+func TestProfiler_WritesGzippedProfile(t *testing.T) {
+	m := New(compileSrc(t, `fn sq(n: int) -> int:
+    return n * n
+
+let s = 0
+for i in 0..5000:
+    s = s + sq(i)
+`))
+	p := NewProfiler(10)
+	m.SetProfiler(p)
+	_, err := m.Run()
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, p.Write(&buf))
+	zr, err := gzip.NewReader(&buf)
+	require.NoError(t, err)
+	data, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	assert.Equal(t, p.encode()[:8], data[:8], "the profile starts with its sample types")
+	for _, s := range []string{"samples", "instructions", "count", "sq", "main", "t.fn"} {
+		assert.Contains(t, string(data), s)
+	}
+}
+
+func TestProtoBuffer_Encoding(t *testing.T) {
+	var b protoBuffer
+	b.uint64(1, 300)
+	b.int64(2, 0) // omitted
+	b.string(6, "")
+	b.packedUint64(1, []uint64{1, 2})
+	b.message(4, func(b *protoBuffer) { b.bool(7, true) })
+	assert.Equal(t, []byte{
+		0x08, 0xac, 0x02, // field 1 varint 300
+		0x32, 0x00, // field 6, ""
+		0x0a, 0x02, 0x01, 0x02, // field 1 packed [1 2]
+		0x22, 0x02, 0x38, 0x01, // field 4 {field 7: true}
+	}, b.data)
+}
@@ -0,0 +1,107 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jiejie-dev/funny/v2/internal/errs"
+)
+
+// Runtime error codes. A failure the evaluator also reports keeps the
+// evaluator's code (E2030 division by zero, E2051 index out of bounds and
+// so on); the E3xxx codes are the VM's own.
+const (
+	codeInternal     = "E3000" // malformed bytecode, which is a compiler bug
+	codeCancelled    = "E3001"
+	codeInstructions = "E3002"
+	codeCallDepth    = "E3003"
+	codeHeap         = "E3004"
+	codeBuiltin      = "E3010" // a builtin call failed
+)
+
+// runtimeError is a failure the program itself can cause (as opposed to
+// malformed bytecode), with the code it's reported under.
+type runtimeError struct {
+	code string
+	err  error
+}
+
+func (e *runtimeError) Error() string { return "vm: " + e.err.Error() }
+
+func (e *runtimeError) Unwrap() error { return e.err }
+
+// errorf returns a runtime error reported under code; format may use %w.
+func errorf(code, format string, args ...any) error {
+	return &runtimeError{code: code, err: fmt.Errorf(format, args...)}
+}
+
+// codeOf returns the code err is reported under.
+func codeOf(err error) string {
+	var re *runtimeError
+	switch {
+	case errors.As(err, &re):
+		return re.code
+	case errors.Is(err, ErrCancelled):
+		return codeCancelled
+	case errors.Is(err, ErrInstructionLimit):
+		return codeInstructions
+	case errors.Is(err, ErrCallDepthLimit):
+		return codeCallDepth
+	case errors.Is(err, ErrHeapLimit):
+		return codeHeap
+	}
+	return codeInternal
+}
+
+// traced returns err as an *errs.Error with its code and the funny stack
+// trace of the frames active now, innermost first, each with the number
+// of calls tail calls elided from it. A run of identical frames, as deep
+// recursion leaves, is folded into its first (see
+// errs.Frame.Repeated). It wraps err, so errors.Is still finds
+// ErrCancelled and the other sentinels. An error that already carries a
+// trace (one raised inside a deferred call, say) is returned as it is, as
+// is the debugger's quit.
+func (v *VM) traced(err error) error {
+	var diag *errs.Error
+	if err == nil || errors.Is(err, errDebugStopped) || errors.As(err, &diag) {
+		return err
+	}
+	trace := make([]errs.Frame, 0, len(v.frames))
+	for i := len(v.frames) - 1; i >= 0; i-- {
+		frame := &v.frames[i]
+		f := errs.Frame{Function: frame.fn.Name, Pos: frameLoc(frame), Elided: frame.elided}
+		if n := len(trace); n > 0 {
+			if last := &trace[n-1]; last.Function == f.Function && last.Pos == f.Pos && last.Elided == f.Elided {
+				last.Repeated++
+				continue
+			}
+		}
+		trace = append(trace, f)
+	}
+	diag = &errs.Error{
+		Code:    codeOf(err),
+		Message: strings.TrimPrefix(err.Error(), "vm: "),
+		Trace:   trace,
+		Err:     err,
+	}
+	if len(trace) > 0 {
+		diag.Pos = trace[0].Pos
+	}
+	return diag
+}
+
+// frameLoc returns the source position of the instruction frame last
+// executed: the failing one for the innermost frame, the call for the
+// others.
+func frameLoc(frame *Frame) errs.Position {
+	ip := frame.ip - 1
+	if ip < 0 {
+		ip = 0
+	}
+	if ip >= len(frame.fn.Locations) {
+		return errs.Position{}
+	}
+	loc := frame.fn.Locations[ip]
+	return errs.Position{File: loc.File, Line: loc.Line, Col: loc.Col}
+}
@@ -0,0 +1,88 @@
+package vm
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/jiejie-dev/funny/v2/internal/errs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrace_RuntimeErrorCarriesStack(t *testing.T) {
+	m := New(compileSrc(t, `fn ratio(a: int, b: int) -> int:
+    return a / b
+
+fn report(n: int) -> int:
+    return ratio(10, n) + 1
+
+report(0)
+`))
+	_, err := m.Run()
+	var diag *errs.Error
+	require.True(t, errors.As(err, &diag))
+	assert.Equal(t, "E2030", diag.Code)
+	assert.Equal(t, "division by zero", diag.Message)
+	require.Len(t, diag.Trace, 3)
+	assert.Equal(t, []string{"ratio", "report", "main"},
+		[]string{diag.Trace[0].Function, diag.Trace[1].Function, diag.Trace[2].Function})
+	assert.Equal(t, 1, diag.Trace[0].Pos.Line)
+	assert.Equal(t, 4, diag.Trace[1].Pos.Line)
+	assert.Equal(t, 6, diag.Trace[2].Pos.Line)
+	assert.Equal(t, diag.Trace[0].Pos, diag.Pos)
+	assert.Contains(t, err.Error(), "error[E2030]: division by zero\n --> t.fn:2:")
+	assert.Contains(t, err.Error(), "    at report (t.fn:5:")
+}
+
+func TestTrace_KeepsLimitErrors(t *testing.T) {
+	m := New(compileSrc(t, spinSrc))
+	m.SetLimits(Limits{MaxInstructions: 1000})
+	_, err := m.Run()
+	require.ErrorIs(t, err, ErrInstructionLimit)
+	var diag *errs.Error
+	require.True(t, errors.As(err, &diag))
+	assert.Equal(t, "E3002", diag.Code)
+	assert.Equal(t, "instruction limit exceeded (1000)", diag.Message)
+}
+
+func TestTrace_MarksElidedTailCalls(t *testing.T) {
+	m := New(compileSrc(t, `fn down(n: int) -> int:
+    if n == 0:
+        return 1 / n
+    return down(n - 1)
+
+down(3)
+`))
+	_, err := m.Run()
+	var diag *errs.Error
+	require.True(t, errors.As(err, &diag))
+	require.Len(t, diag.Trace, 2)
+	assert.Equal(t, "down", diag.Trace[0].Function)
+	assert.Equal(t, 3, diag.Trace[0].Elided)
+	assert.Equal(t, 0, diag.Trace[1].Elided)
+	assert.Contains(t, err.Error(), "    at down (t.fn:3:")
+	assert.Contains(t, err.Error(), ")\n    ... 3 tail calls elided\n    at main (t.fn:6:")
+}
+
+func TestTrace_CollapsesRepeatedFrames(t *testing.T) {
+	m := New(compileSrc(t, `fn down(n: int) -> int:
+    if n == 0:
+        return 1 / n
+    return down(n - 1) + 1
+
+down(500)
+`))
+	_, err := m.Run()
+	var diag *errs.Error
+	require.True(t, errors.As(err, &diag))
+	require.Len(t, diag.Trace, 3)
+	assert.Equal(t, "down", diag.Trace[0].Function)
+	assert.Equal(t, 2, diag.Trace[0].Pos.Line, "the failing division")
+	assert.Equal(t, 0, diag.Trace[0].Repeated)
+	assert.Equal(t, "down", diag.Trace[1].Function)
+	assert.Equal(t, 3, diag.Trace[1].Pos.Line, "the recursive call")
+	assert.Equal(t, 499, diag.Trace[1].Repeated)
+	assert.Equal(t, "main", diag.Trace[2].Function)
+	assert.Contains(t, err.Error(), ")\n    ... previous frame repeated 499 times\n    at main (t.fn:6:")
+	assert.Less(t, len(err.Error()), 400)
+}
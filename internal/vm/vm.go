@@ -1,9 +1,11 @@
 package vm
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/jiejie-dev/funny/v2/internal/bytecode"
+	"github.com/jiejie-dev/funny/v2/internal/stdlib"
 )
 
 // Frame is a function call frame.
@@ -11,6 +13,9 @@ type Frame struct {
 	fn     *bytecode.Function
 	ip     int // instruction pointer within fn.Code
 	locals []bytecode.Value
+	defers []deferred // registered by DEFER, run last-first on exit
+	elided int        // calls this frame has been reused for by TAIL_CALL
+	line   int        // 1-based source line coverage last counted here
 }
 
 // VM is a stack-based bytecode interpreter.
@@ -19,7 +24,22 @@ type VM struct {
 	stack      []bytecode.Value
 	frames     []Frame
 	localsPool [][]bytecode.Value
+	methods    map[string]int // function name → index, built on first CALL_METHOD
 	dbg        *Debugger
+	prof       *Profiler
+	cover      *Coverage
+
+	// structTypes holds the runtime layout of each struct type, built on
+	// its first NEW_STRUCT.
+	structTypes map[*bytecode.StructInfo]*stdlib.StructType
+
+	// Run limits and their counters; see limits.go.
+	ctx      context.Context
+	limits   Limits
+	steps    int64 // instructions executed this run
+	nextPoll int64 // steps at which checkpoint next polls ctx and the heap
+	heapBase int64 // heap size when the run started
+	heapUsed int64 // heap growth at the last sample, plus what allocate charged since
 }
 
 // New creates a VM ready to run the given module.
@@ -39,7 +59,7 @@ func (v *VM) SetDebugger(d *Debugger) {
 
 // Run executes the module's first function (main) and returns the top of stack.
 func (v *VM) Run() (bytecode.Value, error) {
-	return v.runFrom(0)
+	return v.RunContext(context.Background())
 }
 
 // RunDebug executes with the attached debugger, pausing on breakpoints/steps.
@@ -54,6 +74,7 @@ func (v *VM) runFrom(fnIdx int) (bytecode.Value, error) {
 		return nil, fmt.Errorf("vm: module has no functions")
 	}
 	v.reset()
+	v.startBudget()
 	main := v.mod.Functions[fnIdx]
 	locals := v.acquireLocals(main.NumLocals)
 	v.frames = append(v.frames, Frame{fn: main, locals: locals})
@@ -61,37 +82,126 @@ func (v *VM) runFrom(fnIdx int) (bytecode.Value, error) {
 }
 
 func (v *VM) execute() (bytecode.Value, error) {
-	for {
-		if len(v.frames) == 0 {
-			if len(v.stack) > 0 {
-				return v.stack[len(v.stack)-1], nil
+	if err := v.runFrames(0); err != nil && err != errHalt {
+		return nil, v.unwind(0, v.traced(err))
+	}
+	if len(v.stack) > 0 {
+		return v.stack[len(v.stack)-1], nil
+	}
+	return nil, nil
+}
+
+// runFrames executes instructions until only depth frames are left (or
+// HALT, or an error). execute runs the whole program with depth 0; a
+// deferred call runs on top of the frame that registered it.
+//
+// Without a debugger the inner loop stays on one frame, with its code
+// slice in hand, until an instruction calls or returns; only then is the
+// (possibly reallocated) frame looked up again. A TAIL_CALL that reuses
+// the frame swaps in the callee's code and locals where it stands.
+func (v *VM) runFrames(depth int) error {
+	if v.dbg != nil || v.prof != nil || v.cover != nil {
+		return v.runFramesDebug(depth)
+	}
+	for n := len(v.frames); n > depth; n = len(v.frames) {
+		if err := v.checkpoint(); err != nil {
+			return err
+		}
+		fi := n - 1
+		frame := &v.frames[fi]
+		code := frame.fn.Code
+		locals := frame.locals
+		for len(v.frames) == n {
+			if frame.ip >= len(code) {
+				return fmt.Errorf("vm: ip out of bounds at %d", frame.ip)
+			}
+			instr := code[frame.ip]
+			frame.ip++
+			v.steps++
+			// The stack and local-slot traffic of a typical loop body,
+			// handled without a call; everything else goes through step.
+			switch instr.Op {
+			case bytecode.LOAD_LOCAL:
+				if uint(instr.Arg) < uint(len(locals)) {
+					v.stack = append(v.stack, locals[instr.Arg])
+					continue
+				}
+			case bytecode.STORE_LOCAL_POP:
+				if top := len(v.stack) - 1; top >= 0 && uint(instr.Arg) < uint(len(locals)) {
+					locals[instr.Arg] = v.stack[top]
+					v.stack = v.stack[:top]
+					continue
+				}
+			case bytecode.PUSH_INT, bytecode.PUSH_FLOAT, bytecode.PUSH_STR, bytecode.PUSH_BOOL:
+				v.stack = append(v.stack, v.mod.Constants[instr.Arg])
+				continue
+			case bytecode.POP:
+				if len(v.stack) > 0 {
+					v.stack = v.stack[:len(v.stack)-1]
+					continue
+				}
+			case bytecode.JUMP:
+				if err := v.jump(frame, instr.Arg); err != nil {
+					return err
+				}
+				continue
+			case bytecode.TAIL_CALL:
+				// A reused frame runs other code with other locals. A
+				// tail-recursive loop never leaves this frame, so it
+				// passes a checkpoint here, as a backward jump does.
+				if err := v.execTailCall(fi, instr.Arg); err != nil {
+					return err
+				}
+				if len(v.frames) == n {
+					if err := v.checkpoint(); err != nil {
+						return err
+					}
+					code, locals = frame.fn.Code, frame.locals
+				}
+				continue
+			}
+			if err := v.step(fi, instr); err != nil {
+				return err
 			}
-			return nil, nil
 		}
+	}
+	return nil
+}
+
+// runFramesDebug is runFrames with the debugger consulted before every
+// instruction, and every instruction counted by the profiler and for
+// coverage.
+func (v *VM) runFramesDebug(depth int) error {
+	for len(v.frames) > depth {
 		fi := len(v.frames) - 1
 		frame := &v.frames[fi]
 		if frame.ip >= len(frame.fn.Code) {
-			return nil, fmt.Errorf("vm: ip out of bounds at %d", frame.ip)
+			return fmt.Errorf("vm: ip out of bounds at %d", frame.ip)
 		}
 		if v.dbg != nil {
 			action, err := v.dbg.beforeInstr(v, frame)
 			if err != nil {
-				return nil, err
+				return err
 			}
 			if action == ActionQuit {
-				return nil, fmt.Errorf("debug: stopped")
+				return errDebugStopped
 			}
 		}
 		instr := frame.fn.Code[frame.ip]
 		frame.ip++
+		v.steps++
+		if v.prof != nil {
+			v.prof.tick(v)
+		}
+		if v.cover != nil {
+			v.cover.hit(frame, frame.ip-1)
+		}
+		if err := v.checkpoint(); err != nil {
+			return err
+		}
 		if err := v.step(fi, instr); err != nil {
-			if err == errHalt {
-				if len(v.stack) > 0 {
-					return v.stack[len(v.stack)-1], nil
-				}
-				return nil, nil
-			}
-			return nil, err
+			return err
 		}
 	}
+	return nil
 }
@@ -54,6 +54,16 @@ func TestVM_LoadStoreLocal(t *testing.T) {
 	assert.Equal(t, 20, v) // top of stack is y
 }
 
+func TestVM_StoreLocalPop(t *testing.T) {
+	fn := &bytecode.Function{Name: "main", Arity: 0, NumLocals: 1}
+	fn.Emit(bytecode.PUSH_INT, 0)        // push 10
+	fn.Emit(bytecode.PUSH_INT, 1)        // push 20
+	fn.Emit(bytecode.STORE_LOCAL_POP, 0) // x = 20, popped
+	fn.Emit(bytecode.HALT, 0)
+	v := runVM(t, fn, 10, 20)
+	assert.Equal(t, 10, v) // 20 was popped
+}
+
 func TestVM_String(t *testing.T) {
 	fn := &bytecode.Function{Name: "main", Arity: 0}
 	fn.Emit(bytecode.PUSH_STR, 0)